@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessExplainHandler 访问解释和访问矩阵处理器
+type AccessExplainHandler struct {
+	explainer *services.AccessExplainer
+}
+
+// NewAccessExplainHandler 创建访问解释处理器
+func NewAccessExplainHandler(explainer *services.AccessExplainer) *AccessExplainHandler {
+	return &AccessExplainHandler{explainer: explainer}
+}
+
+// Explain 解释用户能否连接服务器。user 为用户ID或用户名，server 为服务器ID；
+// 可选 ip（来源地址）、at（RFC3339 时间，默认当前）、reason、ticket 作为连接要求和连接策略的输入，
+// stepped_up=true 表示假定用户已完成二次认证
+func (h *AccessExplainHandler) Explain(c *gin.Context) {
+	userParam := strings.TrimSpace(c.Query("user"))
+	if userParam == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "缺少 user 参数"})
+		return
+	}
+	userID, err := strconv.Atoi(userParam)
+	if err != nil {
+		user, err := h.explainer.GetUserService().GetByUsername(userParam)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		userID = user.ID
+	}
+	serverID, err := strconv.Atoi(c.Query("server"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务器ID"})
+		return
+	}
+	at := time.Now().UTC()
+	if value := c.Query("at"); value != "" {
+		if at, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at 必须是 RFC3339 格式的时间"})
+			return
+		}
+	}
+
+	steppedUp := c.Query("stepped_up") == "true"
+	explanation, err := h.explainer.Explain(userID, serverID, c.Query("ip"), strings.TrimSpace(c.Query("reason")),
+		strings.TrimSpace(c.Query("ticket")), steppedUp, at)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户或服务器不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, explanation)
+}
+
+// Matrix 导出签名的访问矩阵（用户 × 服务器 × 有效访问级别），format 为 json（默认）或 csv
+// JSON 的签名覆盖 report 字段的原始字节，CSV 的签名覆盖整个响应体
+func (h *AccessExplainHandler) Matrix(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式仅支持 json 或 csv"})
+		return
+	}
+
+	matrix, err := h.explainer.Matrix()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var body []byte
+	if format == "csv" {
+		body, err = accessMatrixCSV(matrix)
+	} else {
+		body, err = json.Marshal(matrix)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	signature := h.explainer.SignReport(body)
+
+	filename := "access_matrix_" + matrix.GeneratedAt.Format("20060102_150405") + "." + format
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header(reportSHA256Header, digest)
+	c.Header(reportSignatureHeader, signature)
+	if format == "csv" {
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", body)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"report":    json.RawMessage(body),
+		"sha256":    digest,
+		"signature": signature,
+		"algorithm": "HMAC-SHA256",
+	})
+}
+
+// accessMatrixCSV 生成访问矩阵 CSV，每个用户和服务器一行，途径以分号分隔
+func accessMatrixCSV(matrix *services.AccessMatrix) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"user_id", "username", "role", "user_status", "server_id", "server_name", "level", "sources"})
+	for _, entry := range matrix.Entries {
+		w.Write([]string{
+			strconv.Itoa(entry.UserID), entry.Username, entry.Role, entry.UserStatus,
+			strconv.Itoa(entry.ServerID), entry.ServerName, entry.Level, strings.Join(entry.Sources, ";"),
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessGrantHandler 服务器授权处理器
+type AccessGrantHandler struct {
+	grantService  *models.AccessGrantService
+	groupService  *models.GroupService
+	userService   *models.UserService
+	serverService *models.ServerService
+}
+
+// NewAccessGrantHandler 创建服务器授权处理器
+func NewAccessGrantHandler(grantService *models.AccessGrantService, groupService *models.GroupService,
+	userService *models.UserService, serverService *models.ServerService) *AccessGrantHandler {
+	return &AccessGrantHandler{
+		grantService:  grantService,
+		groupService:  groupService,
+		userService:   userService,
+		serverService: serverService,
+	}
+}
+
+// List 查询授权，支持按 subject_type、subject_id、server_id、tag 过滤
+func (h *AccessGrantHandler) List(c *gin.Context) {
+	filter := models.AccessGrantFilter{
+		SubjectType: c.Query("subject_type"),
+		Tag:         c.Query("tag"),
+	}
+	filter.SubjectID, _ = strconv.Atoi(c.Query("subject_id"))
+	filter.ServerID, _ = strconv.Atoi(c.Query("server_id"))
+
+	grants, err := h.grantService.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"grants": grants, "total": len(grants)})
+}
+
+// Create 创建授权：授予用户或用户组单台服务器，或带有某个标签的全部服务器
+func (h *AccessGrantHandler) Create(c *gin.Context) {
+	var req models.AccessGrantCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Tag = strings.TrimSpace(req.Tag)
+	if (req.ServerID == nil) == (req.Tag == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "server_id 和 tag 必须且只能指定一个"})
+		return
+	}
+
+	switch req.SubjectType {
+	case models.GrantSubjectUser:
+		if _, err := h.userService.GetByID(req.SubjectID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "用户不存在"})
+			return
+		}
+	case models.GrantSubjectGroup:
+		if _, err := h.groupService.GetByID(req.SubjectID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "用户组不存在"})
+			return
+		}
+	}
+	if req.ServerID != nil {
+		if _, err := h.serverService.GetByID(*req.ServerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "服务器不存在"})
+			return
+		}
+	}
+
+	userID, _ := c.Get("user_id")
+	grant, err := h.grantService.Create(&req, userID.(int))
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "授权已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, grant)
+}
+
+// Delete 删除授权
+func (h *AccessGrantHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的授权ID"})
+		return
+	}
+
+	if _, err := h.grantService.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "授权不存在"})
+		return
+	}
+	if err := h.grantService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "授权已删除"})
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AccessRequestHandler 临时访问申请处理器
+type AccessRequestHandler struct {
+	manager *services.AccessRequestManager
+}
+
+// NewAccessRequestHandler 创建临时访问申请处理器
+func NewAccessRequestHandler(manager *services.AccessRequestManager) *AccessRequestHandler {
+	return &AccessRequestHandler{manager: manager}
+}
+
+// ListMine 获取自己的申请
+func (h *AccessRequestHandler) ListMine(c *gin.Context) {
+	h.list(c, c.GetInt("user_id"))
+}
+
+// List 获取全部申请，支持按 status、user_id 过滤
+func (h *AccessRequestHandler) List(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+	h.list(c, userID)
+}
+
+func (h *AccessRequestHandler) list(c *gin.Context, userID int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	requests, err := h.manager.GetRequestService().List(models.AccessRequestFilter{
+		UserID: userID,
+		Status: c.Query("status"),
+		Limit:  pageSize,
+		Offset: (page - 1) * pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requests": requests, "page": page, "page_size": pageSize})
+}
+
+// Create 提交临时访问申请
+func (h *AccessRequestHandler) Create(c *gin.Context) {
+	var req models.AccessRequestCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Tag = strings.TrimSpace(req.Tag)
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写申请原因"})
+		return
+	}
+
+	request, err := h.manager.Submit(c.GetInt("user_id"), &req, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, request)
+}
+
+// Get 获取申请详情，审批人可以查看他人的申请
+func (h *AccessRequestHandler) Get(c *gin.Context) {
+	request, ok := h.request(c)
+	if !ok {
+		return
+	}
+	if request.UserID != c.GetInt("user_id") && !middleware.HasPermission(c, models.PermissionAccessApprove) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// Cancel 撤回自己的申请，已批准的授权立即结束
+func (h *AccessRequestHandler) Cancel(c *gin.Context) {
+	request, ok := h.request(c)
+	if !ok {
+		return
+	}
+	if request.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return
+	}
+
+	updated, err := h.manager.Cancel(request, c.ClientIP())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// Approve 批准申请
+func (h *AccessRequestHandler) Approve(c *gin.Context) {
+	h.decide(c, models.ApprovalDecisionApprove)
+}
+
+// Deny 拒绝申请
+func (h *AccessRequestHandler) Deny(c *gin.Context) {
+	h.decide(c, models.ApprovalDecisionDeny)
+}
+
+func (h *AccessRequestHandler) decide(c *gin.Context, decision string) {
+	id, ok := h.requestID(c)
+	if !ok {
+		return
+	}
+	var req models.AccessRequestDecision
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := h.manager.Decide(id, c.GetInt("user_id"), decision, strings.TrimSpace(req.Comment))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// Revoke 在到期前收回已批准的授权
+func (h *AccessRequestHandler) Revoke(c *gin.Context) {
+	id, ok := h.requestID(c)
+	if !ok {
+		return
+	}
+	var req models.AccessRequestDecision
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, err := h.manager.Revoke(id, c.GetInt("user_id"), strings.TrimSpace(req.Comment))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// writeError 按申请流程错误类型返回状态码
+func (h *AccessRequestHandler) writeError(c *gin.Context, err error) {
+	switch err {
+	case models.ErrAccessRequestClosed, models.ErrAlreadyDecided, services.ErrAccessRequestNotApproved:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case services.ErrSelfApproval, services.ErrNotApprover:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// requestID 解析路径中的申请ID，失败时已写入响应
+func (h *AccessRequestHandler) requestID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的申请ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// request 按路径参数获取申请，失败时已写入响应
+func (h *AccessRequestHandler) request(c *gin.Context) (*models.AccessRequest, bool) {
+	id, ok := h.requestID(c)
+	if !ok {
+		return nil, false
+	}
+	request, err := h.manager.GetRequestService().GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "申请不存在"})
+		return nil, false
+	}
+	return request, true
+}
+
+// AccessPolicyHandler 临时访问审批策略处理器
+type AccessPolicyHandler struct {
+	policyService *models.AccessPolicyService
+	groupService  *models.GroupService
+}
+
+// NewAccessPolicyHandler 创建审批策略处理器
+func NewAccessPolicyHandler(policyService *models.AccessPolicyService, groupService *models.GroupService) *AccessPolicyHandler {
+	return &AccessPolicyHandler{policyService: policyService, groupService: groupService}
+}
+
+// List 获取全部审批策略
+func (h *AccessPolicyHandler) List(c *gin.Context) {
+	policies, err := h.policyService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "total": len(policies)})
+}
+
+// Create 创建审批策略，每个标签一条
+func (h *AccessPolicyHandler) Create(c *gin.Context) {
+	var req models.AccessPolicyCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Tag = strings.TrimSpace(req.Tag)
+	if req.Tag == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "标签不能为空"})
+		return
+	}
+	if !h.checkGroup(c, req.ApproverGroupID) {
+		return
+	}
+
+	policy, err := h.policyService.Create(&req)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "该标签的审批策略已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+// Update 更新审批策略
+func (h *AccessPolicyHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return
+	}
+	var req models.AccessPolicyUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.ApproverGroupID != nil && *req.ApproverGroupID != 0 && !h.checkGroup(c, req.ApproverGroupID) {
+		return
+	}
+
+	if _, err := h.policyService.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审批策略不存在"})
+		return
+	}
+	policy, err := h.policyService.Update(id, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// Delete 删除审批策略
+func (h *AccessPolicyHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return
+	}
+	if _, err := h.policyService.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "审批策略不存在"})
+		return
+	}
+	if err := h.policyService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "审批策略已删除"})
+}
+
+// checkGroup 检查审批组存在，失败时已写入响应
+func (h *AccessPolicyHandler) checkGroup(c *gin.Context, groupID *int) bool {
+	if groupID == nil {
+		return true
+	}
+	if _, err := h.groupService.GetByID(*groupID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "审批组不存在"})
+		return false
+	}
+	return true
+}
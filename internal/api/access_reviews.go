@@ -0,0 +1,289 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 复核报告签名响应头，CSV 格式通过响应头返回摘要和签名
+const (
+	reportSHA256Header    = "X-Report-SHA256"
+	reportSignatureHeader = "X-Report-Signature"
+)
+
+// AccessReviewHandler 访问复核处理器
+type AccessReviewHandler struct {
+	manager *services.AccessReviewManager
+}
+
+// NewAccessReviewHandler 创建访问复核处理器
+func NewAccessReviewHandler(manager *services.AccessReviewManager) *AccessReviewHandler {
+	return &AccessReviewHandler{manager: manager}
+}
+
+// ListMyItems 获取分配给自己、在进行中活动里的复核条目，默认只返回待复核的
+func (h *AccessReviewHandler) ListMyItems(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	decision := c.DefaultQuery("decision", models.AccessReviewPending)
+	if decision == "all" {
+		decision = ""
+	}
+	items, err := h.manager.GetReviewService().ListItems(models.AccessReviewItemFilter{ReviewerID: userID, Decision: decision, ActiveOnly: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pending, err := h.manager.GetReviewService().CountPendingForReviewer(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "pending": pending})
+}
+
+// Decide 复核人确认保留（approve）或收回（revoke）授权
+func (h *AccessReviewHandler) Decide(c *gin.Context) {
+	itemID, ok := h.pathID(c, "item_id", "无效的复核条目ID")
+	if !ok {
+		return
+	}
+	var req models.AccessReviewDecision
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+
+	item, err := h.manager.Decide(itemID, c.GetInt("user_id"), &req, c.ClientIP())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// List 获取复核活动，支持按 status 过滤
+func (h *AccessReviewHandler) List(c *gin.Context) {
+	campaigns, err := h.manager.GetReviewService().List(c.Query("status"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+// Create 创建复核活动并快照当前全部授权
+func (h *AccessReviewHandler) Create(c *gin.Context) {
+	var req models.AccessReviewCampaignCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	campaign, err := h.manager.Create(&req, c.GetInt("user_id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// Get 获取复核活动
+func (h *AccessReviewHandler) Get(c *gin.Context) {
+	id, ok := h.pathID(c, "id", "无效的复核活动ID")
+	if !ok {
+		return
+	}
+	campaign, err := h.manager.GetReviewService().GetByID(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// ListItems 获取复核活动的条目，支持按 decision、reviewer_id 过滤
+func (h *AccessReviewHandler) ListItems(c *gin.Context) {
+	id, ok := h.pathID(c, "id", "无效的复核活动ID")
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 500 {
+		pageSize = 50
+	}
+	reviewerID, _ := strconv.Atoi(c.Query("reviewer_id"))
+
+	items, err := h.manager.GetReviewService().ListItems(models.AccessReviewItemFilter{
+		CampaignID: id,
+		ReviewerID: reviewerID,
+		Decision:   c.Query("decision"),
+		Limit:      pageSize,
+		Offset:     (page - 1) * pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "page": page, "page_size": pageSize})
+}
+
+// Cancel 取消复核活动，未复核的授权保持不变
+func (h *AccessReviewHandler) Cancel(c *gin.Context) {
+	id, ok := h.pathID(c, "id", "无效的复核活动ID")
+	if !ok {
+		return
+	}
+	campaign, err := h.manager.Cancel(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, campaign)
+}
+
+// Reassign 更换待复核条目的复核人
+func (h *AccessReviewHandler) Reassign(c *gin.Context) {
+	id, ok := h.pathID(c, "id", "无效的复核活动ID")
+	if !ok {
+		return
+	}
+	itemID, ok := h.pathID(c, "item_id", "无效的复核条目ID")
+	if !ok {
+		return
+	}
+	var req models.AccessReviewReassign
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if item, err := h.manager.GetReviewService().GetItem(itemID); err != nil || item.CampaignID != id {
+		c.JSON(http.StatusNotFound, gin.H{"error": "复核条目不存在"})
+		return
+	}
+
+	item, err := h.manager.Reassign(itemID, req.ReviewerID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// Report 导出签名的复核报告，format 为 json（默认）或 csv
+// JSON 的签名覆盖 report 字段的原始字节，CSV 的签名覆盖整个响应体
+func (h *AccessReviewHandler) Report(c *gin.Context) {
+	id, ok := h.pathID(c, "id", "无效的复核活动ID")
+	if !ok {
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式仅支持 json 或 csv"})
+		return
+	}
+
+	report, err := h.manager.Report(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	var body []byte
+	if format == "csv" {
+		body, err = accessReviewCSV(report)
+	} else {
+		body, err = json.Marshal(report)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sum := sha256.Sum256(body)
+	digest := hex.EncodeToString(sum[:])
+	signature := h.manager.SignReport(body)
+
+	filename := fmt.Sprintf("access_review_%d_%s.%s", id, report.GeneratedAt.Format("20060102_150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header(reportSHA256Header, digest)
+	c.Header(reportSignatureHeader, signature)
+	if format == "csv" {
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", body)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"report":    json.RawMessage(body),
+		"sha256":    digest,
+		"signature": signature,
+		"algorithm": "HMAC-SHA256",
+	})
+}
+
+// accessReviewCSV 生成复核报告 CSV，每个条目一行
+func accessReviewCSV(report *services.AccessReviewReport) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"campaign_id", "campaign_name", "campaign_status", "deadline", "item_id", "item_type",
+		"subject_type", "subject_id", "subject_name", "target_type", "target_name", "permission", "origin",
+		"reviewer", "decision", "decided_by", "decided_at", "comment"})
+	for _, item := range report.Items {
+		decidedAt := ""
+		if item.DecidedAt != nil {
+			decidedAt = item.DecidedAt.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.Itoa(report.Campaign.ID), report.Campaign.Name, report.Campaign.Status,
+			report.Campaign.Deadline.UTC().Format(time.RFC3339), strconv.Itoa(item.ID), item.ItemType,
+			item.SubjectType, strconv.Itoa(item.SubjectID), item.SubjectName, item.TargetType, item.TargetName,
+			item.Permission, item.Origin, item.ReviewerName, item.Decision, item.DecidedByName, decidedAt, item.Comment,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// writeError 按复核流程错误类型返回状态码
+func (h *AccessReviewHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "复核活动或条目不存在"})
+	case err == models.ErrAccessReviewClosed, err == models.ErrAccessReviewDecided:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err == services.ErrNotAccessReviewer, err == services.ErrAccessReviewSelf:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case err == services.ErrAccessReviewDeadline, errors.Is(err, services.ErrReviewerNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// pathID 解析路径中的ID参数，失败时已写入响应
+func (h *AccessReviewHandler) pathID(c *gin.Context, name, message string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return id, true
+}
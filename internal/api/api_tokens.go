@@ -0,0 +1,256 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenHandler API 令牌和服务账号处理器
+type APITokenHandler struct {
+	authService  *services.AuthService
+	auditService *services.AuditService
+}
+
+// NewAPITokenHandler 创建 API 令牌处理器
+func NewAPITokenHandler(authService *services.AuthService, auditService *services.AuditService) *APITokenHandler {
+	return &APITokenHandler{
+		authService:  authService,
+		auditService: auditService,
+	}
+}
+
+// ListScopes 获取可用的权限范围
+func (h *APITokenHandler) ListScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"scopes": models.AllScopes})
+}
+
+// ListMine 获取当前用户的 API 令牌
+func (h *APITokenHandler) ListMine(c *gin.Context) {
+	tokens, err := h.authService.GetTokenService().List(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateMine 为当前用户创建个人 API 令牌
+func (h *APITokenHandler) CreateMine(c *gin.Context) {
+	var req models.APITokenCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	plaintext, token, err := h.authService.CreateAPIToken(userID, userID, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logTokenAction(c, "api_token_create", token)
+	c.JSON(http.StatusCreated, gin.H{"id": token.ID, "token": plaintext, "api_token": token})
+}
+
+// RevokeMine 撤销当前用户的 API 令牌
+func (h *APITokenHandler) RevokeMine(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的令牌ID"})
+		return
+	}
+
+	token, err := h.authService.GetTokenService().GetByID(id)
+	if err != nil || token.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在"})
+		return
+	}
+
+	if err := h.authService.GetTokenService().Revoke(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在或已撤销"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logTokenAction(c, "api_token_revoke", token)
+	c.JSON(http.StatusOK, gin.H{"message": "令牌已撤销"})
+}
+
+// ListAll 获取全部 API 令牌（管理员）
+func (h *APITokenHandler) ListAll(c *gin.Context) {
+	tokens, err := h.authService.GetTokenService().List(0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// Revoke 撤销任意 API 令牌（管理员）
+func (h *APITokenHandler) Revoke(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的令牌ID"})
+		return
+	}
+
+	if err := h.authService.GetTokenService().Revoke(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "令牌不存在或已撤销"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "令牌已撤销"})
+}
+
+// ListServiceAccounts 获取服务账号列表
+func (h *APITokenHandler) ListServiceAccounts(c *gin.Context) {
+	accounts, err := h.authService.GetUserService().ListServiceAccounts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"service_accounts": accounts})
+}
+
+// CreateServiceAccount 创建服务账号
+func (h *APITokenHandler) CreateServiceAccount(c *gin.Context) {
+	var req models.ServiceAccountCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAssignableRole(c, h.authService.GetRoleService(), req.Role) {
+		return
+	}
+
+	account, err := h.authService.GetUserService().CreateServiceAccount(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// DeleteServiceAccount 删除服务账号并撤销其全部令牌
+func (h *APITokenHandler) DeleteServiceAccount(c *gin.Context) {
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.GetTokenService().RevokeAllForUser(account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.authService.GetUserService().Delete(account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "服务账号已删除"})
+}
+
+// ListServiceAccountTokens 获取服务账号的 API 令牌
+func (h *APITokenHandler) ListServiceAccountTokens(c *gin.Context) {
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.authService.GetTokenService().List(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateServiceAccountToken 为服务账号创建 API 令牌
+func (h *APITokenHandler) CreateServiceAccountToken(c *gin.Context) {
+	account, ok := h.getServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req models.APITokenCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plaintext, token, err := h.authService.CreateAPIToken(account.ID, c.GetInt("user_id"), &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": plaintext, "api_token": token})
+}
+
+// getServiceAccount 根据路径参数获取服务账号，操作者必须拥有该账号角色的全部权限
+func (h *APITokenHandler) getServiceAccount(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的服务账号ID"})
+		return nil, false
+	}
+
+	account, err := h.authService.GetUserService().GetByID(id)
+	if err != nil || account.AccountType != models.AccountTypeService {
+		c.JSON(http.StatusNotFound, gin.H{"error": "服务账号不存在"})
+		return nil, false
+	}
+	if !checkManageableUser(c, h.authService.GetRoleService(), account) {
+		return nil, false
+	}
+	return account, true
+}
+
+// logTokenAction 记录个人令牌的创建和撤销
+func (h *APITokenHandler) logTokenAction(c *gin.Context, action string, token *models.APIToken) {
+	if h.auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"username":     c.GetString("username"),
+		"token_name":   token.Name,
+		"token_prefix": token.TokenPrefix,
+		"scopes":       token.Scopes,
+		"expires_at":   token.ExpiresAt,
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       c.GetInt("user_id"),
+		Action:       action,
+		ResourceType: "api_token",
+		ResourceID:   strconv.Itoa(token.ID),
+		Details:      string(detailsJSON),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		Success:      true,
+	}
+	if err := h.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s: %v", action, err)
+	}
+}
@@ -1,9 +1,17 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
 	"very-jump/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -25,35 +33,17 @@ func NewAuditHandler(auditService *services.AuditService, ttydService *services.
 
 // GetAuditLogs 获取审计日志
 func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
-	// 分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-	offset := (page - 1) * pageSize
+	page, pageSize := parsePagination(c)
 
-	// 用户过滤（管理员可以查看所有，普通用户只能查看自己的）
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+	filter, err := h.parseAuditLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
 
-	user := userInterface.(map[string]interface{})
-	userID := int(user["id"].(float64))
-	role := user["role"].(string)
-
-	var filterUserID *int
-	if role != "admin" {
-		filterUserID = &userID
-	} else {
-		// 管理员可以指定查看特定用户的日志
-		if userIDParam := c.Query("user_id"); userIDParam != "" {
-			if uid, err := strconv.Atoi(userIDParam); err == nil {
-				filterUserID = &uid
-			}
-		}
-	}
-
-	logs, err := h.auditService.GetAuditLogs(c.Request.Context(), filterUserID, pageSize, offset)
+	logs, total, err := h.auditService.SearchAuditLogs(c.Request.Context(), filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审计日志失败"})
 		return
@@ -61,27 +51,122 @@ func (h *AuditHandler) GetAuditLogs(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"logs":      logs,
+		"total":     total,
 		"page":      page,
 		"page_size": pageSize,
 	})
 }
 
-// GetSecurityAlerts 获取安全告警
-func (h *AuditHandler) GetSecurityAlerts(c *gin.Context) {
-	// 检查管理员权限
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+// ExportAuditLogs 以 CSV 或 NDJSON 流式导出审计日志
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	filter, err := h.parseAuditLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	user := userInterface.(map[string]interface{})
-	role := user["role"].(string)
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "导出格式仅支持 csv 或 ndjson"})
 		return
 	}
 
+	filename := fmt.Sprintf("audit_logs_%s.%s", time.Now().Format("20060102_150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	var write func(*models.AuditLog) error
+	var flush func()
+	count := 0
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "created_at", "user_id", "action", "resource_type", "resource_id",
+			"success", "ip_address", "user_agent", "details", "hash"})
+		write = func(l *models.AuditLog) error {
+			return w.Write([]string{
+				strconv.Itoa(l.ID), l.CreatedAt.UTC().Format(time.RFC3339Nano), strconv.Itoa(l.UserID),
+				l.Action, l.ResourceType, l.ResourceID, strconv.FormatBool(l.Success),
+				l.IPAddress, l.UserAgent, l.Details, l.Hash,
+			})
+		}
+		flush = func() {
+			w.Flush()
+			c.Writer.Flush()
+		}
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		write = func(l *models.AuditLog) error {
+			return enc.Encode(l)
+		}
+		flush = c.Writer.Flush
+	}
+	c.Status(http.StatusOK)
+
+	err = h.auditService.StreamAuditLogs(c.Request.Context(), filter, func(l *models.AuditLog) error {
+		if err := write(l); err != nil {
+			return err
+		}
+		count++
+		if count%500 == 0 {
+			flush()
+		}
+		return nil
+	})
+	flush()
+	if err != nil {
+		// 响应头已发送，只能记录错误
+		log.Printf("Audit log export aborted after %d rows: %v", count, err)
+	}
+}
+
+// parseAuditLogFilter 解析审计日志查询参数
+func (h *AuditHandler) parseAuditLogFilter(c *gin.Context) (*models.AuditLogFilter, error) {
+	userID, _ := currentUser(c)
+
+	filter := &models.AuditLogFilter{
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		IPAddress:    c.Query("ip_address"),
+		Search:       c.Query("q"),
+		SortBy:       c.Query("sort_by"),
+		SortOrder:    c.Query("sort_order"),
+	}
+
+	// 用户过滤（拥有 audit.read 权限可以查看所有，其他用户只能查看自己的）
+	if !middleware.HasPermission(c, models.PermissionAuditRead) {
+		filter.UserID = &userID
+	} else if userIDParam := c.Query("user_id"); userIDParam != "" {
+		uid, err := strconv.Atoi(userIDParam)
+		if err != nil {
+			return nil, fmt.Errorf("无效的用户ID")
+		}
+		filter.UserID = &uid
+	}
+
+	if successParam := c.Query("success"); successParam != "" {
+		success, err := strconv.ParseBool(successParam)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 success 参数")
+		}
+		filter.Success = &success
+	}
+
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "start_time"); err != nil {
+		return nil, err
+	}
+	if filter.EndTime, err = parseTimeQuery(c, "end_time"); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// GetSecurityAlerts 获取安全告警
+func (h *AuditHandler) GetSecurityAlerts(c *gin.Context) {
 	// 分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
@@ -110,54 +195,32 @@ func (h *AuditHandler) GetSecurityAlerts(c *gin.Context) {
 
 // ResolveSecurityAlert 解决安全告警
 func (h *AuditHandler) ResolveSecurityAlert(c *gin.Context) {
-	// 检查管理员权限
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
+	userID, _ := currentUser(c)
+
+	alertID, err := strconv.Atoi(c.Param("alert_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
 		return
 	}
 
-	user := userInterface.(map[string]interface{})
-	role := user["role"].(string)
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+	alert, err := h.auditService.ResolveSecurityAlert(c.Request.Context(), alertID, userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "告警不存在"})
 		return
 	}
-
-	alertID, err := strconv.Atoi(c.Param("alert_id"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的告警ID"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解决告警失败"})
 		return
 	}
 
-	userID := int(user["id"].(float64))
-
-	// TODO: 实现解决告警的逻辑
-	// 这里应该调用 auditService 的方法来标记告警为已解决
-
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "告警已解决",
-		"alert_id":    alertID,
-		"resolved_by": userID,
+		"message": "告警已解决",
+		"alert":   alert,
 	})
 }
 
 // GetAuditStatistics 获取审计统计信息
 func (h *AuditHandler) GetAuditStatistics(c *gin.Context) {
-	// 检查管理员权限
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
-	}
-
-	user := userInterface.(map[string]interface{})
-	role := user["role"].(string)
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
-		return
-	}
-
 	stats, err := h.auditService.GetAuditStatistics(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计信息失败"})
@@ -169,68 +232,103 @@ func (h *AuditHandler) GetAuditStatistics(c *gin.Context) {
 
 // GetTerminalSessions 获取终端会话列表
 func (h *AuditHandler) GetTerminalSessions(c *gin.Context) {
-	// 分页参数
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
-
-	// 检查权限
-	userInterface, exists := c.Get("user")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户未认证"})
-		return
+	page, pageSize := parsePagination(c)
+	userID, _ := currentUser(c)
+
+	filter := &models.TerminalSessionFilter{
+		Status:    c.Query("status"),
+		IPAddress: c.Query("ip_address"),
+		TicketID:  c.Query("ticket_id"),
+		Search:    c.Query("q"),
+		SortBy:    c.Query("sort_by"),
+		SortOrder: c.Query("sort_order"),
+		Limit:     pageSize,
+		Offset:    (page - 1) * pageSize,
 	}
 
-	user := userInterface.(map[string]interface{})
-	userID := int(user["id"].(float64))
-	role := user["role"].(string)
-
-	// 从ttyd服务获取所有活跃的会话
-	allSessions := h.ttydService.ListActiveSessions()
-
-	var userSessions []*services.TTYDProcess
-	if role == "admin" {
-		// 管理员可以查看所有会话
-		userSessions = allSessions
-	} else {
-		// 普通用户只能查看自己的会话
-		for _, s := range allSessions {
-			if s.UserID == userID {
-				userSessions = append(userSessions, s)
-			}
+	// 没有 audit.read 或 sessions.read 权限的用户只能查看自己的会话
+	if !middleware.HasPermission(c, models.PermissionAuditRead) && !middleware.HasPermission(c, models.PermissionSessionsRead) {
+		filter.UserID = &userID
+	} else if userIDParam := c.Query("user_id"); userIDParam != "" {
+		if uid, err := strconv.Atoi(userIDParam); err == nil {
+			filter.UserID = &uid
+		}
+	}
+	if serverIDParam := c.Query("server_id"); serverIDParam != "" {
+		if sid, err := strconv.Atoi(serverIDParam); err == nil {
+			filter.ServerID = &sid
 		}
 	}
 
-	// 分页处理
-	total := len(userSessions)
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if start > total {
-		start = total
+	var err error
+	if filter.StartTime, err = parseTimeQuery(c, "start_time"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if end > total {
-		end = total
+	if filter.EndTime, err = parseTimeQuery(c, "end_time"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	paginatedSessions := userSessions[start:end]
-
-	// 格式化输出
-	responseSessions := make([]gin.H, len(paginatedSessions))
-	for i, s := range paginatedSessions {
-		responseSessions[i] = gin.H{
-			"session_id": s.SessionID,
-			"user_id":    s.UserID,
-			"server_id":  s.ServerID,
-			"username":   s.Username,
-			"server":     s.ServerName,
-			"start_time": s.CreatedAt,
-			"status":     "active",
-		}
+	sessions, total, err := h.auditService.ListTerminalSessions(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取终端会话失败"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"sessions":  responseSessions,
+		"sessions":  sessions,
 		"total":     total,
 		"page":      page,
 		"page_size": pageSize,
 	})
 }
+
+// currentUser 获取当前登录用户的ID和角色
+func currentUser(c *gin.Context) (int, string) {
+	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
+	id, _ := userID.(int)
+	r, _ := role.(string)
+	return id, r
+}
+
+// parsePagination 解析分页参数
+func parsePagination(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 20
+	}
+	return page, pageSize
+}
+
+// parseTimeQuery 解析时间查询参数，支持 RFC3339 和 YYYY-MM-DD
+func parseTimeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return &t, nil
+	}
+	return nil, fmt.Errorf("无效的时间参数 %s", key)
+}
+
+// VerifyAuditChain 校验审计日志哈希链
+func (h *AuditHandler) VerifyAuditChain(c *gin.Context) {
+	report, err := h.auditService.VerifyChain(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "校验审计日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,8 +1,17 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
 
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
 	"very-jump/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -10,12 +19,18 @@ import (
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	authService *services.AuthService
+	authService  *services.AuthService
+	auditService *services.AuditService
+	loginLimiter *services.LoginLimiter
 }
 
 // NewAuthHandler 创建认证处理器
-func NewAuthHandler(authService *services.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *services.AuthService, auditService *services.AuditService, loginLimiter *services.LoginLimiter) *AuthHandler {
+	return &AuthHandler{
+		authService:  authService,
+		auditService: auditService,
+		loginLimiter: loginLimiter,
+	}
 }
 
 // Login 登录
@@ -26,15 +41,247 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	resp, err := h.authService.Login(&req)
+	ipAddress := c.ClientIP()
+	attempt, block := h.loginLimiter.Reserve(req.Username, ipAddress)
+	if block != nil {
+		message := "登录尝试过于频繁"
+		if block.Reason == services.LoginBlockLocked {
+			message = "登录失败次数过多，已被临时锁定"
+		}
+		h.logLogin(c, req.Username, 0, fmt.Errorf("%s（%s: %s）", message, block.KeyType, block.Key))
+
+		retryAfter := int(math.Ceil(block.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       fmt.Sprintf("%s，请 %d 秒后重试", message, retryAfter),
+			"reason":      block.Reason,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	resp, err := h.authService.Login(&req, ipAddress, c.GetHeader("User-Agent"))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		h.logLogin(c, req.Username, 0, err)
+		// 只有凭证错误计入失败次数，身份源不可用等错误不应导致锁定
+		if err == services.ErrInvalidCredentials {
+			result := h.loginLimiter.RecordFailure(attempt)
+			if result.UserLocked || result.IPLocked {
+				h.alertBruteForce(c, req.Username, result)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		h.loginLimiter.Release(attempt)
+		switch err {
+		case services.ErrAuthProviderUnavailable:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		case services.ErrUserDisabled, services.ErrUserLocked, services.ErrUserExpired:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败，请稍后重试"})
+		}
+		return
+	}
+
+	h.loginLimiter.RecordSuccess(attempt)
+	h.logLogin(c, req.Username, resp.User.ID, nil)
+	c.JSON(http.StatusOK, resp)
+}
+
+// StepUp 当前登录用户重新验证身份（密码或动态验证码），换取短期二次认证令牌
+// 失败次数与登录共用防暴力破解计数
+func (h *AuthHandler) StepUp(c *gin.Context) {
+	var req services.StepUpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username := c.GetString("username")
+	ipAddress := c.ClientIP()
+	attempt, block := h.loginLimiter.Reserve(username, ipAddress)
+	if block != nil {
+		retryAfter := int(math.Ceil(block.RetryAfter.Seconds()))
+		h.logStepUp(c, "", fmt.Errorf("验证尝试过于频繁（%s: %s）", block.KeyType, block.Key))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       fmt.Sprintf("验证尝试过于频繁，请 %d 秒后重试", retryAfter),
+			"reason":      block.Reason,
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	resp, err := h.authService.StepUp(c.GetInt("user_id"), c.GetString("session_id"), &req)
+	if err != nil {
+		h.logStepUp(c, "", err)
+		if err == services.ErrStepUpFailed || err == services.ErrInvalidTOTPCode {
+			result := h.loginLimiter.RecordFailure(attempt)
+			if result.UserLocked || result.IPLocked {
+				h.alertBruteForce(c, username, result)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		h.loginLimiter.Release(attempt)
+		switch err {
+		case services.ErrStepUpMethodRequired, services.ErrTOTPNotEnabled:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case services.ErrAuthProviderUnavailable:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		}
 		return
 	}
 
+	h.loginLimiter.Release(attempt)
+	h.logStepUp(c, resp.Method, nil)
 	c.JSON(http.StatusOK, resp)
 }
 
+// logStepUp 记录重新验证身份的审计日志
+func (h *AuthHandler) logStepUp(c *gin.Context, method string, stepUpErr error) {
+	if h.auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"username": c.GetString("username"),
+	}
+	if method != "" {
+		details["method"] = method
+	}
+	if stepUpErr != nil {
+		details["reason"] = stepUpErr.Error()
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       c.GetInt("user_id"),
+		Action:       "step_up",
+		ResourceType: "user",
+		ResourceID:   c.GetString("username"),
+		Details:      string(detailsJSON),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		Success:      stepUpErr == nil,
+	}
+	if err := h.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log step-up: %v", err)
+	}
+}
+
+// alertBruteForce 用户名或来源IP因连续登录失败被锁定时产生告警
+func (h *AuthHandler) alertBruteForce(c *gin.Context, username string, result *services.LoginFailureResult) {
+	if h.auditService == nil {
+		return
+	}
+
+	var userID int
+	if user, err := h.authService.GetUserService().GetByUsername(username); err == nil {
+		userID = user.ID
+	}
+
+	description := fmt.Sprintf("Login for %s locked after %d failed attempts", username, result.UserFailures)
+	if result.IPLocked {
+		description = fmt.Sprintf("Source IP %s locked after %d failed login attempts", c.ClientIP(), result.IPFailures)
+	}
+	detailsJSON, _ := json.Marshal(map[string]interface{}{
+		"username":      username,
+		"user_failures": result.UserFailures,
+		"ip_failures":   result.IPFailures,
+		"user_locked":   result.UserLocked,
+		"ip_locked":     result.IPLocked,
+	})
+
+	alert := &models.SecurityAlert{
+		UserID:      userID,
+		AlertType:   "brute_force",
+		Severity:    "high",
+		Description: description,
+		Details:     string(detailsJSON),
+		IPAddress:   c.ClientIP(),
+	}
+	if err := h.auditService.CreateSecurityAlert(context.Background(), alert); err != nil {
+		log.Printf("Failed to create brute force alert: %v", err)
+	}
+}
+
+// ListLoginLockouts 获取当前被锁定的用户名和IP（管理员）
+func (h *AuthHandler) ListLoginLockouts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"lockouts": h.loginLimiter.Lockouts()})
+}
+
+// UnlockLoginRequest 解除登录锁定请求
+type UnlockLoginRequest struct {
+	Username  string `json:"username"`
+	IPAddress string `json:"ip_address"`
+}
+
+// UnlockLogin 解除用户名或IP的登录锁定（管理员）
+func (h *AuthHandler) UnlockLogin(c *gin.Context) {
+	var req UnlockLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Username == "" && req.IPAddress == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名和IP不能同时为空"})
+		return
+	}
+
+	if !h.loginLimiter.Unlock(req.Username, req.IPAddress) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "没有对应的登录失败记录"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除登录锁定"})
+}
+
+// logLogin 记录登录审计日志，失败（包括被限制的尝试）记录为 success=false
+func (h *AuthHandler) logLogin(c *gin.Context, username string, userID int, loginErr error) {
+	if h.auditService == nil {
+		return
+	}
+
+	// 登录失败时尽量关联到被尝试的账号
+	if userID == 0 {
+		if user, err := h.authService.GetUserService().GetByUsername(username); err == nil {
+			userID = user.ID
+		}
+	}
+
+	details := map[string]interface{}{
+		"username": username,
+	}
+	if loginErr != nil {
+		details["reason"] = loginErr.Error()
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       userID,
+		Action:       "login",
+		ResourceType: "user",
+		ResourceID:   username,
+		Details:      string(detailsJSON),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		Success:      loginErr == nil,
+	}
+	if err := h.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log login attempt: %v", err)
+	}
+
+	if loginErr == nil {
+		h.auditService.ObserveLogin(context.Background(), userID, entry.IPAddress)
+	}
+}
+
 // Profile 获取用户信息
 func (h *AuthHandler) Profile(c *gin.Context) {
 	userID, _ := c.Get("user_id")
@@ -44,13 +291,98 @@ func (h *AuthHandler) Profile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
 		return
 	}
+	user.Permissions = middleware.Permissions(c)
 
 	c.JSON(http.StatusOK, user)
 }
 
-// Logout 登出
+// Refresh 使用刷新令牌换取新的访问令牌，刷新令牌同时轮换
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req services.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.Refresh(req.RefreshToken, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		if err == services.ErrRefreshTokenReused {
+			h.alertTokenReuse(c)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// alertTokenReuse 刷新令牌重放可能意味着令牌被盗用
+func (h *AuthHandler) alertTokenReuse(c *gin.Context) {
+	if h.auditService == nil {
+		return
+	}
+	alert := &models.SecurityAlert{
+		AlertType:   "token_reuse",
+		Severity:    "high",
+		Description: "A rotated refresh token was presented again; the login session has been revoked",
+		IPAddress:   c.ClientIP(),
+	}
+	if err := h.auditService.CreateSecurityAlert(context.Background(), alert); err != nil {
+		log.Printf("Failed to create token reuse alert: %v", err)
+	}
+}
+
+// Logout 登出，撤销当前登录会话
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// JWT 是无状态的，这里只返回成功响应
-	// 实际的 token 失效由客户端处理
+	userID, _ := currentUser(c)
+	username := c.GetString("username")
+	sessionID := c.GetString("session_id")
+
+	if err := h.authService.Logout(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.auditService != nil {
+		detailsJSON, _ := json.Marshal(map[string]interface{}{"username": username, "session_id": sessionID})
+		entry := &models.AuditLog{
+			UserID:       userID,
+			Action:       "logout",
+			ResourceType: "user",
+			ResourceID:   username,
+			Details:      string(detailsJSON),
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.GetHeader("User-Agent"),
+			Success:      true,
+		}
+		if err := h.auditService.LogAction(context.Background(), entry); err != nil {
+			log.Printf("Failed to log logout: %v", err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "登出成功"})
 }
+
+// SignOutEverywhere 管理员强制用户在所有设备登出
+func (h *AuthHandler) SignOutEverywhere(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	revoked, err := h.authService.SignOutEverywhere(id, "admin_sign_out")
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "用户已在所有设备登出",
+		"revoked_sessions": revoked,
+	})
+}
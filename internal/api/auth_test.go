@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAuthProvider 返回固定错误的外部身份源
+type fakeAuthProvider struct {
+	err error
+}
+
+func (p *fakeAuthProvider) Name() string    { return "ldap" }
+func (p *fakeAuthProvider) Provision() bool { return true }
+func (p *fakeAuthProvider) Authenticate(username, password string) (*services.ExternalIdentity, error) {
+	return nil, p.err
+}
+
+func newLoginTestRouter(t *testing.T, provider *fakeAuthProvider) (*gin.Engine, *services.LoginLimiter) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authService := services.NewAuthService(&config.Config{
+		JWTSecret:          "test-secret",
+		JWTExpiry:          time.Hour,
+		RefreshTokenExpiry: time.Hour,
+	}, db)
+	authService.RegisterProvider(provider)
+	limiter := services.NewLoginLimiter(services.LoginLimits{MaxFailures: 2, IPMaxFailures: 10, Window: time.Minute, LockoutDuration: time.Minute})
+
+	router := gin.New()
+	router.POST("/api/v1/auth/login", NewAuthHandler(authService, nil, limiter).Login)
+	return router, limiter
+}
+
+func postLogin(router *gin.Engine, username string) int {
+	w := httptest.NewRecorder()
+	body := bytes.NewBufferString(`{"username":"` + username + `","password":"secret"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", body)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestLoginProviderOutageDoesNotCountTowardsLockout(t *testing.T) {
+	provider := &fakeAuthProvider{err: errors.New("dial tcp: connection refused")}
+	router, limiter := newLoginTestRouter(t, provider)
+
+	for i := 0; i < 5; i++ {
+		if code := postLogin(router, "alice"); code != http.StatusServiceUnavailable {
+			t.Fatalf("attempt %d during outage: status %d, want 503", i+1, code)
+		}
+	}
+	if lockouts := limiter.Lockouts(); len(lockouts) != 0 {
+		t.Fatalf("lockouts after outage = %+v, want none", lockouts)
+	}
+
+	// 身份源恢复后，凭证错误照常计数并锁定
+	provider.err = services.ErrInvalidCredentials
+	for i := 0; i < 2; i++ {
+		if code := postLogin(router, "alice"); code != http.StatusUnauthorized {
+			t.Fatalf("wrong password attempt %d: status %d, want 401", i+1, code)
+		}
+	}
+	if code := postLogin(router, "alice"); code != http.StatusTooManyRequests {
+		t.Fatalf("after reaching the failure limit: status %d, want 429", code)
+	}
+}
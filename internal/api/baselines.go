@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BaselineHandler 用户行为基线处理器
+type BaselineHandler struct {
+	baselineService *models.BaselineService
+	anomalyDetector *services.AnomalyDetector
+}
+
+// NewBaselineHandler 创建用户行为基线处理器
+func NewBaselineHandler(baselineService *models.BaselineService, anomalyDetector *services.AnomalyDetector) *BaselineHandler {
+	return &BaselineHandler{
+		baselineService: baselineService,
+		anomalyDetector: anomalyDetector,
+	}
+}
+
+// List 获取所有用户的行为基线和当前检测阈值
+func (h *BaselineHandler) List(c *gin.Context) {
+	baselines, err := h.baselineService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"baselines":  baselines,
+		"thresholds": h.anomalyDetector.Thresholds(),
+	})
+}
+
+// Get 获取单个用户的行为基线
+func (h *BaselineHandler) Get(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	baseline, err := h.baselineService.Get(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	thresholds := h.anomalyDetector.Thresholds()
+	c.JSON(http.StatusOK, gin.H{
+		"baseline":   baseline,
+		"learning":   baseline.Observations < thresholds.MinObservations,
+		"thresholds": thresholds,
+	})
+}
+
+// Reset 重置用户的行为基线
+func (h *BaselineHandler) Reset(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	if err := h.anomalyDetector.Reset(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "行为基线已重置"})
+}
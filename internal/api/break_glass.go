@@ -0,0 +1,194 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BreakGlassHandler 紧急访问处理器
+type BreakGlassHandler struct {
+	manager *services.BreakGlassManager
+}
+
+// NewBreakGlassHandler 创建紧急访问处理器
+func NewBreakGlassHandler(manager *services.BreakGlassManager) *BreakGlassHandler {
+	return &BreakGlassHandler{manager: manager}
+}
+
+// ListMine 获取自己的紧急访问记录
+func (h *BreakGlassHandler) ListMine(c *gin.Context) {
+	h.list(c, c.GetInt("user_id"))
+}
+
+// List 获取全部紧急访问记录，支持按 status、review_status、user_id 过滤
+func (h *BreakGlassHandler) List(c *gin.Context) {
+	userID, _ := strconv.Atoi(c.Query("user_id"))
+	h.list(c, userID)
+}
+
+func (h *BreakGlassHandler) list(c *gin.Context, userID int) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	activations, err := h.manager.GetActivationService().List(models.BreakGlassFilter{
+		UserID:       userID,
+		Status:       c.Query("status"),
+		ReviewStatus: c.Query("review_status"),
+		Limit:        pageSize,
+		Offset:       (page - 1) * pageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pending, err := h.manager.GetActivationService().CountPendingReview()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"activations": activations, "pending_review": pending, "page": page, "page_size": pageSize})
+}
+
+// Activate 发起紧急访问，必须填写原因
+func (h *BreakGlassHandler) Activate(c *gin.Context) {
+	var req models.BreakGlassCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Justification = strings.TrimSpace(req.Justification)
+	if len([]rune(req.Justification)) < 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请详细填写紧急访问原因（至少 10 个字符）"})
+		return
+	}
+
+	activation, err := h.manager.Activate(c.GetInt("user_id"), req.Justification, c.ClientIP())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, activation)
+}
+
+// Get 获取紧急访问详情和期间建立的会话，审批人可以查看他人的记录
+func (h *BreakGlassHandler) Get(c *gin.Context) {
+	id, ok := h.activationID(c)
+	if !ok {
+		return
+	}
+	activation, err := h.manager.Get(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if activation.UserID != c.GetInt("user_id") && !middleware.HasPermission(c, models.PermissionAccessApprove) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "紧急访问不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, activation)
+}
+
+// EndMine 提前结束自己的紧急访问
+func (h *BreakGlassHandler) EndMine(c *gin.Context) {
+	id, ok := h.activationID(c)
+	if !ok {
+		return
+	}
+	activation, err := h.manager.GetActivationService().GetByID(id)
+	if err != nil || activation.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "紧急访问不存在"})
+		return
+	}
+	h.end(c, id, "本人结束")
+}
+
+// End 收回他人的紧急访问
+func (h *BreakGlassHandler) End(c *gin.Context) {
+	id, ok := h.activationID(c)
+	if !ok {
+		return
+	}
+	h.end(c, id, "管理员收回")
+}
+
+func (h *BreakGlassHandler) end(c *gin.Context, id int, defaultReason string) {
+	var req models.BreakGlassEnd
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = defaultReason
+	}
+
+	activation, err := h.manager.End(id, c.GetInt("user_id"), reason, c.ClientIP())
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, activation)
+}
+
+// Review 事后复核签字
+func (h *BreakGlassHandler) Review(c *gin.Context) {
+	id, ok := h.activationID(c)
+	if !ok {
+		return
+	}
+	var req models.BreakGlassReview
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Notes = strings.TrimSpace(req.Notes)
+	if req.Notes == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请填写复核意见"})
+		return
+	}
+
+	activation, err := h.manager.SignOff(id, c.GetInt("user_id"), req.Notes)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, activation)
+}
+
+// writeError 按紧急访问流程错误类型返回状态码
+func (h *BreakGlassHandler) writeError(c *gin.Context, err error) {
+	switch err {
+	case services.ErrBreakGlassAlreadyActive, services.ErrBreakGlassNotActive, services.ErrBreakGlassStillActive, services.ErrBreakGlassReviewed:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case services.ErrBreakGlassSelfReview:
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "紧急访问不存在"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// activationID 解析路径中的紧急访问ID，失败时已写入响应
+func (h *BreakGlassHandler) activationID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的紧急访问ID"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnectPolicyHandler 连接策略处理器
+type ConnectPolicyHandler struct {
+	engine        *services.ConnectPolicyEngine
+	serverService *models.ServerService
+}
+
+// NewConnectPolicyHandler 创建连接策略处理器
+func NewConnectPolicyHandler(engine *services.ConnectPolicyEngine, serverService *models.ServerService) *ConnectPolicyHandler {
+	return &ConnectPolicyHandler{engine: engine, serverService: serverService}
+}
+
+// List 获取全部连接策略
+func (h *ConnectPolicyHandler) List(c *gin.Context) {
+	policies, err := h.engine.GetPolicyService().List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"policies": policies, "total": len(policies)})
+}
+
+// Variables 获取策略表达式可以使用的变量和函数
+func (h *ConnectPolicyHandler) Variables(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"variables":   services.PolicyVariables(),
+		"functions":   []string{"in_cidr(ip, cidr...)", "starts_with(s, prefix)", "ends_with(s, suffix)", "contains(s, sub)", "matches(s, regex)", "lower(s)", "size(s|list)"},
+		"effects":     []string{models.PolicyEffectAllow, models.PolicyEffectDeny, models.PolicyEffectRequireApproval},
+		"obligations": []string{models.ObligationRecord, models.ObligationReadOnly},
+	})
+}
+
+// Get 获取连接策略
+func (h *ConnectPolicyHandler) Get(c *gin.Context) {
+	id, ok := h.pathID(c)
+	if !ok {
+		return
+	}
+	policy, err := h.engine.GetPolicyService().GetByID(id)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// Create 创建连接策略，表达式无法编译时返回 400
+func (h *ConnectPolicyHandler) Create(c *gin.Context) {
+	var req models.ConnectPolicyCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "策略名称不能为空"})
+		return
+	}
+
+	policy, err := h.engine.Create(&req, c.GetInt("user_id"))
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "策略名称已存在"})
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+// Update 更新连接策略，生成新版本
+func (h *ConnectPolicyHandler) Update(c *gin.Context) {
+	id, ok := h.pathID(c)
+	if !ok {
+		return
+	}
+	var req models.ConnectPolicyUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := h.engine.Update(id, &req, c.GetInt("user_id"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// Delete 删除连接策略及其历史版本
+func (h *ConnectPolicyHandler) Delete(c *gin.Context) {
+	id, ok := h.pathID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.engine.GetPolicyService().GetByID(id); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	if err := h.engine.GetPolicyService().Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "连接策略已删除"})
+}
+
+// ListVersions 获取连接策略的历史版本
+func (h *ConnectPolicyHandler) ListVersions(c *gin.Context) {
+	id, ok := h.pathID(c)
+	if !ok {
+		return
+	}
+	if _, err := h.engine.GetPolicyService().GetByID(id); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	versions, err := h.engine.GetPolicyService().ListVersions(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"versions": versions})
+}
+
+// Restore 恢复到历史版本，恢复本身生成一个新版本
+func (h *ConnectPolicyHandler) Restore(c *gin.Context) {
+	id, ok := h.pathID(c)
+	if !ok {
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的版本号"})
+		return
+	}
+	var req struct {
+		Comment string `json:"comment" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Comment == "" {
+		req.Comment = "恢复到第 " + strconv.Itoa(version) + " 版"
+	}
+
+	policy, err := h.engine.GetPolicyService().Restore(id, version, c.GetInt("user_id"), req.Comment)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// DryRun 模拟一次连接，返回决定、每条策略的求值结果和表达式变量，可附带未保存的草稿策略
+func (h *ConnectPolicyHandler) DryRun(c *gin.Context) {
+	var req models.ConnectPolicyDryRun
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	server, err := h.serverService.GetByID(req.ServerID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "服务器不存在"})
+		return
+	}
+	at := time.Now()
+	if req.Time != nil {
+		at = *req.Time
+	}
+
+	input, err := h.engine.Input(req.UserID, server, req.SourceIP, at, models.SessionJustification{Reason: req.Reason, TicketID: req.TicketID})
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	input.BreakGlass = req.BreakGlass
+
+	var draft *models.ConnectPolicy
+	if req.Draft != nil {
+		draft = &models.ConnectPolicy{
+			Name:        "draft",
+			Expression:  req.Draft.Expression,
+			Effect:      req.Draft.Effect,
+			Obligations: req.Draft.Obligations,
+			Enabled:     true,
+			Mode:        models.PolicyModeEnforce,
+		}
+	}
+	decision, traces, err := h.engine.DryRun(input, draft)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"decision":  decision,
+		"permitted": services.Permitted(decision),
+		"policies":  traces,
+		"variables": h.engine.Variables(input),
+	})
+}
+
+// writeError 按连接策略错误类型返回状态码
+func (h *ConnectPolicyHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case err == sql.ErrNoRows:
+		c.JSON(http.StatusNotFound, gin.H{"error": "连接策略或版本不存在"})
+	case errors.Is(err, services.ErrInvalidPolicyExpression):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case err == models.ErrConnectPolicyConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// pathID 解析路径中的策略ID，失败时已写入响应
+func (h *ConnectPolicyHandler) pathID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的策略ID"})
+		return 0, false
+	}
+	return id, true
+}
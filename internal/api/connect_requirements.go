@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConnectRequirementHandler 连接要求处理器
+type ConnectRequirementHandler struct {
+	requirementService *models.ConnectRequirementService
+	serverService      *models.ServerService
+	ticketPattern      string
+}
+
+// NewConnectRequirementHandler 创建连接要求处理器
+func NewConnectRequirementHandler(requirementService *models.ConnectRequirementService, serverService *models.ServerService, ticketPattern string) *ConnectRequirementHandler {
+	return &ConnectRequirementHandler{requirementService: requirementService, serverService: serverService, ticketPattern: ticketPattern}
+}
+
+// List 获取全部连接要求
+func (h *ConnectRequirementHandler) List(c *gin.Context) {
+	requirements, err := h.requirementService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"requirements": requirements, "total": len(requirements), "ticket_pattern": h.ticketPattern})
+}
+
+// Create 为服务器或标签创建连接要求，每个服务器或标签一条
+func (h *ConnectRequirementHandler) Create(c *gin.Context) {
+	var req models.ConnectRequirementCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Tag = strings.TrimSpace(req.Tag)
+	if (req.ServerID == nil) == (req.Tag == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "server_id 和 tag 必须且只能指定一个"})
+		return
+	}
+	if !req.RequireReason && !req.RequireTicket && !req.RequireStepUp {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要指定一项连接要求"})
+		return
+	}
+	if req.ServerID != nil {
+		if _, err := h.serverService.GetByID(*req.ServerID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "服务器不存在"})
+			return
+		}
+	}
+
+	requirement, err := h.requirementService.Create(&req)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "该服务器或标签的连接要求已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, requirement)
+}
+
+// Update 更新连接要求
+func (h *ConnectRequirementHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的连接要求ID"})
+		return
+	}
+	var req models.ConnectRequirementUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.requirementService.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "连接要求不存在"})
+		return
+	}
+	requirement, err := h.requirementService.Update(id, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, requirement)
+}
+
+// Delete 删除连接要求
+func (h *ConnectRequirementHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的连接要求ID"})
+		return
+	}
+	if _, err := h.requirementService.GetByID(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "连接要求不存在"})
+		return
+	}
+	if err := h.requirementService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "连接要求已删除"})
+}
@@ -72,6 +72,30 @@ func (h *CredentialHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, credential)
 }
 
+// Reveal 查看凭证中的密码和私钥，需要近期重新验证过身份，调用会记入审计日志
+func (h *CredentialHandler) Reveal(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的凭证ID"})
+		return
+	}
+
+	credential, err := h.credentialService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "凭证不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":           credential.ID,
+		"name":         credential.Name,
+		"type":         credential.Type,
+		"password":     credential.Password,
+		"private_key":  credential.PrivateKey,
+		"key_password": credential.KeyPassword,
+	})
+}
+
 // Create 创建登录凭证
 func (h *CredentialHandler) Create(c *gin.Context) {
 	var req models.CredentialCreate
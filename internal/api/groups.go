@@ -0,0 +1,208 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GroupHandler 用户组处理器
+type GroupHandler struct {
+	groupService *models.GroupService
+	userService  *models.UserService
+}
+
+// NewGroupHandler 创建用户组处理器
+func NewGroupHandler(groupService *models.GroupService, userService *models.UserService) *GroupHandler {
+	return &GroupHandler{
+		groupService: groupService,
+		userService:  userService,
+	}
+}
+
+// GroupMemberRequest 添加成员请求
+type GroupMemberRequest struct {
+	UserID int `json:"user_id" binding:"required,min=1"`
+}
+
+// List 获取用户组列表
+func (h *GroupHandler) List(c *gin.Context) {
+	groups, err := h.groupService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"groups": groups, "total": len(groups)})
+}
+
+// Get 获取用户组详情及成员
+func (h *GroupHandler) Get(c *gin.Context) {
+	group, ok := h.group(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.groupService.ListMembers(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"group": group, "members": members})
+}
+
+// Create 创建用户组
+func (h *GroupHandler) Create(c *gin.Context) {
+	var req models.GroupCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, userID := range req.UserIDs {
+		if !h.userExists(c, userID) {
+			return
+		}
+	}
+	if req.OwnerID != nil && !h.userExists(c, *req.OwnerID) {
+		return
+	}
+
+	group, err := h.groupService.Create(&req)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "用户组名称已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, group)
+}
+
+// Update 更新用户组
+func (h *GroupHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户组ID"})
+		return
+	}
+
+	var req models.GroupUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.OwnerID != nil && *req.OwnerID != 0 && !h.userExists(c, *req.OwnerID) {
+		return
+	}
+
+	group, err := h.groupService.Update(id, &req)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户组不存在"})
+			return
+		}
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "用户组名称已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, group)
+}
+
+// Delete 删除用户组，授予该组的权限一并删除
+func (h *GroupHandler) Delete(c *gin.Context) {
+	group, ok := h.group(c)
+	if !ok {
+		return
+	}
+
+	if err := h.groupService.Delete(group.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "用户组已删除"})
+}
+
+// AddMember 添加成员
+func (h *GroupHandler) AddMember(c *gin.Context) {
+	group, ok := h.group(c)
+	if !ok {
+		return
+	}
+
+	var req GroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.userExists(c, req.UserID) {
+		return
+	}
+
+	if err := h.groupService.AddMember(group.ID, req.UserID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员已添加"})
+}
+
+// RemoveMember 移除成员
+func (h *GroupHandler) RemoveMember(c *gin.Context) {
+	group, ok := h.group(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	removed, err := h.groupService.RemoveMember(group.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !removed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该用户不是组成员"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "成员已移除"})
+}
+
+// group 按路径参数获取用户组，失败时已写入响应
+func (h *GroupHandler) group(c *gin.Context) (*models.Group, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户组ID"})
+		return nil, false
+	}
+
+	group, err := h.groupService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户组不存在"})
+		return nil, false
+	}
+	return group, true
+}
+
+// userExists 检查用户是否存在，不存在时已写入响应
+func (h *GroupHandler) userExists(c *gin.Context, userID int) bool {
+	if _, err := h.userService.GetByID(userID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "用户不存在: " + strconv.Itoa(userID)})
+		return false
+	}
+	return true
+}
+
+// isUniqueViolation 判断是否违反唯一约束
+func isUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
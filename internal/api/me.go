@@ -0,0 +1,272 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MeHandler 当前用户自助服务处理器
+type MeHandler struct {
+	authService  *services.AuthService
+	auditService *services.AuditService
+	ttydService  *services.TTYDService
+}
+
+// NewMeHandler 创建自助服务处理器
+func NewMeHandler(authService *services.AuthService, auditService *services.AuditService, ttydService *services.TTYDService) *MeHandler {
+	return &MeHandler{
+		authService:  authService,
+		auditService: auditService,
+		ttydService:  ttydService,
+	}
+}
+
+// Get 获取当前用户信息
+func (h *MeHandler) Get(c *gin.Context) {
+	user, err := h.authService.GetUserService().GetByID(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	user.Permissions = middleware.Permissions(c)
+	c.JSON(http.StatusOK, user)
+}
+
+// GetPasswordPolicy 获取密码策略
+func (h *MeHandler) GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, h.authService.PasswordPolicy())
+}
+
+// ChangePassword 修改自己的密码，成功后其他登录会话全部失效，返回当前客户端的新令牌
+func (h *MeHandler) ChangePassword(c *gin.Context) {
+	var req services.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.authService.ChangePassword(c.GetInt("user_id"), &req, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		h.logAction(c, "password_change", "user", c.GetString("username"), map[string]interface{}{"reason": err.Error()}, false)
+		if err == services.ErrWrongPassword {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logAction(c, "password_change", "user", c.GetString("username"), nil, true)
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListLogins 获取自己的有效登录会话
+func (h *MeHandler) ListLogins(c *gin.Context) {
+	sessions, err := h.authService.GetSessionService().ListByUser(c.GetInt("user_id"), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := c.GetString("session_id")
+	logins := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		logins = append(logins, gin.H{
+			"id":           session.ID,
+			"ip_address":   session.IPAddress,
+			"user_agent":   session.UserAgent,
+			"created_at":   session.CreatedAt,
+			"last_seen_at": session.LastSeenAt,
+			"expires_at":   session.ExpiresAt,
+			"current":      session.ID == current,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"logins": logins})
+}
+
+// RevokeLogin 撤销自己的某个登录会话
+func (h *MeHandler) RevokeLogin(c *gin.Context) {
+	id := c.Param("id")
+	session, err := h.authService.GetSessionService().GetByID(id)
+	if err != nil || session.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "登录会话不存在"})
+		return
+	}
+
+	if err := h.authService.GetSessionService().Revoke(id, "user_revoked"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logAction(c, "login_revoke", "auth_session", id, nil, true)
+	c.JSON(http.StatusOK, gin.H{"message": "登录会话已撤销"})
+}
+
+// RevokeOtherLogins 撤销除当前会话外的全部登录会话
+func (h *MeHandler) RevokeOtherLogins(c *gin.Context) {
+	sessions, err := h.authService.GetSessionService().ListByUser(c.GetInt("user_id"), true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := c.GetString("session_id")
+	revoked := 0
+	for _, session := range sessions {
+		if session.ID == current {
+			continue
+		}
+		if err := h.authService.GetSessionService().Revoke(session.ID, "user_revoked"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		revoked++
+	}
+
+	h.logAction(c, "login_revoke_others", "user", c.GetString("username"), map[string]interface{}{"revoked_sessions": revoked}, true)
+	c.JSON(http.StatusOK, gin.H{"message": "其他登录会话已撤销", "revoked_sessions": revoked})
+}
+
+// ListTerminalSessions 获取自己正在进行的终端会话
+func (h *MeHandler) ListTerminalSessions(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	response := make([]gin.H, 0)
+	for _, process := range h.ttydService.ListActiveSessions() {
+		if process.UserID != userID {
+			continue
+		}
+		response = append(response, gin.H{
+			"session_id":  process.SessionID,
+			"server_id":   process.ServerID,
+			"server_name": process.ServerName,
+			"client_ip":   process.ClientIP,
+			"created_at":  process.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+// StopTerminalSession 停止自己的终端会话
+func (h *MeHandler) StopTerminalSession(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	process, exists := h.ttydService.GetTTYDProcess(sessionID)
+	if !exists || process.UserID != c.GetInt("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	if err := h.ttydService.StopTTYDSession(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("停止终端失败: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "终端会话已停止"})
+}
+
+// GetTOTP 获取自己的动态验证码状态
+func (h *MeHandler) GetTOTP(c *gin.Context) {
+	totp, err := h.authService.TOTPStatus(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if totp == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, totp)
+}
+
+// SetupTOTP 生成动态验证码密钥，需要用验证码确认后才启用
+func (h *MeHandler) SetupTOTP(c *gin.Context) {
+	setup, err := h.authService.SetupTOTP(c.GetInt("user_id"), c.GetString("username"))
+	if err != nil {
+		if err == services.ErrTOTPAlreadyEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTOTPRequest 启用动态验证码请求
+type EnableTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// EnableTOTP 用验证码确认并启用动态验证码
+func (h *MeHandler) EnableTOTP(c *gin.Context) {
+	var req EnableTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.EnableTOTP(c.GetInt("user_id"), req.Code); err != nil {
+		h.logAction(c, "totp_enable", "user", c.GetString("username"), map[string]interface{}{"reason": err.Error()}, false)
+		switch err {
+		case services.ErrTOTPNotSetup, services.ErrInvalidTOTPCode:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case services.ErrTOTPAlreadyEnabled:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	h.logAction(c, "totp_enable", "user", c.GetString("username"), nil, true)
+	c.JSON(http.StatusOK, gin.H{"message": "动态验证码已启用"})
+}
+
+// DisableTOTP 停用自己的动态验证码，需要先重新验证身份
+func (h *MeHandler) DisableTOTP(c *gin.Context) {
+	if err := h.authService.DisableTOTP(c.GetInt("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logAction(c, "totp_disable", "user", c.GetString("username"), map[string]interface{}{"step_up": c.GetString("step_up_method")}, true)
+	c.JSON(http.StatusOK, gin.H{"message": "动态验证码已停用"})
+}
+
+// logAction 记录自助操作审计日志
+func (h *MeHandler) logAction(c *gin.Context, action, resourceType, resourceID string, extra map[string]interface{}, success bool) {
+	if h.auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{"username": c.GetString("username")}
+	for key, value := range extra {
+		details[key] = value
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       c.GetInt("user_id"),
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Details:      string(detailsJSON),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		Success:      success,
+	}
+	if err := h.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s: %v", action, err)
+	}
+}
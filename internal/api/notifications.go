@@ -0,0 +1,154 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NotificationHandler 告警通知渠道处理器
+type NotificationHandler struct {
+	channelService  *models.NotificationChannelService
+	alertDispatcher *services.AlertDispatcher
+}
+
+// NewNotificationHandler 创建告警通知渠道处理器
+func NewNotificationHandler(channelService *models.NotificationChannelService, alertDispatcher *services.AlertDispatcher) *NotificationHandler {
+	return &NotificationHandler{
+		channelService:  channelService,
+		alertDispatcher: alertDispatcher,
+	}
+}
+
+// List 获取通知渠道列表
+func (h *NotificationHandler) List(c *gin.Context) {
+	channels, err := h.channelService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	masked := make([]*models.NotificationChannel, 0, len(channels))
+	for _, channel := range channels {
+		masked = append(masked, channel.Masked())
+	}
+	c.JSON(http.StatusOK, gin.H{"channels": masked})
+}
+
+// Get 获取单个通知渠道
+func (h *NotificationHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的渠道ID"})
+		return
+	}
+
+	channel, err := h.channelService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, channel.Masked())
+}
+
+// Create 创建通知渠道
+func (h *NotificationHandler) Create(c *gin.Context) {
+	var req models.NotificationChannelCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 保存前校验渠道配置
+	if _, err := services.NewNotifier(&models.NotificationChannel{Type: req.Type, Config: req.Config}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	channel, err := h.channelService.Create(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, channel.Masked())
+}
+
+// Update 更新通知渠道
+func (h *NotificationHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的渠道ID"})
+		return
+	}
+
+	var req models.NotificationChannelUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := h.channelService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知渠道不存在"})
+		return
+	}
+	if req.Config != nil {
+		candidate := &models.NotificationChannel{Type: existing.Type, Config: map[string]string{}}
+		for key, value := range req.Config {
+			if value == models.MaskedSecret {
+				value = existing.Config[key]
+			}
+			candidate.Config[key] = value
+		}
+		if _, err := services.NewNotifier(candidate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	channel, err := h.channelService.Update(id, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, channel.Masked())
+}
+
+// Delete 删除通知渠道
+func (h *NotificationHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的渠道ID"})
+		return
+	}
+
+	if err := h.channelService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "通知渠道已删除"})
+}
+
+// Test 向通知渠道发送测试消息
+func (h *NotificationHandler) Test(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的渠道ID"})
+		return
+	}
+
+	if err := h.alertDispatcher.Test(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "测试通知已发送"})
+}
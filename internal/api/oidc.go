@@ -0,0 +1,207 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie 发起登录的浏览器标记，回调时与 state 比对，防止登录 CSRF
+const oidcStateCookie = "vj_oidc_state"
+
+// oidcProviderName 身份源名称只允许小写字母、数字、下划线和连字符
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// OIDCHandler OpenID Connect 单点登录处理器
+type OIDCHandler struct {
+	oidcService  *services.OIDCService
+	loginCodes   *services.LoginCodeStore
+	auditService *services.AuditService
+}
+
+// NewOIDCHandler 创建 OIDC 单点登录处理器
+func NewOIDCHandler(oidcService *services.OIDCService, loginCodes *services.LoginCodeStore, auditService *services.AuditService) *OIDCHandler {
+	return &OIDCHandler{
+		oidcService:  oidcService,
+		loginCodes:   loginCodes,
+		auditService: auditService,
+	}
+}
+
+// Login 跳转到身份源授权页
+func (h *OIDCHandler) Login(c *gin.Context) {
+	name := c.Param("name")
+	authURL, state, err := h.oidcService.Begin(name, callbackURL(c, name))
+	if err != nil {
+		if err == services.ErrOIDCProviderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Failed to start OIDC login with %s: %v", name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.setStateCookie(c, state, 600)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback 处理身份源回调，登录成功后把一次性登录码通过 URL 片段交给前端
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	name := c.Param("name")
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if idpError := c.Query("error"); idpError != "" {
+		h.finishWithError(c, name, fmt.Errorf("身份源拒绝登录: %s %s", idpError, c.Query("error_description")))
+		return
+	}
+	if state == "" || cookieState != state {
+		h.finishWithError(c, name, services.ErrInvalidOIDCState)
+		return
+	}
+
+	result, err := h.oidcService.Complete(c.Request.Context(), name, state, c.Query("code"), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		h.finishWithError(c, name, err)
+		return
+	}
+
+	code, err := h.loginCodes.Issue(result.Response)
+	if err != nil {
+		h.finishWithError(c, name, err)
+		return
+	}
+
+	logSSOLogin(h.auditService, c, "oidc", name, result.Response.User.Username, result.Response.User.ID, map[string]interface{}{
+		"auth_source":     result.Source,
+		"groups":          result.Identity.Groups,
+		"granted_servers": result.GrantedServers,
+	}, nil)
+	ssoFinish(c, code)
+}
+
+// List 获取全部身份源（管理员）
+func (h *OIDCHandler) List(c *gin.Context) {
+	providers, err := h.oidcService.GetProviderService().List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	masked := make([]*models.OIDCProvider, 0, len(providers))
+	for _, provider := range providers {
+		masked = append(masked, provider.Masked())
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": masked})
+}
+
+// Get 获取单个身份源（管理员）
+func (h *OIDCHandler) Get(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的身份源ID"})
+		return
+	}
+
+	provider, err := h.oidcService.GetProviderService().GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "身份源不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, provider.Masked())
+}
+
+// Create 创建身份源（管理员）
+func (h *OIDCHandler) Create(c *gin.Context) {
+	var req models.OIDCProviderCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !oidcProviderName.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "身份源名称只能包含小写字母、数字、下划线和连字符"})
+		return
+	}
+
+	provider, err := h.oidcService.GetProviderService().Create(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, provider.Masked())
+}
+
+// Update 更新身份源（管理员）
+func (h *OIDCHandler) Update(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的身份源ID"})
+		return
+	}
+
+	var req models.OIDCProviderUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	provider, err := h.oidcService.GetProviderService().Update(id, &req)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "身份源不存在"})
+		return
+	}
+	h.oidcService.Forget(provider.Name)
+	c.JSON(http.StatusOK, provider.Masked())
+}
+
+// Delete 删除身份源（管理员），已创建的用户保留但无法再通过该身份源登录
+func (h *OIDCHandler) Delete(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的身份源ID"})
+		return
+	}
+
+	provider, err := h.oidcService.GetProviderService().GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "身份源不存在"})
+		return
+	}
+	if err := h.oidcService.GetProviderService().Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.oidcService.Forget(provider.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "身份源已删除"})
+}
+
+// finishWithError 记录失败并跳转回登录页展示错误
+func (h *OIDCHandler) finishWithError(c *gin.Context, name string, loginErr error) {
+	log.Printf("OIDC login with %s failed: %v", name, loginErr)
+	logSSOLogin(h.auditService, c, "oidc", name, "", 0, nil, loginErr)
+	ssoFinishWithError(c, loginErr)
+}
+
+// setStateCookie 设置或清除 state Cookie，回调来自身份源的跨站跳转，因此使用 SameSite=Lax
+func (h *OIDCHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/api/v1/auth/oidc", "", requestIsSecure(c), true)
+}
+
+// callbackURL 按当前请求地址生成回调地址，身份源配置了 redirect_url 时以配置为准
+func callbackURL(c *gin.Context, name string) string {
+	scheme := "http"
+	if requestIsSecure(c) {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/v1/auth/oidc/%s/callback", scheme, c.Request.Host, name)
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database"
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID     = "very-jump"
+	testOIDCClientSecret = "client-secret"
+)
+
+// fakeAuthorization 身份源已批准、等待换取令牌的授权码
+type fakeAuthorization struct {
+	challenge   string
+	nonce       string
+	redirectURI string
+	subject     string
+}
+
+// fakeIssuer 进程内的 OIDC 身份源：发现文档、JWKS 和令牌端点
+// 令牌端点按 S256 校验 code_verifier，授权码只能使用一次
+type fakeIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex      sync.Mutex
+	codes      map[string]*fakeAuthorization
+	tokenCalls int
+	nonce      string // 非空时用其替换 ID 令牌中的 nonce
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	issuer := &fakeIssuer{t: t, key: key, codes: make(map[string]*fakeAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"alg": "RS256",
+				"use": "sig",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// approve 模拟用户在身份源完成登录，按授权地址中的参数签发授权码
+func (i *fakeIssuer) approve(authURL, subject string) string {
+	i.t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		i.t.Fatalf("parse auth url: %v", err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		i.t.Fatalf("authorization request without S256 PKCE: %s", authURL)
+	}
+	if query.Get("nonce") == "" || query.Get("client_id") != testOIDCClientID {
+		i.t.Fatalf("authorization request without nonce or client_id: %s", authURL)
+	}
+
+	code := "code-" + query.Get("state")
+	i.mutex.Lock()
+	i.codes[code] = &fakeAuthorization{
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		redirectURI: query.Get("redirect_uri"),
+		subject:     subject,
+	}
+	i.mutex.Unlock()
+	return code
+}
+
+func (i *fakeIssuer) token(w http.ResponseWriter, r *http.Request) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.tokenCalls++
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != testOIDCClientID || clientSecret != testOIDCClientSecret {
+		tokenError(w, "invalid_client")
+		return
+	}
+
+	authorization, ok := i.codes[r.PostFormValue("code")]
+	delete(i.codes, r.PostFormValue("code"))
+	if !ok || r.PostFormValue("redirect_uri") != authorization.redirectURI {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	nonce := authorization.nonce
+	if i.nonce != "" {
+		nonce = i.nonce
+	}
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                i.server.URL,
+		"aud":                testOIDCClientID,
+		"sub":                authorization.subject,
+		"preferred_username": authorization.subject,
+		"groups":             []string{"developers"},
+		"nonce":              nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+	})
+	idToken.Header["kid"] = "test"
+	signed, err := idToken.SignedString(i.key)
+	if err != nil {
+		i.t.Errorf("sign id token: %v", err)
+		tokenError(w, "server_error")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access-" + authorization.subject,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
+
+func (i *fakeIssuer) calls() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	return i.tokenCalls
+}
+
+// newOIDCTestRouter 注册了 OIDC 登录、回调和登录码换取接口的路由
+func newOIDCTestRouter(t *testing.T, issuer *fakeIssuer) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authService := services.NewAuthService(&config.Config{
+		JWTSecret:          "test-secret",
+		JWTExpiry:          time.Hour,
+		RefreshTokenExpiry: time.Hour,
+	}, db)
+	oidcService := services.NewOIDCService(db, authService)
+	provision := true
+	if _, err := oidcService.GetProviderService().Create(&models.OIDCProviderCreate{
+		Name:         "corp",
+		DisplayName:  "Corp SSO",
+		IssuerURL:    issuer.server.URL,
+		ClientID:     testOIDCClientID,
+		ClientSecret: testOIDCClientSecret,
+		Provision:    &provision,
+	}); err != nil {
+		t.Fatalf("create provider: %v", err)
+	}
+
+	loginCodes := services.NewLoginCodeStore()
+	oidcHandler := NewOIDCHandler(oidcService, loginCodes, nil)
+	ssoHandler := NewSSOHandler(oidcService, nil, loginCodes)
+
+	router := gin.New()
+	router.GET("/api/v1/auth/oidc/:name/login", oidcHandler.Login)
+	router.GET("/api/v1/auth/oidc/:name/callback", oidcHandler.Callback)
+	router.POST("/api/v1/auth/sso/exchange", ssoHandler.Exchange)
+	return router
+}
+
+// beginLogin 发起登录，返回授权地址和 state Cookie
+func beginLogin(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/corp/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return "", nil
+}
+
+// callback 以浏览器身份访问回调地址，返回跳转后的登录页片段参数
+func callback(t *testing.T, router *gin.Engine, state, code string, cookie *http.Cookie) url.Values {
+	t.Helper()
+	query := url.Values{"state": {state}, "code": {code}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/corp/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("callback status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	location := w.Header().Get("Location")
+	fragment := location[strings.Index(location, "#")+1:]
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		t.Fatalf("parse callback redirect %q: %v", location, err)
+	}
+	return values
+}
+
+func exchange(router *gin.Engine, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(ExchangeRequest{Code: code})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/sso/exchange", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func stateOf(t *testing.T, authURL string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	return parsed.Query().Get("state")
+}
+
+func TestOIDCLoginAndSingleUseLoginCode(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	router := newOIDCTestRouter(t, issuer)
+
+	authURL, cookie := beginLogin(t, router)
+	state := stateOf(t, authURL)
+	if cookie.Value != state || !cookie.HttpOnly {
+		t.Fatalf("state cookie = %+v, want HttpOnly cookie with state %s", cookie, state)
+	}
+
+	result := callback(t, router, state, issuer.approve(authURL, "alice"), cookie)
+	loginCode := result.Get("sso_code")
+	if loginCode == "" {
+		t.Fatalf("callback redirect = %v, want sso_code", result)
+	}
+
+	w := exchange(router, loginCode)
+	if w.Code != http.StatusOK {
+		t.Fatalf("exchange status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp services.LoginResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" || resp.User.Username != "alice" {
+		t.Fatalf("exchange response = %s, err = %v", w.Body.String(), err)
+	}
+
+	// 登录码只能换取一次
+	if w := exchange(router, loginCode); w.Code != http.StatusUnauthorized {
+		t.Errorf("second exchange status = %d, want 401", w.Code)
+	}
+
+	// state 已被消费，重放回调不能再次登录
+	replay := callback(t, router, state, issuer.approve(authURL, "alice"), cookie)
+	if replay.Get("sso_code") != "" || replay.Get("sso_error") == "" {
+		t.Errorf("replayed callback = %v, want sso_error", replay)
+	}
+}
+
+func TestOIDCCallbackRejectsStateCookieMismatch(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	router := newOIDCTestRouter(t, issuer)
+
+	authURL, cookie := beginLogin(t, router)
+	state := stateOf(t, authURL)
+	code := issuer.approve(authURL, "alice")
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"missing cookie", nil},
+		{"other browser's state", &http.Cookie{Name: oidcStateCookie, Value: "attacker-state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := callback(t, router, state, code, tt.cookie)
+			if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrInvalidOIDCState.Error() {
+				t.Errorf("callback redirect = %v, want invalid state error", result)
+			}
+		})
+	}
+	if n := issuer.calls(); n != 0 {
+		t.Errorf("token endpoint called %d times before the state cookie was checked", n)
+	}
+
+	// Cookie 匹配时 state 仍然有效
+	if result := callback(t, router, state, code, cookie); result.Get("sso_code") == "" {
+		t.Errorf("callback with matching cookie = %v, want sso_code", result)
+	}
+}
+
+func TestOIDCCallbackRequiresMatchingPKCEVerifier(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	router := newOIDCTestRouter(t, issuer)
+
+	// 授权码属于登录请求 A，却通过登录请求 B 的 state 提交：B 的 code_verifier 与 A 的 challenge 不匹配
+	authURLA, _ := beginLogin(t, router)
+	authURLB, cookieB := beginLogin(t, router)
+	stolen := issuer.approve(authURLA, "alice")
+
+	result := callback(t, router, stateOf(t, authURLB), stolen, cookieB)
+	if result.Get("sso_code") != "" || !strings.Contains(result.Get("sso_error"), "invalid_grant") {
+		t.Errorf("callback redirect = %v, want token exchange failure", result)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.nonce = "replayed-nonce"
+	router := newOIDCTestRouter(t, issuer)
+
+	authURL, cookie := beginLogin(t, router)
+	result := callback(t, router, stateOf(t, authURL), issuer.approve(authURL, "alice"), cookie)
+	if result.Get("sso_code") != "" || !strings.Contains(result.Get("sso_error"), "nonce") {
+		t.Errorf("callback redirect = %v, want nonce mismatch error", result)
+	}
+}
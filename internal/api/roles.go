@@ -0,0 +1,174 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleHandler 角色处理器
+type RoleHandler struct {
+	roleService *models.RoleService
+}
+
+// NewRoleHandler 创建角色处理器
+func NewRoleHandler(roleService *models.RoleService) *RoleHandler {
+	return &RoleHandler{roleService: roleService}
+}
+
+// ListPermissions 获取可分配给角色的权限
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": models.AllPermissions})
+}
+
+// List 获取角色列表
+func (h *RoleHandler) List(c *gin.Context) {
+	roles, err := h.roleService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"roles": roles, "total": len(roles)})
+}
+
+// Get 获取角色详情
+func (h *RoleHandler) Get(c *gin.Context) {
+	role, ok := h.role(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// Create 创建角色，不能包含操作者自身没有的权限
+func (h *RoleHandler) Create(c *gin.Context) {
+	var req models.RoleCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.CoversPermissions(middleware.Permissions(c), req.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能授予自身没有的权限"})
+		return
+	}
+
+	role, err := h.roleService.Create(&req)
+	if err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "角色名称已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// Update 更新角色的描述和权限
+func (h *RoleHandler) Update(c *gin.Context) {
+	role, ok := h.role(c)
+	if !ok {
+		return
+	}
+
+	var req models.RoleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if role.Builtin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": models.ErrBuiltinRole.Error()})
+		return
+	}
+	if err := models.ValidatePermissions(req.Permissions); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	granted := middleware.Permissions(c)
+	if !models.CoversPermissions(granted, role.Permissions) || !models.CoversPermissions(granted, req.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能修改或授予超出自身权限的角色"})
+		return
+	}
+
+	updated, err := h.roleService.Update(role.ID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete 删除角色，内置角色和仍有用户使用的角色不能删除
+func (h *RoleHandler) Delete(c *gin.Context) {
+	role, ok := h.role(c)
+	if !ok {
+		return
+	}
+	if !models.CoversPermissions(middleware.Permissions(c), role.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能删除超出自身权限的角色"})
+		return
+	}
+
+	if err := h.roleService.Delete(role.ID); err != nil {
+		switch err {
+		case models.ErrBuiltinRole, models.ErrRoleInUse:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "角色已删除"})
+}
+
+// role 按路径参数获取角色，失败时已写入响应
+func (h *RoleHandler) role(c *gin.Context) (*models.Role, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色ID"})
+		return nil, false
+	}
+
+	role, err := h.roleService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "角色不存在"})
+		return nil, false
+	}
+	return role, true
+}
+
+// checkAssignableRole 检查角色存在且操作者拥有该角色的全部权限，防止通过分配角色提升权限，失败时已写入响应
+func checkAssignableRole(c *gin.Context, roleService *models.RoleService, name string) bool {
+	role, err := roleService.GetByName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不存在: " + name})
+		return false
+	}
+	if !models.CoversPermissions(middleware.Permissions(c), role.Permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能分配超出自身权限的角色: " + name})
+		return false
+	}
+	return true
+}
+
+// checkManageableUser 检查操作者拥有目标用户角色的全部权限，权限较低者不能修改或删除权限较高的用户，失败时已写入响应
+func checkManageableUser(c *gin.Context, roleService *models.RoleService, user *models.User) bool {
+	permissions, err := roleService.Permissions(user.Role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !models.CoversPermissions(middleware.Permissions(c), permissions) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不能管理权限高于自己的用户"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// samlStateCookie 发起登录的浏览器标记，断言消费时与 RelayState 比对，防止登录 CSRF
+const samlStateCookie = "vj_saml_state"
+
+// SAMLHandler SAML 2.0 单点登录处理器
+type SAMLHandler struct {
+	samlService  *services.SAMLService
+	loginCodes   *services.LoginCodeStore
+	auditService *services.AuditService
+}
+
+// NewSAMLHandler 创建 SAML 单点登录处理器
+func NewSAMLHandler(samlService *services.SAMLService, loginCodes *services.LoginCodeStore, auditService *services.AuditService) *SAMLHandler {
+	return &SAMLHandler{
+		samlService:  samlService,
+		loginCodes:   loginCodes,
+		auditService: auditService,
+	}
+}
+
+// Metadata 输出 SP 元数据，供 IdP 导入
+func (h *SAMLHandler) Metadata(c *gin.Context) {
+	metadata, err := h.samlService.Metadata()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/samlmetadata+xml", metadata)
+}
+
+// Login 生成签名的认证请求并跳转到 IdP
+func (h *SAMLHandler) Login(c *gin.Context) {
+	redirectURL, relayState, err := h.samlService.Begin()
+	if err != nil {
+		log.Printf("Failed to start SAML login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.setStateCookie(c, relayState, 600)
+	c.Redirect(http.StatusFound, redirectURL)
+}
+
+// ACS 断言消费地址，校验 IdP 以 HTTP-POST 绑定提交的响应，登录成功后把一次性登录码通过 URL 片段交给前端
+func (h *SAMLHandler) ACS(c *gin.Context) {
+	relayState := c.PostForm("RelayState")
+	cookieState, _ := c.Cookie(samlStateCookie)
+	h.setStateCookie(c, "", -1)
+
+	if relayState == "" || cookieState != relayState {
+		h.finishWithError(c, services.ErrInvalidSAMLState)
+		return
+	}
+
+	result, err := h.samlService.Complete(relayState, c.PostForm("SAMLResponse"), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		h.finishWithError(c, err)
+		return
+	}
+
+	code, err := h.loginCodes.Issue(result.Response)
+	if err != nil {
+		h.finishWithError(c, err)
+		return
+	}
+
+	logSSOLogin(h.auditService, c, "saml", models.AuthSourceSAML, result.Response.User.Username, result.Response.User.ID, map[string]interface{}{
+		"groups": result.Identity.Groups,
+	}, nil)
+	ssoFinish(c, code)
+}
+
+// finishWithError 记录失败并跳转回登录页展示错误
+func (h *SAMLHandler) finishWithError(c *gin.Context, loginErr error) {
+	log.Printf("SAML login failed: %v", loginErr)
+	logSSOLogin(h.auditService, c, "saml", models.AuthSourceSAML, "", 0, nil, loginErr)
+	ssoFinishWithError(c, loginErr)
+}
+
+// setStateCookie 设置或清除 RelayState Cookie
+// IdP 以跨站 POST 提交断言，SameSite=Lax 的 Cookie 不会随之发送，因此使用 SameSite=None，浏览器要求此时必须为 Secure
+func (h *SAMLHandler) setStateCookie(c *gin.Context, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(samlStateCookie, state, maxAge, "/api/v1/auth/saml", "", true, true)
+}
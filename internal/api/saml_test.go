@@ -0,0 +1,361 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database"
+	"very-jump/internal/services"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+)
+
+// fakeIdP 进程内的 SAML 身份提供方，签名密钥在本地生成，元数据写入临时文件
+type fakeIdP struct {
+	t            *testing.T
+	idp          *saml.IdentityProvider
+	metadataFile string
+	sp           *saml.EntityDescriptor
+
+	rogue        *saml.IdentityProvider // 非空时用其他密钥签名响应
+	unsigned     bool                   // 响应和断言都不签名
+	unsolicited  bool                   // 不关联认证请求（IdP 发起的登录）
+	responseFrom string                 // 非空时改为回应该地址中的认证请求
+}
+
+// newTestIdentityProvider 生成 RSA 密钥和自签名证书的 IdP
+func newTestIdentityProvider(t *testing.T) *saml.IdentityProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	metadataURL, _ := url.Parse("https://idp.example.com/metadata")
+	ssoURL, _ := url.Parse("https://idp.example.com/sso")
+	return &saml.IdentityProvider{Key: key, Certificate: cert, MetadataURL: *metadataURL, SSOURL: *ssoURL}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	f := &fakeIdP{t: t, idp: newTestIdentityProvider(t)}
+	f.idp.ServiceProviderProvider = f
+
+	metadata, err := xml.Marshal(f.idp.Metadata())
+	if err != nil {
+		t.Fatalf("marshal idp metadata: %v", err)
+	}
+	f.metadataFile = filepath.Join(t.TempDir(), "idp-metadata.xml")
+	if err := os.WriteFile(f.metadataFile, metadata, 0600); err != nil {
+		t.Fatalf("write idp metadata: %v", err)
+	}
+	return f
+}
+
+// GetServiceProvider 返回导入的 SP 元数据
+func (f *fakeIdP) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if f.sp == nil || f.sp.EntityID != serviceProviderID {
+		return nil, os.ErrNotExist
+	}
+	return f.sp, nil
+}
+
+// respond 模拟用户在 IdP 完成登录，回应跳转地址中的认证请求，返回提交到断言消费地址的表单
+func (f *fakeIdP) respond(location, nameID string, groups ...string) url.Values {
+	f.t.Helper()
+	requestLocation := location
+	if f.responseFrom != "" {
+		requestLocation = f.responseFrom
+	}
+	req, err := saml.NewIdpAuthnRequest(f.idp, httptest.NewRequest(http.MethodGet, requestLocation, nil))
+	if err != nil {
+		f.t.Fatalf("parse authn request: %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		f.t.Fatalf("validate authn request: %v", err)
+	}
+	if f.unsolicited {
+		req.Request.ID = ""
+	}
+	if f.rogue != nil {
+		req.IDP = f.rogue
+	}
+
+	attribute := saml.Attribute{Name: "groups"}
+	for _, group := range groups {
+		attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: group})
+	}
+	session := &saml.Session{NameID: nameID, CreateTime: time.Now(), CustomAttributes: []saml.Attribute{attribute}}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		f.t.Fatalf("make assertion: %v", err)
+	}
+
+	var raw []byte
+	if f.unsigned {
+		raw, err = xml.Marshal(&saml.Response{
+			ID:           "id-unsigned",
+			InResponseTo: req.Request.ID,
+			Version:      "2.0",
+			IssueInstant: req.Now,
+			Destination:  req.ACSEndpoint.Location,
+			Issuer:       &saml.Issuer{Value: f.idp.MetadataURL.String()},
+			Status:       saml.Status{StatusCode: saml.StatusCode{Value: saml.StatusSuccess}},
+			Assertion:    req.Assertion,
+		})
+		if err != nil {
+			f.t.Fatalf("marshal unsigned response: %v", err)
+		}
+	} else {
+		form, err := req.PostBinding()
+		if err != nil {
+			f.t.Fatalf("make response: %v", err)
+		}
+		if raw, err = base64.StdEncoding.DecodeString(form.SAMLResponse); err != nil {
+			f.t.Fatalf("decode response: %v", err)
+		}
+	}
+
+	parsed, err := url.Parse(location)
+	if err != nil {
+		f.t.Fatalf("parse location: %v", err)
+	}
+	return url.Values{
+		"SAMLResponse": {base64.StdEncoding.EncodeToString(raw)},
+		"RelayState":   {parsed.Query().Get("RelayState")},
+	}
+}
+
+// newSAMLTestRouter 注册了 SAML 登录、断言消费地址和登录码换取接口的路由，并把 SP 元数据导入 IdP
+func newSAMLTestRouter(t *testing.T, idp *fakeIdP) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dataDir := t.TempDir()
+	db, err := database.Init(filepath.Join(dataDir, "test.db"))
+	if err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authService := services.NewAuthService(&config.Config{
+		JWTSecret:          "test-secret",
+		JWTExpiry:          time.Hour,
+		RefreshTokenExpiry: time.Hour,
+	}, db)
+	samlService, err := services.NewSAMLService(services.SAMLConfig{
+		DisplayName:     "Corp SAML",
+		RootURL:         "https://jump.example.com",
+		IDPMetadataFile: idp.metadataFile,
+		GroupsAttribute: "groups",
+		AdminGroups:     []string{"admins"},
+		UserGroups:      []string{"developers"},
+		Provision:       true,
+	}, dataDir, authService)
+	if err != nil {
+		t.Fatalf("create saml service: %v", err)
+	}
+
+	metadata, err := samlService.Metadata()
+	if err != nil {
+		t.Fatalf("sp metadata: %v", err)
+	}
+	idp.sp = &saml.EntityDescriptor{}
+	if err := xml.Unmarshal(metadata, idp.sp); err != nil {
+		t.Fatalf("parse sp metadata: %v", err)
+	}
+
+	loginCodes := services.NewLoginCodeStore()
+	samlHandler := NewSAMLHandler(samlService, loginCodes, nil)
+	ssoHandler := NewSSOHandler(nil, samlService, loginCodes)
+
+	router := gin.New()
+	router.GET("/api/v1/auth/saml/login", samlHandler.Login)
+	router.POST("/api/v1/auth/saml/acs", samlHandler.ACS)
+	router.POST("/api/v1/auth/sso/exchange", ssoHandler.Exchange)
+	return router
+}
+
+// beginSAMLLogin 发起登录，返回跳转到 IdP 的地址和 RelayState Cookie
+func beginSAMLLogin(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/saml/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d, body = %s", w.Code, w.Body.String())
+	}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == samlStateCookie {
+			return w.Header().Get("Location"), cookie
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return "", nil
+}
+
+// postACS 以浏览器身份把 IdP 的响应提交到断言消费地址，返回跳转后的登录页片段参数
+func postACS(t *testing.T, router *gin.Engine, form url.Values, cookie *http.Cookie) url.Values {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/saml/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		t.Fatalf("acs status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	location := w.Header().Get("Location")
+	values, err := url.ParseQuery(location[strings.Index(location, "#")+1:])
+	if err != nil {
+		t.Fatalf("parse acs redirect %q: %v", location, err)
+	}
+	return values
+}
+
+func TestSAMLLoginMapsGroupsToRole(t *testing.T) {
+	idp := newFakeIdP(t)
+	router := newSAMLTestRouter(t, idp)
+
+	location, cookie := beginSAMLLogin(t, router)
+	if !strings.HasPrefix(location, idp.idp.SSOURL.String()) || cookie.Value == "" || !cookie.HttpOnly || !cookie.Secure {
+		t.Fatalf("login redirect %q, cookie %+v", location, cookie)
+	}
+	form := idp.respond(location, "Alice", "admins")
+	result := postACS(t, router, form, cookie)
+	if result.Get("sso_code") == "" {
+		t.Fatalf("acs redirect = %v, want sso_code", result)
+	}
+
+	w := exchange(router, result.Get("sso_code"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exchange status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"username":"alice"`) || !strings.Contains(w.Body.String(), `"role":"admin"`) {
+		t.Errorf("exchange response = %s, want admin alice", w.Body.String())
+	}
+
+	// RelayState 已被消费，重放同一响应不能再次登录
+	if replay := postACS(t, router, form, cookie); replay.Get("sso_code") != "" || replay.Get("sso_error") != services.ErrInvalidSAMLState.Error() {
+		t.Errorf("replayed response = %v, want invalid state error", replay)
+	}
+}
+
+func TestSAMLACSRejectsRelayStateCookieMismatch(t *testing.T) {
+	idp := newFakeIdP(t)
+	router := newSAMLTestRouter(t, idp)
+
+	location, cookie := beginSAMLLogin(t, router)
+	form := idp.respond(location, "alice", "developers")
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"missing cookie", nil},
+		{"other browser's state", &http.Cookie{Name: samlStateCookie, Value: "attacker-state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := postACS(t, router, form, tt.cookie)
+			if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrInvalidSAMLState.Error() {
+				t.Errorf("acs redirect = %v, want invalid state error", result)
+			}
+		})
+	}
+
+	// Cookie 不匹配时 RelayState 未被消费，原浏览器仍可完成登录
+	if result := postACS(t, router, form, cookie); result.Get("sso_code") == "" {
+		t.Errorf("acs with matching cookie = %v, want sso_code", result)
+	}
+}
+
+func TestSAMLACSRequiresMatchingInResponseTo(t *testing.T) {
+	idp := newFakeIdP(t)
+	router := newSAMLTestRouter(t, idp)
+
+	// 响应属于登录请求 A，却通过登录请求 B 的 RelayState 提交
+	locationA, _ := beginSAMLLogin(t, router)
+	locationB, cookieB := beginSAMLLogin(t, router)
+	idp.responseFrom = locationA
+	result := postACS(t, router, idp.respond(locationB, "alice", "developers"), cookieB)
+	if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrInvalidSAMLResponse.Error() {
+		t.Errorf("response to another request = %v, want invalid response error", result)
+	}
+
+	// IdP 发起、不关联任何认证请求的响应
+	idp.responseFrom = ""
+	idp.unsolicited = true
+	locationC, cookieC := beginSAMLLogin(t, router)
+	result = postACS(t, router, idp.respond(locationC, "alice", "developers"), cookieC)
+	if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrInvalidSAMLResponse.Error() {
+		t.Errorf("unsolicited response = %v, want invalid response error", result)
+	}
+}
+
+func TestSAMLACSRejectsUnsignedAndForgedResponses(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(idp *fakeIdP)
+	}{
+		{"unsigned", func(idp *fakeIdP) { idp.unsigned = true }},
+		{"signed with another key", func(idp *fakeIdP) {
+			rogue := newTestIdentityProvider(t)
+			rogue.ServiceProviderProvider = idp
+			idp.rogue = rogue
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newFakeIdP(t)
+			router := newSAMLTestRouter(t, idp)
+			tt.setup(idp)
+
+			location, cookie := beginSAMLLogin(t, router)
+			result := postACS(t, router, idp.respond(location, "alice", "admins"), cookie)
+			if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrInvalidSAMLResponse.Error() {
+				t.Errorf("acs redirect = %v, want invalid response error", result)
+			}
+		})
+	}
+}
+
+func TestSAMLACSRejectsDisallowedGroups(t *testing.T) {
+	idp := newFakeIdP(t)
+	router := newSAMLTestRouter(t, idp)
+
+	location, cookie := beginSAMLLogin(t, router)
+	result := postACS(t, router, idp.respond(location, "mallory", "contractors"), cookie)
+	if result.Get("sso_code") != "" || result.Get("sso_error") != services.ErrSAMLAccessDenied.Error() {
+		t.Errorf("acs redirect = %v, want access denied error", result)
+	}
+}
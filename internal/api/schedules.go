@@ -0,0 +1,203 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScheduleHandler 访问时间窗口处理器
+type ScheduleHandler struct {
+	scheduleService *models.ScheduleService
+	serverService   *models.ServerService
+	groupService    *models.GroupService
+	grantService    *models.AccessGrantService
+}
+
+// NewScheduleHandler 创建访问时间窗口处理器
+func NewScheduleHandler(scheduleService *models.ScheduleService, serverService *models.ServerService,
+	groupService *models.GroupService, grantService *models.AccessGrantService) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: scheduleService,
+		serverService:   serverService,
+		groupService:    groupService,
+		grantService:    grantService,
+	}
+}
+
+// List 获取全部时间窗口
+func (h *ScheduleHandler) List(c *gin.Context) {
+	schedules, err := h.scheduleService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules, "total": len(schedules)})
+}
+
+// Create 创建时间窗口
+func (h *ScheduleHandler) Create(c *gin.Context) {
+	var req models.ScheduleCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Timezone = strings.TrimSpace(req.Timezone)
+
+	schedule, err := h.scheduleService.Create(&req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// Get 获取时间窗口及其绑定
+func (h *ScheduleHandler) Get(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	bindings, err := h.scheduleService.ListBindings(schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"schedule": schedule, "bindings": bindings})
+}
+
+// Update 更新时间窗口
+func (h *ScheduleHandler) Update(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	var req models.ScheduleUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Timezone = strings.TrimSpace(req.Timezone)
+
+	updated, err := h.scheduleService.Update(schedule.ID, &req)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete 删除时间窗口，仍有绑定时拒绝
+func (h *ScheduleHandler) Delete(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	if err := h.scheduleService.Delete(schedule.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "时间窗口已删除"})
+}
+
+// ListBindings 获取时间窗口的绑定
+func (h *ScheduleHandler) ListBindings(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	bindings, err := h.scheduleService.ListBindings(schedule.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bindings": bindings, "total": len(bindings)})
+}
+
+// Bind 将时间窗口绑定到服务器、用户组或授权，对象原有的绑定会被替换
+func (h *ScheduleHandler) Bind(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	var req models.ScheduleBindingCreate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var err error
+	switch req.TargetType {
+	case models.ScheduleTargetServer:
+		_, err = h.serverService.GetByID(req.TargetID)
+	case models.ScheduleTargetGroup:
+		_, err = h.groupService.GetByID(req.TargetID)
+	case models.ScheduleTargetGrant:
+		_, err = h.grantService.GetByID(req.TargetID)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "绑定对象不存在"})
+		return
+	}
+
+	binding, err := h.scheduleService.Bind(schedule.ID, &req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, binding)
+}
+
+// Unbind 删除绑定
+func (h *ScheduleHandler) Unbind(c *gin.Context) {
+	schedule, ok := h.schedule(c)
+	if !ok {
+		return
+	}
+	bindingID, err := strconv.Atoi(c.Param("binding_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的绑定ID"})
+		return
+	}
+	binding, err := h.scheduleService.GetBinding(bindingID)
+	if err != nil || binding.ScheduleID != schedule.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "绑定不存在"})
+		return
+	}
+	if err := h.scheduleService.Unbind(bindingID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "绑定已删除"})
+}
+
+// writeError 名称重复返回 409，仍有绑定和校验失败返回 400
+func (h *ScheduleHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case isUniqueViolation(err):
+		c.JSON(http.StatusConflict, gin.H{"error": "时间窗口名称已存在"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// schedule 按路径参数获取时间窗口，失败时已写入响应
+func (h *ScheduleHandler) schedule(c *gin.Context) (*models.Schedule, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时间窗口ID"})
+		return nil, false
+	}
+	schedule, err := h.scheduleService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "时间窗口不存在"})
+		return nil, false
+	}
+	return schedule, true
+}
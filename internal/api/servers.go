@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,7 +23,6 @@ func NewServerHandler(serverService *models.ServerService) *ServerHandler {
 // List 获取服务器列表
 func (h *ServerHandler) List(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	limit := 20
 	offset := 0
@@ -42,8 +42,8 @@ func (h *ServerHandler) List(c *gin.Context) {
 	var servers []*models.Server
 	var err error
 
-	// 管理员可以看到所有服务器，普通用户只能看到有权限的服务器
-	if role == "admin" {
+	// 拥有 servers.read 权限可以看到所有服务器，其他用户只能看到被授权的服务器
+	if middleware.HasPermission(c, models.PermissionServersRead) {
 		servers, err = h.serverService.List(limit, offset)
 	} else {
 		servers, err = h.serverService.GetByUserID(userID.(int), limit, offset)
@@ -91,6 +91,16 @@ func (h *ServerHandler) Get(c *gin.Context) {
 		return
 	}
 
+	// 没有 servers.read 权限只能查看被授权的服务器
+	if !middleware.HasPermission(c, models.PermissionServersRead) {
+		userID, _ := c.Get("user_id")
+		allowed, err := h.serverService.UserCanAccess(userID.(int), id)
+		if err != nil || !allowed {
+			c.JSON(http.StatusNotFound, gin.H{"error": "服务器不存在"})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, server)
 }
 
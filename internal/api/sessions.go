@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
 	"very-jump/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -41,7 +42,6 @@ func NewSessionHandler(sessionService *models.SessionService, recordingsDir stri
 // List 获取会话列表
 func (h *SessionHandler) List(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	limit := 20
 	offset := 0
@@ -61,8 +61,8 @@ func (h *SessionHandler) List(c *gin.Context) {
 	var sessions []*models.Session
 	var err error
 
-	// 管理员可以看到所有会话，普通用户只能看到自己的会话
-	if role == "admin" {
+	// 拥有 sessions.read 权限可以看到所有会话，其他用户只能看到自己的会话
+	if middleware.HasPermission(c, models.PermissionSessionsRead) {
 		sessions, err = h.sessionService.List(limit, offset)
 	} else {
 		sessions, err = h.sessionService.GetByUserID(userID.(int), limit, offset)
@@ -83,7 +83,6 @@ func (h *SessionHandler) List(c *gin.Context) {
 func (h *SessionHandler) Get(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	session, err := h.sessionService.GetByID(id)
 	if err != nil {
@@ -91,8 +90,8 @@ func (h *SessionHandler) Get(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能查看自己的会话
-	if role != "admin" && session.UserID != userID.(int) {
+	// 没有 sessions.read 权限只能查看自己的会话
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) && session.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看该会话"})
 		return
 	}
@@ -104,7 +103,6 @@ func (h *SessionHandler) Get(c *gin.Context) {
 func (h *SessionHandler) Close(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	session, err := h.sessionService.GetByID(id)
 	if err != nil {
@@ -112,8 +110,8 @@ func (h *SessionHandler) Close(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能关闭自己的会话
-	if role != "admin" && session.UserID != userID.(int) {
+	// 没有 sessions.write 权限只能关闭自己的会话
+	if !middleware.HasPermission(c, models.PermissionSessionsWrite) && session.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限关闭该会话"})
 		return
 	}
@@ -143,7 +141,6 @@ func (h *SessionHandler) GetActiveSessions(c *gin.Context) {
 func (h *SessionHandler) Replay(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	// 获取会话信息
 	session, err := h.sessionService.GetByID(id)
@@ -152,8 +149,8 @@ func (h *SessionHandler) Replay(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能回放自己的会话
-	if role != "admin" && session.UserID != userID.(int) {
+	// 没有 sessions.read 权限只能回放自己的会话
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) && session.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限回放该会话"})
 		return
 	}
@@ -195,7 +192,6 @@ func (h *SessionHandler) Replay(c *gin.Context) {
 func (h *SessionHandler) GetReplayInfo(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	// 获取会话信息
 	session, err := h.sessionService.GetByID(id)
@@ -204,8 +200,8 @@ func (h *SessionHandler) GetReplayInfo(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能查看自己的会话回放信息
-	if role != "admin" && session.UserID != userID.(int) {
+	// 没有 sessions.read 权限只能查看自己的会话回放信息
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) && session.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限查看该会话"})
 		return
 	}
@@ -229,12 +225,10 @@ func (h *SessionHandler) GetReplayInfo(c *gin.Context) {
 	})
 }
 
-// GetRecordingsStats 获取录制文件统计信息 (管理员)
+// GetRecordingsStats 获取录制文件统计信息
 func (h *SessionHandler) GetRecordingsStats(c *gin.Context) {
-	role, _ := c.Get("role")
-
-	// 只有管理员可以查看录制文件统计
-	if role != "admin" {
+	// 需要 sessions.read 权限
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问录制文件统计"})
 		return
 	}
@@ -257,12 +251,10 @@ func (h *SessionHandler) GetRecordingsStats(c *gin.Context) {
 	})
 }
 
-// CleanupOldRecordings 清理旧录制文件 (管理员)
+// CleanupOldRecordings 清理旧录制文件
 func (h *SessionHandler) CleanupOldRecordings(c *gin.Context) {
-	role, _ := c.Get("role")
-
-	// 只有管理员可以清理录制文件
-	if role != "admin" {
+	// 需要 sessions.write 权限
+	if !middleware.HasPermission(c, models.PermissionSessionsWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限清理录制文件"})
 		return
 	}
@@ -292,7 +284,6 @@ func (h *SessionHandler) CleanupOldRecordings(c *gin.Context) {
 func (h *SessionHandler) Heartbeat(c *gin.Context) {
 	id := c.Param("id")
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	// 获取会话信息进行权限检查
 	session, err := h.sessionService.GetByID(id)
@@ -301,8 +292,8 @@ func (h *SessionHandler) Heartbeat(c *gin.Context) {
 		return
 	}
 
-	// 非管理员只能更新自己的会话心跳
-	if role != "admin" && session.UserID != userID.(int) {
+	// 没有 sessions.write 权限只能更新自己的会话心跳
+	if !middleware.HasPermission(c, models.PermissionSessionsWrite) && session.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限更新该会话"})
 		return
 	}
@@ -322,12 +313,10 @@ func (h *SessionHandler) Heartbeat(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "心跳更新成功"})
 }
 
-// CleanupStaleSessions 清理超时会话 (管理员)
+// CleanupStaleSessions 清理超时会话
 func (h *SessionHandler) CleanupStaleSessions(c *gin.Context) {
-	role, _ := c.Get("role")
-
-	// 只有管理员可以手动清理会话
-	if role != "admin" {
+	// 需要 sessions.write 权限
+	if !middleware.HasPermission(c, models.PermissionSessionsWrite) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限清理会话"})
 		return
 	}
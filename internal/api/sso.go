@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSOHandler 单点登录公共接口：登录页展示的身份源列表，以及用一次性登录码换取令牌
+type SSOHandler struct {
+	oidcService *services.OIDCService
+	samlService *services.SAMLService // 未启用 SAML 时为 nil
+	loginCodes  *services.LoginCodeStore
+}
+
+// NewSSOHandler 创建单点登录公共处理器
+func NewSSOHandler(oidcService *services.OIDCService, samlService *services.SAMLService, loginCodes *services.LoginCodeStore) *SSOHandler {
+	return &SSOHandler{
+		oidcService: oidcService,
+		samlService: samlService,
+		loginCodes:  loginCodes,
+	}
+}
+
+// Providers 获取可用于登录的身份源，供登录页展示
+func (h *SSOHandler) Providers(c *gin.Context) {
+	providers, err := h.oidcService.GetProviderService().ListEnabled()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(providers)+1)
+	for _, provider := range providers {
+		response = append(response, gin.H{
+			"name":         provider.Name,
+			"type":         "oidc",
+			"display_name": provider.DisplayName,
+			"login_url":    fmt.Sprintf("/api/v1/auth/oidc/%s/login", provider.Name),
+		})
+	}
+	if h.samlService != nil {
+		response = append(response, gin.H{
+			"name":         models.AuthSourceSAML,
+			"type":         "saml",
+			"display_name": h.samlService.DisplayName(),
+			"login_url":    "/api/v1/auth/saml/login",
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"providers": response})
+}
+
+// ExchangeRequest 登录码换取令牌请求
+type ExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Exchange 用一次性登录码换取访问令牌和刷新令牌
+func (h *SSOHandler) Exchange(c *gin.Context) {
+	var req ExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp, err := h.loginCodes.Redeem(req.Code)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ssoFinish 登录成功后把一次性登录码通过 URL 片段交给前端
+func ssoFinish(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, "/login#sso_code="+url.QueryEscape(code))
+}
+
+// ssoFinishWithError 跳转回登录页展示错误
+func ssoFinishWithError(c *gin.Context, loginErr error) {
+	c.Redirect(http.StatusFound, "/login#sso_error="+url.QueryEscape(loginErr.Error()))
+}
+
+// requestIsSecure 请求是否经由 HTTPS 到达（含反向代理）
+func requestIsSecure(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// logSSOLogin 记录单点登录审计日志
+func logSSOLogin(auditService *services.AuditService, c *gin.Context, method, provider, username string, userID int, extra map[string]interface{}, loginErr error) {
+	if auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"username": username,
+		"provider": provider,
+		"method":   method,
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	if loginErr != nil {
+		details["reason"] = loginErr.Error()
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       userID,
+		Action:       "login",
+		ResourceType: "user",
+		ResourceID:   username,
+		Details:      string(detailsJSON),
+		IPAddress:    c.ClientIP(),
+		UserAgent:    c.GetHeader("User-Agent"),
+		Success:      loginErr == nil,
+	}
+	if err := auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s login: %v", method, err)
+	}
+
+	if loginErr == nil {
+		auditService.ObserveLogin(context.Background(), userID, entry.IPAddress)
+	}
+}
@@ -1,15 +1,21 @@
 package api
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
 	"very-jump/internal/services"
 
 	"github.com/gin-gonic/gin"
@@ -20,14 +26,28 @@ import (
 type TerminalHandler struct {
 	ttydService   *services.TTYDService
 	serverService *models.ServerService
+	ticketService *services.TerminalTicketService
+	windowService *services.AccessWindowService
+	requirements  *models.ConnectRequirementService
+	breakGlass    *services.BreakGlassManager
+	policies      *services.ConnectPolicyEngine
+	ticketPattern *regexp.Regexp
 	upgrader      websocket.Upgrader
 }
 
 // NewTerminalHandler 创建终端处理器
-func NewTerminalHandler(ttydService *services.TTYDService, serverService *models.ServerService) *TerminalHandler {
+func NewTerminalHandler(ttydService *services.TTYDService, serverService *models.ServerService, ticketService *services.TerminalTicketService,
+	windowService *services.AccessWindowService, requirements *models.ConnectRequirementService, breakGlass *services.BreakGlassManager,
+	policies *services.ConnectPolicyEngine, ticketPattern *regexp.Regexp) *TerminalHandler {
 	return &TerminalHandler{
 		ttydService:   ttydService,
 		serverService: serverService,
+		ticketService: ticketService,
+		windowService: windowService,
+		requirements:  requirements,
+		breakGlass:    breakGlass,
+		policies:      policies,
+		ticketPattern: ticketPattern,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // 允许所有来源，生产环境应该更严格
@@ -36,13 +56,31 @@ func NewTerminalHandler(ttydService *services.TTYDService, serverService *models
 	}
 }
 
+// StartTerminalRequest 启动终端请求，请求体可选
+type StartTerminalRequest struct {
+	Reason   string `json:"reason" binding:"max=500"`    // 连接原因，服务器或其标签要求时必填
+	TicketID string `json:"ticket_id" binding:"max=100"` // 工单号，服务器或其标签要求时必填
+	Override bool   `json:"override"`                    // 在访问时间窗口外强制连接，需要 access.override 权限和原因
+}
+
 // StartTerminalResponse 启动终端响应
 type StartTerminalResponse struct {
-	SessionID string `json:"session_id"`
-	Port      int    `json:"port"`
-	URL       string `json:"url"`
+	SessionID       string    `json:"session_id"`
+	Port            int       `json:"port"`
+	URL             string    `json:"url"`
+	TicketExpiresAt time.Time `json:"ticket_expires_at"`
 }
 
+// TerminalTicketResponse 终端票据响应
+type TerminalTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+	URL       string    `json:"url"`
+}
+
+// terminalGrantCookiePrefix 终端访问凭证 Cookie 名前缀，每个终端会话一个 Cookie
+const terminalGrantCookiePrefix = "vj_term_"
+
 // StartTerminal 启动终端会话
 func (h *TerminalHandler) StartTerminal(c *gin.Context) {
 	serverID, err := strconv.Atoi(c.Param("server_id"))
@@ -51,9 +89,16 @@ func (h *TerminalHandler) StartTerminal(c *gin.Context) {
 		return
 	}
 
+	var req StartTerminalRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.TicketID = strings.TrimSpace(req.TicketID)
+
 	userID, _ := c.Get("user_id")
 	username, _ := c.Get("username")
-	role, _ := c.Get("role")
 
 	server, err := h.serverService.GetByID(serverID)
 	if err != nil {
@@ -61,22 +106,116 @@ func (h *TerminalHandler) StartTerminal(c *gin.Context) {
 		return
 	}
 
-	if role != "admin" {
-		hasPermission, err := h.checkUserServerPermission(userID.(int), serverID, c)
+	connectAll := middleware.HasPermission(c, models.PermissionServersConnect)
+	if !connectAll {
+		hasPermission, err := h.checkUserServerPermission(userID.(int), serverID)
 		if err != nil || !hasPermission {
 			c.JSON(http.StatusForbidden, gin.H{"error": "没有访问该服务器的权限"})
 			return
 		}
 	}
 
+	requirements, err := h.requirements.ForServer(serverID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查连接要求失败"})
+		return
+	}
+	// 紧急访问期间发起时填写的原因满足连接原因要求，工单系统可能同样不可用，不再强制工单号
+	breakGlass, err := h.breakGlass.Active(userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查紧急访问失败"})
+		return
+	}
+	if breakGlass != nil {
+		if req.Reason == "" {
+			req.Reason = breakGlass.Justification
+		}
+		requirements.RequireTicket = false
+	}
+	if requirements.RequireReason && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "连接该服务器需要填写原因", "require_reason": true, "require_ticket": requirements.RequireTicket})
+		return
+	}
+	if requirements.RequireTicket && req.TicketID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "连接该服务器需要填写工单号", "require_reason": requirements.RequireReason, "require_ticket": true})
+		return
+	}
+	if req.TicketID != "" && !h.ticketPattern.MatchString(req.TicketID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "工单号格式不正确", "ticket_pattern": h.ticketPattern.String()})
+		return
+	}
+	// 敏感服务器需要近期完成二次认证，API 令牌无法满足
+	if requirements.RequireStepUp && !middleware.SteppedUp(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "连接该服务器需要重新验证身份", "code": middleware.StepUpRequiredCode})
+		return
+	}
+
+	window, err := h.windowService.Check(userID.(int), serverID, connectAll, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查访问时间窗口失败"})
+		return
+	}
+	override := false
+	if !window.Allowed {
+		if !req.Override {
+			response := gin.H{"error": "当前不在访问时间窗口内", "reason": window.Reason}
+			if !window.NextOpen.IsZero() {
+				response["next_open"] = window.NextOpen
+			}
+			c.JSON(http.StatusForbidden, response)
+			return
+		}
+		if !middleware.HasPermission(c, models.PermissionAccessOverride) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有在时间窗口外强制连接的权限"})
+			return
+		}
+		if req.Reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "强制连接需要填写原因"})
+			return
+		}
+		override = true
+	}
+
 	ipAddress := c.ClientIP()
 	userAgent := c.GetHeader("User-Agent")
+	justification := models.SessionJustification{Reason: req.Reason, TicketID: req.TicketID}
+	if breakGlass != nil {
+		justification.BreakGlassID = breakGlass.ID
+	}
 
-	process, err := h.ttydService.StartTTYDSessionWithAudit(server, userID.(int), username.(string), ipAddress, userAgent)
+	// 连接策略在其他检查通过后求值，决定随会话记录
+	input, err := h.policies.Input(userID.(int), server, ipAddress, time.Now(), justification)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查连接策略失败"})
+		return
+	}
+	decision, err := h.policies.Decide(input)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检查连接策略失败"})
+		return
+	}
+	if !services.Permitted(decision) {
+		if decision.Decision == models.PolicyEffectRequireApproval {
+			c.JSON(http.StatusForbidden, gin.H{"error": "连接该服务器需要已批准的临时访问申请", "code": "approval_required", "policies": decision.Matched})
+			return
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "连接策略不允许该连接", "code": "policy_denied", "policies": decision.Matched})
+		return
+	}
+	justification.Policy = decision
+
+	process, err := h.ttydService.StartTTYDSessionWithAudit(server, userID.(int), username.(string), ipAddress, userAgent,
+		justification)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("启动终端失败: %v", err)})
 		return
 	}
+	if override {
+		h.windowService.Override(process, window, req.Reason)
+	}
+	if breakGlass != nil {
+		h.breakGlass.SessionStarted(breakGlass, process, ipAddress)
+	}
 
 	// 更新服务器上次登录时间
 	if err := h.serverService.UpdateLastLoginTime(serverID); err != nil {
@@ -84,17 +223,108 @@ func (h *TerminalHandler) StartTerminal(c *gin.Context) {
 		// 不影响主流程，只记录错误
 	}
 
-	url := fmt.Sprintf("/proxy-terminal/?session_id=%s", process.SessionID)
+	ticket, expiresAt, err := h.ticketService.Issue(userID.(int), username.(string), c.GetString("session_id"), process.SessionID, ipAddress)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成终端票据失败"})
+		return
+	}
 
 	response := StartTerminalResponse{
-		SessionID: process.SessionID,
-		Port:      process.Port,
-		URL:       url,
+		SessionID:       process.SessionID,
+		Port:            process.Port,
+		URL:             terminalURL(process.SessionID, ticket),
+		TicketExpiresAt: expiresAt,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// IssueTicket 为已有终端会话签发新的一次性票据，用于重新加载终端页面
+// 有 sessions.shadow 权限的用户可以为他人的会话签发票据，接入后只能旁观
+func (h *TerminalHandler) IssueTicket(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "会话ID不能为空"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	username, _ := c.Get("username")
+
+	process, exists := h.ttydService.GetTTYDProcess(sessionID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	if !middleware.HasPermission(c, models.PermissionSessionsShadow) && process.UserID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该会话"})
+		return
+	}
+
+	ticket, expiresAt, err := h.ticketService.Issue(userID.(int), username.(string), c.GetString("session_id"), process.SessionID, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成终端票据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TerminalTicketResponse{
+		Ticket:    ticket,
+		ExpiresAt: expiresAt,
+		URL:       terminalURL(process.SessionID, ticket),
+	})
+}
+
+// terminalURL 终端页面地址
+func terminalURL(sessionID, ticket string) string {
+	query := url.Values{}
+	query.Set("session_id", sessionID)
+	if ticket != "" {
+		query.Set("ticket", ticket)
+	}
+	return "/proxy-terminal/?" + query.Encode()
+}
+
+// terminalGrantCookie 终端访问凭证的 Cookie 名
+func terminalGrantCookie(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return terminalGrantCookiePrefix + hex.EncodeToString(sum[:])[:16]
+}
+
+// authorizeTerminal 校验终端访问凭证，首次访问时兑换URL中的一次性票据并下发凭证 Cookie，返回凭证绑定的身份
+// ttyd 页面后续的 token 和 WebSocket 请求会带上原始查询参数，此时票据已被使用，改为校验 Cookie
+func (h *TerminalHandler) authorizeTerminal(c *gin.Context, sessionID string) (*services.TerminalAccess, bool) {
+	ipAddress := c.ClientIP()
+	cookieName := terminalGrantCookie(sessionID)
+
+	if grant, err := c.Cookie(cookieName); err == nil && grant != "" {
+		if access, err := h.ticketService.Check(grant, sessionID, ipAddress); err == nil {
+			return access, true
+		}
+	}
+
+	ticket := c.Query("ticket")
+	if ticket == "" {
+		return nil, false
+	}
+	grant, access, err := h.ticketService.Redeem(ticket, sessionID, ipAddress)
+	if err != nil {
+		log.Printf("Terminal ticket rejected for session %s from %s: %v", sessionID, ipAddress, err)
+		return nil, false
+	}
+
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     cookieName,
+		Value:    grant,
+		Path:     "/proxy-terminal",
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return access, true
+}
+
 // ProxyToTTYD 代理请求到ttyd，支持录制
 func (h *TerminalHandler) ProxyToTTYD(c *gin.Context) {
 	sessionID := c.Query("session_id")
@@ -109,12 +339,18 @@ func (h *TerminalHandler) ProxyToTTYD(c *gin.Context) {
 		return
 	}
 
+	access, ok := h.authorizeTerminal(c, process.SessionID)
+	if !ok {
+		c.String(http.StatusUnauthorized, "Invalid or expired terminal ticket")
+		return
+	}
+
 	// 构造后端目标 URL
 	targetURL := fmt.Sprintf("http://127.0.0.1:%d", process.Port)
 
 	if c.IsWebsocket() {
 		log.Printf("Handling WebSocket request for session %s", process.SessionID)
-		h.handleWebSocketWithRecording(c, process)
+		h.handleWebSocketWithRecording(c, process, access)
 		return
 	} else {
 		log.Printf("Handling HTTP request for session %s", process.SessionID)
@@ -139,9 +375,10 @@ func (h *TerminalHandler) ProxyToTTYD(c *gin.Context) {
 }
 
 // handleWebSocketWithRecording 处理WebSocket连接并录制数据
-func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *services.TTYDProcess) {
-	log.Printf("WebSocket upgrade attempt for session %s, path: %s, headers: %v",
-		process.SessionID, c.Request.URL.Path, c.Request.Header)
+// 凭证属于会话所有者以外的用户时为旁观接入：只转发终端输出，丢弃输入，并记录审计日志
+func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *services.TTYDProcess, access *services.TerminalAccess) {
+	log.Printf("WebSocket upgrade attempt for session %s, path: %s",
+		process.SessionID, c.Request.URL.Path)
 
 	rheader := http.Header{
 		"sec-websocket-protocol": []string{"tty"},
@@ -173,13 +410,41 @@ func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *
 
 	log.Printf("WebSocket proxy with recording established for session %s", process.SessionID)
 
+	shadow := access.UserID != process.UserID
+	if shadow {
+		h.ttydService.RecordShadowAttach(process, access.UserID, access.Username, c.ClientIP())
+	}
+
 	// 使用channel来同步两个goroutine
 	clientDone := make(chan struct{})
 	ttydDone := make(chan struct{})
 
+	// 终端输出和系统提示都写入客户端连接，WebSocket 不支持并发写
+	var clientWriteMutex sync.Mutex
+	notices, unsubscribe := process.SubscribeNotices()
+	defer unsubscribe()
+	go func() {
+		for {
+			select {
+			case notice := <-notices:
+				clientWriteMutex.Lock()
+				err := clientConn.WriteMessage(websocket.BinaryMessage, []byte(notice))
+				clientWriteMutex.Unlock()
+				if err != nil {
+					return
+				}
+			case <-clientDone:
+				return
+			case <-ttydDone:
+				return
+			}
+		}
+	}()
+
 	// 客户端 -> ttyd (用户输入)
 	go func() {
 		defer close(clientDone)
+		var commandBuffer services.CommandLineBuffer
 		for {
 			messageType, message, err := clientConn.ReadMessage()
 			if err != nil {
@@ -189,6 +454,11 @@ func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *
 				break
 			}
 
+			// 连接策略要求只读或旁观接入时丢弃用户输入（只读会话的 ttyd 启动时也未开启写入），窗口大小调整照常转发
+			if (shadow || process.Justification.ReadOnly()) && len(message) > 0 && message[0] == '0' {
+				continue
+			}
+
 			// 录制用户输入（只录制文本消息）
 
 			if messageType == websocket.BinaryMessage && process.Recorder != nil && process.Recorder.IsRecording() {
@@ -197,6 +467,13 @@ func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *
 				}
 			}
 
+			// 还原用户输入的命令用于审计（ttyd 输入消息以 '0' 开头）；命令进入会话的审计队列按输入顺序写入，不阻塞转发
+			if messageType == websocket.BinaryMessage && len(message) > 1 && message[0] == '0' {
+				for _, command := range commandBuffer.Feed(message[1:]) {
+					h.ttydService.RecordCommand(process, command)
+				}
+			}
+
 			// 转发到ttyd
 			if err := ttydConn.WriteMessage(messageType, message); err != nil {
 				log.Printf("Failed to forward to ttyd: %v", err)
@@ -225,7 +502,10 @@ func (h *TerminalHandler) handleWebSocketWithRecording(c *gin.Context, process *
 			}
 
 			// 转发到客户端
-			if err := clientConn.WriteMessage(messageType, message); err != nil {
+			clientWriteMutex.Lock()
+			err = clientConn.WriteMessage(messageType, message)
+			clientWriteMutex.Unlock()
+			if err != nil {
 				log.Printf("Failed to forward to client: %v", err)
 				break
 			}
@@ -252,7 +532,6 @@ func (h *TerminalHandler) StopTerminal(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	process, exists := h.ttydService.GetTTYDProcess(sessionID)
 	if !exists {
@@ -260,7 +539,7 @@ func (h *TerminalHandler) StopTerminal(c *gin.Context) {
 		return
 	}
 
-	if role != "admin" && process.UserID != userID.(int) {
+	if !middleware.HasPermission(c, models.PermissionSessionsWrite) && process.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限停止该会话"})
 		return
 	}
@@ -269,6 +548,7 @@ func (h *TerminalHandler) StopTerminal(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("停止终端失败: %v", err)})
 		return
 	}
+	h.ticketService.RevokeTerminal(sessionID)
 
 	c.JSON(http.StatusOK, gin.H{"message": "终端会话已停止"})
 }
@@ -282,7 +562,6 @@ func (h *TerminalHandler) GetTerminalInfo(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	process, exists := h.ttydService.GetTTYDProcess(sessionID)
 	if !exists {
@@ -290,17 +569,15 @@ func (h *TerminalHandler) GetTerminalInfo(c *gin.Context) {
 		return
 	}
 
-	if role != "admin" && process.UserID != userID.(int) {
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) && process.UserID != userID.(int) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该会话"})
 		return
 	}
 
-	url := fmt.Sprintf("/proxy-terminal/?session_id=%s", process.SessionID)
-
 	response := gin.H{
 		"session_id": process.SessionID,
 		"port":       process.Port,
-		"url":        url,
+		"url":        terminalURL(process.SessionID, ""),
 		"server_id":  process.ServerID,
 		"username":   process.Username,
 		"created_at": process.CreatedAt.Format(time.RFC3339),
@@ -309,14 +586,64 @@ func (h *TerminalHandler) GetTerminalInfo(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// LiveTail 以 asciicast v2 流的形式实时查看进行中的终端会话，先输出头部，之后逐行输出录制事件
+// 会话结束或客户端断开时结束响应
+func (h *TerminalHandler) LiveTail(c *gin.Context) {
+	sessionID := c.Param("session_id")
+	userID, _ := c.Get("user_id")
+
+	process, exists := h.ttydService.GetTTYDProcess(sessionID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+		return
+	}
+
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) && process.UserID != userID.(int) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有权限访问该会话"})
+		return
+	}
+
+	if process.Recorder == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "会话没有在录制"})
+		return
+	}
+	header, events, unsubscribe, ok := process.Recorder.Subscribe()
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "会话没有在录制"})
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "application/x-asciicast")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Write(header)
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if _, err := c.Writer.Write(event); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
+
 // ListActiveSessions 列出活跃会话
 func (h *TerminalHandler) ListActiveSessions(c *gin.Context) {
 	userID, _ := c.Get("user_id")
-	role, _ := c.Get("role")
 
 	sessions := h.ttydService.ListActiveSessions()
 
-	if role != "admin" {
+	if !middleware.HasPermission(c, models.PermissionSessionsRead) {
 		filteredSessions := make([]*services.TTYDProcess, 0)
 		for _, session := range sessions {
 			if session.UserID == userID.(int) {
@@ -340,11 +667,7 @@ func (h *TerminalHandler) ListActiveSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-// checkUserServerPermission 检查用户服务器权限
-func (h *TerminalHandler) checkUserServerPermission(userID, serverID int, c *gin.Context) (bool, error) {
-	// 这里应该调用数据库检查权限，暂时简化实现
-	_ = userID
-	_ = serverID
-	_ = c
-	return true, nil
+// checkUserServerPermission 检查用户服务器权限，与服务器列表使用相同的授权规则
+func (h *TerminalHandler) checkUserServerPermission(userID, serverID int) (bool, error) {
+	return h.serverService.UserCanAccess(userID, serverID)
 }
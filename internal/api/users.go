@@ -1,22 +1,28 @@
 package api
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
 	"very-jump/internal/database/models"
+	"very-jump/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 // UserHandler 用户处理器
 type UserHandler struct {
-	userService *models.UserService
+	userService    *models.UserService
+	roleService    *models.RoleService
+	ttydService    *services.TTYDService
+	totpService    *models.TOTPService
+	passwordPolicy services.PasswordPolicy
 }
 
 // NewUserHandler 创建用户处理器
-func NewUserHandler(userService *models.UserService) *UserHandler {
-	return &UserHandler{userService: userService}
+func NewUserHandler(userService *models.UserService, roleService *models.RoleService, ttydService *services.TTYDService, totpService *models.TOTPService, passwordPolicy services.PasswordPolicy) *UserHandler {
+	return &UserHandler{userService: userService, roleService: roleService, ttydService: ttydService, totpService: totpService, passwordPolicy: passwordPolicy}
 }
 
 // List 获取用户列表
@@ -55,6 +61,13 @@ func (h *UserHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := h.passwordPolicy.Validate(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !checkAssignableRole(c, h.roleService, req.Role) {
+		return
+	}
 
 	user, err := h.userService.Create(&req)
 	if err != nil {
@@ -95,6 +108,28 @@ func (h *UserHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.Password != "" {
+		if err := h.passwordPolicy.Validate(req.Password, req.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.AuthSource != "" && !models.ValidAuthSource(req.AuthSource) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的认证来源"})
+		return
+	}
+
+	existing, err := h.userService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !checkManageableUser(c, h.roleService, existing) {
+		return
+	}
+	if req.Role != "" && !checkAssignableRole(c, h.roleService, req.Role) {
+		return
+	}
 
 	user, err := h.userService.Update(id, &req)
 	if err != nil {
@@ -102,6 +137,17 @@ func (h *UserHandler) Update(c *gin.Context) {
 		return
 	}
 
+	// 停用、锁定或已过期的账号立即断开正在进行的终端会话
+	if !user.Active() {
+		reason := "account_" + user.Status
+		if user.Status == models.UserStatusActive {
+			reason = "account_expired"
+		}
+		if stopped := h.ttydService.StopUserSessions(user.ID, reason); stopped > 0 {
+			log.Printf("Stopped %d terminal sessions of user %d: %s", stopped, user.ID, reason)
+		}
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
@@ -113,11 +159,45 @@ func (h *UserHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	user, err := h.userService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !checkManageableUser(c, h.roleService, user) {
+		return
+	}
+
 	err = h.userService.Delete(id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.ttydService.StopUserSessions(id, "account_deleted")
 
 	c.JSON(http.StatusOK, gin.H{"message": "用户已删除"})
 }
+
+// ResetTOTP 重置用户的动态验证码，用于用户丢失身份验证器后重新设置
+func (h *UserHandler) ResetTOTP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+
+	user, err := h.userService.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if !checkManageableUser(c, h.roleService, user) {
+		return
+	}
+
+	if err := h.totpService.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "动态验证码已重置"})
+}
@@ -3,19 +3,125 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// DefaultTicketIDPattern 默认工单号格式，如 CHG-1024、INC-42
+const DefaultTicketIDPattern = `^[A-Z][A-Z0-9]+-[0-9]+$`
+
 // Config 应用配置
 type Config struct {
 	DataDir            string
 	Port               string
 	JWTSecret          string
-	JWTExpiry          time.Duration
+	JWTExpiry          time.Duration // 访问令牌有效期
+	RefreshTokenExpiry time.Duration // 刷新令牌有效期，每次刷新顺延
 	SessionTimeout     time.Duration
 	MaxConcurrentConn  int
 	RecordingRetention time.Duration
 	LogRetention       time.Duration
+
+	// 审计日志防篡改
+	AuditHMACKey            string        // 审计哈希链 HMAC 密钥，为空时使用纯 SHA-256
+	AuditCheckpointInterval time.Duration // 签名检查点间隔
+
+	// SIEM 审计事件转发
+	AuditSinkBuffer     int    // 每个输出端的缓冲队列长度
+	AuditSyslogAddr     string // syslog 服务地址 host:port，为空时不启用
+	AuditSyslogNetwork  string // udp, tcp, tls
+	AuditSyslogFormat   string // rfc5424, cef
+	AuditSyslogCAFile   string // TLS 模式下校验服务端证书的 CA 文件
+	AuditFileEnabled    bool   // 是否写入 DATA_DIR/logs 下的 NDJSON 文件
+	AuditFileMaxSizeMB  int    // 单个 NDJSON 文件最大大小
+	AuditFileMaxBackups int    // 保留的轮转文件数
+
+	// 安全告警通知
+	AlertDedupWindow time.Duration // 同一渠道相同告警的去重窗口
+	AlertRateLimit   int           // 每个渠道每分钟最多发送的通知数，0 表示不限
+	AlertMaxAttempts int           // 单条通知最多投递次数
+
+	// 行为异常检测
+	AnomalyDetection       bool    // 是否启用
+	AnomalyMinObservations int     // 学习期观测次数
+	AnomalyOffHoursRatio   float64 // 某小时活动占比低于该值视为非常用时段
+	AnomalyVolumeFactor    float64 // 当日会话数超过日均值的倍数时告警
+	AnomalyVolumeMinimum   int     // 当日会话数告警下限
+	AnomalyDurationSigma   float64 // 会话时长超过均值多少个标准差时告警，0 表示不检测
+	AnomalyTimezone        string  // 统计常用时段使用的时区，为空时使用系统时区
+
+	// 登录防暴力破解
+	LoginMaxFailures     int           // 同一用户名在窗口内的失败次数上限，达到后锁定
+	LoginIPMaxFailures   int           // 同一来源IP在窗口内的失败次数上限，达到后锁定
+	LoginFailureWindow   time.Duration // 失败次数统计的滑动窗口
+	LoginLockoutDuration time.Duration // 锁定时长
+	LoginDelayBase       time.Duration // 首次失败后的等待时间，之后每次失败翻倍
+	LoginDelayMax        time.Duration // 等待时间上限
+
+	// 密码策略
+	PasswordMinLength  int // 最短长度
+	PasswordMinClasses int // 至少包含的字符类别数（小写、大写、数字、符号）
+	PasswordHistory    int // 不能与最近几次使用过的密码相同，0 表示不检查
+
+	// 临时访问申请
+	AccessRequestMaxDuration      time.Duration // 单次申请的最长授权时长，审批策略可进一步收紧
+	AccessRequestPendingTTL       time.Duration // 超过该时间仍未审批的申请自动过期
+	AccessRequestCheckInterval    time.Duration // 检查授权到期的间隔
+	AccessRequestDefaultApprovals int           // 没有匹配审批策略时需要的批准人数
+
+	// 访问时间窗口
+	AccessWindowCheckInterval time.Duration // 检查进行中会话的间隔
+	AccessWindowWarning       time.Duration // 窗口关闭前多久在终端中提醒
+
+	// 连接要求
+	TicketIDPattern string // 工单号格式（正则表达式）
+
+	// 二次认证
+	StepUpMaxAge   time.Duration // 重新验证身份后的有效期
+	StepUpAdminOps bool          // 用户、角色、凭据和令牌管理等高风险操作是否需要二次认证
+
+	// 紧急访问
+	BreakGlassDuration      time.Duration // 每次紧急访问的固定时长
+	BreakGlassCheckInterval time.Duration // 检查紧急访问到期的间隔
+
+	// 访问复核
+	AccessReviewCheckInterval time.Duration // 检查复核活动截止的间隔
+
+	// 连接策略
+	PolicyTimezone string // 策略表达式中 time.* 变量使用的时区，为空时使用系统时区
+
+	// LDAP / Active Directory 登录
+	LDAPEnabled            bool
+	LDAPURL                string        // ldap://host:389 或 ldaps://host:636
+	LDAPStartTLS           bool          // ldap:// 连接后升级为 TLS
+	LDAPInsecureSkipVerify bool          // 不校验服务端证书，仅用于测试
+	LDAPCACertFile         string        // 校验服务端证书的 CA 文件
+	LDAPBindDN             string        // 查询用户的服务账号，为空时匿名查询
+	LDAPBindPassword       string        // 查询用户的服务账号密码
+	LDAPBaseDN             string        // 用户查询起点
+	LDAPUserFilter         string        // 用户查询条件，%s 替换为转义后的用户名
+	LDAPUsernameAttribute  string        // 作为本地用户名的属性
+	LDAPGroupAttribute     string        // 用户所属组的属性
+	LDAPAdminGroups        []string      // 属于其中任一组的用户映射为 admin
+	LDAPUserGroups         []string      // 属于其中任一组的用户映射为 user，为空时所有目录用户都可登录
+	LDAPProvision          bool          // 首次登录时自动创建本地用户
+	LDAPTimeout            time.Duration // 连接和查询超时
+
+	// SAML 2.0 单点登录
+	SAMLEnabled           bool
+	SAMLDisplayName       string   // 登录页按钮名称
+	SAMLRootURL           string   // 本系统对外访问地址，用于生成元数据和断言消费地址
+	SAMLEntityID          string   // SP 实体标识，为空时使用元数据地址
+	SAMLIDPMetadataURL    string   // IdP 元数据地址
+	SAMLIDPMetadataFile   string   // IdP 元数据文件，优先于 SAMLIDPMetadataURL
+	SAMLSPCertFile        string   // SP 证书，与 SAMLSPKeyFile 同时为空时自动生成并保存在数据目录
+	SAMLSPKeyFile         string   // SP 私钥，用于签名认证请求和解密断言
+	SAMLSignRequests      bool     // 签名认证请求
+	SAMLUsernameAttribute string   // 作为本地用户名的属性，为空时使用 NameID
+	SAMLGroupsAttribute   string   // 用户所属组的属性
+	SAMLAdminGroups       []string // 属于其中任一组的用户映射为 admin
+	SAMLUserGroups        []string // 属于其中任一组的用户映射为 user，为空时所有用户都可登录
+	SAMLProvision         bool     // 首次登录时自动创建本地用户
 }
 
 // Load 加载配置
@@ -24,11 +130,98 @@ func Load(dataDir string) *Config {
 		DataDir:            dataDir,
 		Port:               getEnv("PORT", "8080"),
 		JWTSecret:          getEnv("JWT_SECRET", "very-jump-secret-key"),
-		JWTExpiry:          getDurationEnv("JWT_EXPIRY", 24*time.Hour),
+		JWTExpiry:          getDurationEnv("JWT_EXPIRY", 15*time.Minute),
+		RefreshTokenExpiry: getDurationEnv("REFRESH_TOKEN_EXPIRY", 7*24*time.Hour),
 		SessionTimeout:     getDurationEnv("SESSION_TIMEOUT", 30*time.Minute),
 		MaxConcurrentConn:  getIntEnv("MAX_CONCURRENT_CONN", 50),
 		RecordingRetention: getDurationEnv("RECORDING_RETENTION", 30*24*time.Hour), // 30 days
 		LogRetention:       getDurationEnv("LOG_RETENTION", 90*24*time.Hour),       // 90 days
+
+		AuditHMACKey:            getEnv("AUDIT_HMAC_KEY", ""),
+		AuditCheckpointInterval: getDurationEnv("AUDIT_CHECKPOINT_INTERVAL", time.Hour),
+
+		AuditSinkBuffer:     getIntEnv("AUDIT_SINK_BUFFER", 1000),
+		AuditSyslogAddr:     getEnv("AUDIT_SYSLOG_ADDR", ""),
+		AuditSyslogNetwork:  getEnv("AUDIT_SYSLOG_NETWORK", "udp"),
+		AuditSyslogFormat:   getEnv("AUDIT_SYSLOG_FORMAT", "rfc5424"),
+		AuditSyslogCAFile:   getEnv("AUDIT_SYSLOG_CA_FILE", ""),
+		AuditFileEnabled:    getBoolEnv("AUDIT_FILE_ENABLED", false),
+		AuditFileMaxSizeMB:  getIntEnv("AUDIT_FILE_MAX_SIZE_MB", 100),
+		AuditFileMaxBackups: getIntEnv("AUDIT_FILE_MAX_BACKUPS", 10),
+
+		AlertDedupWindow: getDurationEnv("ALERT_DEDUP_WINDOW", 10*time.Minute),
+		AlertRateLimit:   getIntEnv("ALERT_RATE_LIMIT", 20),
+		AlertMaxAttempts: getIntEnv("ALERT_MAX_ATTEMPTS", 5),
+
+		AnomalyDetection:       getBoolEnv("ANOMALY_DETECTION", true),
+		AnomalyMinObservations: getIntEnv("ANOMALY_MIN_OBSERVATIONS", 20),
+		AnomalyOffHoursRatio:   getFloatEnv("ANOMALY_OFF_HOURS_RATIO", 0.02),
+		AnomalyVolumeFactor:    getFloatEnv("ANOMALY_VOLUME_FACTOR", 3),
+		AnomalyVolumeMinimum:   getIntEnv("ANOMALY_VOLUME_MINIMUM", 10),
+		AnomalyDurationSigma:   getFloatEnv("ANOMALY_DURATION_SIGMA", 3),
+		AnomalyTimezone:        getEnv("ANOMALY_TIMEZONE", ""),
+
+		LoginMaxFailures:     getIntEnv("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures:   getIntEnv("LOGIN_IP_MAX_FAILURES", 20),
+		LoginFailureWindow:   getDurationEnv("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		LoginLockoutDuration: getDurationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginDelayBase:       getDurationEnv("LOGIN_DELAY_BASE", time.Second),
+		LoginDelayMax:        getDurationEnv("LOGIN_DELAY_MAX", 30*time.Second),
+
+		PasswordMinLength:  getIntEnv("PASSWORD_MIN_LENGTH", 8),
+		PasswordMinClasses: getIntEnv("PASSWORD_MIN_CLASSES", 3),
+		PasswordHistory:    getIntEnv("PASSWORD_HISTORY", 5),
+
+		AccessRequestMaxDuration:      getDurationEnv("ACCESS_REQUEST_MAX_DURATION", 8*time.Hour),
+		AccessRequestPendingTTL:       getDurationEnv("ACCESS_REQUEST_PENDING_TTL", 24*time.Hour),
+		AccessRequestCheckInterval:    getDurationEnv("ACCESS_REQUEST_CHECK_INTERVAL", 30*time.Second),
+		AccessRequestDefaultApprovals: getIntEnv("ACCESS_REQUEST_DEFAULT_APPROVALS", 1),
+
+		AccessWindowCheckInterval: getDurationEnv("ACCESS_WINDOW_CHECK_INTERVAL", 30*time.Second),
+		AccessWindowWarning:       getDurationEnv("ACCESS_WINDOW_WARNING", 5*time.Minute),
+
+		TicketIDPattern: getEnv("TICKET_ID_PATTERN", DefaultTicketIDPattern),
+
+		StepUpMaxAge:   getDurationEnv("STEP_UP_MAX_AGE", 10*time.Minute),
+		StepUpAdminOps: getBoolEnv("STEP_UP_ADMIN_OPS", true),
+
+		BreakGlassDuration:      getDurationEnv("BREAK_GLASS_DURATION", time.Hour),
+		BreakGlassCheckInterval: getDurationEnv("BREAK_GLASS_CHECK_INTERVAL", 30*time.Second),
+
+		AccessReviewCheckInterval: getDurationEnv("ACCESS_REVIEW_CHECK_INTERVAL", time.Minute),
+
+		PolicyTimezone: getEnv("POLICY_TIMEZONE", ""),
+
+		LDAPEnabled:            getBoolEnv("LDAP_ENABLED", false),
+		LDAPURL:                getEnv("LDAP_URL", ""),
+		LDAPStartTLS:           getBoolEnv("LDAP_START_TLS", false),
+		LDAPInsecureSkipVerify: getBoolEnv("LDAP_INSECURE_SKIP_VERIFY", false),
+		LDAPCACertFile:         getEnv("LDAP_CA_CERT_FILE", ""),
+		LDAPBindDN:             getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword:       getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:             getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:         getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(uid=%s))"),
+		LDAPUsernameAttribute:  getEnv("LDAP_USERNAME_ATTRIBUTE", "uid"),
+		LDAPGroupAttribute:     getEnv("LDAP_GROUP_ATTRIBUTE", "memberOf"),
+		LDAPAdminGroups:        getListEnv("LDAP_ADMIN_GROUPS", ";"),
+		LDAPUserGroups:         getListEnv("LDAP_USER_GROUPS", ";"),
+		LDAPProvision:          getBoolEnv("LDAP_PROVISION", true),
+		LDAPTimeout:            getDurationEnv("LDAP_TIMEOUT", 10*time.Second),
+
+		SAMLEnabled:           getBoolEnv("SAML_ENABLED", false),
+		SAMLDisplayName:       getEnv("SAML_DISPLAY_NAME", "SAML 单点登录"),
+		SAMLRootURL:           getEnv("SAML_ROOT_URL", ""),
+		SAMLEntityID:          getEnv("SAML_ENTITY_ID", ""),
+		SAMLIDPMetadataURL:    getEnv("SAML_IDP_METADATA_URL", ""),
+		SAMLIDPMetadataFile:   getEnv("SAML_IDP_METADATA_FILE", ""),
+		SAMLSPCertFile:        getEnv("SAML_SP_CERT_FILE", ""),
+		SAMLSPKeyFile:         getEnv("SAML_SP_KEY_FILE", ""),
+		SAMLSignRequests:      getBoolEnv("SAML_SIGN_REQUESTS", true),
+		SAMLUsernameAttribute: getEnv("SAML_USERNAME_ATTRIBUTE", ""),
+		SAMLGroupsAttribute:   getEnv("SAML_GROUPS_ATTRIBUTE", "groups"),
+		SAMLAdminGroups:       getListEnv("SAML_ADMIN_GROUPS", ";"),
+		SAMLUserGroups:        getListEnv("SAML_USER_GROUPS", ";"),
+		SAMLProvision:         getBoolEnv("SAML_PROVISION", true),
 	}
 }
 
@@ -39,6 +232,17 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getListEnv 按分隔符拆分环境变量，组 DN 本身包含逗号，因此由调用方指定分隔符
+func getListEnv(key, separator string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(key), separator) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func getIntEnv(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -48,6 +252,24 @@ func getIntEnv(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getBoolEnv(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getFloatEnv(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
@@ -38,7 +38,51 @@ func runMigrations(db *sql.DB) error {
 		createAuditLogsTable,
 		createExtraAuditTables, // 新的审计表
 		createCredentialsTable, // 登录凭证表
+		alterAuditLogsAddPrevHashColumn,
+		alterAuditLogsAddHashColumn,
+		createAuditCheckpointsTable,     // 审计哈希链检查点
+		createNotificationChannelsTable, // 告警通知渠道
+		createUserBaselinesTable,        // 用户行为基线
+		alterUsersAddTokenVersionColumn,
+		createAuthSessionsTable, // 登录会话和刷新令牌
+		alterUsersAddAccountTypeColumn,
+		createAPITokensTable, // API 令牌
+		alterUsersAddStatusColumn,
+		alterUsersAddExpiresAtColumn,
+		alterUsersAddLastLoginAtColumn,
+		alterUsersAddLastLoginIPColumn,
+		alterUsersAddMustChangePasswordColumn,
+		createPasswordHistoryTable, // 历史密码，用于禁止重复使用
+		alterUsersAddAuthSourceColumn,
+		createOIDCProvidersTable,
+		alterUserServerPermissionsAddSourceColumn, // 由身份源同步的授权，手工授权为空
+		createGroupsTable,
+		createGroupMembersTable,
+		createAccessGrantsTable, // 按用户组或服务器标签授权
+		createRolesTable,        // 自定义角色和权限集
+		insertBuiltinRoles,
+		createAccessRequestsTable, // 临时访问申请和审批
+		createAccessRequestApprovalsTable,
+		createAccessPoliciesTable, // 按服务器标签的审批策略
+		createSchedulesTable,      // 访问时间窗口
+		createScheduleBindingsTable,
+		createConnectRequirementsTable,      // 连接服务器需要填写的原因和工单号
+		alterSessionsAddLastHeartbeatColumn, // 会话列表和心跳使用，早期建表语句缺少该列
+		alterSessionsAddReasonColumn,
+		alterSessionsAddTicketIDColumn,
+		alterTerminalSessionsAddReasonColumn,
+		alterTerminalSessionsAddTicketIDColumn,
+		createUserTOTPTable, // 二次认证使用的 TOTP 密钥
+		alterConnectRequirementsAddRequireStepUpColumn,
+		createBreakGlassTable, // 紧急访问（break-glass）
+		alterSessionsAddBreakGlassIDColumn,
+		alterGroupsAddOwnerIDColumn,
+		createAccessReviewTables,  // 访问复核活动
+		createConnectPolicyTables, // 连接策略及其历史版本
+		alterSessionsAddPolicyDecisionColumn,
+		createBreakGlassActiveIndex, // 每个用户最多一条生效中的紧急访问
 		insertDefaultAdmin,
+		flagDefaultAdminPassword,
 	}
 
 	for _, migration := range migrations {
@@ -204,7 +248,495 @@ CREATE TABLE IF NOT EXISTS credentials (
 );
 `
 
+const alterAuditLogsAddPrevHashColumn = `
+ALTER TABLE audit_logs ADD COLUMN prev_hash VARCHAR(64);
+`
+
+const alterAuditLogsAddHashColumn = `
+ALTER TABLE audit_logs ADD COLUMN hash VARCHAR(64);
+`
+
+const createAuditCheckpointsTable = `
+-- 审计哈希链检查点：checkpoint 为周期性签名快照，anchor 为保留期截断时留下的锚点
+CREATE TABLE IF NOT EXISTS audit_checkpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind VARCHAR(20) NOT NULL, -- 'checkpoint' 或 'anchor'
+    last_log_id INTEGER NOT NULL,
+    last_hash VARCHAR(64) NOT NULL,
+    entry_count INTEGER DEFAULT 0,
+    details TEXT,
+    signature VARCHAR(64) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_checkpoints_kind ON audit_checkpoints(kind, id);
+`
+
+const createNotificationChannelsTable = `
+-- 告警通知渠道：每个渠道自带路由条件（最低级别、告警类型、服务器标签）
+CREATE TABLE IF NOT EXISTS notification_channels (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    type VARCHAR(20) NOT NULL, -- 'webhook', 'email', 'dingtalk', 'feishu', 'wecom'
+    config TEXT NOT NULL DEFAULT '{}', -- 渠道配置 JSON
+    min_severity VARCHAR(20) NOT NULL DEFAULT 'high',
+    alert_types TEXT, -- JSON 数组，为空表示全部类型
+    server_tags TEXT, -- JSON 数组，为空表示全部服务器
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    last_sent_at DATETIME,
+    last_error TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const createUserBaselinesTable = `
+-- 用户行为基线：常用时段、来源IP/网段、访问过的服务器和会话时长，data 为 JSON
+CREATE TABLE IF NOT EXISTS user_baselines (
+    user_id INTEGER PRIMARY KEY,
+    data TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+`
+
+const alterUsersAddTokenVersionColumn = `
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0;
+`
+
+const createAuthSessionsTable = `
+-- 登录会话：每次登录一条，访问令牌通过 sid 关联，撤销后令牌立即失效
+CREATE TABLE IF NOT EXISTS auth_sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    token_version INTEGER NOT NULL DEFAULT 0, -- 创建时用户的令牌版本
+    ip_address TEXT,
+    user_agent TEXT,
+    expires_at DATETIME NOT NULL,
+    last_seen_at DATETIME,
+    revoked_at DATETIME,
+    revoke_reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- 刷新令牌：只保存哈希，每次刷新轮换，已使用的令牌再次出现视为被盗用
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id VARCHAR(64) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES auth_sessions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_sessions_user_id ON auth_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+`
+
+const alterUsersAddAccountTypeColumn = `
+ALTER TABLE users ADD COLUMN account_type VARCHAR(20) NOT NULL DEFAULT 'human';
+`
+
+const createAPITokensTable = `
+-- API 令牌：供脚本和 CI 调用接口，只保存哈希
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    token_prefix VARCHAR(16) NOT NULL,
+    token_hash VARCHAR(64) UNIQUE NOT NULL,
+    scopes TEXT NOT NULL,
+    expires_at DATETIME,
+    last_used_at DATETIME,
+    last_used_ip VARCHAR(45),
+    revoked_at DATETIME,
+    created_by INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+`
+
+const alterUsersAddStatusColumn = `
+ALTER TABLE users ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active';
+`
+
+const alterUsersAddExpiresAtColumn = `
+ALTER TABLE users ADD COLUMN expires_at DATETIME;
+`
+
+const alterUsersAddLastLoginAtColumn = `
+ALTER TABLE users ADD COLUMN last_login_at DATETIME;
+`
+
+const alterUsersAddLastLoginIPColumn = `
+ALTER TABLE users ADD COLUMN last_login_ip VARCHAR(45);
+`
+
+const alterUsersAddMustChangePasswordColumn = `
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+const createPasswordHistoryTable = `
+CREATE TABLE IF NOT EXISTS password_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history(user_id);
+`
+
+const alterUsersAddAuthSourceColumn = `
+ALTER TABLE users ADD COLUMN auth_source VARCHAR(20) NOT NULL DEFAULT 'local';
+`
+
+const createOIDCProvidersTable = `
+CREATE TABLE IF NOT EXISTS oidc_providers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    display_name VARCHAR(100) NOT NULL,
+    issuer_url VARCHAR(500) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    client_secret TEXT,
+    redirect_url VARCHAR(500),
+    scopes TEXT,
+    username_claim VARCHAR(100) NOT NULL DEFAULT 'preferred_username',
+    groups_claim VARCHAR(100) NOT NULL DEFAULT 'groups',
+    admin_groups TEXT,
+    user_groups TEXT,
+    server_grants TEXT,
+    provision BOOLEAN NOT NULL DEFAULT TRUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const alterUserServerPermissionsAddSourceColumn = `
+ALTER TABLE user_server_permissions ADD COLUMN source VARCHAR(50);
+`
+
+const createGroupsTable = `
+CREATE TABLE IF NOT EXISTS groups (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+const createGroupMembersTable = `
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id),
+    FOREIGN KEY (group_id) REFERENCES groups(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);
+`
+
+const createAccessGrantsTable = `
+CREATE TABLE IF NOT EXISTS access_grants (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subject_type VARCHAR(10) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    server_id INTEGER,
+    tag VARCHAR(100),
+    permission VARCHAR(20) NOT NULL DEFAULT 'connect',
+    created_by INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (server_id) REFERENCES servers(id),
+    CHECK ((server_id IS NULL) <> (tag IS NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_access_grants_subject ON access_grants(subject_type, subject_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_access_grants_unique ON access_grants(subject_type, subject_id, COALESCE(server_id, 0), COALESCE(tag, ''), permission);
+`
+
+const createRolesTable = `
+CREATE TABLE IF NOT EXISTS roles (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(20) UNIQUE NOT NULL,
+    description TEXT,
+    permissions TEXT NOT NULL DEFAULT '[]',
+    builtin BOOLEAN DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// insertBuiltinRoles 内置角色，与引入自定义角色之前的 admin/user 行为一致
+const insertBuiltinRoles = `
+INSERT OR IGNORE INTO roles (name, description, permissions, builtin)
+VALUES ('admin', '管理员，拥有全部权限', '["*"]', TRUE);
+INSERT OR IGNORE INTO roles (name, description, permissions, builtin)
+VALUES ('user', '普通用户，只能访问被授权的服务器', '[]', TRUE);
+`
+
+const createAccessRequestsTable = `
+CREATE TABLE IF NOT EXISTS access_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    server_id INTEGER,
+    tag VARCHAR(100),
+    reason TEXT NOT NULL,
+    duration_minutes INTEGER NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    required_approvals INTEGER NOT NULL DEFAULT 1,
+    approved_at DATETIME,
+    expires_at DATETIME,
+    closed_by INTEGER,
+    close_reason TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (server_id) REFERENCES servers(id),
+    CHECK ((server_id IS NULL) <> (tag IS NULL))
+);
+CREATE INDEX IF NOT EXISTS idx_access_requests_user ON access_requests(user_id, status);
+CREATE INDEX IF NOT EXISTS idx_access_requests_status ON access_requests(status, expires_at);
+`
+
+const createAccessRequestApprovalsTable = `
+CREATE TABLE IF NOT EXISTS access_request_approvals (
+    request_id INTEGER NOT NULL,
+    approver_id INTEGER NOT NULL,
+    decision VARCHAR(10) NOT NULL,
+    comment TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (request_id, approver_id),
+    FOREIGN KEY (request_id) REFERENCES access_requests(id),
+    FOREIGN KEY (approver_id) REFERENCES users(id)
+);
+`
+
+const createAccessPoliciesTable = `
+CREATE TABLE IF NOT EXISTS access_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tag VARCHAR(100) UNIQUE NOT NULL,
+    required_approvals INTEGER NOT NULL DEFAULT 1,
+    max_duration_minutes INTEGER NOT NULL DEFAULT 0,
+    approver_group_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (approver_group_id) REFERENCES groups(id)
+);
+`
+
+const createSchedulesTable = `
+CREATE TABLE IF NOT EXISTS schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    description TEXT,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    windows TEXT NOT NULL DEFAULT '[]',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// createScheduleBindingsTable 时间窗口绑定到服务器、用户组或授权，每个对象最多绑定一个时间窗口
+const createScheduleBindingsTable = `
+CREATE TABLE IF NOT EXISTS schedule_bindings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL,
+    target_type VARCHAR(10) NOT NULL,
+    target_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id),
+    UNIQUE (target_type, target_id)
+);
+`
+
+const createConnectRequirementsTable = `
+CREATE TABLE IF NOT EXISTS connect_requirements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    server_id INTEGER,
+    tag VARCHAR(100),
+    require_reason BOOLEAN NOT NULL DEFAULT FALSE,
+    require_ticket BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (server_id) REFERENCES servers(id),
+    CHECK ((server_id IS NULL) <> (tag IS NULL))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_connect_requirements_target ON connect_requirements(COALESCE(server_id, 0), COALESCE(tag, ''));
+`
+
+const alterSessionsAddLastHeartbeatColumn = `
+ALTER TABLE sessions ADD COLUMN last_heartbeat DATETIME;
+`
+
+const alterSessionsAddReasonColumn = `
+ALTER TABLE sessions ADD COLUMN reason TEXT;
+`
+
+const alterSessionsAddTicketIDColumn = `
+ALTER TABLE sessions ADD COLUMN ticket_id VARCHAR(100);
+`
+
+const alterTerminalSessionsAddReasonColumn = `
+ALTER TABLE terminal_sessions ADD COLUMN reason TEXT;
+`
+
+const alterTerminalSessionsAddTicketIDColumn = `
+ALTER TABLE terminal_sessions ADD COLUMN ticket_id VARCHAR(100);
+`
+
+const createUserTOTPTable = `
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY,
+    secret VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    enabled_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+`
+
+const alterConnectRequirementsAddRequireStepUpColumn = `
+ALTER TABLE connect_requirements ADD COLUMN require_step_up BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+const createBreakGlassTable = `
+CREATE TABLE IF NOT EXISTS break_glass_activations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    justification TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ip_address VARCHAR(45),
+    activated_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    ended_at DATETIME,
+    ended_by INTEGER,
+    end_reason TEXT,
+    review_status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    reviewed_by INTEGER,
+    reviewed_at DATETIME,
+    review_notes TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_break_glass_user ON break_glass_activations(user_id, status, expires_at);
+CREATE INDEX IF NOT EXISTS idx_break_glass_review ON break_glass_activations(review_status);
+`
+
+const alterSessionsAddBreakGlassIDColumn = `
+ALTER TABLE sessions ADD COLUMN break_glass_id INTEGER;
+`
+
+const alterGroupsAddOwnerIDColumn = `
+ALTER TABLE groups ADD COLUMN owner_id INTEGER;
+`
+
+const createAccessReviewTables = `
+CREATE TABLE IF NOT EXISTS access_review_campaigns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    deadline DATETIME NOT NULL,
+    default_reviewer_id INTEGER NOT NULL,
+    tag_reviewers TEXT,
+    created_by INTEGER,
+    created_at DATETIME NOT NULL,
+    completed_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_review_campaigns_status ON access_review_campaigns(status, deadline);
+
+CREATE TABLE IF NOT EXISTS access_review_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    campaign_id INTEGER NOT NULL,
+    item_type VARCHAR(20) NOT NULL,
+    source_id INTEGER NOT NULL,
+    subject_type VARCHAR(10) NOT NULL,
+    subject_id INTEGER NOT NULL,
+    subject_name VARCHAR(100),
+    target_type VARCHAR(10) NOT NULL,
+    target_id INTEGER,
+    target_name VARCHAR(100),
+    permission VARCHAR(20),
+    origin VARCHAR(50),
+    reviewer_id INTEGER NOT NULL,
+    decision VARCHAR(20) NOT NULL DEFAULT 'pending',
+    decided_by INTEGER,
+    decided_at DATETIME,
+    comment TEXT,
+    FOREIGN KEY (campaign_id) REFERENCES access_review_campaigns(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_access_review_items_campaign ON access_review_items(campaign_id, decision);
+CREATE INDEX IF NOT EXISTS idx_access_review_items_reviewer ON access_review_items(reviewer_id, decision);
+`
+
+const createConnectPolicyTables = `
+CREATE TABLE IF NOT EXISTS connect_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT,
+    expression TEXT NOT NULL,
+    effect VARCHAR(20) NOT NULL,
+    obligations TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    mode VARCHAR(20) NOT NULL DEFAULT 'enforce',
+    version INTEGER NOT NULL DEFAULT 1,
+    updated_by INTEGER,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS connect_policy_versions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    policy_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    description TEXT,
+    expression TEXT NOT NULL,
+    effect VARCHAR(20) NOT NULL,
+    obligations TEXT,
+    priority INTEGER NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    mode VARCHAR(20) NOT NULL DEFAULT 'enforce',
+    comment TEXT,
+    created_by INTEGER,
+    created_at DATETIME NOT NULL,
+    UNIQUE(policy_id, version),
+    FOREIGN KEY (policy_id) REFERENCES connect_policies(id)
+);
+`
+
+const alterSessionsAddPolicyDecisionColumn = `
+ALTER TABLE sessions ADD COLUMN policy_decision TEXT;
+`
+
+// createBreakGlassActiveIndex 并发发起紧急访问时由唯一索引保证每个用户只有一条生效中的记录，
+// 建索引前把同一用户较早的生效中记录标记为到期
+const createBreakGlassActiveIndex = `
+UPDATE break_glass_activations SET status = 'expired', ended_at = expires_at, end_reason = '到期'
+WHERE status = 'active' AND id NOT IN (
+    SELECT MAX(id) FROM break_glass_activations WHERE status = 'active' GROUP BY user_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_break_glass_one_active ON break_glass_activations(user_id) WHERE status = 'active';
+`
+
 const insertDefaultAdmin = `
 INSERT OR IGNORE INTO users (username, password_hash, role)
 VALUES ('admin', '$2a$10$u4V8qHD8a4YyP0ylvUjAb.hhJ8KdhJ32.rV1jOcxyAoinpJu64vo2', 'admin');
 `
+
+// flagDefaultAdminPassword 仍在使用内置默认密码的 admin 必须修改密码
+const flagDefaultAdminPassword = `
+UPDATE users SET must_change_password = TRUE
+WHERE username = 'admin' AND password_hash = '$2a$10$u4V8qHD8a4YyP0ylvUjAb.hhJ8KdhJ32.rV1jOcxyAoinpJu64vo2';
+`
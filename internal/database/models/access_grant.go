@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// 授权对象类型
+const (
+	GrantSubjectUser  = "user"
+	GrantSubjectGroup = "group"
+)
+
+// PermissionConnect 允许启动终端连接服务器
+const PermissionConnect = "connect"
+
+// AccessGrant 服务器授权：授予用户或用户组，目标为单台服务器或带有某个标签的全部服务器
+type AccessGrant struct {
+	ID          int       `json:"id" db:"id"`
+	SubjectType string    `json:"subject_type" db:"subject_type"` // user 或 group
+	SubjectID   int       `json:"subject_id" db:"subject_id"`
+	SubjectName string    `json:"subject_name" db:"-"` // 用户名或组名，不入库
+	ServerID    *int      `json:"server_id,omitempty" db:"server_id"`
+	ServerName  string    `json:"server_name,omitempty" db:"-"` // 服务器名称，不入库
+	Tag         string    `json:"tag,omitempty" db:"tag"`
+	Permission  string    `json:"permission" db:"permission"`
+	CreatedBy   *int      `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// AccessGrantCreate 创建授权请求，server_id 和 tag 二选一
+type AccessGrantCreate struct {
+	SubjectType string `json:"subject_type" binding:"required,oneof=user group"`
+	SubjectID   int    `json:"subject_id" binding:"required,min=1"`
+	ServerID    *int   `json:"server_id"`
+	Tag         string `json:"tag" binding:"max=100"`
+	Permission  string `json:"permission" binding:"omitempty,oneof=connect"`
+}
+
+// AccessGrantFilter 授权查询条件，零值表示不限
+type AccessGrantFilter struct {
+	SubjectType string
+	SubjectID   int
+	ServerID    int
+	Tag         string
+}
+
+// AccessGrantService 服务器授权服务
+type AccessGrantService struct {
+	db *sql.DB
+}
+
+// NewAccessGrantService 创建服务器授权服务
+func NewAccessGrantService(db *sql.DB) *AccessGrantService {
+	return &AccessGrantService{db: db}
+}
+
+const accessGrantColumns = `g.id, g.subject_type, g.subject_id,
+	CASE g.subject_type WHEN 'user' THEN (SELECT username FROM users WHERE id = g.subject_id)
+		ELSE (SELECT name FROM groups WHERE id = g.subject_id) END,
+	g.server_id, (SELECT name FROM servers WHERE id = g.server_id), COALESCE(g.tag, ''),
+	g.permission, g.created_by, g.created_at`
+
+func scanAccessGrant(scanner interface{ Scan(...interface{}) error }) (*AccessGrant, error) {
+	var grant AccessGrant
+	var subjectName, serverName *string
+	err := scanner.Scan(&grant.ID, &grant.SubjectType, &grant.SubjectID, &subjectName,
+		&grant.ServerID, &serverName, &grant.Tag, &grant.Permission, &grant.CreatedBy, &grant.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if subjectName != nil {
+		grant.SubjectName = *subjectName
+	}
+	if serverName != nil {
+		grant.ServerName = *serverName
+	}
+	return &grant, nil
+}
+
+// Create 创建授权
+func (s *AccessGrantService) Create(req *AccessGrantCreate, createdBy int) (*AccessGrant, error) {
+	if req.Permission == "" {
+		req.Permission = PermissionConnect
+	}
+	var tag interface{}
+	if req.Tag != "" {
+		tag = req.Tag
+	}
+
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO access_grants (subject_type, subject_id, server_id, tag, permission, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.SubjectType, req.SubjectID, req.ServerID, tag, req.Permission, createdBy).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取授权
+func (s *AccessGrantService) GetByID(id int) (*AccessGrant, error) {
+	return scanAccessGrant(s.db.QueryRow(`SELECT `+accessGrantColumns+` FROM access_grants g WHERE g.id = ?`, id))
+}
+
+// List 按条件查询授权
+func (s *AccessGrantService) List(filter AccessGrantFilter) ([]*AccessGrant, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.SubjectType != "" {
+		conditions = append(conditions, "g.subject_type = ?")
+		args = append(args, filter.SubjectType)
+	}
+	if filter.SubjectID > 0 {
+		conditions = append(conditions, "g.subject_id = ?")
+		args = append(args, filter.SubjectID)
+	}
+	if filter.ServerID > 0 {
+		conditions = append(conditions, "g.server_id = ?")
+		args = append(args, filter.ServerID)
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "g.tag = ?")
+		args = append(args, filter.Tag)
+	}
+
+	query := `SELECT ` + accessGrantColumns + ` FROM access_grants g`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY g.id"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []*AccessGrant{}
+	for rows.Next() {
+		grant, err := scanAccessGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, grant)
+	}
+	return grants, rows.Err()
+}
+
+// Delete 删除授权及其时间窗口绑定
+func (s *AccessGrantService) Delete(id int) error {
+	if _, err := s.db.Exec(`DELETE FROM schedule_bindings WHERE target_type = ? AND target_id = ?`, ScheduleTargetGrant, id); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`DELETE FROM access_grants WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AccessPolicy 按服务器标签配置的临时访问审批策略，例如 prod 标签需要两人审批
+type AccessPolicy struct {
+	ID                 int       `json:"id" db:"id"`
+	Tag                string    `json:"tag" db:"tag"`
+	RequiredApprovals  int       `json:"required_approvals" db:"required_approvals"`
+	MaxDurationMinutes int       `json:"max_duration_minutes" db:"max_duration_minutes"` // 0 表示使用全局上限
+	ApproverGroupID    *int      `json:"approver_group_id" db:"approver_group_id"`       // 为空表示任何有 access.approve 权限的用户
+	ApproverGroupName  string    `json:"approver_group_name,omitempty" db:"-"`
+	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// AccessPolicyCreate 创建审批策略请求
+type AccessPolicyCreate struct {
+	Tag                string `json:"tag" binding:"required,max=100"`
+	RequiredApprovals  int    `json:"required_approvals" binding:"required,min=1,max=10"`
+	MaxDurationMinutes int    `json:"max_duration_minutes" binding:"min=0"`
+	ApproverGroupID    *int   `json:"approver_group_id"`
+}
+
+// AccessPolicyUpdate 更新审批策略请求，approver_group_id 传 0 表示取消审批组限制
+type AccessPolicyUpdate struct {
+	RequiredApprovals  *int `json:"required_approvals" binding:"omitempty,min=1,max=10"`
+	MaxDurationMinutes *int `json:"max_duration_minutes" binding:"omitempty,min=0"`
+	ApproverGroupID    *int `json:"approver_group_id"`
+}
+
+// AccessPolicyService 审批策略服务
+type AccessPolicyService struct {
+	db *sql.DB
+}
+
+// NewAccessPolicyService 创建审批策略服务
+func NewAccessPolicyService(db *sql.DB) *AccessPolicyService {
+	return &AccessPolicyService{db: db}
+}
+
+const accessPolicyColumns = `p.id, p.tag, p.required_approvals, p.max_duration_minutes, p.approver_group_id,
+	COALESCE((SELECT name FROM groups WHERE id = p.approver_group_id), ''), p.created_at, p.updated_at`
+
+// serverTagsQuery 展开服务器 tags 字段中的每个标签
+const serverTagsQuery = `json_each(COALESCE(NULLIF(srv.tags, ''), '[]'))`
+
+func scanAccessPolicy(scanner interface{ Scan(...interface{}) error }) (*AccessPolicy, error) {
+	var policy AccessPolicy
+	err := scanner.Scan(&policy.ID, &policy.Tag, &policy.RequiredApprovals, &policy.MaxDurationMinutes,
+		&policy.ApproverGroupID, &policy.ApproverGroupName, &policy.CreatedAt, &policy.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Create 创建审批策略
+func (s *AccessPolicyService) Create(req *AccessPolicyCreate) (*AccessPolicy, error) {
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO access_policies (tag, required_approvals, max_duration_minutes, approver_group_id)
+		VALUES (?, ?, ?, ?)
+		RETURNING id
+	`, req.Tag, req.RequiredApprovals, req.MaxDurationMinutes, req.ApproverGroupID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取审批策略
+func (s *AccessPolicyService) GetByID(id int) (*AccessPolicy, error) {
+	return scanAccessPolicy(s.db.QueryRow(`SELECT `+accessPolicyColumns+` FROM access_policies p WHERE p.id = ?`, id))
+}
+
+// List 获取全部审批策略
+func (s *AccessPolicyService) List() ([]*AccessPolicy, error) {
+	return s.list(`SELECT ` + accessPolicyColumns + ` FROM access_policies p ORDER BY p.tag`)
+}
+
+// Match 获取适用于申请目标的审批策略：申请服务器时匹配服务器的标签；
+// 申请标签时匹配该标签以及带有该标签的服务器上的其他标签，避免通过宽泛的标签绕过 prod 等严格策略
+func (s *AccessPolicyService) Match(serverID *int, tag string) ([]*AccessPolicy, error) {
+	if serverID != nil {
+		return s.list(`SELECT `+accessPolicyColumns+` FROM access_policies p
+			WHERE p.tag IN (SELECT value FROM servers srv, `+serverTagsQuery+` WHERE srv.id = ?)
+			ORDER BY p.tag`, *serverID)
+	}
+	return s.list(`SELECT `+accessPolicyColumns+` FROM access_policies p
+		WHERE p.tag = ? OR p.tag IN (
+			SELECT t.value FROM servers srv, `+serverTagsQuery+` t
+			WHERE EXISTS (SELECT 1 FROM `+serverTagsQuery+` WHERE value = ?))
+		ORDER BY p.tag`, tag, tag)
+}
+
+func (s *AccessPolicyService) list(query string, args ...interface{}) ([]*AccessPolicy, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*AccessPolicy{}
+	for rows.Next() {
+		policy, err := scanAccessPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// Update 更新审批策略，只影响之后提交的申请
+func (s *AccessPolicyService) Update(id int, req *AccessPolicyUpdate) (*AccessPolicy, error) {
+	policy, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RequiredApprovals != nil {
+		policy.RequiredApprovals = *req.RequiredApprovals
+	}
+	if req.MaxDurationMinutes != nil {
+		policy.MaxDurationMinutes = *req.MaxDurationMinutes
+	}
+	if req.ApproverGroupID != nil {
+		if *req.ApproverGroupID == 0 {
+			policy.ApproverGroupID = nil
+		} else {
+			policy.ApproverGroupID = req.ApproverGroupID
+		}
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE access_policies SET required_approvals = ?, max_duration_minutes = ?, approver_group_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, policy.RequiredApprovals, policy.MaxDurationMinutes, policy.ApproverGroupID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Delete 删除审批策略
+func (s *AccessPolicyService) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM access_policies WHERE id = ?`, id)
+	return err
+}
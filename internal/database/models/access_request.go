@@ -0,0 +1,313 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 临时访问申请状态
+const (
+	AccessRequestPending   = "pending"   // 等待审批
+	AccessRequestApproved  = "approved"  // 已批准，有效期内可以连接
+	AccessRequestDenied    = "denied"    // 被拒绝
+	AccessRequestCancelled = "cancelled" // 申请人在审批前撤回
+	AccessRequestExpired   = "expired"   // 授权到期或审批超时
+	AccessRequestRevoked   = "revoked"   // 授权在到期前被收回
+)
+
+// 审批意见
+const (
+	ApprovalDecisionApprove = "approve"
+	ApprovalDecisionDeny    = "deny"
+)
+
+var (
+	// ErrAccessRequestClosed 申请已不是待审批状态
+	ErrAccessRequestClosed = errors.New("申请已处理，不能再审批")
+	// ErrAlreadyDecided 同一审批人只能审批一次
+	ErrAlreadyDecided = errors.New("已审批过该申请")
+)
+
+// AccessRequest 临时访问申请，批准后在有效期内授予申请人服务器或标签的 connect 权限
+type AccessRequest struct {
+	ID                int               `json:"id" db:"id"`
+	UserID            int               `json:"user_id" db:"user_id"`
+	Username          string            `json:"username" db:"-"`
+	ServerID          *int              `json:"server_id,omitempty" db:"server_id"`
+	ServerName        string            `json:"server_name,omitempty" db:"-"`
+	Tag               string            `json:"tag,omitempty" db:"tag"`
+	Reason            string            `json:"reason" db:"reason"`
+	DurationMinutes   int               `json:"duration_minutes" db:"duration_minutes"`
+	Status            string            `json:"status" db:"status"`
+	RequiredApprovals int               `json:"required_approvals" db:"required_approvals"`
+	ApprovalCount     int               `json:"approval_count" db:"-"`
+	Approvals         []*AccessApproval `json:"approvals,omitempty" db:"-"`
+	ApprovedAt        *time.Time        `json:"approved_at" db:"approved_at"`
+	ExpiresAt         *time.Time        `json:"expires_at" db:"expires_at"`
+	ClosedBy          *int              `json:"closed_by" db:"closed_by"`
+	CloseReason       string            `json:"close_reason,omitempty" db:"close_reason"`
+	CreatedAt         time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// Target 申请目标的描述，用于日志和通知
+func (r *AccessRequest) Target() string {
+	if r.ServerID != nil {
+		if r.ServerName != "" {
+			return "服务器 " + r.ServerName
+		}
+		return "服务器"
+	}
+	return "标签 " + r.Tag
+}
+
+// AccessApproval 审批记录
+type AccessApproval struct {
+	ApproverID   int       `json:"approver_id" db:"approver_id"`
+	ApproverName string    `json:"approver_name" db:"-"`
+	Decision     string    `json:"decision" db:"decision"`
+	Comment      string    `json:"comment,omitempty" db:"comment"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// AccessRequestCreate 提交申请请求，server_id 和 tag 二选一
+type AccessRequestCreate struct {
+	ServerID        *int   `json:"server_id"`
+	Tag             string `json:"tag" binding:"max=100"`
+	Reason          string `json:"reason" binding:"required,max=1000"`
+	DurationMinutes int    `json:"duration_minutes" binding:"required,min=1"`
+}
+
+// AccessRequestDecision 审批、撤回或收回时的说明
+type AccessRequestDecision struct {
+	Comment string `json:"comment" binding:"max=500"`
+}
+
+// AccessRequestFilter 申请查询条件，零值表示不限
+type AccessRequestFilter struct {
+	UserID int
+	Status string
+	Limit  int
+	Offset int
+}
+
+// AccessRequestService 临时访问申请服务
+type AccessRequestService struct {
+	db *sql.DB
+}
+
+// NewAccessRequestService 创建临时访问申请服务
+func NewAccessRequestService(db *sql.DB) *AccessRequestService {
+	return &AccessRequestService{db: db}
+}
+
+const accessRequestColumns = `r.id, r.user_id, COALESCE((SELECT username FROM users WHERE id = r.user_id), ''),
+	r.server_id, COALESCE((SELECT name FROM servers WHERE id = r.server_id), ''), COALESCE(r.tag, ''),
+	r.reason, r.duration_minutes, r.status, r.required_approvals,
+	(SELECT COUNT(*) FROM access_request_approvals a WHERE a.request_id = r.id AND a.decision = 'approve'),
+	r.approved_at, r.expires_at, r.closed_by, COALESCE(r.close_reason, ''), r.created_at, r.updated_at`
+
+func scanAccessRequest(scanner interface{ Scan(...interface{}) error }) (*AccessRequest, error) {
+	var r AccessRequest
+	err := scanner.Scan(&r.ID, &r.UserID, &r.Username, &r.ServerID, &r.ServerName, &r.Tag,
+		&r.Reason, &r.DurationMinutes, &r.Status, &r.RequiredApprovals, &r.ApprovalCount,
+		&r.ApprovedAt, &r.ExpiresAt, &r.ClosedBy, &r.CloseReason, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Create 创建待审批的申请
+func (s *AccessRequestService) Create(userID int, req *AccessRequestCreate, requiredApprovals int) (*AccessRequest, error) {
+	var tag interface{}
+	if req.Tag != "" {
+		tag = req.Tag
+	}
+
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO access_requests (user_id, server_id, tag, reason, duration_minutes, required_approvals, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, req.ServerID, tag, req.Reason, req.DurationMinutes, requiredApprovals, time.Now().UTC(), time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取申请及审批记录
+func (s *AccessRequestService) GetByID(id int) (*AccessRequest, error) {
+	request, err := scanAccessRequest(s.db.QueryRow(`SELECT `+accessRequestColumns+` FROM access_requests r WHERE r.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if request.Approvals, err = s.listApprovals(id); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// listApprovals 获取申请的审批记录
+func (s *AccessRequestService) listApprovals(requestID int) ([]*AccessApproval, error) {
+	rows, err := s.db.Query(`
+		SELECT a.approver_id, COALESCE(u.username, ''), a.decision, COALESCE(a.comment, ''), a.created_at
+		FROM access_request_approvals a
+		LEFT JOIN users u ON u.id = a.approver_id
+		WHERE a.request_id = ?
+		ORDER BY a.created_at
+	`, requestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	approvals := []*AccessApproval{}
+	for rows.Next() {
+		var approval AccessApproval
+		if err := rows.Scan(&approval.ApproverID, &approval.ApproverName, &approval.Decision, &approval.Comment, &approval.CreatedAt); err != nil {
+			return nil, err
+		}
+		approvals = append(approvals, &approval)
+	}
+	return approvals, rows.Err()
+}
+
+// List 按条件查询申请，最新的在前
+func (s *AccessRequestService) List(filter AccessRequestFilter) ([]*AccessRequest, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.UserID > 0 {
+		conditions = append(conditions, "r.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "r.status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := `SELECT ` + accessRequestColumns + ` FROM access_requests r`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY r.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	return s.list(query, args...)
+}
+
+func (s *AccessRequestService) list(query string, args ...interface{}) ([]*AccessRequest, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*AccessRequest{}
+	for rows.Next() {
+		request, err := scanAccessRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// RecordDecision 记录审批意见：任一审批人拒绝即拒绝，批准数达到要求时批准并从此刻开始计算有效期
+// 返回更新后的申请，申请已不是待审批状态时返回 ErrAccessRequestClosed
+func (s *AccessRequestService) RecordDecision(id, approverID int, decision, comment string) (*AccessRequest, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var required, duration int
+	err = tx.QueryRow(`SELECT status, required_approvals, duration_minutes FROM access_requests WHERE id = ?`, id).
+		Scan(&status, &required, &duration)
+	if err != nil {
+		return nil, err
+	}
+	if status != AccessRequestPending {
+		return nil, ErrAccessRequestClosed
+	}
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(`INSERT INTO access_request_approvals (request_id, approver_id, decision, comment, created_at) VALUES (?, ?, ?, ?, ?)`,
+		id, approverID, decision, comment, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrAlreadyDecided
+		}
+		return nil, err
+	}
+
+	if decision == ApprovalDecisionDeny {
+		_, err = tx.Exec(`UPDATE access_requests SET status = ?, closed_by = ?, close_reason = ?, updated_at = ? WHERE id = ?`,
+			AccessRequestDenied, approverID, comment, now, id)
+	} else {
+		var approvals int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM access_request_approvals WHERE request_id = ? AND decision = ?`,
+			id, ApprovalDecisionApprove).Scan(&approvals); err != nil {
+			return nil, err
+		}
+		if approvals >= required {
+			_, err = tx.Exec(`UPDATE access_requests SET status = ?, approved_at = ?, expires_at = ?, updated_at = ? WHERE id = ?`,
+				AccessRequestApproved, now, now.Add(time.Duration(duration)*time.Minute), now, id)
+		} else {
+			_, err = tx.Exec(`UPDATE access_requests SET updated_at = ? WHERE id = ?`, now, id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Close 将申请从 from 状态结束为 to 状态，返回状态是否发生变化（并发时只有一方成功）
+func (s *AccessRequestService) Close(id int, from, to string, closedBy *int, reason string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE access_requests SET status = ?, closed_by = ?, close_reason = ?, updated_at = ?
+		WHERE id = ? AND status = ?
+	`, to, closedBy, reason, time.Now().UTC(), id, from)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ListDue 已到期的授权和超过 pendingBefore 仍未审批的申请
+func (s *AccessRequestService) ListDue(now, pendingBefore time.Time) ([]*AccessRequest, error) {
+	return s.list(`SELECT `+accessRequestColumns+` FROM access_requests r
+		WHERE (r.status = ? AND r.expires_at <= ?) OR (r.status = ? AND r.created_at <= ?)
+		ORDER BY r.id`,
+		AccessRequestApproved, now.UTC(), AccessRequestPending, pendingBefore.UTC())
+}
+
+// HasApproverVoted 审批人是否已审批过该申请
+func (s *AccessRequestService) HasApproverVoted(id, approverID int) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM access_request_approvals WHERE request_id = ? AND approver_id = ?)`,
+		id, approverID).Scan(&exists)
+	return exists, err
+}
+
+// ListActiveFor 用户已批准且未到期、覆盖该服务器（服务器本身或其标签）的临时访问申请
+func (s *AccessRequestService) ListActiveFor(userID, serverID int) ([]*AccessRequest, error) {
+	return s.list(`SELECT `+accessRequestColumns+` FROM access_requests r
+		WHERE r.user_id = ? AND r.status = ? AND r.expires_at > ? AND (r.server_id = ? OR (r.tag IS NOT NULL AND EXISTS (
+			SELECT 1 FROM servers srv, `+serverTagsQuery+` WHERE srv.id = ? AND value = r.tag)))
+		ORDER BY r.id`,
+		userID, AccessRequestApproved, time.Now().UTC(), serverID, serverID)
+}
@@ -0,0 +1,385 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// 访问复核活动状态
+const (
+	AccessReviewActive    = "active"    // 复核中
+	AccessReviewCompleted = "completed" // 已到截止时间，未复核的授权已自动收回
+	AccessReviewCancelled = "cancelled" // 被取消，未复核的授权保持不变
+)
+
+// 复核条目类型
+const (
+	AccessReviewItemDirect     = "direct"     // 直接授予用户的服务器权限（user_server_permissions）
+	AccessReviewItemGrant      = "grant"      // 授予用户或用户组的服务器/标签授权（access_grants）
+	AccessReviewItemMembership = "membership" // 用户组成员关系
+)
+
+// 复核条目的目标类型
+const (
+	AccessReviewTargetServer = "server"
+	AccessReviewTargetTag    = "tag"
+	AccessReviewTargetGroup  = "group"
+)
+
+// 复核结论
+const (
+	AccessReviewPending     = "pending"      // 等待复核
+	AccessReviewApproved    = "approved"     // 确认保留
+	AccessReviewRevoked     = "revoked"      // 复核人收回
+	AccessReviewAutoRevoked = "auto_revoked" // 截止时仍未复核，自动收回
+)
+
+var (
+	// ErrAccessReviewClosed 复核活动已结束
+	ErrAccessReviewClosed = errors.New("复核活动已结束")
+	// ErrAccessReviewDecided 复核条目已有结论
+	ErrAccessReviewDecided = errors.New("该授权已复核")
+)
+
+// AccessReviewCampaign 访问复核活动：创建时对全部授权做快照，复核人逐条确认保留或收回，截止时未复核的授权自动收回
+type AccessReviewCampaign struct {
+	ID                  int                 `json:"id" db:"id"`
+	Name                string              `json:"name" db:"name"`
+	Description         string              `json:"description,omitempty" db:"description"`
+	Status              string              `json:"status" db:"status"`
+	Deadline            time.Time           `json:"deadline" db:"deadline"`
+	DefaultReviewerID   int                 `json:"default_reviewer_id" db:"default_reviewer_id"`
+	DefaultReviewerName string              `json:"default_reviewer_name" db:"-"`
+	TagReviewers        map[string]int      `json:"tag_reviewers" db:"tag_reviewers"` // 标签 -> 复核人ID
+	CreatedBy           *int                `json:"created_by" db:"created_by"`
+	CreatedAt           time.Time           `json:"created_at" db:"created_at"`
+	CompletedAt         *time.Time          `json:"completed_at" db:"completed_at"`
+	Summary             AccessReviewSummary `json:"summary" db:"-"`
+}
+
+// AccessReviewSummary 复核活动各结论的条目数
+type AccessReviewSummary struct {
+	Total       int `json:"total"`
+	Pending     int `json:"pending"`
+	Approved    int `json:"approved"`
+	Revoked     int `json:"revoked"`
+	AutoRevoked int `json:"auto_revoked"`
+}
+
+// AccessReviewCampaignCreate 创建复核活动请求
+type AccessReviewCampaignCreate struct {
+	Name              string         `json:"name" binding:"required,min=1,max=100"`
+	Description       string         `json:"description" binding:"max=1000"`
+	Deadline          time.Time      `json:"deadline" binding:"required"`
+	DefaultReviewerID int            `json:"default_reviewer_id"` // 没有匹配标签复核人和用户组负责人时的复核人，默认为创建人
+	TagReviewers      map[string]int `json:"tag_reviewers"`
+}
+
+// AccessReviewItem 复核条目，保存创建活动时授权的快照，授权之后被修改或删除不影响复核记录
+type AccessReviewItem struct {
+	ID            int        `json:"id" db:"id"`
+	CampaignID    int        `json:"campaign_id" db:"campaign_id"`
+	ItemType      string     `json:"item_type" db:"item_type"`
+	SourceID      int        `json:"source_id" db:"source_id"` // 直接授权ID、授权ID或用户组ID
+	SubjectType   string     `json:"subject_type" db:"subject_type"`
+	SubjectID     int        `json:"subject_id" db:"subject_id"`
+	SubjectName   string     `json:"subject_name" db:"subject_name"`
+	TargetType    string     `json:"target_type" db:"target_type"`
+	TargetID      *int       `json:"target_id,omitempty" db:"target_id"`
+	TargetName    string     `json:"target_name" db:"target_name"`
+	Permission    string     `json:"permission,omitempty" db:"permission"`
+	Origin        string     `json:"origin,omitempty" db:"origin"` // 身份源同步的直接授权的来源
+	ReviewerID    int        `json:"reviewer_id" db:"reviewer_id"`
+	ReviewerName  string     `json:"reviewer_name" db:"-"`
+	Decision      string     `json:"decision" db:"decision"`
+	DecidedBy     *int       `json:"decided_by" db:"decided_by"`
+	DecidedByName string     `json:"decided_by_name,omitempty" db:"-"`
+	DecidedAt     *time.Time `json:"decided_at" db:"decided_at"`
+	Comment       string     `json:"comment,omitempty" db:"comment"`
+}
+
+// AccessReviewDecision 复核意见
+type AccessReviewDecision struct {
+	Decision string `json:"decision" binding:"required,oneof=approve revoke"`
+	Comment  string `json:"comment" binding:"max=1000"`
+}
+
+// AccessReviewReassign 更换复核人请求
+type AccessReviewReassign struct {
+	ReviewerID int `json:"reviewer_id" binding:"required,min=1"`
+}
+
+// AccessReviewItemFilter 复核条目查询条件，零值表示不限
+type AccessReviewItemFilter struct {
+	CampaignID int
+	ReviewerID int
+	Decision   string
+	ActiveOnly bool // 只返回进行中活动的条目
+	Limit      int
+	Offset     int
+}
+
+// AccessReviewService 访问复核服务
+type AccessReviewService struct {
+	db *sql.DB
+}
+
+// NewAccessReviewService 创建访问复核服务
+func NewAccessReviewService(db *sql.DB) *AccessReviewService {
+	return &AccessReviewService{db: db}
+}
+
+const accessReviewCampaignColumns = `c.id, c.name, COALESCE(c.description, ''), c.status, c.deadline,
+	c.default_reviewer_id, COALESCE((SELECT username FROM users WHERE id = c.default_reviewer_id), ''),
+	COALESCE(c.tag_reviewers, ''), c.created_by, c.created_at, c.completed_at,
+	(SELECT COUNT(*) FROM access_review_items i WHERE i.campaign_id = c.id),
+	(SELECT COUNT(*) FROM access_review_items i WHERE i.campaign_id = c.id AND i.decision = 'pending'),
+	(SELECT COUNT(*) FROM access_review_items i WHERE i.campaign_id = c.id AND i.decision = 'approved'),
+	(SELECT COUNT(*) FROM access_review_items i WHERE i.campaign_id = c.id AND i.decision = 'revoked'),
+	(SELECT COUNT(*) FROM access_review_items i WHERE i.campaign_id = c.id AND i.decision = 'auto_revoked')`
+
+func scanAccessReviewCampaign(scanner interface{ Scan(...interface{}) error }) (*AccessReviewCampaign, error) {
+	var c AccessReviewCampaign
+	var tagReviewers string
+	err := scanner.Scan(&c.ID, &c.Name, &c.Description, &c.Status, &c.Deadline,
+		&c.DefaultReviewerID, &c.DefaultReviewerName, &tagReviewers, &c.CreatedBy, &c.CreatedAt, &c.CompletedAt,
+		&c.Summary.Total, &c.Summary.Pending, &c.Summary.Approved, &c.Summary.Revoked, &c.Summary.AutoRevoked)
+	if err != nil {
+		return nil, err
+	}
+	c.TagReviewers = map[string]int{}
+	if tagReviewers != "" {
+		json.Unmarshal([]byte(tagReviewers), &c.TagReviewers)
+	}
+	return &c, nil
+}
+
+const accessReviewItemColumns = `i.id, i.campaign_id, i.item_type, i.source_id, i.subject_type, i.subject_id,
+	COALESCE(i.subject_name, ''), i.target_type, i.target_id, COALESCE(i.target_name, ''),
+	COALESCE(i.permission, ''), COALESCE(i.origin, ''), i.reviewer_id, COALESCE((SELECT username FROM users WHERE id = i.reviewer_id), ''),
+	i.decision, i.decided_by, COALESCE((SELECT username FROM users WHERE id = i.decided_by), ''), i.decided_at, COALESCE(i.comment, '')`
+
+func scanAccessReviewItem(scanner interface{ Scan(...interface{}) error }) (*AccessReviewItem, error) {
+	var i AccessReviewItem
+	err := scanner.Scan(&i.ID, &i.CampaignID, &i.ItemType, &i.SourceID, &i.SubjectType, &i.SubjectID,
+		&i.SubjectName, &i.TargetType, &i.TargetID, &i.TargetName,
+		&i.Permission, &i.Origin, &i.ReviewerID, &i.ReviewerName,
+		&i.Decision, &i.DecidedBy, &i.DecidedByName, &i.DecidedAt, &i.Comment)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Create 创建复核活动并保存授权快照
+func (s *AccessReviewService) Create(req *AccessReviewCampaignCreate, createdBy int, items []*AccessReviewItem) (*AccessReviewCampaign, error) {
+	tagReviewers, err := json.Marshal(req.TagReviewers)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO access_review_campaigns (name, description, status, deadline, default_reviewer_id, tag_reviewers, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.Name, req.Description, AccessReviewActive, req.Deadline.UTC(), req.DefaultReviewerID, string(tagReviewers),
+		createdBy, time.Now().UTC()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO access_review_items (campaign_id, item_type, source_id, subject_type, subject_id, subject_name,
+			target_type, target_id, target_name, permission, origin, reviewer_id, decision)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, item := range items {
+		_, err := stmt.Exec(id, item.ItemType, item.SourceID, item.SubjectType, item.SubjectID, item.SubjectName,
+			item.TargetType, item.TargetID, item.TargetName, item.Permission, item.Origin, item.ReviewerID, AccessReviewPending)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取复核活动
+func (s *AccessReviewService) GetByID(id int) (*AccessReviewCampaign, error) {
+	return scanAccessReviewCampaign(s.db.QueryRow(`SELECT `+accessReviewCampaignColumns+` FROM access_review_campaigns c WHERE c.id = ?`, id))
+}
+
+// List 获取复核活动，status 为空表示不限
+func (s *AccessReviewService) List(status string) ([]*AccessReviewCampaign, error) {
+	query := `SELECT ` + accessReviewCampaignColumns + ` FROM access_review_campaigns c`
+	args := []interface{}{}
+	if status != "" {
+		query += ` WHERE c.status = ?`
+		args = append(args, status)
+	}
+	return s.listCampaigns(query+` ORDER BY c.id DESC`, args...)
+}
+
+// ListDue 已到截止时间但仍在复核中的活动
+func (s *AccessReviewService) ListDue(now time.Time) ([]*AccessReviewCampaign, error) {
+	return s.listCampaigns(`SELECT `+accessReviewCampaignColumns+` FROM access_review_campaigns c
+		WHERE c.status = ? AND c.deadline <= ? ORDER BY c.id`, AccessReviewActive, now.UTC())
+}
+
+func (s *AccessReviewService) listCampaigns(query string, args ...interface{}) ([]*AccessReviewCampaign, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []*AccessReviewCampaign{}
+	for rows.Next() {
+		campaign, err := scanAccessReviewCampaign(rows)
+		if err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, campaign)
+	}
+	return campaigns, rows.Err()
+}
+
+// Close 结束复核中的活动，返回状态是否发生变化（并发时只有一方成功）
+func (s *AccessReviewService) Close(id int, status string) (bool, error) {
+	result, err := s.db.Exec(`UPDATE access_review_campaigns SET status = ?, completed_at = ? WHERE id = ? AND status = ?`,
+		status, time.Now().UTC(), id, AccessReviewActive)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// GetItem 根据ID获取复核条目
+func (s *AccessReviewService) GetItem(id int) (*AccessReviewItem, error) {
+	return scanAccessReviewItem(s.db.QueryRow(`SELECT `+accessReviewItemColumns+` FROM access_review_items i WHERE i.id = ?`, id))
+}
+
+// ListItems 按条件获取复核条目
+func (s *AccessReviewService) ListItems(filter AccessReviewItemFilter) ([]*AccessReviewItem, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.CampaignID > 0 {
+		conditions = append(conditions, "i.campaign_id = ?")
+		args = append(args, filter.CampaignID)
+	}
+	if filter.ReviewerID > 0 {
+		conditions = append(conditions, "i.reviewer_id = ?")
+		args = append(args, filter.ReviewerID)
+	}
+	if filter.ActiveOnly {
+		conditions = append(conditions, "i.campaign_id IN (SELECT id FROM access_review_campaigns WHERE status = ?)")
+		args = append(args, AccessReviewActive)
+	}
+	if filter.Decision != "" {
+		conditions = append(conditions, "i.decision = ?")
+		args = append(args, filter.Decision)
+	}
+
+	query := `SELECT ` + accessReviewItemColumns + ` FROM access_review_items i`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY i.id"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*AccessReviewItem{}
+	for rows.Next() {
+		item, err := scanAccessReviewItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Decide 记录复核结论，只能对复核中活动的待复核条目操作；decidedBy 为 nil 表示系统自动收回
+func (s *AccessReviewService) Decide(itemID int, decision string, decidedBy *int, comment string) error {
+	result, err := s.db.Exec(`
+		UPDATE access_review_items SET decision = ?, decided_by = ?, decided_at = ?, comment = ?
+		WHERE id = ? AND decision = ?
+			AND campaign_id IN (SELECT id FROM access_review_campaigns WHERE status = ?)
+	`, decision, decidedBy, time.Now().UTC(), comment, itemID, AccessReviewPending, AccessReviewActive)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return s.closedError(itemID)
+	}
+	return nil
+}
+
+// Reassign 更换待复核条目的复核人
+func (s *AccessReviewService) Reassign(itemID, reviewerID int) error {
+	result, err := s.db.Exec(`
+		UPDATE access_review_items SET reviewer_id = ?
+		WHERE id = ? AND decision = ?
+			AND campaign_id IN (SELECT id FROM access_review_campaigns WHERE status = ?)
+	`, reviewerID, itemID, AccessReviewPending, AccessReviewActive)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return s.closedError(itemID)
+	}
+	return nil
+}
+
+// closedError 条目无法修改时区分不存在、活动已结束和已复核
+func (s *AccessReviewService) closedError(itemID int) error {
+	item, err := s.GetItem(itemID)
+	if err != nil {
+		return err
+	}
+	campaign, err := s.GetByID(item.CampaignID)
+	if err != nil {
+		return err
+	}
+	if campaign.Status != AccessReviewActive {
+		return ErrAccessReviewClosed
+	}
+	return ErrAccessReviewDecided
+}
+
+// CountPendingForReviewer 复核人在进行中活动里待复核的条目数
+func (s *AccessReviewService) CountPendingForReviewer(reviewerID int) (int, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM access_review_items
+		WHERE reviewer_id = ? AND decision = ?
+			AND campaign_id IN (SELECT id FROM access_review_campaigns WHERE status = ?)
+	`, reviewerID, AccessReviewPending, AccessReviewActive).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 账号类型
+const (
+	AccountTypeHuman   = "human"   // 普通用户，可使用密码登录
+	AccountTypeService = "service" // 服务账号，只能通过 API 令牌访问
+)
+
+// API 令牌权限范围，资源:read 只允许只读请求，资源:write 同时包含读权限
+const (
+	ScopeServersRead      = "servers:read"
+	ScopeServersWrite     = "servers:write"
+	ScopeCredentialsRead  = "credentials:read"
+	ScopeCredentialsWrite = "credentials:write"
+	ScopeSessionsRead     = "sessions:read"
+	ScopeSessionsWrite    = "sessions:write"
+	ScopeUsersRead        = "users:read"
+	ScopeUsersWrite       = "users:write"
+	ScopeAuditRead        = "audit:read"
+	ScopeAuditWrite       = "audit:write"
+	ScopeSystemRead       = "system:read"
+	ScopeSystemWrite      = "system:write"
+)
+
+// AllScopes 全部可用的令牌权限范围
+var AllScopes = []string{
+	ScopeServersRead, ScopeServersWrite,
+	ScopeCredentialsRead, ScopeCredentialsWrite,
+	ScopeSessionsRead, ScopeSessionsWrite,
+	ScopeUsersRead, ScopeUsersWrite,
+	ScopeAuditRead, ScopeAuditWrite,
+	ScopeSystemRead, ScopeSystemWrite,
+}
+
+// ValidateScopes 校验权限范围是否合法
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		valid := false
+		for _, s := range AllScopes {
+			if scope == s {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("未知的权限范围: %s", scope)
+		}
+	}
+	return nil
+}
+
+// HasScope 判断权限范围列表是否包含 scope，资源:write 隐含资源:read
+func HasScope(scopes []string, scope string) bool {
+	write := strings.TrimSuffix(scope, ":read") + ":write"
+	for _, s := range scopes {
+		if s == scope || (strings.HasSuffix(scope, ":read") && s == write) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken API 令牌
+type APIToken struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Username    string     `json:"username" db:"-"`
+	Name        string     `json:"name" db:"name"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"` // 便于识别令牌的前几位明文
+	TokenHash   string     `json:"-" db:"token_hash"`
+	Scopes      []string   `json:"scopes" db:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP  string     `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt   *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedBy   int        `json:"created_by" db:"created_by"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+
+	// 所属用户的当前状态，仅在按哈希查询时填充
+	UserRole        string `json:"-" db:"-"`
+	UserAccountType string `json:"-" db:"-"`
+	UserActive      bool   `json:"-" db:"-"`
+}
+
+// Active 令牌是否仍然有效
+func (t *APIToken) Active() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || time.Now().Before(*t.ExpiresAt)
+}
+
+// APITokenCreate 创建 API 令牌请求
+type APITokenCreate struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"` // 为空表示永不过期
+}
+
+// ServiceAccountCreate 创建服务账号请求
+type ServiceAccountCreate struct {
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Role     string `json:"role" binding:"required,max=20"`
+}
+
+// APITokenService API 令牌服务
+type APITokenService struct {
+	db *sql.DB
+}
+
+// NewAPITokenService 创建 API 令牌服务
+func NewAPITokenService(db *sql.DB) *APITokenService {
+	return &APITokenService{db: db}
+}
+
+const apiTokenColumns = `t.id, t.user_id, u.username, t.name, t.token_prefix, t.token_hash, t.scopes, t.expires_at,
+	t.last_used_at, COALESCE(t.last_used_ip, ''), t.revoked_at, COALESCE(t.created_by, 0), t.created_at,
+	u.role, u.account_type, u.status, u.expires_at`
+
+func scanAPIToken(scanner interface{ Scan(...interface{}) error }) (*APIToken, error) {
+	var token APIToken
+	var scopes string
+	var user User
+	err := scanner.Scan(&token.ID, &token.UserID, &token.Username, &token.Name, &token.TokenPrefix, &token.TokenHash,
+		&scopes, &token.ExpiresAt, &token.LastUsedAt, &token.LastUsedIP, &token.RevokedAt, &token.CreatedBy,
+		&token.CreatedAt, &token.UserRole, &token.UserAccountType, &user.Status, &user.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	token.UserActive = user.Active()
+	token.Scopes = []string{}
+	json.Unmarshal([]byte(scopes), &token.Scopes)
+	return &token, nil
+}
+
+// Create 保存 API 令牌
+func (s *APITokenService) Create(token *APIToken) error {
+	scopes, err := json.Marshal(token.Scopes)
+	if err != nil {
+		return err
+	}
+	var expiresAt interface{}
+	if token.ExpiresAt != nil {
+		expiresAt = token.ExpiresAt.UTC()
+	}
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, token.UserID, token.Name, token.TokenPrefix, token.TokenHash, string(scopes), expiresAt, token.CreatedBy, now)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	token.ID = int(id)
+	token.CreatedAt = now
+	return nil
+}
+
+// GetByID 根据ID获取 API 令牌
+func (s *APITokenService) GetByID(id int) (*APIToken, error) {
+	return scanAPIToken(s.db.QueryRow(`
+		SELECT `+apiTokenColumns+` FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.id = ?
+	`, id))
+}
+
+// GetByHash 根据哈希获取 API 令牌，所属用户已删除时返回 sql.ErrNoRows
+func (s *APITokenService) GetByHash(tokenHash string) (*APIToken, error) {
+	return scanAPIToken(s.db.QueryRow(`
+		SELECT `+apiTokenColumns+` FROM api_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = ?
+	`, tokenHash))
+}
+
+// List 获取 API 令牌列表，userID 为 0 时返回全部
+func (s *APITokenService) List(userID int) ([]*APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens t JOIN users u ON u.id = t.user_id`
+	args := []interface{}{}
+	if userID > 0 {
+		query += ` WHERE t.user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY t.created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke 撤销 API 令牌
+func (s *APITokenService) Revoke(id int) error {
+	result, err := s.db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAllForUser 撤销用户的全部 API 令牌
+func (s *APITokenService) RevokeAllForUser(userID int) error {
+	_, err := s.db.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL`, time.Now().UTC(), userID)
+	return err
+}
+
+// RecordUsage 记录令牌最近使用时间和来源IP
+func (s *APITokenService) RecordUsage(id int, ipAddress string) error {
+	_, err := s.db.Exec(`UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, time.Now().UTC(), ipAddress, id)
+	return err
+}
@@ -16,6 +16,8 @@ type AuditLog struct {
 	UserAgent    string    `json:"user_agent" db:"user_agent"`        // 客户端信息
 	Success      bool      `json:"success" db:"success"`              // 操作是否成功
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	PrevHash     string    `json:"prev_hash" db:"prev_hash"` // 上一条日志的哈希
+	Hash         string    `json:"hash" db:"hash"`           // 本条日志的链式哈希
 }
 
 // TerminalSession 终端会话统计模型
@@ -29,9 +31,13 @@ type TerminalSession struct {
 	Duration     int        `json:"duration" db:"duration"`           // 持续时间（秒）
 	CommandCount int        `json:"command_count" db:"command_count"` // 执行命令数量
 	IPAddress    string     `json:"ip_address" db:"ip_address"`
-	Status       string     `json:"status" db:"status"` // active, ended, error
+	Status       string     `json:"status" db:"status"`       // active, ended, error
+	Reason       string     `json:"reason" db:"reason"`       // 连接原因
+	TicketID     string     `json:"ticket_id" db:"ticket_id"` // 关联的工单号
 	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
+	Username     string     `json:"username,omitempty"`    // 关联查询时使用
+	ServerName   string     `json:"server_name,omitempty"` // 关联查询时使用
 }
 
 // SecurityAlert 安全告警模型
@@ -49,6 +55,7 @@ type SecurityAlert struct {
 	ResolvedBy  *int       `json:"resolved_by" db:"resolved_by"` // 解决人ID
 	ResolvedAt  *time.Time `json:"resolved_at" db:"resolved_at"` // 解决时间
 	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	Broadcast   bool       `json:"-" db:"-"` // 发送到全部通知渠道，不经过路由条件、去重和限流
 }
 
 // AuditStatistics 审计统计信息
@@ -60,3 +67,60 @@ type AuditStatistics struct {
 	SecurityAlerts   int `json:"security_alerts"`
 	UnresolvedAlerts int `json:"unresolved_alerts"`
 }
+
+// AuditLogFilter 审计日志查询条件
+type AuditLogFilter struct {
+	UserID       *int
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Success      *bool
+	IPAddress    string
+	StartTime    *time.Time
+	EndTime      *time.Time
+	Search       string // 在 details 中全文匹配
+	SortBy       string // created_at, action, user_id, ip_address, success
+	SortOrder    string // asc, desc
+	Limit        int
+	Offset       int
+}
+
+// TerminalSessionFilter 终端会话查询条件
+type TerminalSessionFilter struct {
+	UserID    *int
+	ServerID  *int
+	Status    string
+	IPAddress string
+	TicketID  string
+	Search    string // 在连接原因和工单号中模糊匹配
+	StartTime *time.Time
+	EndTime   *time.Time
+	SortBy    string // start_time, duration, command_count, user_id, server_id
+	SortOrder string // asc, desc
+	Limit     int
+	Offset    int
+}
+
+// AuditCheckpoint 审计哈希链检查点
+type AuditCheckpoint struct {
+	ID         int       `json:"id" db:"id"`
+	Kind       string    `json:"kind" db:"kind"` // checkpoint, anchor
+	LastLogID  int       `json:"last_log_id" db:"last_log_id"`
+	LastHash   string    `json:"last_hash" db:"last_hash"`
+	EntryCount int       `json:"entry_count" db:"entry_count"` // anchor 时为被截断的条数
+	Details    string    `json:"details" db:"details"`
+	Signature  string    `json:"signature" db:"signature"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuditChainReport 审计哈希链校验结果
+type AuditChainReport struct {
+	Valid               bool      `json:"valid"`
+	CheckedEntries      int       `json:"checked_entries"`
+	CheckpointsVerified int       `json:"checkpoints_verified"`
+	AnchorID            *int      `json:"anchor_id,omitempty"`       // 校验起点锚点
+	FirstBrokenID       *int      `json:"first_broken_id,omitempty"` // 第一个断裂的日志ID
+	BrokenCheckpointID  *int      `json:"broken_checkpoint_id,omitempty"`
+	Reason              string    `json:"reason,omitempty"`
+	VerifiedAt          time.Time `json:"verified_at"`
+}
@@ -0,0 +1,205 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AuthSession 登录会话
+type AuthSession struct {
+	ID           string     `json:"id" db:"id"`
+	UserID       int        `json:"user_id" db:"user_id"`
+	TokenVersion int        `json:"-" db:"token_version"`
+	IPAddress    string     `json:"ip_address" db:"ip_address"`
+	UserAgent    string     `json:"user_agent" db:"user_agent"`
+	ExpiresAt    time.Time  `json:"expires_at" db:"expires_at"`
+	LastSeenAt   *time.Time `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt    *time.Time `json:"revoked_at" db:"revoked_at"`
+	RevokeReason string     `json:"revoke_reason,omitempty" db:"revoke_reason"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
+
+// Active 会话是否仍然有效
+func (s *AuthSession) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RefreshToken 刷新令牌记录
+type RefreshToken struct {
+	ID        int        `json:"id" db:"id"`
+	SessionID string     `json:"session_id" db:"session_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// AuthSessionService 登录会话服务
+type AuthSessionService struct {
+	db *sql.DB
+}
+
+// NewAuthSessionService 创建登录会话服务
+func NewAuthSessionService(db *sql.DB) *AuthSessionService {
+	return &AuthSessionService{db: db}
+}
+
+const authSessionColumns = `id, user_id, token_version, COALESCE(ip_address, ''), COALESCE(user_agent, ''), expires_at, last_seen_at, revoked_at, COALESCE(revoke_reason, ''), created_at`
+
+func scanAuthSession(scanner interface{ Scan(...interface{}) error }) (*AuthSession, error) {
+	var session AuthSession
+	err := scanner.Scan(&session.ID, &session.UserID, &session.TokenVersion, &session.IPAddress, &session.UserAgent,
+		&session.ExpiresAt, &session.LastSeenAt, &session.RevokedAt, &session.RevokeReason, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Create 创建登录会话
+func (s *AuthSessionService) Create(session *AuthSession) error {
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`
+		INSERT INTO auth_sessions (id, user_id, token_version, ip_address, user_agent, expires_at, last_seen_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, session.ID, session.UserID, session.TokenVersion, session.IPAddress, session.UserAgent,
+		session.ExpiresAt.UTC(), now, now)
+	if err != nil {
+		return err
+	}
+	session.LastSeenAt = &now
+	session.CreatedAt = now
+	return nil
+}
+
+// GetByID 根据ID获取登录会话
+func (s *AuthSessionService) GetByID(id string) (*AuthSession, error) {
+	return scanAuthSession(s.db.QueryRow(`SELECT `+authSessionColumns+` FROM auth_sessions WHERE id = ?`, id))
+}
+
+// ListByUser 获取用户的登录会话，activeOnly 为 true 时只返回未撤销且未过期的会话
+func (s *AuthSessionService) ListByUser(userID int, activeOnly bool) ([]*AuthSession, error) {
+	query := `SELECT ` + authSessionColumns + ` FROM auth_sessions WHERE user_id = ?`
+	args := []interface{}{userID}
+	if activeOnly {
+		query += ` AND revoked_at IS NULL AND expires_at > ?`
+		args = append(args, time.Now().UTC())
+	}
+	query += ` ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*AuthSession{}
+	for rows.Next() {
+		session, err := scanAuthSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Touch 刷新时更新会话的最近活动信息和过期时间
+func (s *AuthSessionService) Touch(id, ipAddress, userAgent string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE auth_sessions SET last_seen_at = ?, ip_address = ?, user_agent = ?, expires_at = ? WHERE id = ?
+	`, time.Now().UTC(), ipAddress, userAgent, expiresAt.UTC(), id)
+	return err
+}
+
+// Revoke 撤销登录会话
+func (s *AuthSessionService) Revoke(id, reason string) error {
+	_, err := s.db.Exec(`
+		UPDATE auth_sessions SET revoked_at = ?, revoke_reason = ? WHERE id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), reason, id)
+	return err
+}
+
+// RevokeAllForUser 撤销用户的所有登录会话，返回撤销数量
+func (s *AuthSessionService) RevokeAllForUser(userID int, reason string) (int, error) {
+	return revokeUserSessions(s.db, userID, reason)
+}
+
+// revokeUserSessions 撤销用户的所有登录会话
+func revokeUserSessions(db *sql.DB, userID int, reason string) (int, error) {
+	result, err := db.Exec(`
+		UPDATE auth_sessions SET revoked_at = ?, revoke_reason = ? WHERE user_id = ? AND revoked_at IS NULL
+	`, time.Now().UTC(), reason, userID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
+// CreateRefreshToken 保存刷新令牌哈希
+func (s *AuthSessionService) CreateRefreshToken(sessionID, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO refresh_tokens (session_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)
+	`, sessionID, tokenHash, expiresAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// GetRefreshToken 根据哈希获取刷新令牌
+func (s *AuthSessionService) GetRefreshToken(tokenHash string) (*RefreshToken, error) {
+	var token RefreshToken
+	err := s.db.QueryRow(`
+		SELECT id, session_id, token_hash, expires_at, used_at, created_at FROM refresh_tokens WHERE token_hash = ?
+	`, tokenHash).Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed 标记刷新令牌已使用，令牌已被使用过时返回 false
+func (s *AuthSessionService) MarkRefreshTokenUsed(id int) (bool, error) {
+	result, err := s.db.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// DeleteExpiredRefreshTokens 清理已过期的刷新令牌
+func (s *AuthSessionService) DeleteExpiredRefreshTokens() error {
+	_, err := s.db.Exec(`DELETE FROM refresh_tokens WHERE expires_at < ?`, time.Now().UTC())
+	return err
+}
+
+// TokenState 校验访问令牌所需的用户和会话状态
+type TokenState struct {
+	TokenVersion int
+	Role         string
+	SessionFound bool
+	SessionValid bool
+	UserActive   bool // 账号状态为 active 且未过期
+}
+
+// GetTokenState 查询用户当前令牌版本、角色、账号状态和登录会话状态，用户不存在时返回 sql.ErrNoRows
+func (s *AuthSessionService) GetTokenState(userID int, sessionID string) (*TokenState, error) {
+	var state TokenState
+	var sessionUserID *int
+	var revokedAt *time.Time
+	var expiresAt *time.Time
+	user := User{}
+	err := s.db.QueryRow(`
+		SELECT u.token_version, u.role, u.status, u.expires_at, a.user_id, a.revoked_at, a.expires_at
+		FROM users u
+		LEFT JOIN auth_sessions a ON a.id = ? AND a.user_id = u.id
+		WHERE u.id = ?
+	`, sessionID, userID).Scan(&state.TokenVersion, &state.Role, &user.Status, &user.ExpiresAt, &sessionUserID, &revokedAt, &expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	state.UserActive = user.Active()
+	state.SessionFound = sessionUserID != nil
+	state.SessionValid = state.SessionFound && revokedAt == nil && expiresAt != nil && time.Now().Before(*expiresAt)
+	return &state, nil
+}
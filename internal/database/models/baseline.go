@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// BaselineEntry 基线中的单个观测对象（来源IP、网段、服务器）
+type BaselineEntry struct {
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// UserBaseline 用户行为基线
+type UserBaseline struct {
+	UserID        int                       `json:"user_id"`
+	Username      string                    `json:"username,omitempty"` // 关联查询时使用
+	Observations  int                       `json:"observations"`       // 登录和会话的累计观测次数
+	Hours         [24]int                   `json:"hours"`              // 按小时统计的活动次数
+	SourceIPs     map[string]*BaselineEntry `json:"source_ips"`
+	Subnets       map[string]*BaselineEntry `json:"subnets"`
+	Servers       map[int]*BaselineEntry    `json:"servers"`
+	DailySessions map[string]int            `json:"daily_sessions"` // key: 日期 2006-01-02
+	SessionCount  int                       `json:"session_count"`  // 已结束会话数
+	SessionMean   float64                   `json:"session_mean_seconds"`
+	SessionM2     float64                   `json:"-"` // Welford 算法的平方差累计
+	SessionStdDev float64                   `json:"session_stddev_seconds"`
+	LastAlertDay  string                    `json:"last_volume_alert_day,omitempty"`
+	UpdatedAt     time.Time                 `json:"updated_at"`
+	CreatedAt     time.Time                 `json:"created_at"`
+}
+
+// NewUserBaseline 创建空基线
+func NewUserBaseline(userID int) *UserBaseline {
+	return &UserBaseline{
+		UserID:        userID,
+		SourceIPs:     map[string]*BaselineEntry{},
+		Subnets:       map[string]*BaselineEntry{},
+		Servers:       map[int]*BaselineEntry{},
+		DailySessions: map[string]int{},
+	}
+}
+
+// AddSessionDuration 累计会话时长的均值和方差
+func (b *UserBaseline) AddSessionDuration(seconds float64) {
+	b.SessionCount++
+	delta := seconds - b.SessionMean
+	b.SessionMean += delta / float64(b.SessionCount)
+	b.SessionM2 += delta * (seconds - b.SessionMean)
+	b.updateStdDev()
+}
+
+func (b *UserBaseline) updateStdDev() {
+	if b.SessionCount > 1 {
+		b.SessionStdDev = math.Sqrt(b.SessionM2 / float64(b.SessionCount-1))
+	} else {
+		b.SessionStdDev = 0
+	}
+}
+
+// baselineData 基线的持久化结构，SessionM2 不对外输出但需要保存
+type baselineData struct {
+	*UserBaseline
+	SessionM2 float64 `json:"session_m2"`
+}
+
+// BaselineService 用户行为基线服务
+type BaselineService struct {
+	db *sql.DB
+}
+
+// NewBaselineService 创建用户行为基线服务
+func NewBaselineService(db *sql.DB) *BaselineService {
+	return &BaselineService{db: db}
+}
+
+func decodeBaseline(userID int, data string, createdAt, updatedAt time.Time) (*UserBaseline, error) {
+	baseline := NewUserBaseline(userID)
+	stored := baselineData{UserBaseline: baseline}
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, err
+	}
+	baseline.SessionM2 = stored.SessionM2
+	baseline.UserID = userID
+	baseline.CreatedAt = createdAt
+	baseline.UpdatedAt = updatedAt
+	if baseline.SourceIPs == nil {
+		baseline.SourceIPs = map[string]*BaselineEntry{}
+	}
+	if baseline.Subnets == nil {
+		baseline.Subnets = map[string]*BaselineEntry{}
+	}
+	if baseline.Servers == nil {
+		baseline.Servers = map[int]*BaselineEntry{}
+	}
+	if baseline.DailySessions == nil {
+		baseline.DailySessions = map[string]int{}
+	}
+	baseline.updateStdDev()
+	return baseline, nil
+}
+
+// Get 获取用户基线，不存在时返回空基线
+func (s *BaselineService) Get(userID int) (*UserBaseline, error) {
+	var data string
+	var createdAt, updatedAt time.Time
+	err := s.db.QueryRow("SELECT data, created_at, updated_at FROM user_baselines WHERE user_id = ?", userID).
+		Scan(&data, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		return NewUserBaseline(userID), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeBaseline(userID, data, createdAt, updatedAt)
+}
+
+// Save 保存用户基线
+func (s *BaselineService) Save(baseline *UserBaseline) error {
+	data, err := json.Marshal(baselineData{UserBaseline: baseline, SessionM2: baseline.SessionM2})
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = s.db.Exec(`
+		INSERT INTO user_baselines (user_id, data, created_at, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at
+	`, baseline.UserID, string(data), now, now)
+	if err == nil {
+		baseline.UpdatedAt = now
+	}
+	return err
+}
+
+// List 获取所有用户基线
+func (s *BaselineService) List() ([]*UserBaseline, error) {
+	rows, err := s.db.Query(`
+		SELECT b.user_id, b.data, b.created_at, b.updated_at, COALESCE(u.username, '')
+		FROM user_baselines b
+		LEFT JOIN users u ON b.user_id = u.id
+		ORDER BY b.user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	baselines := []*UserBaseline{}
+	for rows.Next() {
+		var userID int
+		var data, username string
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&userID, &data, &createdAt, &updatedAt, &username); err != nil {
+			return nil, err
+		}
+		baseline, err := decodeBaseline(userID, data, createdAt, updatedAt)
+		if err != nil {
+			return nil, err
+		}
+		baseline.Username = username
+		baselines = append(baselines, baseline)
+	}
+	return baselines, rows.Err()
+}
+
+// Delete 重置用户基线，之后重新进入学习期
+func (s *BaselineService) Delete(userID int) error {
+	_, err := s.db.Exec("DELETE FROM user_baselines WHERE user_id = ?", userID)
+	return err
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// 紧急访问状态
+const (
+	BreakGlassActive  = "active"  // 生效中，可以连接任意服务器
+	BreakGlassEnded   = "ended"   // 到期前由本人结束或被管理员收回
+	BreakGlassExpired = "expired" // 到期自动结束
+)
+
+// 紧急访问复核状态
+const (
+	BreakGlassReviewPending   = "pending"    // 等待事后复核
+	BreakGlassReviewSignedOff = "signed_off" // 已复核签字
+)
+
+// BreakGlassActivation 紧急访问：审批链不可用时在固定时长内授予任意服务器的 connect 权限，结束后需要事后复核
+type BreakGlassActivation struct {
+	ID            int        `json:"id" db:"id"`
+	UserID        int        `json:"user_id" db:"user_id"`
+	Username      string     `json:"username" db:"-"`
+	Justification string     `json:"justification" db:"justification"`
+	Status        string     `json:"status" db:"status"`
+	IPAddress     string     `json:"ip_address" db:"ip_address"`
+	ActivatedAt   time.Time  `json:"activated_at" db:"activated_at"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	EndedAt       *time.Time `json:"ended_at" db:"ended_at"`
+	EndedBy       *int       `json:"ended_by" db:"ended_by"`
+	EndReason     string     `json:"end_reason,omitempty" db:"end_reason"`
+	ReviewStatus  string     `json:"review_status" db:"review_status"`
+	ReviewedBy    *int       `json:"reviewed_by" db:"reviewed_by"`
+	ReviewerName  string     `json:"reviewer_name,omitempty" db:"-"`
+	ReviewedAt    *time.Time `json:"reviewed_at" db:"reviewed_at"`
+	ReviewNotes   string     `json:"review_notes,omitempty" db:"review_notes"`
+	Sessions      []*Session `json:"sessions,omitempty" db:"-"` // 紧急访问期间建立的终端会话
+}
+
+// BreakGlassCreate 发起紧急访问请求
+type BreakGlassCreate struct {
+	Justification string `json:"justification" binding:"required,min=10,max=2000"`
+}
+
+// BreakGlassEnd 提前结束紧急访问时的说明
+type BreakGlassEnd struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// BreakGlassReview 事后复核签字请求
+type BreakGlassReview struct {
+	Notes string `json:"notes" binding:"required,max=2000"`
+}
+
+// BreakGlassFilter 紧急访问查询条件，零值表示不限
+type BreakGlassFilter struct {
+	UserID       int
+	Status       string
+	ReviewStatus string
+	Limit        int
+	Offset       int
+}
+
+// BreakGlassService 紧急访问服务
+type BreakGlassService struct {
+	db *sql.DB
+}
+
+// NewBreakGlassService 创建紧急访问服务
+func NewBreakGlassService(db *sql.DB) *BreakGlassService {
+	return &BreakGlassService{db: db}
+}
+
+const breakGlassColumns = `b.id, b.user_id, COALESCE((SELECT username FROM users WHERE id = b.user_id), ''),
+	b.justification, b.status, COALESCE(b.ip_address, ''), b.activated_at, b.expires_at, b.ended_at, b.ended_by,
+	COALESCE(b.end_reason, ''), b.review_status, b.reviewed_by, COALESCE((SELECT username FROM users WHERE id = b.reviewed_by), ''),
+	b.reviewed_at, COALESCE(b.review_notes, '')`
+
+func scanBreakGlass(scanner interface{ Scan(...interface{}) error }) (*BreakGlassActivation, error) {
+	var b BreakGlassActivation
+	err := scanner.Scan(&b.ID, &b.UserID, &b.Username, &b.Justification, &b.Status, &b.IPAddress,
+		&b.ActivatedAt, &b.ExpiresAt, &b.EndedAt, &b.EndedBy, &b.EndReason,
+		&b.ReviewStatus, &b.ReviewedBy, &b.ReviewerName, &b.ReviewedAt, &b.ReviewNotes)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Create 创建生效中的紧急访问
+func (s *BreakGlassService) Create(userID int, justification, ipAddress string, duration time.Duration) (*BreakGlassActivation, error) {
+	now := time.Now().UTC()
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO break_glass_activations (user_id, justification, status, ip_address, activated_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, userID, justification, BreakGlassActive, ipAddress, now, now.Add(duration)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取紧急访问
+func (s *BreakGlassService) GetByID(id int) (*BreakGlassActivation, error) {
+	return scanBreakGlass(s.db.QueryRow(`SELECT `+breakGlassColumns+` FROM break_glass_activations b WHERE b.id = ?`, id))
+}
+
+// Active 获取用户当前生效中的紧急访问，没有时返回 sql.ErrNoRows
+func (s *BreakGlassService) Active(userID int) (*BreakGlassActivation, error) {
+	return scanBreakGlass(s.db.QueryRow(`SELECT `+breakGlassColumns+` FROM break_glass_activations b
+		WHERE b.user_id = ? AND b.status = ? AND b.expires_at > ?
+		ORDER BY b.id DESC LIMIT 1`, userID, BreakGlassActive, time.Now().UTC()))
+}
+
+// List 按条件获取紧急访问记录
+func (s *BreakGlassService) List(filter BreakGlassFilter) ([]*BreakGlassActivation, error) {
+	conditions := []string{}
+	args := []interface{}{}
+	if filter.UserID > 0 {
+		conditions = append(conditions, "b.user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "b.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.ReviewStatus != "" {
+		conditions = append(conditions, "b.review_status = ?")
+		args = append(args, filter.ReviewStatus)
+	}
+
+	query := `SELECT ` + breakGlassColumns + ` FROM break_glass_activations b`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY b.id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	return s.list(query, args...)
+}
+
+// ListDue 已到期但仍为生效状态的紧急访问
+func (s *BreakGlassService) ListDue(now time.Time) ([]*BreakGlassActivation, error) {
+	return s.list(`SELECT `+breakGlassColumns+` FROM break_glass_activations b
+		WHERE b.status = ? AND b.expires_at <= ? ORDER BY b.id`, BreakGlassActive, now.UTC())
+}
+
+func (s *BreakGlassService) list(query string, args ...interface{}) ([]*BreakGlassActivation, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	activations := []*BreakGlassActivation{}
+	for rows.Next() {
+		activation, err := scanBreakGlass(rows)
+		if err != nil {
+			return nil, err
+		}
+		activations = append(activations, activation)
+	}
+	return activations, rows.Err()
+}
+
+// End 结束生效中的紧急访问，返回状态是否发生变化（并发时只有一方成功）
+func (s *BreakGlassService) End(id int, status string, endedBy *int, reason string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE break_glass_activations SET status = ?, ended_at = ?, ended_by = ?, end_reason = ?
+		WHERE id = ? AND status = ?
+	`, status, time.Now().UTC(), endedBy, reason, id, BreakGlassActive)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// SignOff 记录事后复核签字，只能签字一次
+func (s *BreakGlassService) SignOff(id, reviewerID int, notes string) (bool, error) {
+	result, err := s.db.Exec(`
+		UPDATE break_glass_activations SET review_status = ?, reviewed_by = ?, reviewed_at = ?, review_notes = ?
+		WHERE id = ? AND review_status = ?
+	`, BreakGlassReviewSignedOff, reviewerID, time.Now().UTC(), notes, id, BreakGlassReviewPending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// CountPendingReview 等待复核的紧急访问数
+func (s *BreakGlassService) CountPendingReview() (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM break_glass_activations WHERE review_status = ?`, BreakGlassReviewPending).Scan(&count)
+	return count, err
+}
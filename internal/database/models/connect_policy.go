@@ -0,0 +1,437 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrConnectPolicyConflict 策略在读取后被其他人修改
+var ErrConnectPolicyConflict = errors.New("策略已被其他人修改，请刷新后重试")
+
+// 连接策略效果，多条策略同时命中时 deny 优先于 require_approval，require_approval 优先于 allow
+const (
+	PolicyEffectAllow           = "allow"
+	PolicyEffectDeny            = "deny"
+	PolicyEffectRequireApproval = "require_approval" // 需要已批准的临时访问申请或生效中的紧急访问
+)
+
+// 连接策略模式
+const (
+	PolicyModeEnforce = "enforce" // 命中后生效
+	PolicyModeDryRun  = "dry_run" // 只记录命中结果，不影响连接
+)
+
+// 连接策略附加要求，命中的策略的要求合并后作用于会话
+const (
+	ObligationRecord   = "record"    // 必须录制，录制启动失败时不允许连接
+	ObligationReadOnly = "read_only" // 只读终端，不接受用户输入
+)
+
+// ConnectPolicy 连接策略：用表达式描述连接条件，命中时给出允许、拒绝或需要审批的决定，每次修改生成新版本
+type ConnectPolicy struct {
+	ID            int       `json:"id" db:"id"`
+	Name          string    `json:"name" db:"name"`
+	Description   string    `json:"description" db:"description"`
+	Expression    string    `json:"expression" db:"expression"`
+	Effect        string    `json:"effect" db:"effect"`
+	Obligations   []string  `json:"obligations" db:"obligations"`
+	Priority      int       `json:"priority" db:"priority"` // 数值大的先求值，只影响决策记录中的顺序
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	Mode          string    `json:"mode" db:"mode"`
+	Version       int       `json:"version" db:"version"`
+	UpdatedBy     *int      `json:"updated_by" db:"updated_by"`
+	UpdatedByName string    `json:"updated_by_name,omitempty" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ConnectPolicyVersion 连接策略的历史版本
+type ConnectPolicyVersion struct {
+	ID            int       `json:"id" db:"id"`
+	PolicyID      int       `json:"policy_id" db:"policy_id"`
+	Version       int       `json:"version" db:"version"`
+	Description   string    `json:"description" db:"description"`
+	Expression    string    `json:"expression" db:"expression"`
+	Effect        string    `json:"effect" db:"effect"`
+	Obligations   []string  `json:"obligations" db:"obligations"`
+	Priority      int       `json:"priority" db:"priority"`
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	Mode          string    `json:"mode" db:"mode"`
+	Comment       string    `json:"comment,omitempty" db:"comment"`
+	CreatedBy     *int      `json:"created_by" db:"created_by"`
+	CreatedByName string    `json:"created_by_name,omitempty" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
+
+// ConnectPolicyCreate 创建连接策略请求
+type ConnectPolicyCreate struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=500"`
+	Expression  string   `json:"expression" binding:"required,max=4000"`
+	Effect      string   `json:"effect" binding:"required,oneof=allow deny require_approval"`
+	Obligations []string `json:"obligations" binding:"dive,oneof=record read_only"`
+	Priority    int      `json:"priority"`
+	Enabled     *bool    `json:"enabled"`
+	Mode        string   `json:"mode" binding:"omitempty,oneof=enforce dry_run"`
+	Comment     string   `json:"comment" binding:"max=500"` // 版本说明
+}
+
+// ConnectPolicyUpdate 更新连接策略请求，生成新版本
+type ConnectPolicyUpdate struct {
+	Description *string   `json:"description" binding:"omitempty,max=500"`
+	Expression  *string   `json:"expression" binding:"omitempty,max=4000"`
+	Effect      *string   `json:"effect" binding:"omitempty,oneof=allow deny require_approval"`
+	Obligations *[]string `json:"obligations" binding:"omitempty,dive,oneof=record read_only"`
+	Priority    *int      `json:"priority"`
+	Enabled     *bool     `json:"enabled"`
+	Mode        *string   `json:"mode" binding:"omitempty,oneof=enforce dry_run"`
+	Comment     string    `json:"comment" binding:"max=500"`
+}
+
+// ConnectPolicyDraft 试运行时附带的未保存策略
+type ConnectPolicyDraft struct {
+	Expression  string   `json:"expression" binding:"required,max=4000"`
+	Effect      string   `json:"effect" binding:"required,oneof=allow deny require_approval"`
+	Obligations []string `json:"obligations" binding:"dive,oneof=record read_only"`
+}
+
+// ConnectPolicyDryRun 试运行请求：模拟用户在指定时间从指定IP连接服务器
+type ConnectPolicyDryRun struct {
+	UserID     int                 `json:"user_id" binding:"required"`
+	ServerID   int                 `json:"server_id" binding:"required"`
+	SourceIP   string              `json:"source_ip" binding:"omitempty,ip"`
+	Time       *time.Time          `json:"time"` // 为空表示当前时间
+	Reason     string              `json:"reason" binding:"max=500"`
+	TicketID   string              `json:"ticket_id" binding:"max=100"`
+	BreakGlass bool                `json:"break_glass"`
+	Draft      *ConnectPolicyDraft `json:"draft"`
+}
+
+// PolicyMatch 决策中命中的一条策略
+type PolicyMatch struct {
+	PolicyID    int      `json:"policy_id"`
+	Name        string   `json:"name"`
+	Version     int      `json:"version"`
+	Effect      string   `json:"effect"`
+	Obligations []string `json:"obligations,omitempty"`
+	Error       string   `json:"error,omitempty"` // 求值出错，按拒绝处理
+}
+
+// PolicyDecision 连接策略的决定，随会话一起记录
+type PolicyDecision struct {
+	Decision    string        `json:"decision"`
+	Obligations []string      `json:"obligations,omitempty"`
+	Matched     []PolicyMatch `json:"matched,omitempty"`
+	DryRun      []PolicyMatch `json:"dry_run,omitempty"`  // 试运行策略的命中结果，不影响决定
+	Approval    string        `json:"approval,omitempty"` // require_approval 时满足审批的方式：access_request 或 break_glass
+	EvaluatedAt time.Time     `json:"evaluated_at"`
+}
+
+// Has 决定是否带有指定的附加要求
+func (d *PolicyDecision) Has(obligation string) bool {
+	if d == nil {
+		return false
+	}
+	for _, o := range d.Obligations {
+		if o == obligation {
+			return true
+		}
+	}
+	return false
+}
+
+// policyDecisionColumn 读取会话记录中的策略决定，NULL 或空字符串时保持为空
+type policyDecisionColumn struct {
+	dest **PolicyDecision
+}
+
+// Scan 实现 sql.Scanner
+func (c policyDecisionColumn) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	}
+	if len(data) == 0 {
+		*c.dest = nil
+		return nil
+	}
+	var decision PolicyDecision
+	if err := json.Unmarshal(data, &decision); err != nil {
+		return err
+	}
+	*c.dest = &decision
+	return nil
+}
+
+// ConnectPolicyService 连接策略服务
+type ConnectPolicyService struct {
+	db *sql.DB
+}
+
+// NewConnectPolicyService 创建连接策略服务
+func NewConnectPolicyService(db *sql.DB) *ConnectPolicyService {
+	return &ConnectPolicyService{db: db}
+}
+
+const connectPolicyColumns = `p.id, p.name, COALESCE(p.description, ''), p.expression, p.effect, COALESCE(p.obligations, ''),
+	p.priority, p.enabled, p.mode, p.version, p.updated_by, COALESCE((SELECT username FROM users WHERE id = p.updated_by), ''),
+	p.created_at, p.updated_at`
+
+func scanConnectPolicy(scanner interface{ Scan(...interface{}) error }) (*ConnectPolicy, error) {
+	var p ConnectPolicy
+	var obligations string
+	err := scanner.Scan(&p.ID, &p.Name, &p.Description, &p.Expression, &p.Effect, &obligations,
+		&p.Priority, &p.Enabled, &p.Mode, &p.Version, &p.UpdatedBy, &p.UpdatedByName, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Obligations = parseObligations(obligations)
+	return &p, nil
+}
+
+const connectPolicyVersionColumns = `v.id, v.policy_id, v.version, COALESCE(v.description, ''), v.expression, v.effect,
+	COALESCE(v.obligations, ''), v.priority, v.enabled, v.mode, COALESCE(v.comment, ''), v.created_by,
+	COALESCE((SELECT username FROM users WHERE id = v.created_by), ''), v.created_at`
+
+func scanConnectPolicyVersion(scanner interface{ Scan(...interface{}) error }) (*ConnectPolicyVersion, error) {
+	var v ConnectPolicyVersion
+	var obligations string
+	err := scanner.Scan(&v.ID, &v.PolicyID, &v.Version, &v.Description, &v.Expression, &v.Effect,
+		&obligations, &v.Priority, &v.Enabled, &v.Mode, &v.Comment, &v.CreatedBy, &v.CreatedByName, &v.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	v.Obligations = parseObligations(obligations)
+	return &v, nil
+}
+
+func parseObligations(raw string) []string {
+	obligations := []string{}
+	if raw != "" {
+		json.Unmarshal([]byte(raw), &obligations)
+	}
+	return obligations
+}
+
+func marshalObligations(obligations []string) string {
+	if obligations == nil {
+		obligations = []string{}
+	}
+	data, _ := json.Marshal(obligations)
+	return string(data)
+}
+
+// Create 创建连接策略，同时记录第 1 版
+func (s *ConnectPolicyService) Create(req *ConnectPolicyCreate, createdBy int) (*ConnectPolicy, error) {
+	policy := &ConnectPolicy{
+		Name:        req.Name,
+		Description: req.Description,
+		Expression:  req.Expression,
+		Effect:      req.Effect,
+		Obligations: req.Obligations,
+		Priority:    req.Priority,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+		Mode:        req.Mode,
+		Version:     1,
+	}
+	if policy.Mode == "" {
+		policy.Mode = PolicyModeEnforce
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	err = tx.QueryRow(`
+		INSERT INTO connect_policies (name, description, expression, effect, obligations, priority, enabled, mode, version, updated_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`, policy.Name, policy.Description, policy.Expression, policy.Effect, marshalObligations(policy.Obligations),
+		policy.Priority, policy.Enabled, policy.Mode, policy.Version, createdBy, now, now).Scan(&policy.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertConnectPolicyVersion(tx, policy, req.Comment, createdBy, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(policy.ID)
+}
+
+// Update 更新连接策略，版本号加一并保存新版本
+func (s *ConnectPolicyService) Update(id int, req *ConnectPolicyUpdate, updatedBy int) (*ConnectPolicy, error) {
+	policy, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Description != nil {
+		policy.Description = *req.Description
+	}
+	if req.Expression != nil {
+		policy.Expression = *req.Expression
+	}
+	if req.Effect != nil {
+		policy.Effect = *req.Effect
+	}
+	if req.Obligations != nil {
+		policy.Obligations = *req.Obligations
+	}
+	if req.Priority != nil {
+		policy.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Mode != nil {
+		policy.Mode = *req.Mode
+	}
+	return s.saveVersion(policy, req.Comment, updatedBy)
+}
+
+// Restore 用历史版本的内容生成新版本，历史版本本身保持不变
+func (s *ConnectPolicyService) Restore(id, version, restoredBy int, comment string) (*ConnectPolicy, error) {
+	policy, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	old, err := s.GetVersion(id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	policy.Description = old.Description
+	policy.Expression = old.Expression
+	policy.Effect = old.Effect
+	policy.Obligations = old.Obligations
+	policy.Priority = old.Priority
+	policy.Enabled = old.Enabled
+	policy.Mode = old.Mode
+	return s.saveVersion(policy, comment, restoredBy)
+}
+
+func (s *ConnectPolicyService) saveVersion(policy *ConnectPolicy, comment string, by int) (*ConnectPolicy, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 并发修改时以版本号判断，后提交的一方失败
+	now := time.Now().UTC()
+	result, err := tx.Exec(`
+		UPDATE connect_policies SET description = ?, expression = ?, effect = ?, obligations = ?, priority = ?, enabled = ?, mode = ?,
+			version = version + 1, updated_by = ?, updated_at = ?
+		WHERE id = ? AND version = ?
+	`, policy.Description, policy.Expression, policy.Effect, marshalObligations(policy.Obligations), policy.Priority,
+		policy.Enabled, policy.Mode, by, now, policy.ID, policy.Version)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, ErrConnectPolicyConflict
+	}
+	policy.Version++
+	if err := insertConnectPolicyVersion(tx, policy, comment, by, now); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(policy.ID)
+}
+
+func insertConnectPolicyVersion(tx *sql.Tx, policy *ConnectPolicy, comment string, by int, now time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO connect_policy_versions (policy_id, version, description, expression, effect, obligations, priority, enabled, mode, comment, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, policy.ID, policy.Version, policy.Description, policy.Expression, policy.Effect, marshalObligations(policy.Obligations),
+		policy.Priority, policy.Enabled, policy.Mode, comment, by, now)
+	return err
+}
+
+// GetByID 根据ID获取连接策略
+func (s *ConnectPolicyService) GetByID(id int) (*ConnectPolicy, error) {
+	return scanConnectPolicy(s.db.QueryRow(`SELECT `+connectPolicyColumns+` FROM connect_policies p WHERE p.id = ?`, id))
+}
+
+// List 获取全部连接策略，按优先级从高到低
+func (s *ConnectPolicyService) List() ([]*ConnectPolicy, error) {
+	return s.list(`SELECT ` + connectPolicyColumns + ` FROM connect_policies p ORDER BY p.priority DESC, p.id`)
+}
+
+// ListEnabled 获取启用的连接策略，按优先级从高到低
+func (s *ConnectPolicyService) ListEnabled() ([]*ConnectPolicy, error) {
+	return s.list(`SELECT ` + connectPolicyColumns + ` FROM connect_policies p WHERE p.enabled = TRUE ORDER BY p.priority DESC, p.id`)
+}
+
+func (s *ConnectPolicyService) list(query string, args ...interface{}) ([]*ConnectPolicy, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []*ConnectPolicy{}
+	for rows.Next() {
+		policy, err := scanConnectPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, rows.Err()
+}
+
+// ListVersions 获取连接策略的全部版本，新版本在前
+func (s *ConnectPolicyService) ListVersions(policyID int) ([]*ConnectPolicyVersion, error) {
+	rows, err := s.db.Query(`SELECT `+connectPolicyVersionColumns+` FROM connect_policy_versions v
+		WHERE v.policy_id = ? ORDER BY v.version DESC`, policyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*ConnectPolicyVersion{}
+	for rows.Next() {
+		version, err := scanConnectPolicyVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+// GetVersion 获取连接策略的指定版本
+func (s *ConnectPolicyService) GetVersion(policyID, version int) (*ConnectPolicyVersion, error) {
+	return scanConnectPolicyVersion(s.db.QueryRow(`SELECT `+connectPolicyVersionColumns+` FROM connect_policy_versions v
+		WHERE v.policy_id = ? AND v.version = ?`, policyID, version))
+}
+
+// Delete 删除连接策略及其历史版本，需要保留历史时应改为停用
+func (s *ConnectPolicyService) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM connect_policy_versions WHERE policy_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM connect_policies WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SensitiveTag 带有该标签的服务器视为敏感服务器，连接前总是需要二次认证
+const SensitiveTag = "sensitive"
+
+// ConnectRequirement 连接服务器时必须满足的要求，按服务器或服务器标签配置
+type ConnectRequirement struct {
+	ID            int       `json:"id" db:"id"`
+	ServerID      *int      `json:"server_id" db:"server_id"`
+	ServerName    string    `json:"server_name,omitempty" db:"-"`
+	Tag           string    `json:"tag,omitempty" db:"tag"`
+	RequireReason bool      `json:"require_reason" db:"require_reason"`   // 需要填写连接原因
+	RequireTicket bool      `json:"require_ticket" db:"require_ticket"`   // 需要填写符合格式的工单号
+	RequireStepUp bool      `json:"require_step_up" db:"require_step_up"` // 需要近期完成二次认证
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ConnectRequirementCreate 创建连接要求请求，server_id 和 tag 二选一
+type ConnectRequirementCreate struct {
+	ServerID      *int   `json:"server_id"`
+	Tag           string `json:"tag" binding:"max=100"`
+	RequireReason bool   `json:"require_reason"`
+	RequireTicket bool   `json:"require_ticket"`
+	RequireStepUp bool   `json:"require_step_up"`
+}
+
+// ConnectRequirementUpdate 更新连接要求请求
+type ConnectRequirementUpdate struct {
+	RequireReason *bool `json:"require_reason"`
+	RequireTicket *bool `json:"require_ticket"`
+	RequireStepUp *bool `json:"require_step_up"`
+}
+
+// ConnectRequirementSet 合并后对某台服务器生效的要求
+type ConnectRequirementSet struct {
+	RequireReason bool `json:"require_reason"`
+	RequireTicket bool `json:"require_ticket"`
+	RequireStepUp bool `json:"require_step_up"`
+}
+
+// SessionJustification 连接服务器时填写的原因和工单号，紧急访问期间建立的会话同时记录紧急访问ID，
+// Policy 为连接策略的决定
+type SessionJustification struct {
+	Reason       string          `json:"reason,omitempty"`
+	TicketID     string          `json:"ticket_id,omitempty"`
+	BreakGlassID int             `json:"break_glass_id,omitempty"`
+	Policy       *PolicyDecision `json:"policy,omitempty"`
+}
+
+// MustRecord 会话是否必须录制：紧急访问期间或连接策略要求录制
+func (j SessionJustification) MustRecord() bool {
+	return j.BreakGlassID > 0 || j.Policy.Has(ObligationRecord)
+}
+
+// ReadOnly 连接策略是否要求只读终端
+func (j SessionJustification) ReadOnly() bool {
+	return j.Policy.Has(ObligationReadOnly)
+}
+
+// ConnectRequirementService 连接要求服务
+type ConnectRequirementService struct {
+	db *sql.DB
+}
+
+// NewConnectRequirementService 创建连接要求服务
+func NewConnectRequirementService(db *sql.DB) *ConnectRequirementService {
+	return &ConnectRequirementService{db: db}
+}
+
+const connectRequirementColumns = `r.id, r.server_id, COALESCE((SELECT name FROM servers WHERE id = r.server_id), ''),
+	COALESCE(r.tag, ''), r.require_reason, r.require_ticket, r.require_step_up, r.created_at, r.updated_at`
+
+func scanConnectRequirement(scanner interface{ Scan(...interface{}) error }) (*ConnectRequirement, error) {
+	var requirement ConnectRequirement
+	err := scanner.Scan(&requirement.ID, &requirement.ServerID, &requirement.ServerName, &requirement.Tag,
+		&requirement.RequireReason, &requirement.RequireTicket, &requirement.RequireStepUp, &requirement.CreatedAt, &requirement.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &requirement, nil
+}
+
+// Create 创建连接要求
+func (s *ConnectRequirementService) Create(req *ConnectRequirementCreate) (*ConnectRequirement, error) {
+	var tag interface{}
+	if req.Tag != "" {
+		tag = req.Tag
+	}
+
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO connect_requirements (server_id, tag, require_reason, require_ticket, require_step_up)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`, req.ServerID, tag, req.RequireReason, req.RequireTicket, req.RequireStepUp).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取连接要求
+func (s *ConnectRequirementService) GetByID(id int) (*ConnectRequirement, error) {
+	return scanConnectRequirement(s.db.QueryRow(`SELECT `+connectRequirementColumns+` FROM connect_requirements r WHERE r.id = ?`, id))
+}
+
+// List 获取全部连接要求
+func (s *ConnectRequirementService) List() ([]*ConnectRequirement, error) {
+	rows, err := s.db.Query(`SELECT ` + connectRequirementColumns + ` FROM connect_requirements r ORDER BY r.tag IS NULL, r.tag, r.server_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requirements := []*ConnectRequirement{}
+	for rows.Next() {
+		requirement, err := scanConnectRequirement(rows)
+		if err != nil {
+			return nil, err
+		}
+		requirements = append(requirements, requirement)
+	}
+	return requirements, rows.Err()
+}
+
+// ForServer 合并服务器本身和其标签上的连接要求，任一条要求即需要；带有 sensitive 标签的服务器总是需要二次认证
+func (s *ConnectRequirementService) ForServer(serverID int) (*ConnectRequirementSet, error) {
+	var set ConnectRequirementSet
+	var sensitive bool
+	err := s.db.QueryRow(`
+		SELECT COALESCE(MAX(r.require_reason), FALSE), COALESCE(MAX(r.require_ticket), FALSE), COALESCE(MAX(r.require_step_up), FALSE),
+			EXISTS (SELECT 1 FROM servers srv, `+serverTagsQuery+` WHERE srv.id = ? AND value = ?)
+		FROM connect_requirements r
+		WHERE r.server_id = ? OR r.tag IN (SELECT value FROM servers srv, `+serverTagsQuery+` WHERE srv.id = ?)
+	`, serverID, SensitiveTag, serverID, serverID).Scan(&set.RequireReason, &set.RequireTicket, &set.RequireStepUp, &sensitive)
+	if err != nil {
+		return nil, err
+	}
+	set.RequireStepUp = set.RequireStepUp || sensitive
+	return &set, nil
+}
+
+// Update 更新连接要求，对之后启动的终端生效
+func (s *ConnectRequirementService) Update(id int, req *ConnectRequirementUpdate) (*ConnectRequirement, error) {
+	requirement, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RequireReason != nil {
+		requirement.RequireReason = *req.RequireReason
+	}
+	if req.RequireTicket != nil {
+		requirement.RequireTicket = *req.RequireTicket
+	}
+	if req.RequireStepUp != nil {
+		requirement.RequireStepUp = *req.RequireStepUp
+	}
+
+	_, err = s.db.Exec(`UPDATE connect_requirements SET require_reason = ?, require_ticket = ?, require_step_up = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		requirement.RequireReason, requirement.RequireTicket, requirement.RequireStepUp, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Delete 删除连接要求
+func (s *ConnectRequirementService) Delete(id int) error {
+	_, err := s.db.Exec(`DELETE FROM connect_requirements WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,256 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrGroupMemberChanged 成员关系在指定时间之后重新加入，不是同一条成员关系
+var ErrGroupMemberChanged = errors.New("成员关系已变更")
+
+// Group 用户组，组成员继承授予该组的服务器权限
+type Group struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	OwnerID     *int      `json:"owner_id" db:"owner_id"`      // 负责人，访问复核时复核该组的成员和授权
+	OwnerName   string    `json:"owner_name,omitempty" db:"-"` // 负责人用户名，不入库
+	MemberCount int       `json:"member_count" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// GroupMember 用户组成员
+type GroupMember struct {
+	UserID   int       `json:"user_id" db:"user_id"`
+	Username string    `json:"username" db:"username"`
+	Role     string    `json:"role" db:"role"`
+	Status   string    `json:"status" db:"status"`
+	AddedAt  time.Time `json:"added_at" db:"created_at"`
+}
+
+// GroupCreate 创建用户组请求
+type GroupCreate struct {
+	Name        string `json:"name" binding:"required,min=1,max=50"`
+	Description string `json:"description" binding:"max=500"`
+	OwnerID     *int   `json:"owner_id"`
+	UserIDs     []int  `json:"user_ids"` // 初始成员
+}
+
+// GroupUpdate 更新用户组请求
+type GroupUpdate struct {
+	Name        string  `json:"name" binding:"omitempty,min=1,max=50"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+	OwnerID     *int    `json:"owner_id"` // 0 表示清除负责人
+}
+
+// GroupService 用户组服务
+type GroupService struct {
+	db *sql.DB
+}
+
+// NewGroupService 创建用户组服务
+func NewGroupService(db *sql.DB) *GroupService {
+	return &GroupService{db: db}
+}
+
+const groupColumns = `g.id, g.name, COALESCE(g.description, ''), g.owner_id, COALESCE((SELECT username FROM users WHERE id = g.owner_id), ''),
+	g.created_at, g.updated_at, (SELECT COUNT(*) FROM group_members m WHERE m.group_id = g.id)`
+
+func scanGroup(scanner interface{ Scan(...interface{}) error }) (*Group, error) {
+	var group Group
+	err := scanner.Scan(&group.ID, &group.Name, &group.Description, &group.OwnerID, &group.OwnerName,
+		&group.CreatedAt, &group.UpdatedAt, &group.MemberCount)
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// Create 创建用户组并添加初始成员
+func (s *GroupService) Create(req *GroupCreate) (*Group, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`INSERT INTO groups (name, description, owner_id) VALUES (?, ?, ?) RETURNING id`,
+		req.Name, req.Description, req.OwnerID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	for _, userID := range req.UserIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)`, id, userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取用户组
+func (s *GroupService) GetByID(id int) (*Group, error) {
+	return scanGroup(s.db.QueryRow(`SELECT `+groupColumns+` FROM groups g WHERE g.id = ?`, id))
+}
+
+// List 获取全部用户组
+func (s *GroupService) List() ([]*Group, error) {
+	return s.list(`SELECT ` + groupColumns + ` FROM groups g ORDER BY g.name`)
+}
+
+// ListByUserID 获取用户所属的用户组
+func (s *GroupService) ListByUserID(userID int) ([]*Group, error) {
+	return s.list(`
+		SELECT `+groupColumns+` FROM groups g
+		INNER JOIN group_members gm ON gm.group_id = g.id
+		WHERE gm.user_id = ?
+		ORDER BY g.name`, userID)
+}
+
+func (s *GroupService) list(query string, args ...interface{}) ([]*Group, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*Group{}
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+// Update 更新用户组
+func (s *GroupService) Update(id int, req *GroupUpdate) (*Group, error) {
+	group, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		group.Name = req.Name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.OwnerID != nil {
+		group.OwnerID = req.OwnerID
+		if *req.OwnerID == 0 {
+			group.OwnerID = nil
+		}
+	}
+
+	_, err = s.db.Exec(`UPDATE groups SET name = ?, description = ?, owner_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		group.Name, group.Description, group.OwnerID, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Delete 删除用户组，同时删除成员关系、授予该组的权限和时间窗口绑定，以该组为审批组的策略改为不限审批组
+func (s *GroupService) Delete(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM schedule_bindings WHERE target_type = ? AND target_id IN (
+		SELECT id FROM access_grants WHERE subject_type = ? AND subject_id = ?)`, ScheduleTargetGrant, GrantSubjectGroup, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM access_grants WHERE subject_type = ? AND subject_id = ?`, GrantSubjectGroup, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE access_policies SET approver_group_id = NULL WHERE approver_group_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM schedule_bindings WHERE target_type = ? AND target_id = ?`, ScheduleTargetGroup, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM groups WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListMembers 获取用户组成员
+func (s *GroupService) ListMembers(groupID int) ([]*GroupMember, error) {
+	rows, err := s.db.Query(`
+		SELECT u.id, u.username, u.role, u.status, gm.created_at
+		FROM group_members gm
+		INNER JOIN users u ON u.id = gm.user_id
+		WHERE gm.group_id = ?
+		ORDER BY u.username
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*GroupMember{}
+	for rows.Next() {
+		var member GroupMember
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Role, &member.Status, &member.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	return members, rows.Err()
+}
+
+// AddMember 添加成员，已是成员时不报错
+func (s *GroupService) AddMember(groupID, userID int) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO group_members (group_id, user_id) VALUES (?, ?)`, groupID, userID)
+	return err
+}
+
+// RemoveMemberAddedBefore 移除在 before 之前加入的成员关系，返回成员是否存在；
+// 成员在 before 之后（重新）加入时不移除并返回 ErrGroupMemberChanged
+func (s *GroupService) RemoveMemberAddedBefore(groupID, userID int, before time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var addedAt time.Time
+	err = tx.QueryRow(`SELECT created_at FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID).Scan(&addedAt)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if addedAt.After(before) {
+		return false, ErrGroupMemberChanged
+	}
+	if _, err := tx.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RemoveMember 移除成员，返回成员是否存在
+func (s *GroupService) RemoveMember(groupID, userID int) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`, groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,225 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// MaskedSecret 接口返回时替代敏感配置的占位符，更新时原样提交表示保持不变
+const MaskedSecret = "******"
+
+// notificationSecretKeys 渠道配置中的敏感字段
+var notificationSecretKeys = []string{"secret", "password"}
+
+// NotificationChannel 告警通知渠道
+type NotificationChannel struct {
+	ID          int               `json:"id" db:"id"`
+	Name        string            `json:"name" db:"name"`
+	Type        string            `json:"type" db:"type"`     // webhook, email, dingtalk, feishu, wecom
+	Config      map[string]string `json:"config" db:"config"` // 渠道配置，如 url、secret、smtp 参数
+	MinSeverity string            `json:"min_severity" db:"min_severity"`
+	AlertTypes  []string          `json:"alert_types" db:"alert_types"` // 为空表示全部类型
+	ServerTags  []string          `json:"server_tags" db:"server_tags"` // 为空表示全部服务器
+	Enabled     bool              `json:"enabled" db:"enabled"`
+	LastSentAt  *time.Time        `json:"last_sent_at" db:"last_sent_at"`
+	LastError   string            `json:"last_error" db:"last_error"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at" db:"updated_at"`
+}
+
+// NotificationChannelCreate 创建通知渠道请求
+type NotificationChannelCreate struct {
+	Name        string            `json:"name" binding:"required,min=1,max=100"`
+	Type        string            `json:"type" binding:"required,oneof=webhook email dingtalk feishu wecom"`
+	Config      map[string]string `json:"config" binding:"required"`
+	MinSeverity string            `json:"min_severity" binding:"omitempty,oneof=low medium high critical"`
+	AlertTypes  []string          `json:"alert_types"`
+	ServerTags  []string          `json:"server_tags"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// NotificationChannelUpdate 更新通知渠道请求
+type NotificationChannelUpdate struct {
+	Name        string            `json:"name" binding:"omitempty,min=1,max=100"`
+	Config      map[string]string `json:"config"`
+	MinSeverity string            `json:"min_severity" binding:"omitempty,oneof=low medium high critical"`
+	AlertTypes  []string          `json:"alert_types"`
+	ServerTags  []string          `json:"server_tags"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// Masked 返回敏感配置已脱敏的副本
+func (c *NotificationChannel) Masked() *NotificationChannel {
+	masked := *c
+	masked.Config = make(map[string]string, len(c.Config))
+	for key, value := range c.Config {
+		if value != "" && isNotificationSecret(key) {
+			value = MaskedSecret
+		}
+		masked.Config[key] = value
+	}
+	return &masked
+}
+
+func isNotificationSecret(key string) bool {
+	for _, secret := range notificationSecretKeys {
+		if key == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationChannelService 通知渠道服务
+type NotificationChannelService struct {
+	db *sql.DB
+}
+
+// NewNotificationChannelService 创建通知渠道服务
+func NewNotificationChannelService(db *sql.DB) *NotificationChannelService {
+	return &NotificationChannelService{db: db}
+}
+
+const notificationChannelColumns = `id, name, type, config, min_severity, alert_types, server_tags, enabled, last_sent_at, last_error, created_at, updated_at`
+
+func scanNotificationChannel(scanner interface{ Scan(...interface{}) error }) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	var config string
+	var alertTypes, serverTags, lastError *string
+	err := scanner.Scan(&channel.ID, &channel.Name, &channel.Type, &config, &channel.MinSeverity,
+		&alertTypes, &serverTags, &channel.Enabled, &channel.LastSentAt, &lastError,
+		&channel.CreatedAt, &channel.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	channel.Config = map[string]string{}
+	json.Unmarshal([]byte(config), &channel.Config)
+	channel.AlertTypes = stringToTags(alertTypes)
+	channel.ServerTags = stringToTags(serverTags)
+	if lastError != nil {
+		channel.LastError = *lastError
+	}
+	return &channel, nil
+}
+
+// Create 创建通知渠道
+func (s *NotificationChannelService) Create(req *NotificationChannelCreate) (*NotificationChannel, error) {
+	if req.MinSeverity == "" {
+		req.MinSeverity = "high"
+	}
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	config, err := json.Marshal(req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO notification_channels (name, type, config, min_severity, alert_types, server_tags, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + notificationChannelColumns
+
+	return scanNotificationChannel(s.db.QueryRow(query, req.Name, req.Type, string(config), req.MinSeverity,
+		tagsToString(req.AlertTypes), tagsToString(req.ServerTags), enabled))
+}
+
+// GetByID 根据ID获取通知渠道
+func (s *NotificationChannelService) GetByID(id int) (*NotificationChannel, error) {
+	query := `SELECT ` + notificationChannelColumns + ` FROM notification_channels WHERE id = ?`
+	return scanNotificationChannel(s.db.QueryRow(query, id))
+}
+
+// List 获取全部通知渠道
+func (s *NotificationChannelService) List() ([]*NotificationChannel, error) {
+	return s.list(`SELECT ` + notificationChannelColumns + ` FROM notification_channels ORDER BY id`)
+}
+
+// ListEnabled 获取已启用的通知渠道
+func (s *NotificationChannelService) ListEnabled() ([]*NotificationChannel, error) {
+	return s.list(`SELECT ` + notificationChannelColumns + ` FROM notification_channels WHERE enabled = 1 ORDER BY id`)
+}
+
+func (s *NotificationChannelService) list(query string) ([]*NotificationChannel, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := []*NotificationChannel{}
+	for rows.Next() {
+		channel, err := scanNotificationChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, rows.Err()
+}
+
+// Update 更新通知渠道，配置中值为 MaskedSecret 的敏感字段保持原值
+func (s *NotificationChannelService) Update(id int, req *NotificationChannelUpdate) (*NotificationChannel, error) {
+	channel, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		channel.Name = req.Name
+	}
+	if req.Config != nil {
+		config := make(map[string]string, len(req.Config))
+		for key, value := range req.Config {
+			if value == MaskedSecret && isNotificationSecret(key) {
+				value = channel.Config[key]
+			}
+			config[key] = value
+		}
+		channel.Config = config
+	}
+	if req.MinSeverity != "" {
+		channel.MinSeverity = req.MinSeverity
+	}
+	if req.AlertTypes != nil {
+		channel.AlertTypes = req.AlertTypes
+	}
+	if req.ServerTags != nil {
+		channel.ServerTags = req.ServerTags
+	}
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+
+	config, err := json.Marshal(channel.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE notification_channels
+		SET name = ?, config = ?, min_severity = ?, alert_types = ?, server_tags = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		RETURNING ` + notificationChannelColumns
+
+	return scanNotificationChannel(s.db.QueryRow(query, channel.Name, string(config), channel.MinSeverity,
+		tagsToString(channel.AlertTypes), tagsToString(channel.ServerTags), channel.Enabled, id))
+}
+
+// Delete 删除通知渠道
+func (s *NotificationChannelService) Delete(id int) error {
+	_, err := s.db.Exec("DELETE FROM notification_channels WHERE id = ?", id)
+	return err
+}
+
+// RecordDelivery 记录最近一次投递结果
+func (s *NotificationChannelService) RecordDelivery(id int, deliveryErr error) error {
+	if deliveryErr != nil {
+		_, err := s.db.Exec("UPDATE notification_channels SET last_error = ? WHERE id = ?", deliveryErr.Error(), id)
+		return err
+	}
+	_, err := s.db.Exec("UPDATE notification_channels SET last_sent_at = ?, last_error = '' WHERE id = ?", time.Now().UTC(), id)
+	return err
+}
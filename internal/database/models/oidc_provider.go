@@ -0,0 +1,264 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuthSourceOIDCPrefix OIDC 用户的 auth_source 前缀，后接身份源名称，如 oidc:corp
+const AuthSourceOIDCPrefix = "oidc:"
+
+// ValidAuthSource 判断认证来源是否合法
+func ValidAuthSource(source string) bool {
+	return source == AuthSourceLocal || source == AuthSourceLDAP || source == AuthSourceSAML ||
+		(strings.HasPrefix(source, AuthSourceOIDCPrefix) && len(source) > len(AuthSourceOIDCPrefix))
+}
+
+// OIDCProvider OpenID Connect 身份源
+type OIDCProvider struct {
+	ID            int                 `json:"id" db:"id"`
+	Name          string              `json:"name" db:"name"` // 用于回调地址和 auth_source
+	DisplayName   string              `json:"display_name" db:"display_name"`
+	IssuerURL     string              `json:"issuer_url" db:"issuer_url"`
+	ClientID      string              `json:"client_id" db:"client_id"`
+	ClientSecret  string              `json:"client_secret" db:"client_secret"`
+	RedirectURL   string              `json:"redirect_url" db:"redirect_url"` // 为空时按请求地址生成
+	Scopes        []string            `json:"scopes" db:"scopes"`             // openid 之外额外申请的 scope
+	UsernameClaim string              `json:"username_claim" db:"username_claim"`
+	GroupsClaim   string              `json:"groups_claim" db:"groups_claim"`
+	AdminGroups   []string            `json:"admin_groups" db:"admin_groups"`
+	UserGroups    []string            `json:"user_groups" db:"user_groups"`     // 为空时所有用户都可登录
+	ServerGrants  map[string][]string `json:"server_grants" db:"server_grants"` // 组 -> 服务器标签
+	Provision     bool                `json:"provision" db:"provision"`
+	Enabled       bool                `json:"enabled" db:"enabled"`
+	CreatedAt     time.Time           `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at" db:"updated_at"`
+}
+
+// AuthSource 该身份源登录的用户的 auth_source
+func (p *OIDCProvider) AuthSource() string {
+	return AuthSourceOIDCPrefix + p.Name
+}
+
+// Masked 返回客户端密钥已脱敏的副本
+func (p *OIDCProvider) Masked() *OIDCProvider {
+	masked := *p
+	if masked.ClientSecret != "" {
+		masked.ClientSecret = MaskedSecret
+	}
+	return &masked
+}
+
+// OIDCProviderCreate 创建 OIDC 身份源请求
+type OIDCProviderCreate struct {
+	Name          string              `json:"name" binding:"required,min=1,max=50"`
+	DisplayName   string              `json:"display_name" binding:"required,max=100"`
+	IssuerURL     string              `json:"issuer_url" binding:"required,url"`
+	ClientID      string              `json:"client_id" binding:"required"`
+	ClientSecret  string              `json:"client_secret"`
+	RedirectURL   string              `json:"redirect_url" binding:"omitempty,url"`
+	Scopes        []string            `json:"scopes"`
+	UsernameClaim string              `json:"username_claim"`
+	GroupsClaim   string              `json:"groups_claim"`
+	AdminGroups   []string            `json:"admin_groups"`
+	UserGroups    []string            `json:"user_groups"`
+	ServerGrants  map[string][]string `json:"server_grants"`
+	Provision     *bool               `json:"provision"`
+	Enabled       *bool               `json:"enabled"`
+}
+
+// OIDCProviderUpdate 更新 OIDC 身份源请求
+type OIDCProviderUpdate struct {
+	DisplayName   string              `json:"display_name" binding:"omitempty,max=100"`
+	IssuerURL     string              `json:"issuer_url" binding:"omitempty,url"`
+	ClientID      string              `json:"client_id"`
+	ClientSecret  *string             `json:"client_secret"` // 提交 MaskedSecret 表示保持不变
+	RedirectURL   *string             `json:"redirect_url"`
+	Scopes        []string            `json:"scopes"`
+	UsernameClaim string              `json:"username_claim"`
+	GroupsClaim   string              `json:"groups_claim"`
+	AdminGroups   []string            `json:"admin_groups"`
+	UserGroups    []string            `json:"user_groups"`
+	ServerGrants  map[string][]string `json:"server_grants"`
+	Provision     *bool               `json:"provision"`
+	Enabled       *bool               `json:"enabled"`
+}
+
+// OIDCProviderService OIDC 身份源服务
+type OIDCProviderService struct {
+	db *sql.DB
+}
+
+// NewOIDCProviderService 创建 OIDC 身份源服务
+func NewOIDCProviderService(db *sql.DB) *OIDCProviderService {
+	return &OIDCProviderService{db: db}
+}
+
+const oidcProviderColumns = `id, name, display_name, issuer_url, client_id, COALESCE(client_secret, ''), COALESCE(redirect_url, ''),
+	scopes, username_claim, groups_claim, admin_groups, user_groups, server_grants, provision, enabled, created_at, updated_at`
+
+func scanOIDCProvider(scanner interface{ Scan(...interface{}) error }) (*OIDCProvider, error) {
+	var provider OIDCProvider
+	var scopes, adminGroups, userGroups, serverGrants *string
+	err := scanner.Scan(&provider.ID, &provider.Name, &provider.DisplayName, &provider.IssuerURL, &provider.ClientID,
+		&provider.ClientSecret, &provider.RedirectURL, &scopes, &provider.UsernameClaim, &provider.GroupsClaim,
+		&adminGroups, &userGroups, &serverGrants, &provider.Provision, &provider.Enabled,
+		&provider.CreatedAt, &provider.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	provider.Scopes = stringToTags(scopes)
+	provider.AdminGroups = stringToTags(adminGroups)
+	provider.UserGroups = stringToTags(userGroups)
+	provider.ServerGrants = map[string][]string{}
+	if serverGrants != nil && *serverGrants != "" {
+		json.Unmarshal([]byte(*serverGrants), &provider.ServerGrants)
+	}
+	return &provider, nil
+}
+
+// Create 创建 OIDC 身份源
+func (s *OIDCProviderService) Create(req *OIDCProviderCreate) (*OIDCProvider, error) {
+	if req.UsernameClaim == "" {
+		req.UsernameClaim = "preferred_username"
+	}
+	if req.GroupsClaim == "" {
+		req.GroupsClaim = "groups"
+	}
+	if req.Scopes == nil {
+		req.Scopes = []string{"profile", "email"}
+	}
+	provision, enabled := true, true
+	if req.Provision != nil {
+		provision = *req.Provision
+	}
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+	serverGrants, err := json.Marshal(req.ServerGrants)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO oidc_providers (name, display_name, issuer_url, client_id, client_secret, redirect_url, scopes,
+			username_claim, groups_claim, admin_groups, user_groups, server_grants, provision, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + oidcProviderColumns
+
+	return scanOIDCProvider(s.db.QueryRow(query, req.Name, req.DisplayName, req.IssuerURL, req.ClientID, req.ClientSecret,
+		req.RedirectURL, tagsToString(req.Scopes), req.UsernameClaim, req.GroupsClaim, tagsToString(req.AdminGroups),
+		tagsToString(req.UserGroups), string(serverGrants), provision, enabled))
+}
+
+// GetByID 根据ID获取 OIDC 身份源
+func (s *OIDCProviderService) GetByID(id int) (*OIDCProvider, error) {
+	return scanOIDCProvider(s.db.QueryRow(`SELECT `+oidcProviderColumns+` FROM oidc_providers WHERE id = ?`, id))
+}
+
+// GetByName 根据名称获取 OIDC 身份源
+func (s *OIDCProviderService) GetByName(name string) (*OIDCProvider, error) {
+	return scanOIDCProvider(s.db.QueryRow(`SELECT `+oidcProviderColumns+` FROM oidc_providers WHERE name = ?`, name))
+}
+
+// List 获取全部 OIDC 身份源
+func (s *OIDCProviderService) List() ([]*OIDCProvider, error) {
+	return s.list(`SELECT ` + oidcProviderColumns + ` FROM oidc_providers ORDER BY id`)
+}
+
+// ListEnabled 获取已启用的 OIDC 身份源
+func (s *OIDCProviderService) ListEnabled() ([]*OIDCProvider, error) {
+	return s.list(`SELECT ` + oidcProviderColumns + ` FROM oidc_providers WHERE enabled = 1 ORDER BY id`)
+}
+
+func (s *OIDCProviderService) list(query string) ([]*OIDCProvider, error) {
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	providers := []*OIDCProvider{}
+	for rows.Next() {
+		provider, err := scanOIDCProvider(rows)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, rows.Err()
+}
+
+// Update 更新 OIDC 身份源，名称不可修改
+func (s *OIDCProviderService) Update(id int, req *OIDCProviderUpdate) (*OIDCProvider, error) {
+	provider, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.DisplayName != "" {
+		provider.DisplayName = req.DisplayName
+	}
+	if req.IssuerURL != "" {
+		provider.IssuerURL = req.IssuerURL
+	}
+	if req.ClientID != "" {
+		provider.ClientID = req.ClientID
+	}
+	if req.ClientSecret != nil && *req.ClientSecret != MaskedSecret {
+		provider.ClientSecret = *req.ClientSecret
+	}
+	if req.RedirectURL != nil {
+		provider.RedirectURL = *req.RedirectURL
+	}
+	if req.Scopes != nil {
+		provider.Scopes = req.Scopes
+	}
+	if req.UsernameClaim != "" {
+		provider.UsernameClaim = req.UsernameClaim
+	}
+	if req.GroupsClaim != "" {
+		provider.GroupsClaim = req.GroupsClaim
+	}
+	if req.AdminGroups != nil {
+		provider.AdminGroups = req.AdminGroups
+	}
+	if req.UserGroups != nil {
+		provider.UserGroups = req.UserGroups
+	}
+	if req.ServerGrants != nil {
+		provider.ServerGrants = req.ServerGrants
+	}
+	if req.Provision != nil {
+		provider.Provision = *req.Provision
+	}
+	if req.Enabled != nil {
+		provider.Enabled = *req.Enabled
+	}
+
+	serverGrants, err := json.Marshal(provider.ServerGrants)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE oidc_providers
+		SET display_name = ?, issuer_url = ?, client_id = ?, client_secret = ?, redirect_url = ?, scopes = ?,
+			username_claim = ?, groups_claim = ?, admin_groups = ?, user_groups = ?, server_grants = ?,
+			provision = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+		RETURNING ` + oidcProviderColumns
+
+	return scanOIDCProvider(s.db.QueryRow(query, provider.DisplayName, provider.IssuerURL, provider.ClientID,
+		provider.ClientSecret, provider.RedirectURL, tagsToString(provider.Scopes), provider.UsernameClaim,
+		provider.GroupsClaim, tagsToString(provider.AdminGroups), tagsToString(provider.UserGroups),
+		string(serverGrants), provider.Provision, provider.Enabled, id))
+}
+
+// Delete 删除 OIDC 身份源，已创建的用户保留
+func (s *OIDCProviderService) Delete(id int) error {
+	_, err := s.db.Exec("DELETE FROM oidc_providers WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,272 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 内置角色
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// 角色权限，资源.write 同时包含资源.read
+const (
+	PermissionAll              = "*"                // 全部权限，仅内置 admin 角色使用
+	PermissionServersRead      = "servers.read"     // 查看全部服务器（未授权的也可见）
+	PermissionServersWrite     = "servers.write"    // 创建、修改、删除服务器
+	PermissionServersConnect   = "servers.connect"  // 无需授权即可连接任意服务器
+	PermissionCredentialsRead  = "credentials.read" // 查看登录凭证列表
+	PermissionCredentialsWrite = "credentials.write"
+	PermissionUsersRead        = "users.read" // 查看用户、用户组、授权和登录锁定
+	PermissionUsersWrite       = "users.write"
+	PermissionRolesRead        = "roles.read"
+	PermissionRolesWrite       = "roles.write"
+	PermissionSessionsRead     = "sessions.read"   // 查看和回放所有人的会话
+	PermissionSessionsWrite    = "sessions.write"  // 关闭他人会话、清理会话和录像
+	PermissionSessionsShadow   = "sessions.shadow" // 旁观他人正在进行的终端，不能输入
+	PermissionAuditRead        = "audit.read"      // 审计日志、统计、安全告警和完整性校验
+	PermissionAlertsResolve    = "alerts.resolve"
+	PermissionAccessApprove    = "access.approve"     // 审批临时访问申请
+	PermissionAccessOverride   = "access.override"    // 在访问时间窗口外强制连接（产生告警）
+	PermissionAccessBreakGlass = "access.break_glass" // 紧急访问任意服务器（产生严重告警，需事后复核）
+	PermissionAccessReview     = "access.review"      // 管理访问复核活动和导出复核报告
+	PermissionSystemRead       = "system.read"        // 系统统计、身份源、通知渠道、行为基线
+	PermissionSystemWrite      = "system.write"
+)
+
+// AllPermissions 可分配给自定义角色的全部权限
+var AllPermissions = []string{
+	PermissionServersRead, PermissionServersWrite, PermissionServersConnect,
+	PermissionCredentialsRead, PermissionCredentialsWrite,
+	PermissionUsersRead, PermissionUsersWrite,
+	PermissionRolesRead, PermissionRolesWrite,
+	PermissionSessionsRead, PermissionSessionsWrite, PermissionSessionsShadow,
+	PermissionAuditRead, PermissionAlertsResolve,
+	PermissionAccessApprove, PermissionAccessOverride, PermissionAccessBreakGlass, PermissionAccessReview,
+	PermissionSystemRead, PermissionSystemWrite,
+}
+
+var (
+	// ErrBuiltinRole 内置角色不能修改或删除
+	ErrBuiltinRole = errors.New("内置角色不能修改或删除")
+	// ErrRoleInUse 角色仍有用户使用
+	ErrRoleInUse = errors.New("角色仍有用户使用，不能删除")
+)
+
+// ValidatePermissions 校验权限是否合法
+func ValidatePermissions(permissions []string) error {
+	for _, permission := range permissions {
+		valid := false
+		for _, p := range AllPermissions {
+			if permission == p {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("未知的权限: %s", permission)
+		}
+	}
+	return nil
+}
+
+// HasPermission 判断权限列表是否包含 permission，* 包含全部权限，资源.write 隐含资源.read
+func HasPermission(permissions []string, permission string) bool {
+	write := strings.TrimSuffix(permission, ".read") + ".write"
+	for _, p := range permissions {
+		if p == PermissionAll || p == permission || (strings.HasSuffix(permission, ".read") && p == write) {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversPermissions 判断 granted 是否包含 required 中的全部权限，用于禁止授予超出自身的权限
+func CoversPermissions(granted, required []string) bool {
+	if HasPermission(granted, PermissionAll) {
+		return true
+	}
+	for _, p := range required {
+		if p == PermissionAll || !HasPermission(granted, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Role 角色，由一组权限组成
+type Role struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Permissions []string  `json:"permissions" db:"permissions"`
+	Builtin     bool      `json:"builtin" db:"builtin"`
+	UserCount   int       `json:"user_count" db:"-"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RoleCreate 创建角色请求
+type RoleCreate struct {
+	Name        string   `json:"name" binding:"required,min=1,max=20"`
+	Description string   `json:"description" binding:"max=500"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// RoleUpdate 更新角色请求，角色名创建后不能修改（用户通过角色名关联）
+type RoleUpdate struct {
+	Description *string  `json:"description" binding:"omitempty,max=500"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleService 角色服务
+type RoleService struct {
+	db *sql.DB
+}
+
+// NewRoleService 创建角色服务
+func NewRoleService(db *sql.DB) *RoleService {
+	return &RoleService{db: db}
+}
+
+const roleColumns = `r.id, r.name, COALESCE(r.description, ''), r.permissions, r.builtin, r.created_at, r.updated_at,
+	(SELECT COUNT(*) FROM users u WHERE u.role = r.name)`
+
+func scanRole(scanner interface{ Scan(...interface{}) error }) (*Role, error) {
+	var role Role
+	var permissions string
+	err := scanner.Scan(&role.ID, &role.Name, &role.Description, &permissions, &role.Builtin,
+		&role.CreatedAt, &role.UpdatedAt, &role.UserCount)
+	if err != nil {
+		return nil, err
+	}
+	role.Permissions = []string{}
+	json.Unmarshal([]byte(permissions), &role.Permissions)
+	return &role, nil
+}
+
+// Create 创建角色
+func (s *RoleService) Create(req *RoleCreate) (*Role, error) {
+	if err := ValidatePermissions(req.Permissions); err != nil {
+		return nil, err
+	}
+	permissions, err := json.Marshal(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRow(`INSERT INTO roles (name, description, permissions) VALUES (?, ?, ?) RETURNING id`,
+		req.Name, req.Description, string(permissions)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取角色
+func (s *RoleService) GetByID(id int) (*Role, error) {
+	return scanRole(s.db.QueryRow(`SELECT `+roleColumns+` FROM roles r WHERE r.id = ?`, id))
+}
+
+// GetByName 根据名称获取角色
+func (s *RoleService) GetByName(name string) (*Role, error) {
+	return scanRole(s.db.QueryRow(`SELECT `+roleColumns+` FROM roles r WHERE r.name = ?`, name))
+}
+
+// List 获取全部角色，内置角色在前
+func (s *RoleService) List() ([]*Role, error) {
+	rows, err := s.db.Query(`SELECT ` + roleColumns + ` FROM roles r ORDER BY r.builtin DESC, r.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// Update 更新角色，权限变化对已登录用户的下一个请求立即生效
+func (s *RoleService) Update(id int, req *RoleUpdate) (*Role, error) {
+	role, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if role.Builtin {
+		return nil, ErrBuiltinRole
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if err := ValidatePermissions(req.Permissions); err != nil {
+			return nil, err
+		}
+		role.Permissions = req.Permissions
+	}
+	permissions, err := json.Marshal(role.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE roles SET description = ?, permissions = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		role.Description, string(permissions), id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Delete 删除角色，内置角色和仍有用户使用的角色不能删除
+func (s *RoleService) Delete(id int) error {
+	role, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if role.Builtin {
+		return ErrBuiltinRole
+	}
+	if role.UserCount > 0 {
+		return ErrRoleInUse
+	}
+	_, err = s.db.Exec(`DELETE FROM roles WHERE id = ? AND NOT EXISTS (SELECT 1 FROM users WHERE role = ?)`, id, role.Name)
+	return err
+}
+
+// Permissions 获取角色的权限，角色不存在时没有任何权限
+func (s *RoleService) Permissions(name string) ([]string, error) {
+	var permissions string
+	err := s.db.QueryRow(`SELECT permissions FROM roles WHERE name = ?`, name).Scan(&permissions)
+	if err == sql.ErrNoRows {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	if err := json.Unmarshal([]byte(permissions), &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Exists 角色是否存在
+func (s *RoleService) Exists(name string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = ?)`, name).Scan(&exists)
+	return exists, err
+}
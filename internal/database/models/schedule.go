@@ -0,0 +1,437 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 时间窗口绑定对象类型
+const (
+	ScheduleTargetServer = "server" // 服务器只能在窗口内连接，对所有人生效
+	ScheduleTargetGroup  = "group"  // 通过该用户组获得的授权只在窗口内有效
+	ScheduleTargetGrant  = "grant"  // 该授权只在窗口内有效
+)
+
+// ErrScheduleInUse 时间窗口仍有绑定
+var ErrScheduleInUse = errors.New("时间窗口仍有绑定，不能删除")
+
+// weekdayNames 星期缩写，与 time.Weekday 顺序一致
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ScheduleWindow 每周重复的时间段，end 早于或等于 start 表示跨越午夜，end 为 24:00 表示到当天结束
+type ScheduleWindow struct {
+	Days  []string `json:"days"`  // mon、tue、wed、thu、fri、sat、sun
+	Start string   `json:"start"` // HH:MM
+	End   string   `json:"end"`   // HH:MM
+}
+
+// Schedule 访问时间窗口，由若干每周重复的时间段组成，按指定时区计算
+type Schedule struct {
+	ID           int              `json:"id" db:"id"`
+	Name         string           `json:"name" db:"name"`
+	Description  string           `json:"description" db:"description"`
+	Timezone     string           `json:"timezone" db:"timezone"`
+	Windows      []ScheduleWindow `json:"windows" db:"windows"`
+	BindingCount int              `json:"binding_count" db:"-"`
+	CreatedAt    time.Time        `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at" db:"updated_at"`
+}
+
+// ScheduleCreate 创建时间窗口请求
+type ScheduleCreate struct {
+	Name        string           `json:"name" binding:"required,min=1,max=50"`
+	Description string           `json:"description" binding:"max=500"`
+	Timezone    string           `json:"timezone" binding:"max=64"`
+	Windows     []ScheduleWindow `json:"windows" binding:"required,min=1"`
+}
+
+// ScheduleUpdate 更新时间窗口请求
+type ScheduleUpdate struct {
+	Name        string           `json:"name" binding:"omitempty,min=1,max=50"`
+	Description *string          `json:"description" binding:"omitempty,max=500"`
+	Timezone    string           `json:"timezone" binding:"max=64"`
+	Windows     []ScheduleWindow `json:"windows"`
+}
+
+// ScheduleBinding 时间窗口绑定
+type ScheduleBinding struct {
+	ID         int       `json:"id" db:"id"`
+	ScheduleID int       `json:"schedule_id" db:"schedule_id"`
+	TargetType string    `json:"target_type" db:"target_type"`
+	TargetID   int       `json:"target_id" db:"target_id"`
+	TargetName string    `json:"target_name" db:"-"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// ScheduleBindingCreate 绑定请求
+type ScheduleBindingCreate struct {
+	TargetType string `json:"target_type" binding:"required,oneof=server group grant"`
+	TargetID   int    `json:"target_id" binding:"required,min=1"`
+}
+
+// parseClock 解析 HH:MM，返回距午夜的分钟数，允许 24:00
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("时间格式应为 HH:MM: %s", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("无效的时间: %s", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// ValidateSchedule 校验时区和时间段
+func ValidateSchedule(timezone string, windows []ScheduleWindow) error {
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return fmt.Errorf("无效的时区: %s", timezone)
+	}
+	if len(windows) == 0 {
+		return errors.New("至少需要一个时间段")
+	}
+	for _, window := range windows {
+		if len(window.Days) == 0 {
+			return errors.New("时间段必须指定星期")
+		}
+		for _, day := range window.Days {
+			if weekday(day) < 0 {
+				return fmt.Errorf("无效的星期: %s", day)
+			}
+		}
+		start, err := parseClock(window.Start)
+		if err != nil {
+			return err
+		}
+		end, err := parseClock(window.End)
+		if err != nil {
+			return err
+		}
+		if start == 24*60 {
+			return fmt.Errorf("开始时间不能是 24:00")
+		}
+		if start == end {
+			return fmt.Errorf("开始时间和结束时间不能相同: %s", window.Start)
+		}
+	}
+	return nil
+}
+
+func weekday(day string) int {
+	day = strings.ToLower(day)
+	for i, name := range weekdayNames {
+		if day == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// scheduleInterval 具体的开放时间段
+type scheduleInterval struct {
+	start, end time.Time
+}
+
+// intervals 展开 at 前后一周内的开放时间段，相邻或重叠的时间段合并
+func (s *Schedule) intervals(at time.Time) []scheduleInterval {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := at.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	var intervals []scheduleInterval
+	for offset := -1; offset <= 8; offset++ {
+		day := today.AddDate(0, 0, offset)
+		for _, window := range s.Windows {
+			matched := false
+			for _, name := range window.Days {
+				if weekday(name) == int(day.Weekday()) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				continue
+			}
+			start, err1 := parseClock(window.Start)
+			end, err2 := parseClock(window.End)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			from := time.Date(day.Year(), day.Month(), day.Day(), start/60, start%60, 0, 0, loc)
+			endDay := day
+			if end <= start {
+				endDay = day.AddDate(0, 0, 1)
+			}
+			to := time.Date(endDay.Year(), endDay.Month(), endDay.Day(), end/60, end%60, 0, 0, loc)
+			intervals = append(intervals, scheduleInterval{from, to})
+		}
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.Before(intervals[j].start) })
+	merged := []scheduleInterval{}
+	for _, interval := range intervals {
+		if n := len(merged); n > 0 && !interval.start.After(merged[n-1].end) {
+			if interval.end.After(merged[n-1].end) {
+				merged[n-1].end = interval.end
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// OpenAt 判断 at 是否在窗口内，在窗口内时同时返回本次开放的结束时间，一周以上不关闭时返回零值
+func (s *Schedule) OpenAt(at time.Time) (bool, time.Time) {
+	for _, interval := range s.intervals(at) {
+		if !at.Before(interval.start) && at.Before(interval.end) {
+			if interval.end.Sub(at) > 7*24*time.Hour {
+				return true, time.Time{}
+			}
+			return true, interval.end
+		}
+	}
+	return false, time.Time{}
+}
+
+// NextOpen 下一次开放的时间，一周内不开放时返回零值
+func (s *Schedule) NextOpen(at time.Time) time.Time {
+	for _, interval := range s.intervals(at) {
+		if interval.start.After(at) {
+			return interval.start
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduleService 时间窗口服务
+type ScheduleService struct {
+	db *sql.DB
+}
+
+// NewScheduleService 创建时间窗口服务
+func NewScheduleService(db *sql.DB) *ScheduleService {
+	return &ScheduleService{db: db}
+}
+
+const scheduleColumns = `s.id, s.name, COALESCE(s.description, ''), s.timezone, s.windows, s.created_at, s.updated_at,
+	(SELECT COUNT(*) FROM schedule_bindings b WHERE b.schedule_id = s.id)`
+
+func scanSchedule(scanner interface{ Scan(...interface{}) error }) (*Schedule, error) {
+	var schedule Schedule
+	var windows string
+	err := scanner.Scan(&schedule.ID, &schedule.Name, &schedule.Description, &schedule.Timezone, &windows,
+		&schedule.CreatedAt, &schedule.UpdatedAt, &schedule.BindingCount)
+	if err != nil {
+		return nil, err
+	}
+	schedule.Windows = []ScheduleWindow{}
+	json.Unmarshal([]byte(windows), &schedule.Windows)
+	return &schedule, nil
+}
+
+// Create 创建时间窗口
+func (s *ScheduleService) Create(req *ScheduleCreate) (*Schedule, error) {
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if err := ValidateSchedule(req.Timezone, req.Windows); err != nil {
+		return nil, err
+	}
+	windows, err := json.Marshal(req.Windows)
+	if err != nil {
+		return nil, err
+	}
+
+	var id int
+	err = s.db.QueryRow(`INSERT INTO schedules (name, description, timezone, windows) VALUES (?, ?, ?, ?) RETURNING id`,
+		req.Name, req.Description, req.Timezone, string(windows)).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// GetByID 根据ID获取时间窗口
+func (s *ScheduleService) GetByID(id int) (*Schedule, error) {
+	return scanSchedule(s.db.QueryRow(`SELECT `+scheduleColumns+` FROM schedules s WHERE s.id = ?`, id))
+}
+
+// List 获取全部时间窗口
+func (s *ScheduleService) List() ([]*Schedule, error) {
+	rows, err := s.db.Query(`SELECT ` + scheduleColumns + ` FROM schedules s ORDER BY s.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// Update 更新时间窗口，对进行中的会话在下一次检查时生效
+func (s *ScheduleService) Update(id int, req *ScheduleUpdate) (*Schedule, error) {
+	schedule, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		schedule.Name = req.Name
+	}
+	if req.Description != nil {
+		schedule.Description = *req.Description
+	}
+	if req.Timezone != "" {
+		schedule.Timezone = req.Timezone
+	}
+	if req.Windows != nil {
+		schedule.Windows = req.Windows
+	}
+	if err := ValidateSchedule(schedule.Timezone, schedule.Windows); err != nil {
+		return nil, err
+	}
+	windows, err := json.Marshal(schedule.Windows)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.Exec(`UPDATE schedules SET name = ?, description = ?, timezone = ?, windows = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		schedule.Name, schedule.Description, schedule.Timezone, string(windows), id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(id)
+}
+
+// Delete 删除时间窗口，仍有绑定时不能删除
+func (s *ScheduleService) Delete(id int) error {
+	schedule, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if schedule.BindingCount > 0 {
+		return ErrScheduleInUse
+	}
+	_, err = s.db.Exec(`DELETE FROM schedules WHERE id = ? AND NOT EXISTS (SELECT 1 FROM schedule_bindings WHERE schedule_id = ?)`, id, id)
+	return err
+}
+
+// Bind 将时间窗口绑定到对象，对象已绑定其他时间窗口时替换
+func (s *ScheduleService) Bind(scheduleID int, req *ScheduleBindingCreate) (*ScheduleBinding, error) {
+	var id int
+	err := s.db.QueryRow(`
+		INSERT INTO schedule_bindings (schedule_id, target_type, target_id) VALUES (?, ?, ?)
+		ON CONFLICT (target_type, target_id) DO UPDATE SET schedule_id = excluded.schedule_id, created_at = CURRENT_TIMESTAMP
+		RETURNING id
+	`, scheduleID, req.TargetType, req.TargetID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetBinding(id)
+}
+
+const scheduleBindingColumns = `b.id, b.schedule_id, b.target_type, b.target_id,
+	COALESCE(CASE b.target_type
+		WHEN 'server' THEN (SELECT name FROM servers WHERE id = b.target_id)
+		WHEN 'group' THEN (SELECT name FROM groups WHERE id = b.target_id)
+		ELSE (SELECT COALESCE((SELECT name FROM servers WHERE id = g.server_id), 'tag:' || g.tag) FROM access_grants g WHERE g.id = b.target_id)
+	END, ''), b.created_at`
+
+func scanScheduleBinding(scanner interface{ Scan(...interface{}) error }) (*ScheduleBinding, error) {
+	var binding ScheduleBinding
+	err := scanner.Scan(&binding.ID, &binding.ScheduleID, &binding.TargetType, &binding.TargetID, &binding.TargetName, &binding.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+// GetBinding 根据ID获取绑定
+func (s *ScheduleService) GetBinding(id int) (*ScheduleBinding, error) {
+	return scanScheduleBinding(s.db.QueryRow(`SELECT `+scheduleBindingColumns+` FROM schedule_bindings b WHERE b.id = ?`, id))
+}
+
+// ListBindings 获取时间窗口的绑定
+func (s *ScheduleService) ListBindings(scheduleID int) ([]*ScheduleBinding, error) {
+	rows, err := s.db.Query(`SELECT `+scheduleBindingColumns+` FROM schedule_bindings b WHERE b.schedule_id = ? ORDER BY b.id`, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []*ScheduleBinding{}
+	for rows.Next() {
+		binding, err := scanScheduleBinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, rows.Err()
+}
+
+// Unbind 删除绑定
+func (s *ScheduleService) Unbind(id int) error {
+	_, err := s.db.Exec(`DELETE FROM schedule_bindings WHERE id = ?`, id)
+	return err
+}
+
+// ForTarget 获取对象绑定的时间窗口，未绑定时返回 nil
+func (s *ScheduleService) ForTarget(targetType string, targetID int) (*Schedule, error) {
+	schedule, err := scanSchedule(s.db.QueryRow(`
+		SELECT `+scheduleColumns+` FROM schedules s
+		INNER JOIN schedule_bindings tb ON tb.schedule_id = s.id
+		WHERE tb.target_type = ? AND tb.target_id = ?`, targetType, targetID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return schedule, err
+}
+
+// AccessPathSchedules 用户在 at 时刻连接服务器的每条访问途径受哪些时间窗口限制，途径来自 accessPathsQuery：
+// 直接授权、临时访问申请和紧急访问不受限制，授权受其绑定的时间窗口限制，通过用户组获得的授权同时受用户组的时间窗口限制。
+// 返回值每个元素是一条途径上的时间窗口ID，空切片表示该途径不受限制；没有任何访问途径时返回空结果
+func (s *ScheduleService) AccessPathSchedules(userID, serverID int, at time.Time) ([][]int, error) {
+	rows, err := s.db.Query(`
+		SELECT COALESCE(gb.schedule_id, 0), COALESCE(grp.schedule_id, 0)
+		FROM (`+accessPathsQuery+`) a
+		LEFT JOIN schedule_bindings gb ON a.path_type = 'grant' AND gb.target_type = 'grant' AND gb.target_id = a.path_id
+		LEFT JOIN schedule_bindings grp ON a.group_id != 0 AND grp.target_type = 'group' AND grp.target_id = a.group_id
+		WHERE a.server_id = ?
+	`, append(accessArgs(userID, at), serverID)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	paths := [][]int{}
+	for rows.Next() {
+		var grantSchedule, groupSchedule int
+		if err := rows.Scan(&grantSchedule, &groupSchedule); err != nil {
+			return nil, err
+		}
+		path := []int{}
+		for _, id := range []int{grantSchedule, groupSchedule} {
+			if id != 0 {
+				path = append(path, id)
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths, rows.Err()
+}
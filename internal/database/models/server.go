@@ -3,8 +3,8 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
@@ -177,6 +177,89 @@ func (s *ServerService) List(limit, offset int) ([]*Server, error) {
 	return servers, nil
 }
 
+// 用户获得服务器连接权的途径类型
+const (
+	AccessPathDirect        = "direct"         // 直接授权（user_server_permissions）
+	AccessPathGrant         = "grant"          // 授予用户本人或其所属用户组的 connect 权限
+	AccessPathAccessRequest = "access_request" // 已批准且未到期的临时访问申请
+	AccessPathBreakGlass    = "break_glass"    // 生效中的紧急访问
+)
+
+// accessPathsQuery 用户连接服务器的全部途径，服务器列表、终端启动检查、时间窗口和访问解释共用这一套规则：
+// 直接授权、授予用户本人或其所属用户组的 connect 权限（目标为服务器本身或服务器带有的标签）、
+// 已批准且未到期的临时访问申请，以及生效中的紧急访问。
+// 每行是一条途径：server_id、path_type、path_id、group_id（通过用户组获得时的用户组，否则为 0）、tag。
+// 参数为 accessArgs 的返回值
+const accessPathsQuery = `
+	SELECT p.server_id, 'direct' AS path_type, p.id AS path_id, 0 AS group_id, '' AS tag
+	FROM user_server_permissions p WHERE p.user_id = ?
+	UNION ALL
+	SELECT srv.id, 'grant', g.id, CASE g.subject_type WHEN 'group' THEN g.subject_id ELSE 0 END, COALESCE(g.tag, '')
+	FROM servers srv
+	INNER JOIN access_grants g ON g.server_id = srv.id
+		OR (g.tag IS NOT NULL AND EXISTS (
+			SELECT 1 FROM json_each(COALESCE(NULLIF(srv.tags, ''), '[]')) WHERE value = g.tag))
+	WHERE g.permission = 'connect' AND (
+		(g.subject_type = 'user' AND g.subject_id = ?)
+		OR (g.subject_type = 'group' AND g.subject_id IN (SELECT group_id FROM group_members WHERE user_id = ?)))
+	UNION ALL
+	SELECT srv.id, 'access_request', r.id, 0, COALESCE(r.tag, '')
+	FROM servers srv
+	INNER JOIN access_requests r ON r.server_id = srv.id
+		OR (r.tag IS NOT NULL AND EXISTS (
+			SELECT 1 FROM json_each(COALESCE(NULLIF(srv.tags, ''), '[]')) WHERE value = r.tag))
+	WHERE r.user_id = ? AND r.status = 'approved' AND r.expires_at > ?
+	UNION ALL
+	SELECT srv.id, 'break_glass', b.id, 0, ''
+	FROM servers srv
+	INNER JOIN break_glass_activations b ON b.user_id = ? AND b.status = 'active' AND b.expires_at > ?
+`
+
+// accessibleServerIDsQuery 用户可访问的服务器ID，即至少有一条访问途径的服务器。参数为 accessArgs 的返回值
+const accessibleServerIDsQuery = `SELECT server_id FROM (` + accessPathsQuery + `)`
+
+// accessArgs 按 accessPathsQuery 中占位符的顺序填充用户ID和判断临时授权、紧急访问是否到期的时间
+func accessArgs(userID int, at time.Time) []interface{} {
+	at = at.UTC()
+	return []interface{}{userID, userID, userID, userID, at, userID, at}
+}
+
+// AccessPathRecord 用户获得服务器连接权的一条途径
+type AccessPathRecord struct {
+	ServerID int
+	Type     string // AccessPath* 常量
+	ID       int    // 直接授权、服务器授权、申请或紧急访问的ID
+	GroupID  int    // 通过用户组获得授权时的用户组
+	Tag      string // 按标签授权或申请时匹配的标签
+}
+
+// AccessPaths 用户在 at 时刻连接服务器的全部途径，serverID 为 0 时返回全部服务器的途径
+func (s *ServerService) AccessPaths(userID, serverID int, at time.Time) ([]*AccessPathRecord, error) {
+	query := `SELECT server_id, path_type, path_id, group_id, tag FROM (` + accessPathsQuery + `)`
+	args := accessArgs(userID, at)
+	if serverID != 0 {
+		query += ` WHERE server_id = ?`
+		args = append(args, serverID)
+	}
+	query += ` ORDER BY server_id, CASE path_type WHEN 'direct' THEN 0 WHEN 'grant' THEN 1 WHEN 'access_request' THEN 2 ELSE 3 END, path_id`
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*AccessPathRecord{}
+	for rows.Next() {
+		var record AccessPathRecord
+		if err := rows.Scan(&record.ServerID, &record.Type, &record.ID, &record.GroupID, &record.Tag); err != nil {
+			return nil, err
+		}
+		records = append(records, &record)
+	}
+	return records, rows.Err()
+}
+
 // GetByUserID 获取用户有权限的服务器列表
 func (s *ServerService) GetByUserID(userID int, limit, offset int) ([]*Server, error) {
 	query := `
@@ -184,14 +267,13 @@ func (s *ServerService) GetByUserID(userID int, limit, offset int) ([]*Server, e
 		       s.description, s.tags, s.last_login_time, s.created_at, s.updated_at,
 		       c.name as credential_name
 		FROM servers s
-		INNER JOIN user_server_permissions p ON s.id = p.server_id
 		LEFT JOIN credentials c ON s.credential_id = c.id
-		WHERE p.user_id = ?
+		WHERE s.id IN (` + accessibleServerIDsQuery + `)
 		ORDER BY s.created_at DESC
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := s.db.Query(query, userID, limit, offset)
+	rows, err := s.db.Query(query, append(accessArgs(userID, time.Now()), limit, offset)...)
 	if err != nil {
 		return nil, err
 	}
@@ -218,6 +300,61 @@ func (s *ServerService) GetByUserID(userID int, limit, offset int) ([]*Server, e
 	return servers, nil
 }
 
+// UserCanAccess 判断用户是否有权连接服务器，规则与 GetByUserID 相同
+func (s *ServerService) UserCanAccess(userID, serverID int) (bool, error) {
+	var exists bool
+	query := `SELECT EXISTS (SELECT 1 FROM (` + accessibleServerIDsQuery + `) a WHERE a.server_id = ?)`
+	err := s.db.QueryRow(query, append(accessArgs(userID, time.Now()), serverID)...).Scan(&exists)
+	return exists, err
+}
+
+// DirectPermission 直接授予用户的服务器权限（user_server_permissions）
+type DirectPermission struct {
+	ID         int    `json:"id"`
+	UserID     int    `json:"user_id"`
+	Username   string `json:"username"`
+	ServerID   int    `json:"server_id"`
+	ServerName string `json:"server_name"`
+	Permission string `json:"permission"`
+	Source     string `json:"source,omitempty"` // 身份源同步的来源，手工授权为空
+}
+
+// ListDirectPermissions 获取全部直接授权
+func (s *ServerService) ListDirectPermissions() ([]*DirectPermission, error) {
+	rows, err := s.db.Query(`
+		SELECT p.id, p.user_id, COALESCE(u.username, ''), p.server_id, COALESCE(srv.name, ''),
+		       COALESCE(p.permission, ''), COALESCE(p.source, '')
+		FROM user_server_permissions p
+		LEFT JOIN users u ON u.id = p.user_id
+		LEFT JOIN servers srv ON srv.id = p.server_id
+		ORDER BY p.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []*DirectPermission{}
+	for rows.Next() {
+		var p DirectPermission
+		if err := rows.Scan(&p.ID, &p.UserID, &p.Username, &p.ServerID, &p.ServerName, &p.Permission, &p.Source); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &p)
+	}
+	return permissions, rows.Err()
+}
+
+// DeleteDirectPermission 删除一条直接授权，返回授权是否存在
+func (s *ServerService) DeleteDirectPermission(id int) (bool, error) {
+	result, err := s.db.Exec(`DELETE FROM user_server_permissions WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
 // Update 更新服务器
 func (s *ServerService) Update(id int, req *ServerUpdate) (*Server, error) {
 	server, err := s.GetByID(id)
@@ -278,11 +415,64 @@ func (s *ServerService) Update(id int, req *ServerUpdate) (*Server, error) {
 	return s.GetByID(id)
 }
 
-// Delete 删除服务器
+// Delete 删除服务器，并在同一事务中删除针对该服务器的授权、时间窗口绑定和连接要求
 func (s *ServerService) Delete(id int) error {
-	query := `DELETE FROM servers WHERE id = ?`
-	_, err := s.db.Exec(query, id)
-	return err
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM servers WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM user_server_permissions WHERE server_id = ?`, id); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM schedule_bindings WHERE (target_type = ? AND target_id = ?)
+		OR (target_type = ? AND target_id IN (SELECT id FROM access_grants WHERE server_id = ?))`,
+		ScheduleTargetServer, id, ScheduleTargetGrant, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM connect_requirements WHERE server_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM access_grants WHERE server_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SyncSourceGrants 用身份源映射的服务器标签重建该来源的授权，手工授权和其他来源的授权不受影响
+// 返回同步后该来源授权的服务器数
+func (s *ServerService) SyncSourceGrants(userID int, source string, tags []string) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM user_server_permissions WHERE user_id = ? AND source = ?`, userID, source); err != nil {
+		return 0, err
+	}
+
+	granted := 0
+	for _, tag := range tags {
+		result, err := tx.Exec(`
+			INSERT INTO user_server_permissions (user_id, server_id, source)
+			SELECT ?, s.id, ? FROM servers s
+			WHERE EXISTS (SELECT 1 FROM json_each(COALESCE(NULLIF(s.tags, ''), '[]')) WHERE value = ?)
+			ON CONFLICT(user_id, server_id) DO NOTHING
+		`, userID, source, tag)
+		if err != nil {
+			return 0, err
+		}
+		n, _ := result.RowsAffected()
+		granted += int(n)
+	}
+
+	return granted, tx.Commit()
 }
 
 // GetServerCount 获取服务器总数
@@ -306,7 +496,7 @@ func (s *ServerService) UpdateLastLoginTime(id int) error {
 // CheckServerStatus 检测服务器状态
 func (s *Server) CheckServerStatus() string {
 	timeout := 5 * time.Second
-	address := fmt.Sprintf("%s:%d", s.Host, s.Port)
+	address := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
 
 	conn, err := net.DialTimeout("tcp", address, timeout)
 	if err != nil {
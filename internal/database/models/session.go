@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,17 +10,21 @@ import (
 
 // Session 会话模型
 type Session struct {
-	ID            string     `json:"id" db:"id"`
-	UserID        int        `json:"user_id" db:"user_id"`
-	ServerID      int        `json:"server_id" db:"server_id"`
-	StartTime     time.Time  `json:"start_time" db:"start_time"`
-	EndTime       *time.Time `json:"end_time" db:"end_time"`
-	Status        string     `json:"status" db:"status"`
-	ClientIP      string     `json:"client_ip" db:"client_ip"`
-	RecordingFile string     `json:"recording_file" db:"recording_file"`
-	LastHeartbeat *time.Time `json:"last_heartbeat" db:"last_heartbeat"` // 最后心跳时间
-	Username      string     `json:"username,omitempty"`                 // 关联查询时使用
-	ServerName    string     `json:"server_name,omitempty"`              // 关联查询时使用
+	ID             string          `json:"id" db:"id"`
+	UserID         int             `json:"user_id" db:"user_id"`
+	ServerID       int             `json:"server_id" db:"server_id"`
+	StartTime      time.Time       `json:"start_time" db:"start_time"`
+	EndTime        *time.Time      `json:"end_time" db:"end_time"`
+	Status         string          `json:"status" db:"status"`
+	ClientIP       string          `json:"client_ip" db:"client_ip"`
+	RecordingFile  string          `json:"recording_file" db:"recording_file"`
+	LastHeartbeat  *time.Time      `json:"last_heartbeat" db:"last_heartbeat"`             // 最后心跳时间
+	Reason         string          `json:"reason" db:"reason"`                             // 连接原因
+	TicketID       string          `json:"ticket_id" db:"ticket_id"`                       // 关联的工单号
+	BreakGlassID   *int            `json:"break_glass_id,omitempty" db:"break_glass_id"`   // 在紧急访问期间建立的会话
+	PolicyDecision *PolicyDecision `json:"policy_decision,omitempty" db:"policy_decision"` // 连接策略的决定
+	Username       string          `json:"username,omitempty"`                             // 关联查询时使用
+	ServerName     string          `json:"server_name,omitempty"`                          // 关联查询时使用
 }
 
 // SessionService 会话服务
@@ -33,23 +38,38 @@ func NewSessionService(db *sql.DB) *SessionService {
 }
 
 // Create 创建会话
-func (s *SessionService) Create(userID, serverID int, clientIP, recordingFile string) (*Session, error) {
+func (s *SessionService) Create(userID, serverID int, clientIP, recordingFile string, justification SessionJustification) (*Session, error) {
 	sessionID := uuid.New().String()
 
 	query := `
-		INSERT INTO sessions (id, user_id, server_id, client_ip, recording_file) 
-		VALUES (?, ?, ?, ?, ?) 
-		RETURNING id, user_id, server_id, start_time, status, client_ip, recording_file
+		INSERT INTO sessions (id, user_id, server_id, client_ip, recording_file, reason, ticket_id, break_glass_id, policy_decision) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) 
+		RETURNING id, user_id, server_id, start_time, status, client_ip, recording_file, COALESCE(reason, ''), COALESCE(ticket_id, ''), break_glass_id
 	`
 
+	var breakGlassID *int
+	if justification.BreakGlassID > 0 {
+		breakGlassID = &justification.BreakGlassID
+	}
+	var policyDecision *string
+	if justification.Policy != nil {
+		data, err := json.Marshal(justification.Policy)
+		if err != nil {
+			return nil, err
+		}
+		decision := string(data)
+		policyDecision = &decision
+	}
+
 	var session Session
-	err := s.db.QueryRow(query, sessionID, userID, serverID, clientIP, recordingFile).Scan(
+	err := s.db.QueryRow(query, sessionID, userID, serverID, clientIP, recordingFile, justification.Reason, justification.TicketID, breakGlassID, policyDecision).Scan(
 		&session.ID, &session.UserID, &session.ServerID, &session.StartTime,
-		&session.Status, &session.ClientIP, &session.RecordingFile,
+		&session.Status, &session.ClientIP, &session.RecordingFile, &session.Reason, &session.TicketID, &session.BreakGlassID,
 	)
 	if err != nil {
 		return nil, err
 	}
+	session.PolicyDecision = justification.Policy
 
 	return &session, nil
 }
@@ -58,7 +78,8 @@ func (s *SessionService) Create(userID, serverID int, clientIP, recordingFile st
 func (s *SessionService) GetByID(id string) (*Session, error) {
 	query := `
 		SELECT s.id, s.user_id, s.server_id, s.start_time, s.end_time, s.status, 
-		       s.client_ip, s.recording_file, s.last_heartbeat, u.username, srv.name as server_name
+		       s.client_ip, s.recording_file, s.last_heartbeat, COALESCE(s.reason, ''), COALESCE(s.ticket_id, ''), s.break_glass_id, s.policy_decision,
+		       u.username, srv.name as server_name
 		FROM sessions s
 		LEFT JOIN users u ON s.user_id = u.id
 		LEFT JOIN servers srv ON s.server_id = srv.id
@@ -69,7 +90,7 @@ func (s *SessionService) GetByID(id string) (*Session, error) {
 	err := s.db.QueryRow(query, id).Scan(
 		&session.ID, &session.UserID, &session.ServerID, &session.StartTime,
 		&session.EndTime, &session.Status, &session.ClientIP, &session.RecordingFile,
-		&session.LastHeartbeat, &session.Username, &session.ServerName,
+		&session.LastHeartbeat, &session.Reason, &session.TicketID, &session.BreakGlassID, policyDecisionColumn{&session.PolicyDecision}, &session.Username, &session.ServerName,
 	)
 	if err != nil {
 		return nil, err
@@ -82,7 +103,8 @@ func (s *SessionService) GetByID(id string) (*Session, error) {
 func (s *SessionService) List(limit, offset int) ([]*Session, error) {
 	query := `
 		SELECT s.id, s.user_id, s.server_id, s.start_time, s.end_time, s.status, 
-		       s.client_ip, s.recording_file, s.last_heartbeat, u.username, srv.name as server_name
+		       s.client_ip, s.recording_file, s.last_heartbeat, COALESCE(s.reason, ''), COALESCE(s.ticket_id, ''), s.break_glass_id, s.policy_decision,
+		       u.username, srv.name as server_name
 		FROM sessions s
 		LEFT JOIN users u ON s.user_id = u.id
 		LEFT JOIN servers srv ON s.server_id = srv.id
@@ -101,7 +123,8 @@ func (s *SessionService) List(limit, offset int) ([]*Session, error) {
 		var session Session
 		err := rows.Scan(&session.ID, &session.UserID, &session.ServerID,
 			&session.StartTime, &session.EndTime, &session.Status,
-			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Username, &session.ServerName)
+			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Reason, &session.TicketID, &session.BreakGlassID, policyDecisionColumn{&session.PolicyDecision},
+			&session.Username, &session.ServerName)
 		if err != nil {
 			return nil, err
 		}
@@ -115,7 +138,8 @@ func (s *SessionService) List(limit, offset int) ([]*Session, error) {
 func (s *SessionService) GetByUserID(userID int, limit, offset int) ([]*Session, error) {
 	query := `
 		SELECT s.id, s.user_id, s.server_id, s.start_time, s.end_time, s.status, 
-		       s.client_ip, s.recording_file, s.last_heartbeat, u.username, srv.name as server_name
+		       s.client_ip, s.recording_file, s.last_heartbeat, COALESCE(s.reason, ''), COALESCE(s.ticket_id, ''), s.break_glass_id, s.policy_decision,
+		       u.username, srv.name as server_name
 		FROM sessions s
 		LEFT JOIN users u ON s.user_id = u.id
 		LEFT JOIN servers srv ON s.server_id = srv.id
@@ -135,7 +159,8 @@ func (s *SessionService) GetByUserID(userID int, limit, offset int) ([]*Session,
 		var session Session
 		err := rows.Scan(&session.ID, &session.UserID, &session.ServerID,
 			&session.StartTime, &session.EndTime, &session.Status,
-			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Username, &session.ServerName)
+			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Reason, &session.TicketID, &session.BreakGlassID, policyDecisionColumn{&session.PolicyDecision},
+			&session.Username, &session.ServerName)
 		if err != nil {
 			return nil, err
 		}
@@ -145,6 +170,40 @@ func (s *SessionService) GetByUserID(userID int, limit, offset int) ([]*Session,
 	return sessions, nil
 }
 
+// ListByBreakGlass 获取某次紧急访问期间建立的会话，用于事后复核
+func (s *SessionService) ListByBreakGlass(breakGlassID int) ([]*Session, error) {
+	query := `
+		SELECT s.id, s.user_id, s.server_id, s.start_time, s.end_time, s.status,
+		       s.client_ip, s.recording_file, s.last_heartbeat, COALESCE(s.reason, ''), COALESCE(s.ticket_id, ''), s.break_glass_id, s.policy_decision,
+		       u.username, srv.name as server_name
+		FROM sessions s
+		LEFT JOIN users u ON s.user_id = u.id
+		LEFT JOIN servers srv ON s.server_id = srv.id
+		WHERE s.break_glass_id = ?
+		ORDER BY s.start_time
+	`
+
+	rows, err := s.db.Query(query, breakGlassID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserID, &session.ServerID,
+			&session.StartTime, &session.EndTime, &session.Status,
+			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Reason, &session.TicketID, &session.BreakGlassID, policyDecisionColumn{&session.PolicyDecision},
+			&session.Username, &session.ServerName)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
+
 // UpdateStatus 更新会话状态
 func (s *SessionService) UpdateStatus(id, status string) error {
 	query := `UPDATE sessions SET status = ?, end_time = CURRENT_TIMESTAMP WHERE id = ?`
@@ -210,7 +269,8 @@ func (s *SessionService) GetStaleActiveSessions(timeout time.Duration) ([]*Sessi
 	
 	query := `
 		SELECT s.id, s.user_id, s.server_id, s.start_time, s.end_time, s.status, 
-		       s.client_ip, s.recording_file, s.last_heartbeat, u.username, srv.name as server_name
+		       s.client_ip, s.recording_file, s.last_heartbeat, COALESCE(s.reason, ''), COALESCE(s.ticket_id, ''), s.break_glass_id, s.policy_decision,
+		       u.username, srv.name as server_name
 		FROM sessions s
 		LEFT JOIN users u ON s.user_id = u.id
 		LEFT JOIN servers srv ON s.server_id = srv.id
@@ -230,7 +290,7 @@ func (s *SessionService) GetStaleActiveSessions(timeout time.Duration) ([]*Sessi
 		var session Session
 		err := rows.Scan(&session.ID, &session.UserID, &session.ServerID,
 			&session.StartTime, &session.EndTime, &session.Status,
-			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, 
+			&session.ClientIP, &session.RecordingFile, &session.LastHeartbeat, &session.Reason, &session.TicketID, &session.BreakGlassID, policyDecisionColumn{&session.PolicyDecision},
 			&session.Username, &session.ServerName)
 		if err != nil {
 			return nil, err
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// UserTOTP 用户的 TOTP 密钥，确认验证码后才启用
+type UserTOTP struct {
+	UserID    int        `json:"user_id" db:"user_id"`
+	Secret    string     `json:"-" db:"secret"`
+	Enabled   bool       `json:"enabled" db:"enabled"`
+	LastStep  int64      `json:"-" db:"last_step"` // 最近一次通过验证的时间步，防止验证码重放
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	EnabledAt *time.Time `json:"enabled_at" db:"enabled_at"`
+}
+
+// TOTPService TOTP 密钥服务
+type TOTPService struct {
+	db *sql.DB
+}
+
+// NewTOTPService 创建 TOTP 密钥服务
+func NewTOTPService(db *sql.DB) *TOTPService {
+	return &TOTPService{db: db}
+}
+
+// Get 获取用户的 TOTP 密钥，未设置时返回 sql.ErrNoRows
+func (s *TOTPService) Get(userID int) (*UserTOTP, error) {
+	var totp UserTOTP
+	err := s.db.QueryRow(`SELECT user_id, secret, enabled, last_step, created_at, enabled_at FROM user_totp WHERE user_id = ?`, userID).Scan(
+		&totp.UserID, &totp.Secret, &totp.Enabled, &totp.LastStep, &totp.CreatedAt, &totp.EnabledAt)
+	if err != nil {
+		return nil, err
+	}
+	return &totp, nil
+}
+
+// SetPending 保存待确认的密钥，已启用的密钥不会被覆盖，返回是否保存成功
+func (s *TOTPService) SetPending(userID int, secret string) (bool, error) {
+	result, err := s.db.Exec(`
+		INSERT INTO user_totp (user_id, secret) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.enabled = FALSE
+	`, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Enable 启用密钥并记录确认时使用的时间步
+func (s *TOTPService) Enable(userID int, step int64) error {
+	_, err := s.db.Exec(`UPDATE user_totp SET enabled = TRUE, enabled_at = ?, last_step = ? WHERE user_id = ?`,
+		time.Now().UTC(), step, userID)
+	return err
+}
+
+// UseStep 记录通过验证的时间步，时间步不大于上一次时返回 false（验证码已被使用）
+func (s *TOTPService) UseStep(userID int, step int64) (bool, error) {
+	result, err := s.db.Exec(`UPDATE user_totp SET last_step = ? WHERE user_id = ? AND last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// Delete 删除用户的 TOTP 密钥
+func (s *TOTPService) Delete(userID int) error {
+	_, err := s.db.Exec(`DELETE FROM user_totp WHERE user_id = ?`, userID)
+	return err
+}
@@ -1,34 +1,76 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
+// 用户状态
+const (
+	UserStatusActive   = "active"
+	UserStatusDisabled = "disabled"
+	UserStatusLocked   = "locked"
+)
+
+// 账号认证来源
+const (
+	AuthSourceLocal = "local" // 本地密码
+	AuthSourceLDAP  = "ldap"  // LDAP / Active Directory
+	AuthSourceSAML  = "saml"  // SAML 2.0 单点登录
+)
+
 // User 用户模型
 type User struct {
-	ID           int       `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	Role         string    `json:"role" db:"role"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID                 int        `json:"id" db:"id"`
+	Username           string     `json:"username" db:"username"`
+	PasswordHash       string     `json:"-" db:"password_hash"`
+	Role               string     `json:"role" db:"role"`
+	AccountType        string     `json:"account_type" db:"account_type"` // human 或 service
+	AuthSource         string     `json:"auth_source" db:"auth_source"`   // local 或外部身份源名称
+	Status             string     `json:"status" db:"status"`             // active, disabled, locked
+	ExpiresAt          *time.Time `json:"expires_at" db:"expires_at"`     // 账号过期时间，为空表示永不过期
+	LastLoginAt        *time.Time `json:"last_login_at" db:"last_login_at"`
+	LastLoginIP        string     `json:"last_login_ip" db:"last_login_ip"`
+	MustChangePassword bool       `json:"must_change_password" db:"must_change_password"`
+	TokenVersion       int        `json:"-" db:"token_version"`         // 递增后该用户已签发的令牌全部失效
+	Permissions        []string   `json:"permissions,omitempty" db:"-"` // 角色权限，仅在返回当前用户信息时填充
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Expired 账号是否已过期
+func (u *User) Expired() bool {
+	return u.ExpiresAt != nil && !time.Now().Before(*u.ExpiresAt)
+}
+
+// Active 账号是否可用：状态为 active 且未过期
+func (u *User) Active() bool {
+	return u.Status == UserStatusActive && !u.Expired()
 }
 
 // UserCreate 创建用户请求
 type UserCreate struct {
-	Username string `json:"username" binding:"required,min=3,max=50"`
-	Password string `json:"password" binding:"required,min=6"`
-	Role     string `json:"role" binding:"required,oneof=admin user"`
+	Username           string     `json:"username" binding:"required,min=3,max=50"`
+	Password           string     `json:"password" binding:"required,min=6"`
+	Role               string     `json:"role" binding:"required,max=20"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	MustChangePassword bool       `json:"must_change_password"`
 }
 
 // UserUpdate 更新用户请求
 type UserUpdate struct {
-	Username string `json:"username" binding:"omitempty,min=3,max=50"`
-	Password string `json:"password" binding:"omitempty,min=6"`
-	Role     string `json:"role" binding:"omitempty,oneof=admin user"`
+	Username           string     `json:"username" binding:"omitempty,min=3,max=50"`
+	Password           string     `json:"password" binding:"omitempty,min=6"`
+	Role               string     `json:"role" binding:"omitempty,max=20"`
+	Status             string     `json:"status" binding:"omitempty,oneof=active disabled locked"`
+	ExpiresAt          *time.Time `json:"expires_at"`
+	ClearExpiresAt     bool       `json:"clear_expires_at"` // 取消账号过期时间
+	MustChangePassword *bool      `json:"must_change_password"`
+	AuthSource         string     `json:"auth_source" binding:"omitempty,max=50"` // local、ldap、saml 或 oidc:<名称>
 }
 
 // UserService 用户服务
@@ -41,6 +83,20 @@ func NewUserService(db *sql.DB) *UserService {
 	return &UserService{db: db}
 }
 
+const userColumns = `id, username, password_hash, role, account_type, auth_source, status, expires_at, last_login_at,
+	COALESCE(last_login_ip, ''), must_change_password, token_version, created_at, updated_at`
+
+func scanUser(scanner interface{ Scan(...interface{}) error }) (*User, error) {
+	var user User
+	err := scanner.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.AccountType, &user.AuthSource, &user.Status,
+		&user.ExpiresAt, &user.LastLoginAt, &user.LastLoginIP, &user.MustChangePassword, &user.TokenVersion,
+		&user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // Create 创建用户
 func (s *UserService) Create(req *UserCreate) (*User, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -48,74 +104,109 @@ func (s *UserService) Create(req *UserCreate) (*User, error) {
 		return nil, err
 	}
 
+	var expiresAt interface{}
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.UTC()
+	}
+
 	query := `
-		INSERT INTO users (username, password_hash, role) 
-		VALUES (?, ?, ?) 
-		RETURNING id, username, role, created_at, updated_at
-	`
+		INSERT INTO users (username, password_hash, role, expires_at, must_change_password) 
+		VALUES (?, ?, ?, ?, ?) 
+		RETURNING ` + userColumns
 
-	var user User
-	err = s.db.QueryRow(query, req.Username, string(hashedPassword), req.Role).Scan(
-		&user.ID, &user.Username, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
+	return scanUser(s.db.QueryRow(query, req.Username, string(hashedPassword), req.Role, expiresAt, req.MustChangePassword))
+}
+
+// CreateServiceAccount 创建服务账号，密码为随机值且不能用于登录
+func (s *UserService) CreateServiceAccount(req *ServiceAccountCreate) (*User, error) {
+	hashedPassword, err := randomPasswordHash()
 	if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
-}
+	query := `
+		INSERT INTO users (username, password_hash, role, account_type) 
+		VALUES (?, ?, ?, ?) 
+		RETURNING ` + userColumns
 
-// GetByID 根据ID获取用户
-func (s *UserService) GetByID(id int) (*User, error) {
-	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE id = ?`
+	return scanUser(s.db.QueryRow(query, req.Username, hashedPassword, req.Role, AccountTypeService))
+}
 
-	var user User
-	err := s.db.QueryRow(query, id).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
+// CreateExternalUser 首次通过外部身份源登录时创建用户，本地密码为随机值且不能用于登录
+func (s *UserService) CreateExternalUser(username, role, authSource string) (*User, error) {
+	hashedPassword, err := randomPasswordHash()
 	if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	query := `
+		INSERT INTO users (username, password_hash, role, auth_source) 
+		VALUES (?, ?, ?, ?) 
+		RETURNING ` + userColumns
+
+	return scanUser(s.db.QueryRow(query, username, hashedPassword, role, authSource))
 }
 
-// GetByUsername 根据用户名获取用户
-func (s *UserService) GetByUsername(username string) (*User, error) {
-	query := `SELECT id, username, password_hash, role, created_at, updated_at FROM users WHERE username = ?`
+// SetRole 同步外部身份源映射的角色，角色变化时使已签发的令牌失效
+func (s *UserService) SetRole(id int, role string) error {
+	_, err := s.db.Exec(`
+		UPDATE users SET role = ?, token_version = token_version + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND role != ?
+	`, role, id, role)
+	return err
+}
 
-	var user User
-	err := s.db.QueryRow(query, username).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt, &user.UpdatedAt,
-	)
+// randomPasswordHash 生成随机密码的哈希，用于不允许本地密码登录的账号
+func randomPasswordHash() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(buf)), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
+	return string(hashedPassword), nil
+}
 
-	return &user, nil
+// ListServiceAccounts 获取服务账号列表
+func (s *UserService) ListServiceAccounts() ([]*User, error) {
+	return s.query(`SELECT `+userColumns+` FROM users WHERE account_type = ? ORDER BY created_at DESC`, AccountTypeService)
+}
+
+// GetByID 根据ID获取用户
+func (s *UserService) GetByID(id int) (*User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+// GetByUsername 根据用户名获取用户
+func (s *UserService) GetByUsername(username string) (*User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE username = ?`, username))
 }
 
 // List 获取用户列表
 func (s *UserService) List(limit, offset int) ([]*User, error) {
-	query := `SELECT id, username, role, created_at, updated_at FROM users ORDER BY created_at DESC LIMIT ? OFFSET ?`
+	return s.query(`SELECT `+userColumns+` FROM users ORDER BY created_at DESC LIMIT ? OFFSET ?`, limit, offset)
+}
 
-	rows, err := s.db.Query(query, limit, offset)
+// query 查询用户列表
+func (s *UserService) query(query string, args ...interface{}) ([]*User, error) {
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []*User
+	users := []*User{}
 	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt, &user.UpdatedAt)
+		user, err := scanUser(rows)
 		if err != nil {
 			return nil, err
 		}
-		users = append(users, &user)
+		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
 // Update 更新用户
@@ -125,34 +216,170 @@ func (s *UserService) Update(id int, req *UserUpdate) (*User, error) {
 		return nil, err
 	}
 
+	// 角色、密码、认证来源变更或账号停用时使已签发的令牌全部失效
+	revoke := false
+	reason := "credentials_changed"
 	if req.Username != "" {
 		user.Username = req.Username
 	}
-	if req.Role != "" {
+	if req.Role != "" && req.Role != user.Role {
 		user.Role = req.Role
+		revoke = true
 	}
+	previousHash := user.PasswordHash
 	if req.Password != "" {
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return nil, err
 		}
 		user.PasswordHash = string(hashedPassword)
+		revoke = true
+	}
+	if req.Status != "" && req.Status != user.Status {
+		user.Status = req.Status
+		if req.Status != UserStatusActive {
+			revoke = true
+			reason = "account_" + req.Status
+		}
+	}
+	if req.ClearExpiresAt {
+		user.ExpiresAt = nil
+	} else if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		user.ExpiresAt = &expiresAt
+	}
+	if req.MustChangePassword != nil {
+		// 要求修改密码时让用户重新登录，新令牌会带上该标记
+		if *req.MustChangePassword && !user.MustChangePassword {
+			revoke = true
+		}
+		user.MustChangePassword = *req.MustChangePassword
+	}
+	if req.AuthSource != "" && req.AuthSource != user.AuthSource {
+		user.AuthSource = req.AuthSource
+		revoke = true
+	}
+	if revoke {
+		user.TokenVersion++
 	}
 
-	query := `UPDATE users SET username = ?, password_hash = ?, role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
-	_, err = s.db.Exec(query, user.Username, user.PasswordHash, user.Role, id)
+	var expiresAt interface{}
+	if user.ExpiresAt != nil {
+		expiresAt = *user.ExpiresAt
+	}
+
+	query := `UPDATE users SET username = ?, password_hash = ?, role = ?, status = ?, expires_at = ?, must_change_password = ?,
+		auth_source = ?, token_version = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`
+	_, err = s.db.Exec(query, user.Username, user.PasswordHash, user.Role, user.Status, expiresAt, user.MustChangePassword,
+		user.AuthSource, user.TokenVersion, id)
 	if err != nil {
 		return nil, err
 	}
+	if user.PasswordHash != previousHash {
+		if err := s.addPasswordHistory(id, previousHash); err != nil {
+			return nil, err
+		}
+	}
+	if revoke {
+		if _, err := revokeUserSessions(s.db, id, reason); err != nil {
+			return nil, err
+		}
+	}
 
 	return s.GetByID(id)
 }
 
+// ChangePassword 用户修改自己的密码：旧密码写入历史，清除强制改密标记，撤销全部登录会话
+func (s *UserService) ChangePassword(id int, newPassword string) error {
+	user, err := s.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE users SET password_hash = ?, must_change_password = FALSE, token_version = token_version + 1,
+			updated_at = CURRENT_TIMESTAMP WHERE id = ?
+	`, string(hashedPassword), id)
+	if err != nil {
+		return err
+	}
+	if err := s.addPasswordHistory(id, user.PasswordHash); err != nil {
+		return err
+	}
+	_, err = revokeUserSessions(s.db, id, "password_changed")
+	return err
+}
+
+// PasswordHistory 获取用户最近使用过的密码哈希，按时间倒序
+func (s *UserService) PasswordHistory(id, limit int) ([]string, error) {
+	rows, err := s.db.Query(`SELECT password_hash FROM password_history WHERE user_id = ? ORDER BY id DESC LIMIT ?`, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// addPasswordHistory 记录被替换的密码哈希
+func (s *UserService) addPasswordHistory(id int, passwordHash string) error {
+	_, err := s.db.Exec(`INSERT INTO password_history (user_id, password_hash, created_at) VALUES (?, ?, ?)`,
+		id, passwordHash, time.Now().UTC())
+	return err
+}
+
+// RecordLogin 记录最近登录时间和IP
+func (s *UserService) RecordLogin(id int, ipAddress string) error {
+	_, err := s.db.Exec(`UPDATE users SET last_login_at = ?, last_login_ip = ? WHERE id = ?`, time.Now().UTC(), ipAddress, id)
+	return err
+}
+
+// BumpTokenVersion 递增用户令牌版本并撤销全部登录会话，用于"全部登出"
+func (s *UserService) BumpTokenVersion(id int, reason string) (int, error) {
+	result, err := s.db.Exec(`UPDATE users SET token_version = token_version + 1 WHERE id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return 0, sql.ErrNoRows
+	}
+	return revokeUserSessions(s.db, id, reason)
+}
+
 // Delete 删除用户
 func (s *UserService) Delete(id int) error {
 	query := `DELETE FROM users WHERE id = ?`
-	_, err := s.db.Exec(query, id)
-	return err
+	if _, err := s.db.Exec(query, id); err != nil {
+		return err
+	}
+	// 同时清理该用户的历史密码、TOTP 密钥、用户组成员关系和服务器授权，并清除其用户组负责人身份
+	cleanups := []string{
+		`DELETE FROM password_history WHERE user_id = ?`,
+		`DELETE FROM user_totp WHERE user_id = ?`,
+		`DELETE FROM group_members WHERE user_id = ?`,
+		`DELETE FROM user_server_permissions WHERE user_id = ?`,
+		`DELETE FROM access_grants WHERE subject_type = 'user' AND subject_id = ?`,
+		`UPDATE groups SET owner_id = NULL WHERE owner_id = ?`,
+	}
+	for _, cleanup := range cleanups {
+		if _, err := s.db.Exec(cleanup, id); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // ValidatePassword 验证密码
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope API 令牌权限范围检查中间件
+// resource 为资源名（如 servers），只读请求需要 resource:read，其余请求需要 resource:write；JWT 请求不受限制
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_type") != AuthTypeAPIToken {
+			c.Next()
+			return
+		}
+
+		scope := resource + ":write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = resource + ":read"
+		}
+
+		scopes, _ := c.Get("api_token_scopes")
+		granted, _ := scopes.([]string)
+		if !models.HasScope(granted, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("API token missing scope: %s", scope)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireLoginSession 只允许通过账号登录（JWT）访问，用于令牌管理等不应由令牌自身调用的接口
+func RequireLoginSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_type") != AuthTypeJWT {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Login session required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// APITokenAuditMiddleware 记录 API 令牌发起的每个请求（包括只读请求）
+// 已由 AuditMiddleware 记录的管理接口变更不再重复记录
+func APITokenAuditMiddleware(logger AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if c.GetString("auth_type") != AuthTypeAPIToken || c.GetBool("audited") {
+			return
+		}
+
+		status := c.Writer.Status()
+		details := map[string]interface{}{
+			"method":     c.Request.Method,
+			"route":      c.FullPath(),
+			"path":       c.Request.URL.Path,
+			"status":     status,
+			"username":   c.GetString("username"),
+			"token_name": c.GetString("api_token_name"),
+		}
+		detailsJSON, _ := json.Marshal(details)
+
+		entry := &models.AuditLog{
+			UserID:       c.GetInt("user_id"),
+			Action:       "api_token_request",
+			ResourceType: "api_token",
+			ResourceID:   fmt.Sprint(c.GetInt("api_token_id")),
+			Details:      string(detailsJSON),
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.GetHeader("User-Agent"),
+			Success:      status < http.StatusBadRequest,
+		}
+		if err := logger.LogAction(context.Background(), entry); err != nil {
+			log.Printf("Failed to log API token request %s: %v", c.Request.URL.Path, err)
+		}
+	}
+}
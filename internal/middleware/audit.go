@@ -0,0 +1,287 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCapturedBody 响应体最多缓存的字节数，仅用于解析新建资源ID和错误信息
+const maxCapturedBody = 64 * 1024
+
+// AuditLogger 审计日志记录接口
+type AuditLogger interface {
+	LogAction(ctx context.Context, log *models.AuditLog) error
+}
+
+// SnapshotFunc 根据资源ID加载实体快照，用于生成变更前后对比
+type SnapshotFunc func(id string) (interface{}, error)
+
+// sensitiveKeys 快照中需要脱敏的字段关键字
+var sensitiveKeys = []string{"password", "private_key", "secret", "token"}
+
+// bodyCaptureWriter 在写出响应的同时缓存响应体
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	if remain := maxCapturedBody - w.body.Len(); remain > 0 {
+		if len(b) > remain {
+			w.body.Write(b[:remain])
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// AuditMiddleware 管理接口变更审计中间件
+// 对每个非只读请求记录操作人、路由、资源ID、结果以及脱敏后的实体变更前后对比
+// snapshots 以资源类型（单数，如 server）为键
+func AuditMiddleware(logger AuditLogger, snapshots map[string]SnapshotFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		resourceType, verb := describeRoute(route, c.Request.Method)
+		resourceID := firstParam(c)
+
+		snapshot := snapshots[resourceType]
+		var before interface{}
+		if snapshot != nil && resourceID != "" {
+			before = loadSnapshot(snapshot, resourceID)
+		}
+
+		writer := &bodyCaptureWriter{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+		c.Writer = writer
+
+		c.Next()
+
+		status := c.Writer.Status()
+		success := status < http.StatusBadRequest
+
+		var response map[string]interface{}
+		json.Unmarshal(writer.body.Bytes(), &response)
+
+		// 新建资源时从响应中取ID
+		if resourceID == "" && success {
+			if id, ok := response["id"]; ok {
+				resourceID = fmt.Sprint(id)
+			}
+		}
+
+		var after interface{}
+		if snapshot != nil && resourceID != "" && success && c.Request.Method != http.MethodDelete {
+			after = loadSnapshot(snapshot, resourceID)
+		}
+
+		details := map[string]interface{}{
+			"method":   c.Request.Method,
+			"route":    route,
+			"path":     c.Request.URL.Path,
+			"status":   status,
+			"username": c.GetString("username"),
+		}
+		if c.GetString("auth_type") == AuthTypeAPIToken {
+			details["auth_type"] = AuthTypeAPIToken
+			details["token_id"] = c.GetInt("api_token_id")
+			details["token_name"] = c.GetString("api_token_name")
+		}
+		if SteppedUp(c) {
+			details["step_up"] = c.GetString("step_up_method")
+		}
+		if changes := diffSnapshots(before, after); len(changes) > 0 {
+			details["changes"] = changes
+		}
+		if !success {
+			if msg, ok := response["error"]; ok {
+				details["error"] = msg
+			}
+		}
+		detailsJSON, _ := json.Marshal(details)
+
+		entry := &models.AuditLog{
+			UserID:       c.GetInt("user_id"),
+			Action:       resourceType + "_" + verb,
+			ResourceType: resourceType,
+			ResourceID:   resourceID,
+			Details:      string(detailsJSON),
+			IPAddress:    c.ClientIP(),
+			UserAgent:    c.GetHeader("User-Agent"),
+			Success:      success,
+		}
+		// 请求上下文可能已取消，使用独立上下文写入
+		if err := logger.LogAction(context.Background(), entry); err != nil {
+			log.Printf("Failed to log admin action %s: %v", entry.Action, err)
+		}
+		c.Set("audited", true)
+	}
+}
+
+// describeRoute 从路由模板推导资源类型和动作
+// 如 /api/v1/admin/servers/:id -> (server, update)，/api/v1/admin/sessions/cleanup -> (session, cleanup)
+func describeRoute(route, method string) (string, string) {
+	path := route
+	if idx := strings.Index(path, "/admin/"); idx >= 0 {
+		path = path[idx+len("/admin/"):]
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	resourceType := strings.TrimSuffix(segments[0], "s")
+	switch {
+	case strings.HasSuffix(segments[0], "ies"):
+		resourceType = strings.TrimSuffix(segments[0], "ies") + "y"
+	case strings.HasSuffix(segments[0], "ss"):
+		// 不可数名词（如 break-glass）保持原样
+		resourceType = segments[0]
+	}
+	if resourceType == "" {
+		resourceType = "admin"
+	}
+
+	// 末尾的静态路径段视为动作
+	if last := segments[len(segments)-1]; len(segments) > 1 && !strings.HasPrefix(last, ":") && !strings.HasPrefix(last, "*") {
+		return resourceType, last
+	}
+
+	switch method {
+	case http.MethodPost:
+		return resourceType, "create"
+	case http.MethodPut, http.MethodPatch:
+		return resourceType, "update"
+	case http.MethodDelete:
+		return resourceType, "delete"
+	}
+	return resourceType, strings.ToLower(method)
+}
+
+// firstParam 获取路由中的第一个路径参数作为资源ID
+func firstParam(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	if len(c.Params) > 0 {
+		return c.Params[0].Value
+	}
+	return ""
+}
+
+// loadSnapshot 加载实体快照，脱敏在输出对比结果时进行
+func loadSnapshot(snapshot SnapshotFunc, id string) map[string]interface{} {
+	entity, err := snapshot(id)
+	if err != nil || entity == nil {
+		return nil
+	}
+	if v := reflect.ValueOf(entity); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// SnapshotWithSecrets 合并实体的 JSON 字段和不对外序列化的敏感字段
+// 敏感字段在审计对比中只体现"是否变更"，值会被脱敏
+func SnapshotWithSecrets(entity interface{}, secrets map[string]interface{}) map[string]interface{} {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil
+	}
+	fields := map[string]interface{}{}
+	json.Unmarshal(data, &fields)
+	for key, value := range secrets {
+		fields[key] = value
+	}
+	return fields
+}
+
+// redact 返回脱敏后的字段值
+func redact(key string, value interface{}) interface{} {
+	if value != nil && isSensitiveKey(key) {
+		return "[REDACTED]"
+	}
+	return value
+}
+
+// redactAll 返回脱敏后的完整快照
+func redactAll(fields map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		redacted[key] = redact(key, value)
+	}
+	return redacted
+}
+
+// isSensitiveKey 判断字段是否需要脱敏
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffSnapshots 生成字段级变更对比，新建或删除时输出完整快照
+func diffSnapshots(before, after interface{}) map[string]interface{} {
+	b, _ := before.(map[string]interface{})
+	a, _ := after.(map[string]interface{})
+
+	changes := map[string]interface{}{}
+	switch {
+	case b == nil && a == nil:
+		return changes
+	case b == nil:
+		changes["after"] = redactAll(a)
+		return changes
+	case a == nil:
+		changes["before"] = redactAll(b)
+		return changes
+	}
+
+	fields := map[string]interface{}{}
+	for key, bv := range b {
+		if key == "updated_at" {
+			continue
+		}
+		if av, ok := a[key]; !ok || !reflect.DeepEqual(av, bv) {
+			fields[key] = map[string]interface{}{"before": redact(key, bv), "after": redact(key, a[key])}
+		}
+	}
+	for key, av := range a {
+		if _, ok := b[key]; !ok {
+			fields[key] = map[string]interface{}{"before": nil, "after": redact(key, av)}
+		}
+	}
+	if len(fields) > 0 {
+		changes["fields"] = fields
+	}
+	return changes
+}
@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"log"
 	"net/http"
 	"strings"
 
@@ -13,33 +12,51 @@ import (
 
 // Claims JWT 声明
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	SessionID    string `json:"sid,omitempty"` // 登录会话ID
+	TokenVersion int    `json:"tv"`            // 签发时用户的令牌版本
+	// MustChangePassword 签发时用户需要修改密码，此时只能访问修改密码等少数接口
+	MustChangePassword bool `json:"pwc,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware JWT 认证中间件
-func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// 打印收到的完整URL以进行调试
-		log.Printf("AuthMiddleware: Received request for URL: %s", c.Request.URL.String())
+// APITokenPrefix API 令牌前缀，用于和 JWT 区分
+const APITokenPrefix = "vjt_"
 
-		var tokenString string
+// 认证方式，保存在上下文 auth_type 中
+const (
+	AuthTypeJWT      = "jwt"
+	AuthTypeAPIToken = "api_token"
+)
 
-		// 优先从URL参数获取token（用于iframe和WebSocket连接）
-		tokenString = c.Query("token")
+// APITokenIdentity API 令牌对应的身份
+type APITokenIdentity struct {
+	TokenID   int
+	TokenName string
+	UserID    int
+	Username  string
+	Role      string
+	Scopes    []string
+}
 
-		// 如果URL中没有，再从 Authorization header 获取 token
-		if tokenString == "" {
-			authHeader := c.GetHeader("Authorization")
-			if authHeader != "" {
-				tokenString = strings.TrimPrefix(authHeader, "Bearer ")
-				// 如果token和header一样，说明没有"Bearer "前缀，格式无效
-				if tokenString == authHeader {
-					tokenString = ""
-				}
-			}
+// TokenValidator 在签名校验之外检查令牌是否已被撤销，并校验 API 令牌、解析角色权限
+type TokenValidator interface {
+	ValidateClaims(claims *Claims) error
+	AuthenticateAPIToken(token, ipAddress string) (*APITokenIdentity, error)
+	RolePermissions(role string) ([]string, error)
+}
+
+// AuthMiddleware JWT 认证中间件
+func AuthMiddleware(cfg *config.Config, validator TokenValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 只接受 Authorization 头，令牌不能出现在URL中（会被代理和访问日志记录）
+		// 终端页面的 iframe 和 WebSocket 使用一次性终端票据，见 TerminalTicketService
+		var tokenString string
+		authHeader := c.GetHeader("Authorization")
+		if strings.HasPrefix(authHeader, "Bearer ") {
+			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
 		// 如果最终还是没有token，则报错
@@ -49,34 +66,89 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// API 令牌
+		if strings.HasPrefix(tokenString, APITokenPrefix) {
+			if validator == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			identity, err := validator.AuthenticateAPIToken(tokenString, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+
+			c.Set("user_id", identity.UserID)
+			c.Set("username", identity.Username)
+			c.Set("role", identity.Role)
+			c.Set("auth_type", AuthTypeAPIToken)
+			c.Set("api_token_id", identity.TokenID)
+			c.Set("api_token_name", identity.TokenName)
+			c.Set("api_token_scopes", identity.Scopes)
+			if !setPermissions(c, validator, identity.Role) {
+				return
+			}
+
+			c.Next()
+			return
+		}
+
 		claims := &Claims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 			return []byte(cfg.JWTSecret), nil
 		})
 
-		if err != nil || !token.Valid {
+		// 二次认证令牌带有 aud，不能当作访问令牌使用
+		if err != nil || !token.Valid || len(claims.Audience) > 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// 用户被删除、降权、修改密码或会话被撤销后令牌立即失效
+		if validator != nil {
+			if err := validator.ValidateClaims(claims); err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+				c.Abort()
+				return
+			}
+		}
+
 		// 将用户信息存储到上下文
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("session_id", claims.SessionID)
+		c.Set("auth_type", AuthTypeJWT)
+		c.Set("must_change_password", claims.MustChangePassword)
+		parseStepUp(c, cfg.JWTSecret, claims)
+		if !setPermissions(c, validator, claims.Role) {
+			return
+		}
 
 		c.Next()
 	}
 }
 
-// AdminMiddleware 管理员权限中间件
-func AdminMiddleware() gin.HandlerFunc {
+// PasswordChangeGuard 需要修改密码的用户只能访问 allowedRoutes 中的路由
+func PasswordChangeGuard(allowedRoutes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-			c.Abort()
-			return
+		if c.GetBool("must_change_password") {
+			route := c.FullPath()
+			allowed := false
+			for _, r := range allowedRoutes {
+				if route == r {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "code": "password_change_required"})
+				c.Abort()
+				return
+			}
 		}
 		c.Next()
 	}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"very-jump/internal/database/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setPermissions 解析角色的权限保存到上下文 permissions 中，失败时中止请求
+// 未配置 validator 时只有 admin 角色拥有全部权限
+func setPermissions(c *gin.Context, validator TokenValidator, role string) bool {
+	permissions := []string{}
+	if validator != nil {
+		var err error
+		permissions, err = validator.RolePermissions(role)
+		if err != nil {
+			log.Printf("Failed to load permissions of role %s: %v", role, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load permissions"})
+			c.Abort()
+			return false
+		}
+	} else if role == models.RoleAdmin {
+		permissions = []string{models.PermissionAll}
+	}
+	c.Set("permissions", permissions)
+	return true
+}
+
+// Permissions 当前请求用户的角色权限
+func Permissions(c *gin.Context) []string {
+	value, _ := c.Get("permissions")
+	permissions, _ := value.([]string)
+	return permissions
+}
+
+// HasPermission 当前请求用户的角色是否拥有 permission
+func HasPermission(c *gin.Context, permission string) bool {
+	return models.HasPermission(Permissions(c), permission)
+}
+
+// RequirePermission 角色权限检查中间件，拥有 permissions 中任意一个即可访问
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, permission := range permissions {
+			if HasPermission(c, permission) {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Permission required: %s", permissions[0])})
+		c.Abort()
+	}
+}
+
+// RequireResourcePermission 按请求方法检查资源权限：只读请求需要 resource.read，其余请求需要 resource.write
+func RequireResourcePermission(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		permission := resource + ".write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			permission = resource + ".read"
+		}
+
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("Permission required: %s", permission)})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
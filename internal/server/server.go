@@ -5,6 +5,9 @@ import (
 	"log"
 	"net/http"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"very-jump/internal/api"
 	"very-jump/internal/config"
@@ -17,12 +20,19 @@ import (
 
 // Server HTTP 服务器
 type Server struct {
-	cfg            *config.Config
-	db             *sql.DB
-	router         *gin.Engine
-	ttydService    *services.TTYDService
-	auditService   *services.AuditService
-	sessionMonitor *services.SessionMonitor
+	cfg             *config.Config
+	db              *sql.DB
+	router          *gin.Engine
+	ttydService     *services.TTYDService
+	auditService    *services.AuditService
+	auditSealer     *services.AuditSealer
+	alertDispatcher *services.AlertDispatcher
+	anomalyDetector *services.AnomalyDetector
+	sessionMonitor  *services.SessionMonitor
+	accessRequests  *services.AccessRequestManager
+	accessWindows   *services.AccessWindowService
+	breakGlass      *services.BreakGlassManager
+	accessReviews   *services.AccessReviewManager
 }
 
 // New 创建服务器
@@ -31,7 +41,31 @@ func New(cfg *config.Config, db *sql.DB) *Server {
 	router := gin.New()
 
 	// 初始化审计服务
-	auditService := services.NewAuditService(db)
+	auditService := services.NewAuditService(db, cfg)
+
+	// 初始化审计哈希链维护服务
+	auditSealer := services.NewAuditSealer(auditService, cfg.AuditCheckpointInterval, cfg.LogRetention)
+
+	// 初始化安全告警通知
+	alertDispatcher := services.NewAlertDispatcher(
+		models.NewNotificationChannelService(db),
+		models.NewServerService(db),
+		models.NewUserService(db),
+		cfg.AlertDedupWindow, cfg.AlertRateLimit, cfg.AlertMaxAttempts,
+	)
+	auditService.SetAlertNotifier(alertDispatcher)
+
+	// 初始化行为异常检测
+	anomalyDetector := services.NewAnomalyDetector(auditService, models.NewBaselineService(db), services.AnomalyThresholds{
+		Enabled:         cfg.AnomalyDetection,
+		MinObservations: cfg.AnomalyMinObservations,
+		OffHoursRatio:   cfg.AnomalyOffHoursRatio,
+		VolumeFactor:    cfg.AnomalyVolumeFactor,
+		VolumeMinimum:   cfg.AnomalyVolumeMinimum,
+		DurationSigma:   cfg.AnomalyDurationSigma,
+		Timezone:        cfg.AnomalyTimezone,
+	})
+	auditService.SetAnomalyDetector(anomalyDetector)
 
 	// 初始化会话服务
 	sessionService := models.NewSessionService(db)
@@ -45,13 +79,72 @@ func New(cfg *config.Config, db *sql.DB) *Server {
 	// 初始化会话监控服务
 	sessionMonitor := services.NewSessionMonitor(sessionService, ttydService)
 
+	// 初始化临时访问申请流程
+	accessRequests := services.NewAccessRequestManager(
+		models.NewAccessRequestService(db),
+		models.NewAccessPolicyService(db),
+		models.NewServerService(db),
+		models.NewUserService(db),
+		models.NewGroupService(db),
+		models.NewRoleService(db),
+		ttydService, auditService,
+		services.AccessRequestLimits{
+			MaxDuration:      cfg.AccessRequestMaxDuration,
+			PendingTTL:       cfg.AccessRequestPendingTTL,
+			CheckInterval:    cfg.AccessRequestCheckInterval,
+			DefaultApprovals: cfg.AccessRequestDefaultApprovals,
+		},
+	)
+
+	// 初始化访问时间窗口
+	accessWindows := services.NewAccessWindowService(
+		models.NewScheduleService(db),
+		models.NewUserService(db),
+		models.NewRoleService(db),
+		ttydService, auditService,
+		cfg.AccessWindowCheckInterval, cfg.AccessWindowWarning,
+	)
+
+	// 初始化紧急访问流程
+	breakGlass := services.NewBreakGlassManager(
+		models.NewBreakGlassService(db),
+		sessionService,
+		models.NewServerService(db),
+		models.NewUserService(db),
+		models.NewRoleService(db),
+		ttydService, auditService,
+		services.BreakGlassLimits{
+			Duration:      cfg.BreakGlassDuration,
+			CheckInterval: cfg.BreakGlassCheckInterval,
+		},
+	)
+
+	// 初始化访问复核流程
+	accessReviews := services.NewAccessReviewManager(
+		models.NewAccessReviewService(db),
+		models.NewAccessGrantService(db),
+		models.NewGroupService(db),
+		models.NewServerService(db),
+		models.NewUserService(db),
+		models.NewRoleService(db),
+		ttydService, auditService,
+		cfg.AccessReviewCheckInterval,
+	)
+
 	return &Server{
-		cfg:            cfg,
-		db:             db,
-		router:         router,
-		ttydService:    ttydService,
-		auditService:   auditService,
-		sessionMonitor: sessionMonitor,
+		cfg:             cfg,
+		db:              db,
+		router:          router,
+		ttydService:     ttydService,
+		auditService:    auditService,
+		auditSealer:     auditSealer,
+		alertDispatcher: alertDispatcher,
+		anomalyDetector: anomalyDetector,
+		sessionMonitor:  sessionMonitor,
+		accessRequests:  accessRequests,
+		accessWindows:   accessWindows,
+		breakGlass:      breakGlass,
+		accessReviews:   accessReviews,
 	}
 }
 
@@ -65,6 +158,36 @@ func (s *Server) Start() error {
 		log.Printf("Failed to start session monitor: %v", err)
 	}
 
+	// 启动审计哈希链维护
+	if err := s.auditSealer.Start(); err != nil {
+		log.Printf("Failed to start audit sealer: %v", err)
+	}
+
+	// 启动安全告警通知
+	if err := s.alertDispatcher.Start(); err != nil {
+		log.Printf("Failed to start alert dispatcher: %v", err)
+	}
+
+	// 启动临时访问授权到期检查
+	if err := s.accessRequests.Start(); err != nil {
+		log.Printf("Failed to start access request manager: %v", err)
+	}
+
+	// 启动访问时间窗口检查
+	if err := s.accessWindows.Start(); err != nil {
+		log.Printf("Failed to start access window enforcement: %v", err)
+	}
+
+	// 启动紧急访问到期检查
+	if err := s.breakGlass.Start(); err != nil {
+		log.Printf("Failed to start break-glass manager: %v", err)
+	}
+
+	// 启动访问复核截止检查
+	if err := s.accessReviews.Start(); err != nil {
+		log.Printf("Failed to start access review manager: %v", err)
+	}
+
 	log.Printf("Server starting on port %s", s.cfg.Port)
 	return s.router.Run(":" + s.cfg.Port)
 }
@@ -75,6 +198,39 @@ func (s *Server) Stop() {
 	if s.sessionMonitor != nil {
 		s.sessionMonitor.Stop()
 	}
+
+	// 停止审计哈希链维护
+	if s.auditSealer != nil {
+		s.auditSealer.Stop()
+	}
+
+	// 停止安全告警通知
+	if s.alertDispatcher != nil {
+		s.alertDispatcher.Stop()
+	}
+
+	// 停止临时访问授权到期检查
+	if s.accessRequests != nil {
+		s.accessRequests.Stop()
+	}
+	if s.accessWindows != nil {
+		s.accessWindows.Stop()
+	}
+
+	// 停止紧急访问到期检查
+	if s.breakGlass != nil {
+		s.breakGlass.Stop()
+	}
+
+	// 停止访问复核截止检查
+	if s.accessReviews != nil {
+		s.accessReviews.Stop()
+	}
+
+	// 关闭审计事件输出端
+	if s.auditService != nil {
+		s.auditService.Close()
+	}
 }
 
 // setupMiddleware 设置中间件
@@ -93,23 +249,85 @@ func (s *Server) setupRoutes() {
 
 	// 创建服务
 	authService := services.NewAuthService(s.cfg, s.db)
+	if s.cfg.LDAPEnabled {
+		ldapProvider, err := services.NewLDAPProvider(services.LDAPConfigFromConfig(s.cfg))
+		if err != nil {
+			log.Printf("Failed to configure LDAP login, only local accounts can sign in: %v", err)
+		} else {
+			if !ldapProvider.Encrypted() {
+				log.Printf("Warning: LDAP connection to %s is not encrypted, passwords are sent in plain text", s.cfg.LDAPURL)
+			}
+			authService.RegisterProvider(ldapProvider)
+		}
+	}
+	var samlService *services.SAMLService
+	if s.cfg.SAMLEnabled {
+		var err error
+		samlService, err = services.NewSAMLService(services.SAMLConfigFromConfig(s.cfg), s.cfg.DataDir, authService)
+		if err != nil {
+			log.Printf("Failed to configure SAML login: %v", err)
+			samlService = nil
+		} else if !strings.HasPrefix(s.cfg.SAMLRootURL, "https://") {
+			log.Printf("Warning: SAML_ROOT_URL is not https, browsers will not send the login state cookie back from the IdP")
+		}
+	}
 	serverService := models.NewServerService(s.db)
 	credentialService := models.NewCredentialService(s.db)
 	userService := models.NewUserService(s.db)
 	sessionService := models.NewSessionService(s.db)
+	notificationChannelService := models.NewNotificationChannelService(s.db)
 	// auditLogService := models.NewAuditLogService(s.db)
 
 	// 创建处理器
-	authHandler := api.NewAuthHandler(authService)
+	authHandler := api.NewAuthHandler(authService, s.auditService, services.NewLoginLimiter(services.LoginLimits{
+		MaxFailures:     s.cfg.LoginMaxFailures,
+		IPMaxFailures:   s.cfg.LoginIPMaxFailures,
+		Window:          s.cfg.LoginFailureWindow,
+		LockoutDuration: s.cfg.LoginLockoutDuration,
+		DelayBase:       s.cfg.LoginDelayBase,
+		DelayMax:        s.cfg.LoginDelayMax,
+	}))
 	serverHandler := api.NewServerHandler(serverService)
 	credentialHandler := api.NewCredentialHandler(credentialService)
-	userHandler := api.NewUserHandler(userService)
+	userHandler := api.NewUserHandler(userService, authService.GetRoleService(), s.ttydService, models.NewTOTPService(s.db), authService.PasswordPolicy())
 	recordingsDir := filepath.Join(s.cfg.DataDir, "recordings")
 	sessionHandler := api.NewSessionHandler(sessionService, recordingsDir, s.ttydService)
 	statsHandler := api.NewStatsHandler(serverService, userService, s.auditService)
 	// auditLogHandler := api.NewAuditLogHandler(auditLogService)
-	terminalHandler := api.NewTerminalHandler(s.ttydService, serverService)
+	ticketPattern, err := regexp.Compile(s.cfg.TicketIDPattern)
+	if err != nil {
+		log.Printf("Invalid TICKET_ID_PATTERN, using default %s: %v", config.DefaultTicketIDPattern, err)
+		ticketPattern = regexp.MustCompile(config.DefaultTicketIDPattern)
+	}
+	connectRequirementService := models.NewConnectRequirementService(s.db)
+	groupService := models.NewGroupService(s.db)
+	connectPolicies := services.NewConnectPolicyEngine(models.NewConnectPolicyService(s.db), userService, groupService,
+		s.accessRequests.GetRequestService(), s.auditService, s.cfg.PolicyTimezone)
+	terminalHandler := api.NewTerminalHandler(s.ttydService, serverService, services.NewTerminalTicketService(authService), s.accessWindows,
+		connectRequirementService, s.breakGlass, connectPolicies, ticketPattern)
+	connectRequirementHandler := api.NewConnectRequirementHandler(connectRequirementService, serverService, ticketPattern.String())
 	auditHandler := api.NewAuditHandler(s.auditService, s.ttydService)
+	notificationHandler := api.NewNotificationHandler(notificationChannelService, s.alertDispatcher)
+	baselineHandler := api.NewBaselineHandler(models.NewBaselineService(s.db), s.anomalyDetector)
+	apiTokenHandler := api.NewAPITokenHandler(authService, s.auditService)
+	meHandler := api.NewMeHandler(authService, s.auditService, s.ttydService)
+	loginCodes := services.NewLoginCodeStore()
+	oidcService := services.NewOIDCService(s.db, authService)
+	oidcHandler := api.NewOIDCHandler(oidcService, loginCodes, s.auditService)
+	ssoHandler := api.NewSSOHandler(oidcService, samlService, loginCodes)
+	grantService := models.NewAccessGrantService(s.db)
+	groupHandler := api.NewGroupHandler(groupService, userService)
+	grantHandler := api.NewAccessGrantHandler(grantService, groupService, userService, serverService)
+	roleHandler := api.NewRoleHandler(authService.GetRoleService())
+	accessRequestHandler := api.NewAccessRequestHandler(s.accessRequests)
+	breakGlassHandler := api.NewBreakGlassHandler(s.breakGlass)
+	accessReviewHandler := api.NewAccessReviewHandler(s.accessReviews)
+	scheduleHandler := api.NewScheduleHandler(s.accessWindows.GetScheduleService(), serverService, groupService, grantService)
+	accessPolicyHandler := api.NewAccessPolicyHandler(s.accessRequests.GetPolicyService(), groupService)
+	connectPolicyHandler := api.NewConnectPolicyHandler(connectPolicies, serverService)
+	accessExplainHandler := api.NewAccessExplainHandler(services.NewAccessExplainer(userService, authService.GetRoleService(), groupService,
+		serverService, grantService, s.accessRequests.GetRequestService(), s.breakGlass.GetActivationService(),
+		connectRequirementService, ticketPattern, s.accessWindows, connectPolicies, s.auditService))
 
 	// API 路由
 	apiV1 := s.router.Group("/api/v1")
@@ -118,16 +336,64 @@ func (s *Server) setupRoutes() {
 		auth := apiV1.Group("/auth")
 		{
 			auth.POST("/login", authHandler.Login)
-			auth.POST("/logout", authHandler.Logout)
-			auth.GET("/profile", middleware.AuthMiddleware(s.cfg), authHandler.Profile)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", middleware.AuthMiddleware(s.cfg, authService), authHandler.Logout)
+			auth.GET("/profile", middleware.AuthMiddleware(s.cfg, authService), authHandler.Profile)
+
+			// 单点登录：身份源列表和一次性登录码换取令牌
+			auth.GET("/sso/providers", ssoHandler.Providers)
+			auth.POST("/sso/exchange", ssoHandler.Exchange)
+
+			// OpenID Connect 单点登录
+			auth.GET("/oidc/:name/login", oidcHandler.Login)
+			auth.GET("/oidc/:name/callback", oidcHandler.Callback)
+
+			// SAML 2.0 单点登录
+			if samlService != nil {
+				samlHandler := api.NewSAMLHandler(samlService, loginCodes, s.auditService)
+				auth.GET("/saml/metadata", samlHandler.Metadata)
+				auth.GET("/saml/login", samlHandler.Login)
+				auth.POST("/saml/acs", samlHandler.ACS)
+			}
 		}
 
-		// 需要认证的路由
+		// 需要认证的路由，新增路由组需声明 API 令牌权限范围（RequireScope）和所需的角色权限（RequirePermission）
 		authenticated := apiV1.Group("")
-		authenticated.Use(middleware.AuthMiddleware(s.cfg))
+		authenticated.Use(middleware.AuthMiddleware(s.cfg, authService))
+		authenticated.Use(middleware.APITokenAuditMiddleware(s.auditService))
+		authenticated.Use(middleware.PasswordChangeGuard("/api/v1/me", "/api/v1/me/password", "/api/v1/me/password-policy"))
+		// 高风险管理操作需要近期重新验证身份（STEP_UP_ADMIN_OPS）
+		adminStepUp := middleware.RequireStepUp(s.cfg.StepUpAdminOps)
 		{
+			// 当前用户自助服务，只允许通过账号登录访问
+			me := authenticated.Group("/me", middleware.RequireLoginSession())
+			{
+				me.GET("", meHandler.Get)
+				me.GET("/password-policy", meHandler.GetPasswordPolicy)
+				me.PUT("/password", meHandler.ChangePassword)
+
+				// 重新验证身份和动态验证码
+				me.POST("/step-up", authHandler.StepUp)
+				me.GET("/totp", meHandler.GetTOTP)
+				me.POST("/totp/setup", meHandler.SetupTOTP)
+				me.POST("/totp/enable", meHandler.EnableTOTP)
+				me.DELETE("/totp", middleware.RequireStepUp(true), meHandler.DisableTOTP)
+
+				me.GET("/logins", meHandler.ListLogins)
+				me.DELETE("/logins/:id", meHandler.RevokeLogin)
+				me.POST("/logins/revoke-others", meHandler.RevokeOtherLogins)
+
+				me.GET("/tokens", apiTokenHandler.ListMine)
+				me.GET("/tokens/scopes", apiTokenHandler.ListScopes)
+				me.POST("/tokens", adminStepUp, apiTokenHandler.CreateMine)
+				me.DELETE("/tokens/:id", apiTokenHandler.RevokeMine)
+
+				me.GET("/terminal-sessions", meHandler.ListTerminalSessions)
+				me.DELETE("/terminal-sessions/:session_id", meHandler.StopTerminalSession)
+			}
+
 			// 服务器管理
-			servers := authenticated.Group("/servers")
+			servers := authenticated.Group("/servers", middleware.RequireScope("servers"))
 			{
 				servers.GET("", serverHandler.List)
 				servers.GET("/:id", serverHandler.Get)
@@ -135,7 +401,7 @@ func (s *Server) setupRoutes() {
 			}
 
 			// 会话管理
-			sessions := authenticated.Group("/sessions")
+			sessions := authenticated.Group("/sessions", middleware.RequireScope("sessions"))
 			{
 				sessions.GET("", sessionHandler.List)
 				sessions.GET("/:id", sessionHandler.Get)
@@ -146,8 +412,34 @@ func (s *Server) setupRoutes() {
 				sessions.POST("/:id/heartbeat", sessionHandler.Heartbeat)
 			}
 
+			// 访问复核：复核人处理分配给自己的条目，必须使用登录会话
+			reviews := authenticated.Group("/access-reviews", middleware.RequireLoginSession())
+			{
+				reviews.GET("/items", accessReviewHandler.ListMyItems)
+				reviews.POST("/items/:item_id/decide", accessReviewHandler.Decide)
+			}
+
+			// 紧急访问：审批链不可用时发起，必须使用登录会话
+			breakGlass := authenticated.Group("/break-glass", middleware.RequireScope("servers"), middleware.RequireLoginSession())
+			{
+				breakGlass.GET("", breakGlassHandler.ListMine)
+				breakGlass.POST("", middleware.RequirePermission(models.PermissionAccessBreakGlass), breakGlassHandler.Activate)
+				breakGlass.GET("/:id", breakGlassHandler.Get)
+				breakGlass.POST("/:id/end", breakGlassHandler.EndMine)
+			}
+
+			// 临时访问申请
+			accessRequests := authenticated.Group("/access-requests", middleware.RequireScope("servers"))
+			{
+				accessRequests.GET("", accessRequestHandler.ListMine)
+				accessRequests.POST("", accessRequestHandler.Create)
+				accessRequests.GET("/:id", accessRequestHandler.Get)
+				accessRequests.POST("/:id/cancel", accessRequestHandler.Cancel)
+			}
+
 			// 登录凭证（只读，用于创建服务器时选择）
-			credentials := authenticated.Group("/credentials")
+			credentials := authenticated.Group("/credentials", middleware.RequireScope("credentials"),
+				middleware.RequirePermission(models.PermissionCredentialsRead, models.PermissionServersWrite))
 			{
 				credentials.GET("", credentialHandler.List)
 			}
@@ -158,57 +450,392 @@ func (s *Server) setupRoutes() {
 			//     auditLogs.GET("", auditLogHandler.List)
 			// }
 
-			// 管理员路由
+			// 管理路由，每个路由组按角色权限控制访问，新增路由必须声明所需权限
 			admin := authenticated.Group("/admin")
-			admin.Use(middleware.AdminMiddleware())
+			admin.Use(middleware.AuditMiddleware(s.auditService, map[string]middleware.SnapshotFunc{
+				"server": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					server, err := serverService.GetByID(intID)
+					if err != nil {
+						return nil, err
+					}
+					return middleware.SnapshotWithSecrets(server, map[string]interface{}{
+						"password":    server.Password,
+						"private_key": server.PrivateKey,
+					}), nil
+				},
+				"credential": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					credential, err := credentialService.GetByID(intID)
+					if err != nil {
+						return nil, err
+					}
+					return middleware.SnapshotWithSecrets(credential, map[string]interface{}{
+						"password":     credential.Password,
+						"private_key":  credential.PrivateKey,
+						"key_password": credential.KeyPassword,
+					}), nil
+				},
+				"user": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					user, err := userService.GetByID(intID)
+					if err != nil {
+						return nil, err
+					}
+					return middleware.SnapshotWithSecrets(user, map[string]interface{}{
+						"password_hash": user.PasswordHash,
+					}), nil
+				},
+				"service-account": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return userService.GetByID(intID)
+				},
+				"api-token": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return authService.GetTokenService().GetByID(intID)
+				},
+				"group": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return groupService.GetByID(intID)
+				},
+				"role": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return authService.GetRoleService().GetByID(intID)
+				},
+				"grant": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return grantService.GetByID(intID)
+				},
+				"access-request": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return s.accessRequests.GetRequestService().GetByID(intID)
+				},
+				"access-review": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return s.accessReviews.GetReviewService().GetByID(intID)
+				},
+				"break-glass": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return s.breakGlass.GetActivationService().GetByID(intID)
+				},
+				"connect-requirement": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return connectRequirementService.GetByID(intID)
+				},
+				"connect-policy": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return connectPolicies.GetPolicyService().GetByID(intID)
+				},
+				"schedule": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return s.accessWindows.GetScheduleService().GetByID(intID)
+				},
+				"access-policy": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					return s.accessRequests.GetPolicyService().GetByID(intID)
+				},
+				"oidc-provider": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					provider, err := oidcService.GetProviderService().GetByID(intID)
+					if err != nil {
+						return nil, err
+					}
+					return middleware.SnapshotWithSecrets(provider.Masked(), map[string]interface{}{
+						"client_secret": provider.ClientSecret,
+					}), nil
+				},
+				"notification-channel": func(id string) (interface{}, error) {
+					intID, err := strconv.Atoi(id)
+					if err != nil {
+						return nil, err
+					}
+					channel, err := notificationChannelService.GetByID(intID)
+					if err != nil {
+						return nil, err
+					}
+					secrets := map[string]interface{}{}
+					for key, value := range channel.Config {
+						secrets["config."+key] = value
+					}
+					return middleware.SnapshotWithSecrets(channel.Masked(), secrets), nil
+				},
+			}))
 			{
-				// 服务器管理（管理员）
-				admin.POST("/servers", serverHandler.Create)
-				admin.PUT("/servers/:id", serverHandler.Update)
-				admin.DELETE("/servers/:id", serverHandler.Delete)
+				// 服务器管理
+				adminServers := admin.Group("/servers", middleware.RequireScope("servers"), middleware.RequireResourcePermission("servers"))
+				{
+					adminServers.POST("", serverHandler.Create)
+					adminServers.PUT("/:id", serverHandler.Update)
+					adminServers.DELETE("/:id", serverHandler.Delete)
+				}
+
+				// 连接服务器时需要填写的原因和工单号
+				connectRequirements := admin.Group("/connect-requirements", middleware.RequireScope("servers"), middleware.RequireResourcePermission("servers"))
+				{
+					connectRequirements.GET("", connectRequirementHandler.List)
+					connectRequirements.POST("", connectRequirementHandler.Create)
+					connectRequirements.PUT("/:id", connectRequirementHandler.Update)
+					connectRequirements.DELETE("/:id", connectRequirementHandler.Delete)
+				}
 
 				// 登录凭证管理
-				credentials := admin.Group("/credentials")
+				credentials := admin.Group("/credentials", middleware.RequireScope("credentials"), middleware.RequireResourcePermission("credentials"))
 				{
 					credentials.GET("", credentialHandler.List)
 					credentials.GET("/:id", credentialHandler.Get)
-					credentials.POST("", credentialHandler.Create)
-					credentials.PUT("/:id", credentialHandler.Update)
-					credentials.DELETE("/:id", credentialHandler.Delete)
+					credentials.POST("", adminStepUp, credentialHandler.Create)
+					credentials.PUT("/:id", adminStepUp, credentialHandler.Update)
+					credentials.DELETE("/:id", adminStepUp, credentialHandler.Delete)
+					credentials.POST("/:id/reveal", middleware.RequireLoginSession(), middleware.RequireStepUp(true), credentialHandler.Reveal)
 				}
 
 				// 用户管理
-				admin.GET("/users", userHandler.List)
-				admin.POST("/users", userHandler.Create)
-				admin.GET("/users/:id", userHandler.Get)
-				admin.PUT("/users/:id", userHandler.Update)
-				admin.DELETE("/users/:id", userHandler.Delete)
+				users := admin.Group("/users", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					users.GET("", userHandler.List)
+					users.POST("", adminStepUp, userHandler.Create)
+					users.GET("/:id", userHandler.Get)
+					users.PUT("/:id", adminStepUp, userHandler.Update)
+					users.DELETE("/:id", adminStepUp, userHandler.Delete)
+					users.POST("/:id/logout-all", authHandler.SignOutEverywhere)
+					users.DELETE("/:id/totp", adminStepUp, userHandler.ResetTOTP)
+				}
+
+				// 用户组
+				groups := admin.Group("/groups", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					groups.GET("", groupHandler.List)
+					groups.POST("", groupHandler.Create)
+					groups.GET("/:id", groupHandler.Get)
+					groups.PUT("/:id", groupHandler.Update)
+					groups.DELETE("/:id", groupHandler.Delete)
+					groups.POST("/:id/members", groupHandler.AddMember)
+					groups.DELETE("/:id/members/:user_id", groupHandler.RemoveMember)
+				}
+
+				// 服务器授权：授予用户或用户组单台服务器或服务器标签
+				grants := admin.Group("/grants", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					grants.GET("", grantHandler.List)
+					grants.POST("", grantHandler.Create)
+					grants.DELETE("/:id", grantHandler.Delete)
+				}
+
+				// 临时访问申请审批
+				adminAccessRequests := admin.Group("/access-requests", middleware.RequireScope("users"), middleware.RequirePermission(models.PermissionAccessApprove))
+				{
+					adminAccessRequests.GET("", accessRequestHandler.List)
+					adminAccessRequests.POST("/:id/approve", accessRequestHandler.Approve)
+					adminAccessRequests.POST("/:id/deny", accessRequestHandler.Deny)
+					adminAccessRequests.POST("/:id/revoke", accessRequestHandler.Revoke)
+				}
+
+				// 访问复核活动
+				accessReviews := admin.Group("/access-reviews", middleware.RequireScope("users"), middleware.RequirePermission(models.PermissionAccessReview))
+				{
+					accessReviews.GET("", accessReviewHandler.List)
+					accessReviews.POST("", accessReviewHandler.Create)
+					accessReviews.GET("/:id", accessReviewHandler.Get)
+					accessReviews.GET("/:id/items", accessReviewHandler.ListItems)
+					accessReviews.GET("/:id/report", accessReviewHandler.Report)
+					accessReviews.POST("/:id/cancel", accessReviewHandler.Cancel)
+					accessReviews.POST("/:id/items/:item_id/reassign", accessReviewHandler.Reassign)
+				}
+
+				// 紧急访问收回和事后复核
+				adminBreakGlass := admin.Group("/break-glass", middleware.RequireScope("users"), middleware.RequirePermission(models.PermissionAccessApprove))
+				{
+					adminBreakGlass.GET("", breakGlassHandler.List)
+					adminBreakGlass.GET("/:id", breakGlassHandler.Get)
+					adminBreakGlass.POST("/:id/revoke", breakGlassHandler.End)
+					adminBreakGlass.POST("/:id/review", breakGlassHandler.Review)
+				}
+
+				// 临时访问审批策略
+				accessPolicies := admin.Group("/access-policies", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					accessPolicies.GET("", accessPolicyHandler.List)
+					accessPolicies.POST("", accessPolicyHandler.Create)
+					accessPolicies.PUT("/:id", accessPolicyHandler.Update)
+					accessPolicies.DELETE("/:id", accessPolicyHandler.Delete)
+				}
+
+				// 连接策略：按表达式允许、拒绝或要求审批连接，每次修改保留历史版本
+				connectPolicyRoutes := admin.Group("/connect-policies", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					connectPolicyRoutes.GET("", connectPolicyHandler.List)
+					connectPolicyRoutes.GET("/variables", connectPolicyHandler.Variables)
+					connectPolicyRoutes.POST("", adminStepUp, connectPolicyHandler.Create)
+					connectPolicyRoutes.POST("/dry-run", connectPolicyHandler.DryRun)
+					connectPolicyRoutes.GET("/:id", connectPolicyHandler.Get)
+					connectPolicyRoutes.PUT("/:id", adminStepUp, connectPolicyHandler.Update)
+					connectPolicyRoutes.DELETE("/:id", adminStepUp, connectPolicyHandler.Delete)
+					connectPolicyRoutes.GET("/:id/versions", connectPolicyHandler.ListVersions)
+					connectPolicyRoutes.POST("/:id/versions/:version/restore", adminStepUp, connectPolicyHandler.Restore)
+				}
+
+				// 访问解释：用户能否连接服务器及其依据，访问矩阵导出
+				accessExplain := admin.Group("/access", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					accessExplain.GET("/explain", accessExplainHandler.Explain)
+					accessExplain.GET("/matrix", accessExplainHandler.Matrix)
+				}
+
+				// 访问时间窗口
+				schedules := admin.Group("/schedules", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					schedules.GET("", scheduleHandler.List)
+					schedules.POST("", scheduleHandler.Create)
+					schedules.GET("/:id", scheduleHandler.Get)
+					schedules.PUT("/:id", scheduleHandler.Update)
+					schedules.DELETE("/:id", scheduleHandler.Delete)
+					schedules.GET("/:id/bindings", scheduleHandler.ListBindings)
+					schedules.POST("/:id/bindings", scheduleHandler.Bind)
+					schedules.DELETE("/:id/bindings/:binding_id", scheduleHandler.Unbind)
+				}
+
+				// 角色和权限
+				roles := admin.Group("/roles", middleware.RequireScope("users"), middleware.RequireResourcePermission("roles"))
+				{
+					roles.GET("", roleHandler.List)
+					roles.GET("/permissions", roleHandler.ListPermissions)
+					roles.POST("", adminStepUp, roleHandler.Create)
+					roles.GET("/:id", roleHandler.Get)
+					roles.PUT("/:id", adminStepUp, roleHandler.Update)
+					roles.DELETE("/:id", adminStepUp, roleHandler.Delete)
+				}
+
+				// 登录锁定
+				lockouts := admin.Group("/login-lockouts", middleware.RequireScope("users"), middleware.RequireResourcePermission("users"))
+				{
+					lockouts.GET("", authHandler.ListLoginLockouts)
+					lockouts.POST("/unlock", authHandler.UnlockLogin)
+				}
+
+				// OIDC 身份源
+				oidcProviders := admin.Group("/oidc-providers", middleware.RequireScope("system"), middleware.RequireResourcePermission("system"))
+				{
+					oidcProviders.GET("", oidcHandler.List)
+					oidcProviders.GET("/:id", oidcHandler.Get)
+					oidcProviders.POST("", oidcHandler.Create)
+					oidcProviders.PUT("/:id", oidcHandler.Update)
+					oidcProviders.DELETE("/:id", oidcHandler.Delete)
+				}
+
+				// 服务账号和 API 令牌管理，只允许通过账号登录操作
+				serviceAccounts := admin.Group("/service-accounts", middleware.RequireLoginSession(), middleware.RequireResourcePermission("users"))
+				{
+					serviceAccounts.GET("", apiTokenHandler.ListServiceAccounts)
+					serviceAccounts.POST("", adminStepUp, apiTokenHandler.CreateServiceAccount)
+					serviceAccounts.DELETE("/:id", apiTokenHandler.DeleteServiceAccount)
+					serviceAccounts.GET("/:id/tokens", apiTokenHandler.ListServiceAccountTokens)
+					serviceAccounts.POST("/:id/tokens", adminStepUp, apiTokenHandler.CreateServiceAccountToken)
+				}
+				apiTokens := admin.Group("/api-tokens", middleware.RequireLoginSession(), middleware.RequireResourcePermission("users"))
+				{
+					apiTokens.GET("", apiTokenHandler.ListAll)
+					apiTokens.DELETE("/:id", apiTokenHandler.Revoke)
+				}
 
 				// 系统统计
-				admin.GET("/stats", statsHandler.GetStats)
+				admin.GET("/stats", middleware.RequireScope("system"), middleware.RequirePermission(models.PermissionSystemRead), statsHandler.GetStats)
+
+				// 清理超时会话
+				admin.POST("/sessions/cleanup", middleware.RequireScope("sessions"), middleware.RequirePermission(models.PermissionSessionsWrite), sessionHandler.CleanupStaleSessions)
 
-				// 会话管理（管理员）
-				admin.POST("/sessions/cleanup", sessionHandler.CleanupStaleSessions)
+				// 审计日志完整性校验
+				admin.GET("/audit/verify", middleware.RequireScope("audit"), middleware.RequirePermission(models.PermissionAuditRead), auditHandler.VerifyAuditChain)
+
+				// 告警通知渠道
+				channels := admin.Group("/notification-channels", middleware.RequireScope("system"), middleware.RequireResourcePermission("system"))
+				{
+					channels.GET("", notificationHandler.List)
+					channels.GET("/:id", notificationHandler.Get)
+					channels.POST("", notificationHandler.Create)
+					channels.PUT("/:id", notificationHandler.Update)
+					channels.DELETE("/:id", notificationHandler.Delete)
+					channels.POST("/:id/test", notificationHandler.Test)
+				}
+
+				// 用户行为基线
+				baselines := admin.Group("/baselines", middleware.RequireScope("system"), middleware.RequireResourcePermission("system"))
+				{
+					baselines.GET("", baselineHandler.List)
+					baselines.GET("/:user_id", baselineHandler.Get)
+					baselines.DELETE("/:user_id", baselineHandler.Reset)
+				}
 			}
 		}
 
 		// 终端路由 (ttyd)
-		terminal := authenticated.Group("/terminal")
+		terminal := authenticated.Group("/terminal", middleware.RequireScope("sessions"))
 		{
-			terminal.POST("/start/:server_id", terminalHandler.StartTerminal)
+			// 交互式终端依赖登录会话，API 令牌不能启动
+			terminal.POST("/start/:server_id", middleware.RequireLoginSession(), terminalHandler.StartTerminal)
 			terminal.POST("/stop/:session_id", terminalHandler.StopTerminal)
 			terminal.GET("/info/:session_id", terminalHandler.GetTerminalInfo)
+			terminal.POST("/ticket/:session_id", middleware.RequireLoginSession(), terminalHandler.IssueTicket)
 			terminal.GET("/sessions", terminalHandler.ListActiveSessions)
+			terminal.GET("/sessions/:session_id/live", terminalHandler.LiveTail)
 		}
 
 		// 审计管理路由
-		audit := authenticated.Group("/audit")
+		audit := authenticated.Group("/audit", middleware.RequireScope("audit"))
 		{
 			audit.GET("/logs", auditHandler.GetAuditLogs)
+			audit.GET("/logs/export", auditHandler.ExportAuditLogs)
 			audit.GET("/sessions", auditHandler.GetTerminalSessions)
-			audit.GET("/statistics", auditHandler.GetAuditStatistics)
-			audit.GET("/alerts", auditHandler.GetSecurityAlerts)
-			audit.PUT("/alerts/:alert_id/resolve", auditHandler.ResolveSecurityAlert)
+			audit.GET("/statistics", middleware.RequirePermission(models.PermissionAuditRead), auditHandler.GetAuditStatistics)
+			audit.GET("/alerts", middleware.RequirePermission(models.PermissionAuditRead), auditHandler.GetSecurityAlerts)
+			audit.PUT("/alerts/:alert_id/resolve", middleware.RequirePermission(models.PermissionAlertsResolve), auditHandler.ResolveSecurityAlert)
 		}
 
 	}
@@ -226,8 +853,8 @@ func (s *Server) setupRoutes() {
 		c.File("./web/dist/index.html")
 	})
 
-	// 终端代理路由（使用query参数避免路径冲突）
-	s.router.Any("/proxy-terminal/*proxy-path", middleware.AuthMiddleware(s.cfg), terminalHandler.ProxyToTTYD)
+	// 终端代理路由（使用query参数避免路径冲突），由一次性终端票据认证，不接受 JWT
+	s.router.Any("/proxy-terminal/*proxy-path", terminalHandler.ProxyToTTYD)
 
 	// SPA 路由处理（前端路由）
 	s.router.NoRoute(func(c *gin.Context) {
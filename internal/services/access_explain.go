@@ -0,0 +1,537 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// 有效访问级别，从高到低
+const (
+	AccessLevelConnectAll = "connect_all" // 角色拥有 servers.connect，可连接任意服务器
+	AccessLevelConnect    = "connect"     // 有长期授权：直接授权或服务器授权
+	AccessLevelTemporary  = "temporary"   // 只通过已批准的临时访问申请或紧急访问
+	AccessLevelView       = "view"        // 角色拥有 servers.read，只能查看
+	AccessLevelNone       = "none"
+)
+
+// 访问途径类型，除角色外与 models.ServerService.AccessPaths 返回的途径一致
+const (
+	AccessPathRole          = "role"
+	AccessPathDirect        = models.AccessPathDirect
+	AccessPathGrant         = models.AccessPathGrant
+	AccessPathAccessRequest = models.AccessPathAccessRequest
+	AccessPathBreakGlass    = models.AccessPathBreakGlass
+)
+
+// ScheduleState 时间窗口在某一时刻的状态
+type ScheduleState struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Target   string     `json:"target"` // 绑定对象类型：server、group 或 grant
+	Timezone string     `json:"timezone"`
+	Open     bool       `json:"open"`
+	ClosesAt *time.Time `json:"closes_at,omitempty"` // 开放时本次的结束时间，一周内不关闭时为空
+	NextOpen *time.Time `json:"next_open,omitempty"` // 关闭时下一次开放的时间，一周内不开放时为空
+}
+
+// AccessPath 用户获得服务器访问权的一条途径
+type AccessPath struct {
+	Type        string          `json:"type"`
+	ID          int             `json:"id,omitempty"` // 直接授权、服务器授权、申请或紧急访问的ID
+	Description string          `json:"description"`
+	GroupID     int             `json:"group_id,omitempty"` // 通过用户组获得授权时的用户组
+	GroupName   string          `json:"group_name,omitempty"`
+	Tag         string          `json:"tag,omitempty"` // 按标签授权或申请时匹配的标签
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+	Schedules   []ScheduleState `json:"schedules,omitempty"`
+	Open        bool            `json:"open"` // 途径上的时间窗口此刻全部开放
+}
+
+// source 途径在矩阵中的简写，如 grant#3(group:ops)
+func (p AccessPath) source() string {
+	switch p.Type {
+	case AccessPathRole:
+		return AccessPathRole
+	case AccessPathGrant:
+		if p.GroupName != "" {
+			return fmt.Sprintf("grant#%d(group:%s)", p.ID, p.GroupName)
+		}
+		return fmt.Sprintf("grant#%d", p.ID)
+	}
+	return p.Type + "#" + strconv.Itoa(p.ID)
+}
+
+// ExplainGroup 用户所属的用户组及其时间窗口
+type ExplainGroup struct {
+	ID       int            `json:"id"`
+	Name     string         `json:"name"`
+	Schedule *ScheduleState `json:"schedule,omitempty"`
+}
+
+// ExplainWindow 访问时间窗口检查结果
+type ExplainWindow struct {
+	Allowed     bool       `json:"allowed"`
+	Reason      string     `json:"reason,omitempty"`
+	ClosesAt    *time.Time `json:"closes_at,omitempty"`
+	NextOpen    *time.Time `json:"next_open,omitempty"`
+	Overridable bool       `json:"overridable"` // 角色拥有 access.override，可以填写原因后强制连接
+}
+
+// AccessExplanation 用户能否连接服务器的解释：最终决定和参与判断的角色、用户组、授权途径、时间窗口、连接要求和连接策略
+type AccessExplanation struct {
+	User           *models.User                  `json:"user"`
+	Server         *models.Server                `json:"server"`
+	At             time.Time                     `json:"at"`
+	Decision       string                        `json:"decision"` // allow、deny 或 require_approval
+	Level          string                        `json:"level"`
+	Reasons        []string                      `json:"reasons"` // 不允许连接的原因，允许时为空
+	ConnectAll     bool                          `json:"connect_all"`
+	Groups         []ExplainGroup                `json:"groups"`
+	Paths          []AccessPath                  `json:"paths"`
+	ServerSchedule *ScheduleState                `json:"server_schedule,omitempty"`
+	Window         ExplainWindow                 `json:"window"`
+	Requirements   *models.ConnectRequirementSet `json:"requirements"`
+	Policy         *models.PolicyDecision        `json:"policy"`
+	Policies       []PolicyTrace                 `json:"policies"`
+}
+
+// AccessMatrixEntry 访问矩阵中的一个用户和服务器
+type AccessMatrixEntry struct {
+	UserID     int      `json:"user_id"`
+	Username   string   `json:"username"`
+	Role       string   `json:"role"`
+	UserStatus string   `json:"user_status"`
+	ServerID   int      `json:"server_id"`
+	ServerName string   `json:"server_name"`
+	Level      string   `json:"level"`
+	Sources    []string `json:"sources"` // 获得访问权的途径
+}
+
+// AccessMatrix 全部用户对全部服务器的有效访问级别
+type AccessMatrix struct {
+	Users       int                 `json:"users"`
+	Servers     int                 `json:"servers"`
+	Entries     []AccessMatrixEntry `json:"entries"`
+	GeneratedAt time.Time           `json:"generated_at"`
+}
+
+// accessSnapshot 描述访问途径所需的授权数据，按ID索引。途径本身由 ServerService.AccessPaths 给出
+type accessSnapshot struct {
+	grants      map[int]*models.AccessGrant
+	requests    map[int]*models.AccessRequest
+	activations map[int]*models.BreakGlassActivation
+}
+
+// AccessExplainer 解释用户的服务器访问权，规则与启动终端时的检查一致
+type AccessExplainer struct {
+	userService     *models.UserService
+	roleService     *models.RoleService
+	groupService    *models.GroupService
+	serverService   *models.ServerService
+	grantService    *models.AccessGrantService
+	requestService  *models.AccessRequestService
+	breakGlass      *models.BreakGlassService
+	scheduleService *models.ScheduleService
+	requirements    *models.ConnectRequirementService
+	ticketPattern   *regexp.Regexp
+	windows         *AccessWindowService
+	policies        *ConnectPolicyEngine
+	auditService    *AuditService
+}
+
+// NewAccessExplainer 创建访问解释服务
+func NewAccessExplainer(userService *models.UserService, roleService *models.RoleService, groupService *models.GroupService,
+	serverService *models.ServerService, grantService *models.AccessGrantService, requestService *models.AccessRequestService,
+	breakGlass *models.BreakGlassService, requirements *models.ConnectRequirementService, ticketPattern *regexp.Regexp,
+	windows *AccessWindowService, policies *ConnectPolicyEngine, auditService *AuditService) *AccessExplainer {
+	return &AccessExplainer{
+		userService:     userService,
+		roleService:     roleService,
+		groupService:    groupService,
+		serverService:   serverService,
+		grantService:    grantService,
+		requestService:  requestService,
+		breakGlass:      breakGlass,
+		scheduleService: windows.GetScheduleService(),
+		requirements:    requirements,
+		ticketPattern:   ticketPattern,
+		windows:         windows,
+		policies:        policies,
+		auditService:    auditService,
+	}
+}
+
+// GetUserService 获取用户数据服务
+func (e *AccessExplainer) GetUserService() *models.UserService {
+	return e.userService
+}
+
+// SignReport 签名导出的报告内容，密钥与审计检查点相同
+func (e *AccessExplainer) SignReport(data []byte) string {
+	return e.auditService.SignReport(data)
+}
+
+// Explain 解释用户在 at 时刻能否连接服务器。依次检查账号状态、授权途径、连接要求、时间窗口和连接策略，
+// 每一步的结果都会返回，不在第一个拒绝处停止。连接要求按 reason、ticketID 检查，steppedUp 表示假定用户已完成二次认证
+func (e *AccessExplainer) Explain(userID, serverID int, sourceIP, reason, ticketID string, steppedUp bool, at time.Time) (*AccessExplanation, error) {
+	user, err := e.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	server, err := e.serverService.GetByID(serverID)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := e.roleService.Permissions(user.Role)
+	if err != nil {
+		return nil, err
+	}
+	user.Permissions = permissions
+	groups, err := e.groupService.ListByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := e.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	records, err := e.serverService.AccessPaths(user.ID, server.ID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &AccessExplanation{
+		User:       user,
+		Server:     server,
+		At:         at,
+		Decision:   models.PolicyEffectAllow,
+		Reasons:    []string{},
+		ConnectAll: models.HasPermission(permissions, models.PermissionServersConnect),
+		Groups:     make([]ExplainGroup, 0, len(groups)),
+	}
+	deny := func(reason string) {
+		explanation.Decision = models.PolicyEffectDeny
+		explanation.Reasons = append(explanation.Reasons, reason)
+	}
+
+	groupNames := map[int]string{}
+	groupSchedules := map[int]*ScheduleState{}
+	for _, group := range groups {
+		groupNames[group.ID] = group.Name
+		state, err := e.scheduleState(models.ScheduleTargetGroup, group.ID, at)
+		if err != nil {
+			return nil, err
+		}
+		groupSchedules[group.ID] = state
+		explanation.Groups = append(explanation.Groups, ExplainGroup{ID: group.ID, Name: group.Name, Schedule: state})
+	}
+
+	var activation *models.BreakGlassActivation
+	explanation.Paths = snapshot.paths(user, permissions, groupNames, records)
+	for i := range explanation.Paths {
+		path := &explanation.Paths[i]
+		if path.Type == AccessPathBreakGlass {
+			activation = snapshot.activations[path.ID]
+		}
+		if path.Type == AccessPathGrant {
+			state, err := e.scheduleState(models.ScheduleTargetGrant, path.ID, at)
+			if err != nil {
+				return nil, err
+			}
+			if state != nil {
+				path.Schedules = append(path.Schedules, *state)
+			}
+			if state := groupSchedules[path.GroupID]; path.GroupID > 0 && state != nil {
+				path.Schedules = append(path.Schedules, *state)
+			}
+		}
+		path.Open = true
+		for _, state := range path.Schedules {
+			path.Open = path.Open && state.Open
+		}
+	}
+	explanation.Level = accessLevel(user, permissions, explanation.Paths)
+
+	if !user.Active() {
+		if user.Expired() {
+			deny("账号已过期")
+		} else {
+			deny("账号状态为 " + user.Status)
+		}
+	}
+	if len(explanation.Paths) == 0 {
+		deny("没有访问该服务器的授权")
+	}
+
+	// 连接要求与启动终端时的检查一致：紧急访问的原因满足原因要求，并且不再要求工单号
+	if explanation.Requirements, err = e.requirements.ForServer(server.ID); err != nil {
+		return nil, err
+	}
+	if activation != nil {
+		if reason == "" {
+			reason = activation.Justification
+		}
+		explanation.Requirements.RequireTicket = false
+	}
+	if explanation.Requirements.RequireReason && reason == "" {
+		deny("连接该服务器需要填写原因")
+	}
+	if explanation.Requirements.RequireTicket && ticketID == "" {
+		deny("连接该服务器需要填写工单号")
+	}
+	if ticketID != "" && !e.ticketPattern.MatchString(ticketID) {
+		deny("工单号格式不正确")
+	}
+	if explanation.Requirements.RequireStepUp && !steppedUp {
+		deny("连接该服务器需要近期完成二次认证")
+	}
+
+	if explanation.ServerSchedule, err = e.scheduleState(models.ScheduleTargetServer, server.ID, at); err != nil {
+		return nil, err
+	}
+	window, err := e.windows.Check(user.ID, server.ID, explanation.ConnectAll, at)
+	if err != nil {
+		return nil, err
+	}
+	explanation.Window = ExplainWindow{
+		Allowed:     window.Allowed,
+		Reason:      window.Reason,
+		ClosesAt:    timePtr(window.ClosesAt),
+		NextOpen:    timePtr(window.NextOpen),
+		Overridable: !window.Allowed && models.HasPermission(permissions, models.PermissionAccessOverride),
+	}
+	if !window.Allowed {
+		deny(window.Reason)
+	}
+
+	justification := models.SessionJustification{Reason: reason, TicketID: ticketID}
+	if activation != nil {
+		justification.BreakGlassID = activation.ID
+	}
+	input, err := e.policies.Input(user.ID, server, sourceIP, at, justification)
+	if err != nil {
+		return nil, err
+	}
+	if explanation.Policy, explanation.Policies, err = e.policies.DryRun(input, nil); err != nil {
+		return nil, err
+	}
+	if !Permitted(explanation.Policy) {
+		for _, match := range explanation.Policy.Matched {
+			if match.Effect == explanation.Policy.Decision || match.Error != "" {
+				explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("连接策略 %s（第 %d 版）要求 %s", match.Name, match.Version, match.Effect))
+			}
+		}
+		if explanation.Decision == models.PolicyEffectAllow {
+			explanation.Decision = explanation.Policy.Decision
+		}
+	}
+	return explanation, nil
+}
+
+// Matrix 全部用户对全部服务器的有效访问级别。级别只由角色和授权途径决定：
+// 时间窗口和连接策略依赖连接时的时间、来源地址等上下文，不计入矩阵，需要时用 Explain 查看具体连接
+func (e *AccessExplainer) Matrix() (*AccessMatrix, error) {
+	now := time.Now().UTC()
+	users, err := e.userService.List(-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	servers, err := e.serverService.List(-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := e.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	matrix := &AccessMatrix{
+		Users:       len(users),
+		Servers:     len(servers),
+		Entries:     make([]AccessMatrixEntry, 0, len(users)*len(servers)),
+		GeneratedAt: now,
+	}
+	rolePermissions := map[string][]string{}
+	for _, user := range users {
+		permissions, ok := rolePermissions[user.Role]
+		if !ok {
+			if permissions, err = e.roleService.Permissions(user.Role); err != nil {
+				return nil, err
+			}
+			rolePermissions[user.Role] = permissions
+		}
+		groups, err := e.groupService.ListByUserID(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		groupNames := map[int]string{}
+		for _, group := range groups {
+			groupNames[group.ID] = group.Name
+		}
+		records, err := e.serverService.AccessPaths(user.ID, 0, now)
+		if err != nil {
+			return nil, err
+		}
+		serverRecords := map[int][]*models.AccessPathRecord{}
+		for _, record := range records {
+			serverRecords[record.ServerID] = append(serverRecords[record.ServerID], record)
+		}
+
+		for _, server := range servers {
+			paths := snapshot.paths(user, permissions, groupNames, serverRecords[server.ID])
+			entry := AccessMatrixEntry{
+				UserID:     user.ID,
+				Username:   user.Username,
+				Role:       user.Role,
+				UserStatus: user.Status,
+				ServerID:   server.ID,
+				ServerName: server.Name,
+				Level:      accessLevel(user, permissions, paths),
+				Sources:    make([]string, 0, len(paths)),
+			}
+			for _, path := range paths {
+				entry.Sources = append(entry.Sources, path.source())
+			}
+			matrix.Entries = append(matrix.Entries, entry)
+		}
+	}
+	return matrix, nil
+}
+
+// loadSnapshot 加载全部服务器授权、已批准的临时访问申请和生效中的紧急访问，用于描述访问途径
+func (e *AccessExplainer) loadSnapshot() (*accessSnapshot, error) {
+	snapshot := &accessSnapshot{
+		grants:      map[int]*models.AccessGrant{},
+		requests:    map[int]*models.AccessRequest{},
+		activations: map[int]*models.BreakGlassActivation{},
+	}
+
+	grants, err := e.grantService.List(models.AccessGrantFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		snapshot.grants[grant.ID] = grant
+	}
+	requests, err := e.requestService.List(models.AccessRequestFilter{Status: models.AccessRequestApproved})
+	if err != nil {
+		return nil, err
+	}
+	for _, request := range requests {
+		snapshot.requests[request.ID] = request
+	}
+	activations, err := e.breakGlass.List(models.BreakGlassFilter{Status: models.BreakGlassActive})
+	if err != nil {
+		return nil, err
+	}
+	for _, activation := range activations {
+		snapshot.activations[activation.ID] = activation
+	}
+	return snapshot, nil
+}
+
+// paths 按 ServerService.AccessPaths 返回的途径生成解释，与终端启动检查使用同一条查询；
+// 角色拥有 servers.connect 时作为第一条途径。groupNames 为用户所属用户组ID到名称
+func (s *accessSnapshot) paths(user *models.User, permissions []string, groupNames map[int]string, records []*models.AccessPathRecord) []AccessPath {
+	paths := []AccessPath{}
+	if models.HasPermission(permissions, models.PermissionServersConnect) {
+		paths = append(paths, AccessPath{Type: AccessPathRole, Description: "角色 " + user.Role + " 拥有 servers.connect", Open: true})
+	}
+
+	for _, record := range records {
+		path := AccessPath{Type: record.Type, ID: record.ID, GroupID: record.GroupID, GroupName: groupNames[record.GroupID], Tag: record.Tag, Open: true}
+		switch record.Type {
+		case AccessPathDirect:
+			path.Description = "直接授权"
+		case AccessPathGrant:
+			path.Description = fmt.Sprintf("授权 #%d", record.ID)
+			if grant := s.grants[record.ID]; grant != nil {
+				path.Description = describeGrant(grant, path.GroupName)
+			}
+		case AccessPathAccessRequest:
+			path.Description = fmt.Sprintf("临时访问申请 #%d", record.ID)
+			if request := s.requests[record.ID]; request != nil {
+				path.Description = "临时访问申请：" + request.Reason
+				path.ExpiresAt = request.ExpiresAt
+			}
+		case AccessPathBreakGlass:
+			path.Description = fmt.Sprintf("紧急访问 #%d", record.ID)
+			if activation := s.activations[record.ID]; activation != nil {
+				expiresAt := activation.ExpiresAt
+				path.Description = "紧急访问：" + activation.Justification
+				path.ExpiresAt = &expiresAt
+			}
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// describeGrant 服务器授权的描述
+func describeGrant(grant *models.AccessGrant, groupName string) string {
+	target := "服务器 " + grant.ServerName
+	if grant.ServerID == nil {
+		target = "标签 " + grant.Tag
+	}
+	if groupName != "" {
+		return fmt.Sprintf("用户组 %s 的授权：%s", groupName, target)
+	}
+	return "用户授权：" + target
+}
+
+// accessLevel 按途径计算有效访问级别，停用或过期的账号没有访问权
+func accessLevel(user *models.User, permissions []string, paths []AccessPath) string {
+	if !user.Active() {
+		return AccessLevelNone
+	}
+	level := AccessLevelNone
+	if models.HasPermission(permissions, models.PermissionServersRead) {
+		level = AccessLevelView
+	}
+	for _, path := range paths {
+		switch path.Type {
+		case AccessPathRole:
+			return AccessLevelConnectAll
+		case AccessPathDirect, AccessPathGrant:
+			level = AccessLevelConnect
+		case AccessPathAccessRequest, AccessPathBreakGlass:
+			if level != AccessLevelConnect {
+				level = AccessLevelTemporary
+			}
+		}
+	}
+	return level
+}
+
+// scheduleState 对象绑定的时间窗口在 at 时刻的状态，未绑定时返回 nil
+func (e *AccessExplainer) scheduleState(targetType string, targetID int, at time.Time) (*ScheduleState, error) {
+	schedule, err := e.scheduleService.ForTarget(targetType, targetID)
+	if err != nil || schedule == nil {
+		return nil, err
+	}
+	open, closesAt := schedule.OpenAt(at)
+	state := &ScheduleState{
+		ID:       schedule.ID,
+		Name:     schedule.Name,
+		Target:   targetType,
+		Timezone: schedule.Timezone,
+		Open:     open,
+		ClosesAt: timePtr(closesAt),
+	}
+	if !open {
+		state.NextOpen = timePtr(schedule.NextOpen(at))
+	}
+	return state, nil
+}
+
+// timePtr 零值时间返回 nil
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
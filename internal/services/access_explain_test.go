@@ -0,0 +1,148 @@
+package services
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// newTestExplainer 创建使用临时数据库的访问解释服务，不签名报告
+func newTestExplainer(t *testing.T, db *sql.DB) *AccessExplainer {
+	t.Helper()
+	userService := models.NewUserService(db)
+	roleService := models.NewRoleService(db)
+	groupService := models.NewGroupService(db)
+	requestService := models.NewAccessRequestService(db)
+	windows := NewAccessWindowService(models.NewScheduleService(db), userService, roleService, nil, nil, time.Minute, time.Minute)
+	policies := NewConnectPolicyEngine(models.NewConnectPolicyService(db), userService, groupService, requestService, nil, "UTC")
+	return NewAccessExplainer(userService, roleService, groupService, models.NewServerService(db), models.NewAccessGrantService(db),
+		requestService, models.NewBreakGlassService(db), models.NewConnectRequirementService(db), regexp.MustCompile(`^[A-Z]+-\d+$`),
+		windows, policies, nil)
+}
+
+// TestAccessExplainPathsMatchUserCanAccess 访问解释和访问矩阵给出的途径与终端启动检查使用的 UserCanAccess 一致
+func TestAccessExplainPathsMatchUserCanAccess(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().UTC()
+	for _, name := range []string{"direct", "tagged", "grouped", "requester", "glass", "nobody"} {
+		mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES (?, 'x', 'user')`, name)
+	}
+	for _, server := range [][2]string{{"web1", `["prod","web"]`}, {"db1", `["db"]`}, {"misc", ``}} {
+		mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+			VALUES (?, '10.0.0.1', 22, 'root', 'password', 'x', '', '', ?)`, server[0], server[1])
+	}
+	mustExec(t, db, `INSERT INTO user_server_permissions (user_id, server_id) VALUES (2, 1)`)
+	mustExec(t, db, `INSERT INTO access_grants (subject_type, subject_id, tag) VALUES ('user', 3, 'db')`)
+	// 非 connect 权限的授权不是访问途径
+	mustExec(t, db, `INSERT INTO access_grants (subject_type, subject_id, server_id, permission) VALUES ('user', 3, 1, 'read')`)
+	mustExec(t, db, `INSERT INTO groups (name) VALUES ('ops')`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id) VALUES (1, 4)`)
+	mustExec(t, db, `INSERT INTO access_grants (subject_type, subject_id, server_id) VALUES ('group', 1, 3)`)
+	mustExec(t, db, `INSERT INTO access_requests (user_id, tag, reason, duration_minutes, status, approved_at, expires_at)
+		VALUES (5, 'prod', 'incident', 60, 'approved', ?, ?)`, now, now.Add(time.Hour))
+	mustExec(t, db, `INSERT INTO access_requests (user_id, server_id, reason, duration_minutes, status, approved_at, expires_at)
+		VALUES (5, 2, 'old incident', 60, 'approved', ?, ?)`, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	mustExec(t, db, `INSERT INTO access_requests (user_id, server_id, reason, duration_minutes, status)
+		VALUES (5, 3, 'pending', 60, 'pending')`)
+	mustExec(t, db, `INSERT INTO break_glass_activations (user_id, justification, activated_at, expires_at)
+		VALUES (6, 'outage', ?, ?)`, now, now.Add(time.Hour))
+	mustExec(t, db, `INSERT INTO break_glass_activations (user_id, justification, status, activated_at, expires_at)
+		VALUES (7, 'old outage', 'expired', ?, ?)`, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	explainer := newTestExplainer(t, db)
+	servers := models.NewServerService(db)
+	matrix, err := explainer.Matrix()
+	if err != nil {
+		t.Fatalf("matrix: %v", err)
+	}
+
+	accessible := 0
+	for _, entry := range matrix.Entries {
+		if entry.Role != models.RoleUser {
+			continue
+		}
+		want, err := servers.UserCanAccess(entry.UserID, entry.ServerID)
+		if err != nil {
+			t.Fatalf("user can access: %v", err)
+		}
+		if got := len(entry.Sources) > 0; got != want {
+			t.Errorf("matrix %s/%s: sources %v, UserCanAccess %v", entry.Username, entry.ServerName, entry.Sources, want)
+		}
+
+		explanation, err := explainer.Explain(entry.UserID, entry.ServerID, "10.0.0.9", "", "", false, time.Now().UTC())
+		if err != nil {
+			t.Fatalf("explain %s/%s: %v", entry.Username, entry.ServerName, err)
+		}
+		if got := len(explanation.Paths) > 0; got != want {
+			t.Errorf("explain %s/%s: paths %+v, UserCanAccess %v", entry.Username, entry.ServerName, explanation.Paths, want)
+		}
+		if want != (explanation.Decision == models.PolicyEffectAllow) {
+			t.Errorf("explain %s/%s: decision %s %v, UserCanAccess %v", entry.Username, entry.ServerName, explanation.Decision, explanation.Reasons, want)
+		}
+		if want {
+			accessible++
+		}
+	}
+	// direct: web1；tagged: db1；grouped: misc；requester: web1；glass: 全部三台
+	if accessible != 7 {
+		t.Errorf("%d accessible user/server pairs, want 7", accessible)
+	}
+}
+
+// TestAccessExplainDeniesUnmetRequirements 未满足连接要求时与启动终端一样拒绝
+func TestAccessExplainDeniesUnmetRequirements(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Now().UTC()
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('bob', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('carol', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+		VALUES ('db1', '10.0.0.1', 22, 'root', 'password', 'x', '', '', '["db"]')`)
+	mustExec(t, db, `INSERT INTO user_server_permissions (user_id, server_id) VALUES (2, 1)`)
+	mustExec(t, db, `INSERT INTO connect_requirements (tag, require_reason, require_ticket, require_step_up) VALUES ('db', TRUE, TRUE, TRUE)`)
+	mustExec(t, db, `INSERT INTO break_glass_activations (user_id, justification, activated_at, expires_at)
+		VALUES (3, 'outage', ?, ?)`, now, now.Add(time.Hour))
+	explainer := newTestExplainer(t, db)
+
+	tests := []struct {
+		name      string
+		userID    int
+		reason    string
+		ticket    string
+		steppedUp bool
+		denied    []string
+	}{
+		{"nothing provided", 2, "", "", false, []string{"原因", "工单号", "二次认证"}},
+		{"missing ticket", 2, "deploy", "", true, []string{"工单号"}},
+		{"invalid ticket", 2, "deploy", "abc", true, []string{"工单号格式不正确"}},
+		{"step-up not completed", 2, "deploy", "OPS-1", false, []string{"二次认证"}},
+		{"all met", 2, "deploy", "OPS-1", true, nil},
+		{"break-glass covers reason and ticket", 3, "", "", true, nil},
+		{"break-glass still needs step-up", 3, "", "", false, []string{"二次认证"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			explanation, err := explainer.Explain(tt.userID, 1, "10.0.0.9", tt.reason, tt.ticket, tt.steppedUp, now)
+			if err != nil {
+				t.Fatalf("explain: %v", err)
+			}
+			if len(tt.denied) == 0 {
+				if explanation.Decision != models.PolicyEffectAllow {
+					t.Fatalf("decision = %s %v, want allow", explanation.Decision, explanation.Reasons)
+				}
+				return
+			}
+			if explanation.Decision != models.PolicyEffectDeny || len(explanation.Reasons) != len(tt.denied) {
+				t.Fatalf("decision = %s %v, want deny for %v", explanation.Decision, explanation.Reasons, tt.denied)
+			}
+			for i, want := range tt.denied {
+				if !strings.Contains(explanation.Reasons[i], want) {
+					t.Errorf("reason %d = %q, want it to mention %q", i, explanation.Reasons[i], want)
+				}
+			}
+		})
+	}
+}
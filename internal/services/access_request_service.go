@@ -0,0 +1,449 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+var (
+	// ErrSelfApproval 不能审批自己的申请
+	ErrSelfApproval = errors.New("不能审批自己的申请")
+	// ErrNotApprover 不在审批策略指定的审批组中
+	ErrNotApprover = errors.New("不在该申请的审批组中")
+	// ErrAccessRequestNotApproved 只能收回已批准的授权
+	ErrAccessRequestNotApproved = errors.New("申请不是已批准状态")
+)
+
+// AccessRequestLimits 临时访问申请的全局限制
+type AccessRequestLimits struct {
+	MaxDuration      time.Duration // 单次申请的最长授权时长
+	PendingTTL       time.Duration // 待审批申请的有效期
+	CheckInterval    time.Duration // 检查授权到期的间隔
+	DefaultApprovals int           // 没有匹配审批策略时需要的批准人数
+}
+
+// AccessRequestManager 临时访问申请流程：提交、审批、到期收回，授权结束时终止失去权限的终端会话
+type AccessRequestManager struct {
+	requestService *models.AccessRequestService
+	policyService  *models.AccessPolicyService
+	serverService  *models.ServerService
+	userService    *models.UserService
+	groupService   *models.GroupService
+	roleService    *models.RoleService
+	ttydService    *TTYDService
+	auditService   *AuditService
+	limits         AccessRequestLimits
+
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mutex     sync.Mutex
+}
+
+// NewAccessRequestManager 创建临时访问申请流程服务
+func NewAccessRequestManager(requestService *models.AccessRequestService, policyService *models.AccessPolicyService,
+	serverService *models.ServerService, userService *models.UserService, groupService *models.GroupService,
+	roleService *models.RoleService, ttydService *TTYDService, auditService *AuditService, limits AccessRequestLimits) *AccessRequestManager {
+	if limits.DefaultApprovals < 1 {
+		limits.DefaultApprovals = 1
+	}
+	return &AccessRequestManager{
+		requestService: requestService,
+		policyService:  policyService,
+		serverService:  serverService,
+		userService:    userService,
+		groupService:   groupService,
+		roleService:    roleService,
+		ttydService:    ttydService,
+		auditService:   auditService,
+		limits:         limits,
+		stopChan:       make(chan struct{}),
+	}
+}
+
+// GetRequestService 获取申请数据服务
+func (m *AccessRequestManager) GetRequestService() *models.AccessRequestService {
+	return m.requestService
+}
+
+// GetPolicyService 获取审批策略数据服务
+func (m *AccessRequestManager) GetPolicyService() *models.AccessPolicyService {
+	return m.policyService
+}
+
+// effectivePolicy 合并匹配到的审批策略：批准人数取最大值，最长时长取最严格的值
+func (m *AccessRequestManager) effectivePolicy(policies []*models.AccessPolicy) (int, time.Duration) {
+	required := m.limits.DefaultApprovals
+	maxDuration := m.limits.MaxDuration
+	for _, policy := range policies {
+		if policy.RequiredApprovals > required {
+			required = policy.RequiredApprovals
+		}
+		if limit := time.Duration(policy.MaxDurationMinutes) * time.Minute; limit > 0 && limit < maxDuration {
+			maxDuration = limit
+		}
+	}
+	return required, maxDuration
+}
+
+// Submit 提交申请，按匹配的审批策略确定批准人数并检查申请时长
+func (m *AccessRequestManager) Submit(userID int, req *models.AccessRequestCreate, ipAddress string) (*models.AccessRequest, error) {
+	if (req.ServerID == nil) == (req.Tag == "") {
+		return nil, errors.New("server_id 和 tag 必须且只能指定一个")
+	}
+	if req.ServerID != nil {
+		if _, err := m.serverService.GetByID(*req.ServerID); err != nil {
+			return nil, errors.New("服务器不存在")
+		}
+	}
+
+	policies, err := m.policyService.Match(req.ServerID, req.Tag)
+	if err != nil {
+		return nil, err
+	}
+	required, maxDuration := m.effectivePolicy(policies)
+	if time.Duration(req.DurationMinutes)*time.Minute > maxDuration {
+		return nil, fmt.Errorf("申请时长不能超过 %d 分钟", int(maxDuration/time.Minute))
+	}
+
+	request, err := m.requestService.Create(userID, req, required)
+	if err != nil {
+		return nil, err
+	}
+
+	m.logAction(userID, "access-request_submit", request, ipAddress, map[string]interface{}{
+		"reason":             request.Reason,
+		"duration_minutes":   request.DurationMinutes,
+		"required_approvals": request.RequiredApprovals,
+	})
+	m.notify(request, "access_request_submitted", "high",
+		fmt.Sprintf("%s 申请临时访问%s %d 分钟（申请 #%d，需要 %d 人批准）：%s",
+			request.Username, request.Target(), request.DurationMinutes, request.ID, request.RequiredApprovals, request.Reason))
+	return request, nil
+}
+
+// CanApprove 审批人是否可以审批该申请：不能审批自己的申请，匹配的策略指定了审批组时需属于其中之一
+func (m *AccessRequestManager) CanApprove(request *models.AccessRequest, approverID int) error {
+	if request.UserID == approverID {
+		return ErrSelfApproval
+	}
+
+	policies, err := m.policyService.Match(request.ServerID, request.Tag)
+	if err != nil {
+		return err
+	}
+	groupIDs := map[int]bool{}
+	for _, policy := range policies {
+		if policy.ApproverGroupID != nil {
+			groupIDs[*policy.ApproverGroupID] = true
+		}
+	}
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	groups, err := m.groupService.ListByUserID(approverID)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		if groupIDs[group.ID] {
+			return nil
+		}
+	}
+	return ErrNotApprover
+}
+
+// Decide 审批申请，批准人数达到要求时授权立即生效
+func (m *AccessRequestManager) Decide(id, approverID int, decision, comment string) (*models.AccessRequest, error) {
+	request, err := m.requestService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status != models.AccessRequestPending {
+		return nil, models.ErrAccessRequestClosed
+	}
+	if err := m.CanApprove(request, approverID); err != nil {
+		return nil, err
+	}
+
+	request, err = m.requestService.RecordDecision(id, approverID, decision, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	switch request.Status {
+	case models.AccessRequestApproved:
+		m.logAction(0, "access-request_grant", request, "", map[string]interface{}{
+			"expires_at": request.ExpiresAt,
+		})
+		m.notify(request, "access_request_approved", "high",
+			fmt.Sprintf("%s 的临时访问申请 #%d 已批准，可访问%s至 %s",
+				request.Username, request.ID, request.Target(), request.ExpiresAt.Local().Format("2006-01-02 15:04")))
+	case models.AccessRequestDenied:
+		m.notify(request, "access_request_denied", "medium",
+			fmt.Sprintf("%s 的临时访问申请 #%d（%s）已被拒绝", request.Username, request.ID, request.Target()))
+	}
+	return request, nil
+}
+
+// Cancel 申请人撤回申请：待审批的申请撤回，已批准的授权提前结束
+func (m *AccessRequestManager) Cancel(request *models.AccessRequest, ipAddress string) (*models.AccessRequest, error) {
+	var to string
+	switch request.Status {
+	case models.AccessRequestPending:
+		to = models.AccessRequestCancelled
+	case models.AccessRequestApproved:
+		to = models.AccessRequestRevoked
+	default:
+		return nil, models.ErrAccessRequestClosed
+	}
+	closed, err := m.requestService.Close(request.ID, request.Status, to, &request.UserID, "申请人撤回")
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, models.ErrAccessRequestClosed
+	}
+
+	m.logAction(request.UserID, "access-request_cancel", request, ipAddress, map[string]interface{}{
+		"previous_status": request.Status,
+	})
+	if to == models.AccessRequestRevoked {
+		m.terminateUnauthorized(request.UserID, "access_revoked")
+	}
+	m.notify(request, "access_request_cancelled", "medium",
+		fmt.Sprintf("%s 撤回了临时访问申请 #%d（%s）", request.Username, request.ID, request.Target()))
+	return m.requestService.GetByID(request.ID)
+}
+
+// Revoke 在到期前收回已批准的授权，并终止申请人失去权限的终端会话
+func (m *AccessRequestManager) Revoke(id, revokedBy int, comment string) (*models.AccessRequest, error) {
+	closed, err := m.requestService.Close(id, models.AccessRequestApproved, models.AccessRequestRevoked, &revokedBy, comment)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		return nil, ErrAccessRequestNotApproved
+	}
+
+	request, err := m.requestService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	stopped := m.terminateUnauthorized(request.UserID, "access_revoked")
+	m.notify(request, "access_request_revoked", "high",
+		fmt.Sprintf("%s 的临时访问授权 #%d（%s）已被收回，终止了 %d 个终端会话",
+			request.Username, request.ID, request.Target(), stopped))
+	return request, nil
+}
+
+// Start 启动授权到期检查
+func (m *AccessRequestManager) Start() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isRunning {
+		return nil
+	}
+
+	m.isRunning = true
+	m.wg.Add(1)
+
+	go m.expireLoop()
+
+	log.Printf("Access request manager started - check interval: %v, pending TTL: %v",
+		m.limits.CheckInterval, m.limits.PendingTTL)
+
+	return nil
+}
+
+// Stop 停止授权到期检查
+func (m *AccessRequestManager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.isRunning {
+		return
+	}
+
+	m.isRunning = false
+	close(m.stopChan)
+	m.wg.Wait()
+
+	log.Printf("Access request manager stopped")
+}
+
+// expireLoop 检查循环
+func (m *AccessRequestManager) expireLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.limits.CheckInterval)
+	defer ticker.Stop()
+
+	// 启动时立即检查一次，收回停机期间到期的授权
+	m.ExpireDue()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.ExpireDue()
+		}
+	}
+}
+
+// ExpireDue 结束到期的授权和审批超时的申请，返回处理的申请数
+func (m *AccessRequestManager) ExpireDue() int {
+	now := time.Now()
+	due, err := m.requestService.ListDue(now, now.Add(-m.limits.PendingTTL))
+	if err != nil {
+		log.Printf("Failed to list due access requests: %v", err)
+		return 0
+	}
+
+	expired := 0
+	for _, request := range due {
+		reason := "授权到期"
+		if request.Status == models.AccessRequestPending {
+			reason = "审批超时"
+		}
+		closed, err := m.requestService.Close(request.ID, request.Status, models.AccessRequestExpired, nil, reason)
+		if err != nil {
+			log.Printf("Failed to expire access request %d: %v", request.ID, err)
+			continue
+		}
+		if !closed {
+			continue
+		}
+		expired++
+
+		stopped := 0
+		if request.Status == models.AccessRequestApproved {
+			stopped = m.terminateUnauthorized(request.UserID, "access_expired")
+		}
+		m.logAction(0, "access-request_expire", request, "", map[string]interface{}{
+			"previous_status":   request.Status,
+			"stopped_terminals": stopped,
+		})
+		m.notify(request, "access_request_expired", "medium",
+			fmt.Sprintf("%s 的临时访问申请 #%d（%s）%s", request.Username, request.ID, request.Target(), reason))
+	}
+	return expired
+}
+
+// terminateUnauthorized 终止用户已无权访问的终端会话，返回终止的会话数
+func (m *AccessRequestManager) terminateUnauthorized(userID int, reason string) int {
+	return terminateUnauthorizedSessions(m.ttydService, m.serverService, m.userService, m.roleService, userID, reason)
+}
+
+// terminateUnauthorizedSessions 终止用户已无权访问的终端会话，返回终止的会话数
+// 同一服务器仍有其他授权（长期授权、其他未到期申请或紧急访问）时保留会话
+func terminateUnauthorizedSessions(ttydService *TTYDService, serverService *models.ServerService, userService *models.UserService,
+	roleService *models.RoleService, userID int, reason string) int {
+	if ttydService == nil {
+		return 0
+	}
+	user, err := userService.GetByID(userID)
+	if err != nil {
+		log.Printf("Failed to load user %d for access check: %v", userID, err)
+		return 0
+	}
+	permissions, err := roleService.Permissions(user.Role)
+	if err != nil {
+		log.Printf("Failed to load permissions of role %s: %v", user.Role, err)
+		return 0
+	}
+	if models.HasPermission(permissions, models.PermissionServersConnect) {
+		return 0
+	}
+
+	stopped := 0
+	for _, process := range ttydService.ListActiveSessions() {
+		if process.UserID != userID {
+			continue
+		}
+		allowed, err := serverService.UserCanAccess(userID, process.ServerID)
+		if err != nil {
+			log.Printf("Failed to check access of user %d to server %d: %v", userID, process.ServerID, err)
+			continue
+		}
+		if allowed {
+			continue
+		}
+		if err := ttydService.StopSessionWithReason(process.SessionID, reason); err != nil {
+			log.Printf("Failed to stop session %s: %v", process.SessionID, err)
+			continue
+		}
+		stopped++
+	}
+	return stopped
+}
+
+// logAction 记录申请流程审计日志，userID 为 0 表示系统操作
+func (m *AccessRequestManager) logAction(userID int, action string, request *models.AccessRequest, ipAddress string, extra map[string]interface{}) {
+	if m.auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"requester": request.Username,
+		"target":    request.Target(),
+	}
+	if request.ServerID != nil {
+		details["server_id"] = *request.ServerID
+	} else {
+		details["tag"] = request.Tag
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "access-request",
+		ResourceID:   fmt.Sprintf("%d", request.ID),
+		Details:      string(detailsJSON),
+		IPAddress:    ipAddress,
+		Success:      true,
+	}
+	if err := m.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s: %v", action, err)
+	}
+}
+
+// notify 发送申请流程通知，按告警路由规则投递到通知渠道
+func (m *AccessRequestManager) notify(request *models.AccessRequest, alertType, severity, description string) {
+	if m.auditService == nil {
+		return
+	}
+
+	alert := &models.SecurityAlert{
+		UserID:      request.UserID,
+		AlertType:   alertType,
+		Severity:    severity,
+		Description: description,
+	}
+	if request.ServerID != nil {
+		alert.ServerID = *request.ServerID
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"request_id":       request.ID,
+		"status":           request.Status,
+		"reason":           request.Reason,
+		"duration_minutes": request.DurationMinutes,
+		"tag":              request.Tag,
+	})
+	alert.Details = string(details)
+	m.auditService.Notify(alert)
+}
@@ -0,0 +1,511 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+var (
+	// ErrAccessReviewDeadline 截止时间必须晚于当前时间
+	ErrAccessReviewDeadline = errors.New("截止时间必须晚于当前时间")
+	// ErrReviewerNotFound 指定的复核人不存在
+	ErrReviewerNotFound = errors.New("复核人不存在")
+	// ErrNotAccessReviewer 不是该条目的复核人
+	ErrNotAccessReviewer = errors.New("不是该授权的复核人")
+	// ErrAccessReviewSelf 不能复核自己的授权
+	ErrAccessReviewSelf = errors.New("不能复核自己的授权")
+)
+
+// AccessReviewReport 复核活动报告，导出时整体签名
+type AccessReviewReport struct {
+	Campaign    *models.AccessReviewCampaign `json:"campaign"`
+	Items       []*models.AccessReviewItem   `json:"items"`
+	GeneratedAt time.Time                    `json:"generated_at"`
+}
+
+// AccessReviewManager 访问复核流程：快照授权、分配复核人、收回被否决的授权，截止时自动收回未复核的授权
+type AccessReviewManager struct {
+	reviewService *models.AccessReviewService
+	grantService  *models.AccessGrantService
+	groupService  *models.GroupService
+	serverService *models.ServerService
+	userService   *models.UserService
+	roleService   *models.RoleService
+	ttydService   *TTYDService
+	auditService  *AuditService
+	checkInterval time.Duration
+
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mutex     sync.Mutex
+}
+
+// NewAccessReviewManager 创建访问复核流程服务
+func NewAccessReviewManager(reviewService *models.AccessReviewService, grantService *models.AccessGrantService,
+	groupService *models.GroupService, serverService *models.ServerService, userService *models.UserService,
+	roleService *models.RoleService, ttydService *TTYDService, auditService *AuditService, checkInterval time.Duration) *AccessReviewManager {
+	return &AccessReviewManager{
+		reviewService: reviewService,
+		grantService:  grantService,
+		groupService:  groupService,
+		serverService: serverService,
+		userService:   userService,
+		roleService:   roleService,
+		ttydService:   ttydService,
+		auditService:  auditService,
+		checkInterval: checkInterval,
+		stopChan:      make(chan struct{}),
+	}
+}
+
+// GetReviewService 获取访问复核数据服务
+func (m *AccessReviewManager) GetReviewService() *models.AccessReviewService {
+	return m.reviewService
+}
+
+// Create 创建复核活动，对当前全部直接授权、服务器授权和用户组成员关系做快照并分配复核人
+func (m *AccessReviewManager) Create(req *models.AccessReviewCampaignCreate, createdBy int) (*models.AccessReviewCampaign, error) {
+	if !req.Deadline.After(time.Now()) {
+		return nil, ErrAccessReviewDeadline
+	}
+	if req.DefaultReviewerID == 0 {
+		req.DefaultReviewerID = createdBy
+	}
+	if req.TagReviewers == nil {
+		req.TagReviewers = map[string]int{}
+	}
+	reviewers := []int{req.DefaultReviewerID}
+	for _, reviewerID := range req.TagReviewers {
+		reviewers = append(reviewers, reviewerID)
+	}
+	for _, reviewerID := range reviewers {
+		if _, err := m.userService.GetByID(reviewerID); err != nil {
+			return nil, fmt.Errorf("%w: %d", ErrReviewerNotFound, reviewerID)
+		}
+	}
+
+	items, err := m.snapshot(req)
+	if err != nil {
+		return nil, err
+	}
+	return m.reviewService.Create(req, createdBy, items)
+}
+
+// snapshot 生成复核条目：
+// 用户组成员关系由组负责人复核；授权按目标标签（标签授权的标签或服务器带有的标签）匹配标签复核人，
+// 没有匹配时授予用户组的授权由组负责人复核，其余由默认复核人复核
+func (m *AccessReviewManager) snapshot(req *models.AccessReviewCampaignCreate) ([]*models.AccessReviewItem, error) {
+	// SQLite 中 LIMIT -1 表示不限
+	servers, err := m.serverService.List(-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	serverTags := make(map[int][]string, len(servers))
+	for _, server := range servers {
+		serverTags[server.ID] = server.Tags
+	}
+	groups, err := m.groupService.List()
+	if err != nil {
+		return nil, err
+	}
+	users, err := m.userService.List(-1, 0)
+	if err != nil {
+		return nil, err
+	}
+	admins := []int{}
+	for _, user := range users {
+		if user.Role == models.RoleAdmin && user.Active() {
+			admins = append(admins, user.ID)
+		}
+	}
+	groupOwners := make(map[int]int, len(groups))
+	for _, group := range groups {
+		if group.OwnerID != nil {
+			groupOwners[group.ID] = *group.OwnerID
+		}
+	}
+
+	tagReviewer := func(tags []string) int {
+		sorted := append([]string(nil), tags...)
+		sort.Strings(sorted)
+		for _, tag := range sorted {
+			if reviewerID, ok := req.TagReviewers[tag]; ok {
+				return reviewerID
+			}
+		}
+		return 0
+	}
+	// assign 依次选择候选人、默认复核人和任一管理员，跳过被复核的用户本人
+	assign := func(subjectType string, subjectID int, candidates ...int) int {
+		candidates = append(append(candidates, req.DefaultReviewerID), admins...)
+		for _, reviewerID := range candidates {
+			if reviewerID != 0 && !(subjectType == models.GrantSubjectUser && reviewerID == subjectID) {
+				return reviewerID
+			}
+		}
+		return req.DefaultReviewerID
+	}
+
+	items := []*models.AccessReviewItem{}
+
+	direct, err := m.serverService.ListDirectPermissions()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range direct {
+		serverID := p.ServerID
+		items = append(items, &models.AccessReviewItem{
+			ItemType:    models.AccessReviewItemDirect,
+			SourceID:    p.ID,
+			SubjectType: models.GrantSubjectUser,
+			SubjectID:   p.UserID,
+			SubjectName: p.Username,
+			TargetType:  models.AccessReviewTargetServer,
+			TargetID:    &serverID,
+			TargetName:  p.ServerName,
+			Permission:  p.Permission,
+			Origin:      p.Source,
+			ReviewerID:  assign(models.GrantSubjectUser, p.UserID, tagReviewer(serverTags[p.ServerID])),
+		})
+	}
+
+	grants, err := m.grantService.List(models.AccessGrantFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for _, grant := range grants {
+		item := &models.AccessReviewItem{
+			ItemType:    models.AccessReviewItemGrant,
+			SourceID:    grant.ID,
+			SubjectType: grant.SubjectType,
+			SubjectID:   grant.SubjectID,
+			SubjectName: grant.SubjectName,
+			Permission:  grant.Permission,
+		}
+		var tags []string
+		if grant.ServerID != nil {
+			item.TargetType = models.AccessReviewTargetServer
+			item.TargetID = grant.ServerID
+			item.TargetName = grant.ServerName
+			tags = serverTags[*grant.ServerID]
+		} else {
+			item.TargetType = models.AccessReviewTargetTag
+			item.TargetName = grant.Tag
+			tags = []string{grant.Tag}
+		}
+		owner := 0
+		if grant.SubjectType == models.GrantSubjectGroup {
+			owner = groupOwners[grant.SubjectID]
+		}
+		item.ReviewerID = assign(grant.SubjectType, grant.SubjectID, tagReviewer(tags), owner)
+		items = append(items, item)
+	}
+
+	for _, group := range groups {
+		members, err := m.groupService.ListMembers(group.ID)
+		if err != nil {
+			return nil, err
+		}
+		groupID := group.ID
+		for _, member := range members {
+			items = append(items, &models.AccessReviewItem{
+				ItemType:    models.AccessReviewItemMembership,
+				SourceID:    group.ID,
+				SubjectType: models.GrantSubjectUser,
+				SubjectID:   member.UserID,
+				SubjectName: member.Username,
+				TargetType:  models.AccessReviewTargetGroup,
+				TargetID:    &groupID,
+				TargetName:  group.Name,
+				ReviewerID:  assign(models.GrantSubjectUser, member.UserID, groupOwners[group.ID]),
+			})
+		}
+	}
+	return items, nil
+}
+
+// Decide 复核人确认保留或收回授权，收回立即生效并终止失去权限的终端会话
+func (m *AccessReviewManager) Decide(itemID, reviewerID int, req *models.AccessReviewDecision, ipAddress string) (*models.AccessReviewItem, error) {
+	item, err := m.reviewService.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.ReviewerID != reviewerID {
+		return nil, ErrNotAccessReviewer
+	}
+	if item.SubjectType == models.GrantSubjectUser && item.SubjectID == reviewerID {
+		return nil, ErrAccessReviewSelf
+	}
+
+	decision := models.AccessReviewApproved
+	if req.Decision == "revoke" {
+		decision = models.AccessReviewRevoked
+	}
+	if err := m.reviewService.Decide(itemID, decision, &reviewerID, req.Comment); err != nil {
+		return nil, err
+	}
+
+	extra := map[string]interface{}{"comment": req.Comment}
+	if decision == models.AccessReviewRevoked {
+		extra["stopped_terminals"] = m.revoke(item)
+	}
+	if item, err = m.reviewService.GetItem(itemID); err != nil {
+		return nil, err
+	}
+	m.logAction(reviewerID, "access-review_"+req.Decision, item, ipAddress, extra)
+	return item, nil
+}
+
+// Reassign 更换待复核条目的复核人，不能指定被复核的用户本人
+func (m *AccessReviewManager) Reassign(itemID, reviewerID int) (*models.AccessReviewItem, error) {
+	if _, err := m.userService.GetByID(reviewerID); err != nil {
+		return nil, ErrReviewerNotFound
+	}
+	item, err := m.reviewService.GetItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+	if item.SubjectType == models.GrantSubjectUser && item.SubjectID == reviewerID {
+		return nil, ErrAccessReviewSelf
+	}
+	if err := m.reviewService.Reassign(itemID, reviewerID); err != nil {
+		return nil, err
+	}
+	return m.reviewService.GetItem(itemID)
+}
+
+// Cancel 取消复核中的活动，未复核的授权保持不变
+func (m *AccessReviewManager) Cancel(id int) (*models.AccessReviewCampaign, error) {
+	closed, err := m.reviewService.Close(id, models.AccessReviewCancelled)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		if _, err := m.reviewService.GetByID(id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrAccessReviewClosed
+	}
+	return m.reviewService.GetByID(id)
+}
+
+// Report 生成复核活动报告
+func (m *AccessReviewManager) Report(id int) (*AccessReviewReport, error) {
+	campaign, err := m.reviewService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	items, err := m.reviewService.ListItems(models.AccessReviewItemFilter{CampaignID: id})
+	if err != nil {
+		return nil, err
+	}
+	return &AccessReviewReport{Campaign: campaign, Items: items, GeneratedAt: time.Now().UTC()}, nil
+}
+
+// SignReport 签名导出的报告内容，密钥与审计检查点相同
+func (m *AccessReviewManager) SignReport(data []byte) string {
+	return m.auditService.SignReport(data)
+}
+
+// revoke 删除条目对应的授权并终止失去权限的终端会话，授权已被删除时视为已收回，返回终止的会话数。
+// 快照之后重新加入的成员关系不是被复核的那一条，保持不变
+func (m *AccessReviewManager) revoke(item *models.AccessReviewItem) int {
+	users := []int{item.SubjectID}
+	var err error
+	switch item.ItemType {
+	case models.AccessReviewItemDirect:
+		_, err = m.serverService.DeleteDirectPermission(item.SourceID)
+	case models.AccessReviewItemGrant:
+		if item.SubjectType == models.GrantSubjectGroup {
+			users = users[:0]
+			members, err := m.groupService.ListMembers(item.SubjectID)
+			if err != nil {
+				log.Printf("Failed to list members of group %d: %v", item.SubjectID, err)
+			}
+			for _, member := range members {
+				users = append(users, member.UserID)
+			}
+		}
+		err = m.grantService.Delete(item.SourceID)
+	case models.AccessReviewItemMembership:
+		var campaign *models.AccessReviewCampaign
+		if campaign, err = m.reviewService.GetByID(item.CampaignID); err == nil {
+			_, err = m.groupService.RemoveMemberAddedBefore(item.SourceID, item.SubjectID, campaign.CreatedAt)
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to revoke access review item %d: %v", item.ID, err)
+		return 0
+	}
+
+	stopped := 0
+	for _, userID := range users {
+		stopped += terminateUnauthorizedSessions(m.ttydService, m.serverService, m.userService, m.roleService, userID, "access_review_revoked")
+	}
+	return stopped
+}
+
+// Start 启动复核截止检查
+func (m *AccessReviewManager) Start() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isRunning {
+		return nil
+	}
+
+	m.isRunning = true
+	m.wg.Add(1)
+
+	go m.deadlineLoop()
+
+	log.Printf("Access review manager started - check interval: %v", m.checkInterval)
+
+	return nil
+}
+
+// Stop 停止复核截止检查
+func (m *AccessReviewManager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.isRunning {
+		return
+	}
+
+	m.isRunning = false
+	close(m.stopChan)
+	m.wg.Wait()
+
+	log.Printf("Access review manager stopped")
+}
+
+// deadlineLoop 检查循环
+func (m *AccessReviewManager) deadlineLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.checkInterval)
+	defer ticker.Stop()
+
+	// 启动时立即检查一次，处理停机期间到期的活动
+	m.CompleteDue()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.CompleteDue()
+		}
+	}
+}
+
+// CompleteDue 结束已到截止时间的活动，自动收回未复核的授权，返回结束的活动数
+func (m *AccessReviewManager) CompleteDue() int {
+	due, err := m.reviewService.ListDue(time.Now())
+	if err != nil {
+		log.Printf("Failed to list due access review campaigns: %v", err)
+		return 0
+	}
+
+	completed := 0
+	for _, campaign := range due {
+		pending, err := m.reviewService.ListItems(models.AccessReviewItemFilter{CampaignID: campaign.ID, Decision: models.AccessReviewPending})
+		if err != nil {
+			log.Printf("Failed to list pending items of access review %d: %v", campaign.ID, err)
+			continue
+		}
+		revoked, stopped := 0, 0
+		for _, item := range pending {
+			if err := m.reviewService.Decide(item.ID, models.AccessReviewAutoRevoked, nil, "截止时未复核"); err != nil {
+				log.Printf("Failed to auto-revoke access review item %d: %v", item.ID, err)
+				continue
+			}
+			revoked++
+			stopped += m.revoke(item)
+		}
+
+		closed, err := m.reviewService.Close(campaign.ID, models.AccessReviewCompleted)
+		if err != nil {
+			log.Printf("Failed to complete access review %d: %v", campaign.ID, err)
+			continue
+		}
+		if !closed {
+			continue
+		}
+		completed++
+
+		m.logCampaign(campaign, "access-review_complete", map[string]interface{}{
+			"auto_revoked":      revoked,
+			"stopped_terminals": stopped,
+		})
+		if m.auditService != nil {
+			details, _ := json.Marshal(map[string]interface{}{
+				"campaign_id":  campaign.ID,
+				"total":        campaign.Summary.Total,
+				"approved":     campaign.Summary.Approved,
+				"revoked":      campaign.Summary.Revoked,
+				"auto_revoked": revoked,
+			})
+			m.auditService.Notify(&models.SecurityAlert{
+				AlertType:   "access_review_completed",
+				Severity:    "medium",
+				Description: fmt.Sprintf("访问复核活动 %s 已截止，自动收回了 %d 项未复核的授权", campaign.Name, revoked),
+				Details:     string(details),
+			})
+		}
+	}
+	return completed
+}
+
+// logAction 记录复核结论审计日志
+func (m *AccessReviewManager) logAction(userID int, action string, item *models.AccessReviewItem, ipAddress string, extra map[string]interface{}) {
+	details := map[string]interface{}{
+		"campaign_id": item.CampaignID,
+		"item_id":     item.ID,
+		"item_type":   item.ItemType,
+		"subject":     item.SubjectType + ":" + item.SubjectName,
+		"target":      item.TargetType + ":" + item.TargetName,
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	m.writeLog(userID, action, fmt.Sprintf("%d", item.CampaignID), ipAddress, details)
+}
+
+// logCampaign 记录复核活动的系统操作审计日志
+func (m *AccessReviewManager) logCampaign(campaign *models.AccessReviewCampaign, action string, extra map[string]interface{}) {
+	details := map[string]interface{}{"name": campaign.Name}
+	for key, value := range extra {
+		details[key] = value
+	}
+	m.writeLog(0, action, fmt.Sprintf("%d", campaign.ID), "", details)
+}
+
+func (m *AccessReviewManager) writeLog(userID int, action, resourceID, ipAddress string, details map[string]interface{}) {
+	if m.auditService == nil {
+		return
+	}
+	detailsJSON, _ := json.Marshal(details)
+	entry := &models.AuditLog{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "access-review",
+		ResourceID:   resourceID,
+		Details:      string(detailsJSON),
+		IPAddress:    ipAddress,
+		Success:      true,
+	}
+	if err := m.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s: %v", action, err)
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+)
+
+// newTestAccessReviewManager 创建使用临时数据库的访问复核服务，不终止终端会话
+func newTestAccessReviewManager(t *testing.T, db *sql.DB) *AccessReviewManager {
+	t.Helper()
+	audit := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(audit.Close)
+	return NewAccessReviewManager(models.NewAccessReviewService(db), models.NewAccessGrantService(db), models.NewGroupService(db),
+		models.NewServerService(db), models.NewUserService(db), models.NewRoleService(db), nil, audit, time.Minute)
+}
+
+// reviewItemsBySubject 按条目类型和用户名索引复核条目
+func reviewItemsBySubject(t *testing.T, m *AccessReviewManager, campaignID int) map[string]*models.AccessReviewItem {
+	t.Helper()
+	items, err := m.GetReviewService().ListItems(models.AccessReviewItemFilter{CampaignID: campaignID})
+	if err != nil {
+		t.Fatalf("list items: %v", err)
+	}
+	bySubject := make(map[string]*models.AccessReviewItem, len(items))
+	for _, item := range items {
+		bySubject[item.ItemType+"/"+item.SubjectName] = item
+	}
+	return bySubject
+}
+
+// TestAccessReviewNeverAssignsSubjectAsReviewer 复核人是被复核的用户本人时改由下一个候选人复核
+func TestAccessReviewNeverAssignsSubjectAsReviewer(t *testing.T) {
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('alice', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('bob', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('carol', 'x', 'admin')`)
+	mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+		VALUES ('db1', '10.0.0.1', 22, 'root', 'password', 'x', '', '', '["db"]')`)
+	mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+		VALUES ('misc', '10.0.0.2', 22, 'root', 'password', 'x', '', '', '')`)
+	// alice 是 db 标签的复核人，同时直接拥有 db1；创建人 admin 直接拥有 misc
+	mustExec(t, db, `INSERT INTO user_server_permissions (user_id, server_id) VALUES (2, 1)`)
+	mustExec(t, db, `INSERT INTO user_server_permissions (user_id, server_id) VALUES (1, 2)`)
+	// alice 是 ops 的负责人，同时是成员
+	mustExec(t, db, `INSERT INTO groups (name, owner_id) VALUES ('ops', 2)`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id) VALUES (1, 2)`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id) VALUES (1, 3)`)
+
+	m := newTestAccessReviewManager(t, db)
+	campaign, err := m.Create(&models.AccessReviewCampaignCreate{
+		Name:         "q3",
+		Deadline:     time.Now().Add(time.Hour),
+		TagReviewers: map[string]int{"db": 2},
+	}, 1)
+	if err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+
+	items := reviewItemsBySubject(t, m, campaign.ID)
+	tests := []struct {
+		key      string
+		reviewer int
+	}{
+		{models.AccessReviewItemDirect + "/alice", 1},     // 标签复核人是本人，改由默认复核人
+		{models.AccessReviewItemDirect + "/admin", 4},     // 默认复核人是本人，改由其他管理员
+		{models.AccessReviewItemMembership + "/alice", 1}, // 组负责人是本人，改由默认复核人
+		{models.AccessReviewItemMembership + "/bob", 2},
+	}
+	for _, tt := range tests {
+		item, ok := items[tt.key]
+		if !ok {
+			t.Fatalf("no item %s in %v", tt.key, items)
+		}
+		if item.ReviewerID != tt.reviewer {
+			t.Errorf("%s: reviewer = %d, want %d", tt.key, item.ReviewerID, tt.reviewer)
+		}
+	}
+
+	if _, err := m.Reassign(items[models.AccessReviewItemMembership+"/bob"].ID, 3); err != ErrAccessReviewSelf {
+		t.Errorf("reassign to subject: err = %v, want ErrAccessReviewSelf", err)
+	}
+	if item, err := m.Reassign(items[models.AccessReviewItemMembership+"/bob"].ID, 4); err != nil || item.ReviewerID != 4 {
+		t.Errorf("reassign to carol: item %+v, err %v", item, err)
+	}
+}
+
+// TestAccessReviewRevokeKeepsMembershipAddedAfterSnapshot 快照之后重新加入的成员关系不被收回
+func TestAccessReviewRevokeKeepsMembershipAddedAfterSnapshot(t *testing.T) {
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('alice', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('bob', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('carol', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO groups (name, owner_id) VALUES ('ops', 2)`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id) VALUES (1, 3)`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id) VALUES (1, 4)`)
+
+	m := newTestAccessReviewManager(t, db)
+	campaign, err := m.Create(&models.AccessReviewCampaignCreate{Name: "q3", Deadline: time.Now().Add(time.Hour)}, 1)
+	if err != nil {
+		t.Fatalf("create campaign: %v", err)
+	}
+	items := reviewItemsBySubject(t, m, campaign.ID)
+
+	// bob 在快照后被移除又重新加入
+	mustExec(t, db, `DELETE FROM group_members WHERE group_id = 1 AND user_id = 3`)
+	mustExec(t, db, `INSERT INTO group_members (group_id, user_id, created_at) VALUES (1, 3, ?)`, time.Now().UTC().Add(time.Minute))
+
+	revoke := &models.AccessReviewDecision{Decision: "revoke"}
+	for _, name := range []string{"bob", "carol"} {
+		if _, err := m.Decide(items[models.AccessReviewItemMembership+"/"+name].ID, 2, revoke, "10.0.0.1"); err != nil {
+			t.Fatalf("revoke %s: %v", name, err)
+		}
+	}
+
+	members, err := models.NewGroupService(db).ListMembers(1)
+	if err != nil {
+		t.Fatalf("list members: %v", err)
+	}
+	if len(members) != 1 || members[0].Username != "bob" {
+		t.Errorf("members after revoke = %+v, want only the re-added bob", members)
+	}
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// WindowDecision 访问时间窗口检查结果
+type WindowDecision struct {
+	Allowed  bool
+	Reason   string    // 拒绝原因
+	ClosesAt time.Time // 允许时本次可用时间的结束时间，零值表示一周内不会关闭
+	NextOpen time.Time // 拒绝时下一次开放的时间，零值表示未知
+}
+
+// AccessWindowService 访问时间窗口：终端启动前检查，窗口关闭前在终端中提醒，关闭后终止会话
+type AccessWindowService struct {
+	scheduleService *models.ScheduleService
+	userService     *models.UserService
+	roleService     *models.RoleService
+	ttydService     *TTYDService
+	auditService    *AuditService
+	stopChan        chan struct{}
+	wg              sync.WaitGroup
+	isRunning       bool
+	mutex           sync.Mutex
+	warned          map[string]time.Time // 已提醒的会话及提醒时对应的关闭时间
+
+	// 配置参数
+	checkInterval time.Duration // 检查间隔
+	warnBefore    time.Duration // 窗口关闭前多久开始提醒
+}
+
+// NewAccessWindowService 创建访问时间窗口服务
+func NewAccessWindowService(scheduleService *models.ScheduleService, userService *models.UserService, roleService *models.RoleService,
+	ttydService *TTYDService, auditService *AuditService, checkInterval, warnBefore time.Duration) *AccessWindowService {
+	return &AccessWindowService{
+		scheduleService: scheduleService,
+		userService:     userService,
+		roleService:     roleService,
+		ttydService:     ttydService,
+		auditService:    auditService,
+		stopChan:        make(chan struct{}),
+		warned:          make(map[string]time.Time),
+		checkInterval:   checkInterval,
+		warnBefore:      warnBefore,
+	}
+}
+
+// GetScheduleService 获取时间窗口数据服务
+func (s *AccessWindowService) GetScheduleService() *models.ScheduleService {
+	return s.scheduleService
+}
+
+// Check 检查用户此刻能否连接服务器：服务器绑定的时间窗口对所有人生效；
+// connectAll 为 true（角色拥有 servers.connect）时不受授权的时间窗口限制，
+// 否则至少一条授权途径上的时间窗口全部开放。授权本身是否存在由调用方检查
+func (s *AccessWindowService) Check(userID, serverID int, connectAll bool, at time.Time) (*WindowDecision, error) {
+	decision := &WindowDecision{Allowed: true}
+
+	serverSchedule, err := s.scheduleService.ForTarget(models.ScheduleTargetServer, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if serverSchedule != nil {
+		open, closesAt := serverSchedule.OpenAt(at)
+		if !open {
+			return &WindowDecision{
+				Reason:   fmt.Sprintf("服务器只能在时间窗口 %s 内连接", serverSchedule.Name),
+				NextOpen: serverSchedule.NextOpen(at),
+			}, nil
+		}
+		decision.ClosesAt = closesAt
+	}
+	if connectAll {
+		return decision, nil
+	}
+
+	paths, err := s.scheduleService.AccessPathSchedules(userID, serverID, at)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return decision, nil
+	}
+
+	schedules := map[int]*models.Schedule{}
+	closedNames := []string{}
+	found := false
+	var best time.Time // 最晚关闭的途径，零值表示不关闭
+	for _, path := range paths {
+		open := true
+		var pathCloses time.Time
+		for _, id := range path {
+			schedule, ok := schedules[id]
+			if !ok {
+				if schedule, err = s.scheduleService.GetByID(id); err != nil {
+					return nil, err
+				}
+				schedules[id] = schedule
+			}
+			scheduleOpen, closesAt := schedule.OpenAt(at)
+			if !scheduleOpen {
+				open = false
+				closedNames = appendUnique(closedNames, schedule.Name)
+				break
+			}
+			pathCloses = earlierClose(pathCloses, closesAt)
+		}
+		if !open {
+			continue
+		}
+		if !found || pathCloses.IsZero() || (!best.IsZero() && pathCloses.After(best)) {
+			best = pathCloses
+		}
+		found = true
+	}
+	if !found {
+		return &WindowDecision{Reason: fmt.Sprintf("授权只在时间窗口 %s 内有效", strings.Join(closedNames, "、"))}, nil
+	}
+
+	decision.ClosesAt = earlierClose(decision.ClosesAt, best)
+	return decision, nil
+}
+
+// earlierClose 取较早的关闭时间，零值表示不关闭
+func earlierClose(a, b time.Time) time.Time {
+	if a.IsZero() {
+		return b
+	}
+	if b.IsZero() || a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// Override 在时间窗口外强制连接：标记会话不受窗口检查终止，并产生安全告警
+func (s *AccessWindowService) Override(process *TTYDProcess, decision *WindowDecision, reason string) {
+	process.WindowOverride.Store(true)
+	if s.auditService == nil {
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"username":        process.Username,
+		"server_name":     process.ServerName,
+		"window_reason":   decision.Reason,
+		"override_reason": reason,
+	})
+	alert := &models.SecurityAlert{
+		UserID:      process.UserID,
+		ServerID:    process.ServerID,
+		AlertType:   "window_override",
+		Severity:    "high",
+		Description: fmt.Sprintf("%s 在访问时间窗口外强制连接服务器 %s：%s", process.Username, process.ServerName, reason),
+		Details:     string(details),
+		IPAddress:   process.ClientIP,
+		SessionID:   process.SessionID,
+	}
+	if err := s.auditService.CreateSecurityAlert(context.Background(), alert); err != nil {
+		log.Printf("Failed to create window override alert: %v", err)
+	}
+}
+
+// Start 启动窗口检查
+func (s *AccessWindowService) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.isRunning {
+		return nil
+	}
+
+	s.isRunning = true
+	s.wg.Add(1)
+
+	go s.enforceLoop()
+
+	log.Printf("Access window enforcement started - check interval: %v, warning: %v", s.checkInterval, s.warnBefore)
+
+	return nil
+}
+
+// Stop 停止窗口检查
+func (s *AccessWindowService) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isRunning {
+		return
+	}
+
+	s.isRunning = false
+	close(s.stopChan)
+	s.wg.Wait()
+
+	log.Printf("Access window enforcement stopped")
+}
+
+// enforceLoop 检查循环
+func (s *AccessWindowService) enforceLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.Enforce(time.Now())
+		}
+	}
+}
+
+// Enforce 检查全部进行中的终端会话：窗口即将关闭时在终端中提醒，已关闭时终止会话，返回终止的会话数
+func (s *AccessWindowService) Enforce(now time.Time) int {
+	if s.ttydService == nil {
+		return 0
+	}
+
+	connectAll := map[int]bool{}
+	active := map[string]bool{}
+	stopped := 0
+	for _, process := range s.ttydService.ListActiveSessions() {
+		active[process.SessionID] = true
+		if process.WindowOverride.Load() {
+			continue
+		}
+
+		all, ok := connectAll[process.UserID]
+		if !ok {
+			all = s.canConnectAll(process.UserID)
+			connectAll[process.UserID] = all
+		}
+		decision, err := s.Check(process.UserID, process.ServerID, all, now)
+		if err != nil {
+			log.Printf("Failed to check access window of session %s: %v", process.SessionID, err)
+			continue
+		}
+
+		if !decision.Allowed {
+			s.ttydService.NotifySession(process.SessionID, "已超出访问时间窗口（"+decision.Reason+"），会话已终止")
+			if err := s.ttydService.StopSessionWithReason(process.SessionID, "window_closed"); err != nil {
+				log.Printf("Failed to stop session %s: %v", process.SessionID, err)
+				continue
+			}
+			stopped++
+			continue
+		}
+
+		if decision.ClosesAt.IsZero() || decision.ClosesAt.Sub(now) > s.warnBefore {
+			continue
+		}
+		if warnedAt, ok := s.warned[process.SessionID]; ok && warnedAt.Equal(decision.ClosesAt) {
+			continue
+		}
+		minutes := int(decision.ClosesAt.Sub(now).Round(time.Minute) / time.Minute)
+		if minutes < 1 {
+			minutes = 1
+		}
+		s.ttydService.NotifySession(process.SessionID,
+			fmt.Sprintf("访问时间窗口将在 %d 分钟后关闭，届时会话将被终止，请及时保存工作", minutes))
+		s.warned[process.SessionID] = decision.ClosesAt
+	}
+
+	for sessionID := range s.warned {
+		if !active[sessionID] {
+			delete(s.warned, sessionID)
+		}
+	}
+	return stopped
+}
+
+// canConnectAll 用户角色是否拥有 servers.connect，查询失败时按没有处理
+func (s *AccessWindowService) canConnectAll(userID int) bool {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return false
+	}
+	permissions, err := s.roleService.Permissions(user.Role)
+	if err != nil {
+		return false
+	}
+	return models.HasPermission(permissions, models.PermissionServersConnect)
+}
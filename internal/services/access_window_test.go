@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// TestAccessWindowCheckUsesRequestedTime 临时访问申请是否到期按检查时刻判断，而不是当前时间
+func TestAccessWindowCheckUsesRequestedTime(t *testing.T) {
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('bob', 'x', 'user')`)
+	mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+		VALUES ('web1', '10.0.0.1', 22, 'root', 'password', 'x', '', '', '[]')`)
+	userID, serverID := 2, 1
+
+	at := time.Now().UTC().Add(48 * time.Hour)
+	schedules := models.NewScheduleService(db)
+	// 只在 at 之外的某一天开放，at 时刻关闭
+	closed, err := schedules.Create(&models.ScheduleCreate{
+		Name:    "closed-at-check",
+		Windows: []models.ScheduleWindow{{Days: []string{strings.ToLower(at.AddDate(0, 0, 3).Weekday().String()[:3])}, Start: "00:00", End: "24:00"}},
+	})
+	if err != nil {
+		t.Fatalf("create schedule: %v", err)
+	}
+	grant, err := models.NewAccessGrantService(db).Create(&models.AccessGrantCreate{
+		SubjectType: models.GrantSubjectUser, SubjectID: userID, ServerID: &serverID,
+	}, 1)
+	if err != nil {
+		t.Fatalf("create grant: %v", err)
+	}
+	if _, err := schedules.Bind(closed.ID, &models.ScheduleBindingCreate{TargetType: models.ScheduleTargetGrant, TargetID: grant.ID}); err != nil {
+		t.Fatalf("bind schedule: %v", err)
+	}
+	// 现在有效、at 时刻已过期的临时访问申请
+	mustExec(t, db, `INSERT INTO access_requests (user_id, server_id, reason, duration_minutes, status, approved_at, expires_at)
+		VALUES (?, ?, 'incident', 60, 'approved', ?, ?)`, userID, serverID, time.Now().UTC(), at.Add(-time.Hour))
+
+	windows := NewAccessWindowService(schedules, models.NewUserService(db), models.NewRoleService(db), nil, nil, time.Minute, time.Minute)
+
+	decision, err := windows.Check(userID, serverID, false, time.Now())
+	if err != nil {
+		t.Fatalf("check now: %v", err)
+	}
+	if !decision.Allowed {
+		t.Fatalf("check now denied (%s), want allowed through the access request", decision.Reason)
+	}
+
+	decision, err = windows.Check(userID, serverID, false, at)
+	if err != nil {
+		t.Fatalf("check at: %v", err)
+	}
+	if decision.Allowed {
+		t.Fatal("check at a time after the access request expired was allowed")
+	}
+
+	paths, err := models.NewServerService(db).AccessPaths(userID, serverID, at)
+	if err != nil {
+		t.Fatalf("access paths: %v", err)
+	}
+	if len(paths) != 1 || paths[0].Type != models.AccessPathGrant {
+		t.Fatalf("paths at %s = %+v, want only the grant", at, paths)
+	}
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+const (
+	alertDeliveryTimeout = 20 * time.Second
+	alertRetryBaseDelay  = 30 * time.Second
+	alertRetryMaxDelay   = 10 * time.Minute
+	alertRateWindow      = time.Minute
+	alertQueueSize       = 500
+	alertWorkers         = 2
+)
+
+// AlertNotifier 安全告警通知入口
+type AlertNotifier interface {
+	Dispatch(alert *models.SecurityAlert)
+	Broadcast(alert *models.SecurityAlert)
+}
+
+// alertDelivery 一次待投递的通知
+type alertDelivery struct {
+	channel      *models.NotificationChannel
+	notifier     Notifier
+	notification *Notification
+	attempt      int
+}
+
+// AlertDispatcher 按渠道路由条件分发安全告警，负责去重、限流和失败重试
+type AlertDispatcher struct {
+	channelService *models.NotificationChannelService
+	serverService  *models.ServerService
+	userService    *models.UserService
+	queue          chan *alertDelivery
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+	isRunning      bool
+	mutex          sync.Mutex
+
+	// 配置参数
+	dedupWindow    time.Duration // 同一渠道相同告警的去重窗口
+	rateLimit      int           // 每个渠道每分钟最多发送的通知数
+	maxAttempts    int           // 单条通知最多投递次数
+	retryBaseDelay time.Duration // 首次重试的等待时间，之后按指数退避
+
+	// 去重与限流状态
+	stateMutex sync.Mutex
+	recent     map[string]time.Time // key: 渠道ID + 告警指纹
+	sent       map[int][]time.Time  // key: 渠道ID，窗口内的发送时间
+	suppressed map[int]int          // key: 渠道ID，因限流被抑制的数量
+}
+
+// NewAlertDispatcher 创建告警分发服务
+func NewAlertDispatcher(channelService *models.NotificationChannelService, serverService *models.ServerService, userService *models.UserService, dedupWindow time.Duration, rateLimit, maxAttempts int) *AlertDispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &AlertDispatcher{
+		channelService: channelService,
+		serverService:  serverService,
+		userService:    userService,
+		queue:          make(chan *alertDelivery, alertQueueSize),
+		stopChan:       make(chan struct{}),
+		dedupWindow:    dedupWindow,
+		rateLimit:      rateLimit,
+		maxAttempts:    maxAttempts,
+		retryBaseDelay: alertRetryBaseDelay,
+		recent:         make(map[string]time.Time),
+		sent:           make(map[int][]time.Time),
+		suppressed:     make(map[int]int),
+	}
+}
+
+// Start 启动投递协程
+func (d *AlertDispatcher) Start() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.isRunning {
+		return nil
+	}
+
+	d.isRunning = true
+	for i := 0; i < alertWorkers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+
+	log.Printf("Alert dispatcher started - dedup window: %v, rate limit: %d/min, max attempts: %d",
+		d.dedupWindow, d.rateLimit, d.maxAttempts)
+	return nil
+}
+
+// Stop 停止投递，队列中未发送的通知被丢弃
+func (d *AlertDispatcher) Stop() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if !d.isRunning {
+		return
+	}
+
+	d.isRunning = false
+	close(d.stopChan)
+	d.wg.Wait()
+
+	if pending := len(d.queue); pending > 0 {
+		log.Printf("Alert dispatcher stopped with %d pending notifications", pending)
+	}
+	log.Printf("Alert dispatcher stopped")
+}
+
+// Dispatch 将告警路由到匹配的渠道并加入投递队列
+func (d *AlertDispatcher) Dispatch(alert *models.SecurityAlert) {
+	d.dispatch(alert, false)
+}
+
+// Broadcast 将告警发送到全部启用的渠道，不经过路由条件、去重和限流，用于紧急访问等必须送达的告警
+func (d *AlertDispatcher) Broadcast(alert *models.SecurityAlert) {
+	d.dispatch(alert, true)
+}
+
+// dispatch 为每个渠道生成投递任务，all 为 true 时忽略路由条件、去重和限流
+func (d *AlertDispatcher) dispatch(alert *models.SecurityAlert, all bool) {
+	channels, err := d.channelService.ListEnabled()
+	if err != nil {
+		log.Printf("Failed to load notification channels: %v", err)
+		return
+	}
+	if len(channels) == 0 {
+		return
+	}
+
+	notification := d.buildNotification(alert)
+	for _, channel := range channels {
+		if !all && !channelMatches(channel, alert, notification.ServerTags) {
+			continue
+		}
+
+		notifier, err := NewNotifier(channel)
+		if err != nil {
+			log.Printf("Notification channel %s misconfigured: %v", channel.Name, err)
+			continue
+		}
+
+		suppressed := 0
+		if !all {
+			var ok bool
+			if suppressed, ok = d.admit(channel.ID, alert); !ok {
+				continue
+			}
+		}
+
+		channelNotification := *notification
+		channelNotification.Suppressed = suppressed
+		d.enqueue(&alertDelivery{
+			channel:      channel,
+			notifier:     notifier,
+			notification: &channelNotification,
+			attempt:      1,
+		})
+	}
+}
+
+// Test 向指定渠道同步发送一条测试通知，不经过路由、去重和限流
+func (d *AlertDispatcher) Test(ctx context.Context, channelID int) error {
+	channel, err := d.channelService.GetByID(channelID)
+	if err != nil {
+		return fmt.Errorf("notification channel not found: %w", err)
+	}
+	notifier, err := NewNotifier(channel)
+	if err != nil {
+		return err
+	}
+
+	notification := &Notification{
+		Alert: &models.SecurityAlert{
+			AlertType:   "test",
+			Severity:    channel.MinSeverity,
+			Description: fmt.Sprintf("这是一条来自通知渠道 %s 的测试消息", channel.Name),
+			CreatedAt:   time.Now(),
+		},
+		Test: true,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, alertDeliveryTimeout)
+	defer cancel()
+	err = notifier.Send(ctx, notification)
+	if recordErr := d.channelService.RecordDelivery(channel.ID, err); recordErr != nil {
+		log.Printf("Failed to record notification delivery: %v", recordErr)
+	}
+	return err
+}
+
+// buildNotification 补充用户名和服务器信息，服务器标签用于路由
+func (d *AlertDispatcher) buildNotification(alert *models.SecurityAlert) *Notification {
+	notification := &Notification{Alert: alert}
+	if alert.UserID != 0 {
+		if user, err := d.userService.GetByID(alert.UserID); err == nil {
+			notification.Username = user.Username
+		}
+	}
+	if alert.ServerID != 0 {
+		if server, err := d.serverService.GetByID(alert.ServerID); err == nil {
+			notification.ServerName = server.Name
+			notification.ServerTags = server.Tags
+		}
+	}
+	return notification
+}
+
+// admit 去重和限流检查，通过时返回此前被抑制的告警数
+func (d *AlertDispatcher) admit(channelID int, alert *models.SecurityAlert) (int, bool) {
+	now := time.Now()
+	fingerprint := fmt.Sprintf("%d|%s|%d|%d|%s", channelID, alert.AlertType, alert.UserID, alert.ServerID, alert.Description)
+
+	d.stateMutex.Lock()
+	defer d.stateMutex.Unlock()
+
+	for key, at := range d.recent {
+		if now.Sub(at) >= d.dedupWindow {
+			delete(d.recent, key)
+		}
+	}
+	if _, duplicate := d.recent[fingerprint]; duplicate {
+		return 0, false
+	}
+
+	if d.rateLimit > 0 {
+		window := d.sent[channelID][:0]
+		for _, at := range d.sent[channelID] {
+			if now.Sub(at) < alertRateWindow {
+				window = append(window, at)
+			}
+		}
+		d.sent[channelID] = window
+		if len(window) >= d.rateLimit {
+			d.suppressed[channelID]++
+			return 0, false
+		}
+		d.sent[channelID] = append(window, now)
+	}
+
+	if d.dedupWindow > 0 {
+		d.recent[fingerprint] = now
+	}
+	suppressed := d.suppressed[channelID]
+	delete(d.suppressed, channelID)
+	return suppressed, true
+}
+
+// enqueue 非阻塞入队，队列满时丢弃
+func (d *AlertDispatcher) enqueue(delivery *alertDelivery) {
+	select {
+	case d.queue <- delivery:
+	default:
+		log.Printf("Alert notification queue full, dropping notification to %s", delivery.channel.Name)
+	}
+}
+
+// worker 投递循环
+func (d *AlertDispatcher) worker() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.stopChan:
+			return
+		case delivery := <-d.queue:
+			d.deliver(delivery)
+		}
+	}
+}
+
+// deliver 投递一条通知，失败时按指数退避重新入队
+func (d *AlertDispatcher) deliver(delivery *alertDelivery) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertDeliveryTimeout)
+	err := delivery.notifier.Send(ctx, delivery.notification)
+	cancel()
+
+	if recordErr := d.channelService.RecordDelivery(delivery.channel.ID, err); recordErr != nil {
+		log.Printf("Failed to record notification delivery: %v", recordErr)
+	}
+	if err == nil {
+		return
+	}
+
+	if delivery.attempt >= d.maxAttempts {
+		log.Printf("Giving up notification to %s after %d attempts: %v", delivery.channel.Name, delivery.attempt, err)
+		return
+	}
+
+	delay := d.retryBaseDelay << (delivery.attempt - 1)
+	if delay > alertRetryMaxDelay {
+		delay = alertRetryMaxDelay
+	}
+	log.Printf("Notification to %s failed (attempt %d), retrying in %v: %v", delivery.channel.Name, delivery.attempt, delay, err)
+
+	delivery.attempt++
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-d.stopChan:
+		case <-timer.C:
+			d.enqueue(delivery)
+		}
+	}()
+}
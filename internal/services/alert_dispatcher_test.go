@@ -0,0 +1,274 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+func TestChannelMatches(t *testing.T) {
+	alert := &models.SecurityAlert{AlertType: "suspicious_command", Severity: "high"}
+	tests := []struct {
+		name    string
+		channel models.NotificationChannel
+		tags    []string
+		want    bool
+	}{
+		{"severity equal", models.NotificationChannel{MinSeverity: "high"}, nil, true},
+		{"severity below minimum", models.NotificationChannel{MinSeverity: "critical"}, nil, false},
+		{"severity above minimum", models.NotificationChannel{MinSeverity: "low"}, nil, true},
+		{"alert type listed", models.NotificationChannel{MinSeverity: "low", AlertTypes: []string{"suspicious_command"}}, nil, true},
+		{"alert type not listed", models.NotificationChannel{MinSeverity: "low", AlertTypes: []string{"login_anomaly"}}, nil, false},
+		{"server tag matches", models.NotificationChannel{MinSeverity: "low", ServerTags: []string{"db", "prod"}}, []string{"prod"}, true},
+		{"server tag differs", models.NotificationChannel{MinSeverity: "low", ServerTags: []string{"db"}}, []string{"prod"}, false},
+		{"server tags without server", models.NotificationChannel{MinSeverity: "low", ServerTags: []string{"db"}}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := channelMatches(&tt.channel, alert, tt.tags); got != tt.want {
+				t.Errorf("channelMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestDispatcher 创建使用临时数据库的告警分发服务，不启动投递协程
+func newTestDispatcher(t *testing.T, dedupWindow time.Duration, rateLimit, maxAttempts int) (*AlertDispatcher, *models.NotificationChannelService) {
+	t.Helper()
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO servers (name, host, port, username, auth_type, password, private_key, description, tags)
+		VALUES ('web1', '10.0.0.1', 22, 'root', 'password', 'x', '', '', '["prod"]')`)
+	channels := models.NewNotificationChannelService(db)
+	return NewAlertDispatcher(channels, models.NewServerService(db), models.NewUserService(db), dedupWindow, rateLimit, maxAttempts), channels
+}
+
+func createChannel(t *testing.T, channels *models.NotificationChannelService, req models.NotificationChannelCreate) *models.NotificationChannel {
+	t.Helper()
+	if req.Type == "" {
+		req.Type = "webhook"
+	}
+	if req.Config == nil {
+		req.Config = map[string]string{"url": "http://127.0.0.1:1/hook"}
+	}
+	channel, err := channels.Create(&req)
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	return channel
+}
+
+// drainQueue 取出队列中全部待投递的通知
+func drainQueue(d *AlertDispatcher) []*alertDelivery {
+	var deliveries []*alertDelivery
+	for {
+		select {
+		case delivery := <-d.queue:
+			deliveries = append(deliveries, delivery)
+		default:
+			return deliveries
+		}
+	}
+}
+
+func queuedChannels(deliveries []*alertDelivery) map[string]bool {
+	names := map[string]bool{}
+	for _, delivery := range deliveries {
+		names[delivery.channel.Name] = true
+	}
+	return names
+}
+
+func TestDispatchRoutesToMatchingChannels(t *testing.T) {
+	d, channels := newTestDispatcher(t, 0, 0, 1)
+	disabled := false
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "all-high", MinSeverity: "high"})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "critical-only", MinSeverity: "critical"})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "login-only", MinSeverity: "low", AlertTypes: []string{"login_anomaly"}})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "prod", MinSeverity: "low", ServerTags: []string{"prod"}})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "db", MinSeverity: "low", ServerTags: []string{"db"}})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "disabled", MinSeverity: "low", Enabled: &disabled})
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "broken", Type: "webhook", MinSeverity: "low", Config: map[string]string{}})
+
+	alert := &models.SecurityAlert{AlertType: "suspicious_command", Severity: "high", ServerID: 1, Description: "rm -rf /"}
+	d.Dispatch(alert)
+	got := queuedChannels(drainQueue(d))
+	want := map[string]bool{"all-high": true, "prod": true}
+	if len(got) != len(want) || !got["all-high"] || !got["prod"] {
+		t.Fatalf("routed to %v, want %v", got, want)
+	}
+
+	// 广播忽略路由条件，但仍跳过停用和配置错误的渠道
+	d.Broadcast(alert)
+	got = queuedChannels(drainQueue(d))
+	if len(got) != 5 || got["disabled"] || got["broken"] {
+		t.Fatalf("broadcast to %v, want all five enabled and valid channels", got)
+	}
+}
+
+func TestDispatchNotificationCarriesServerInfo(t *testing.T) {
+	d, channels := newTestDispatcher(t, 0, 0, 1)
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "all", MinSeverity: "low"})
+
+	d.Dispatch(&models.SecurityAlert{AlertType: "x", Severity: "low", ServerID: 1})
+	deliveries := drainQueue(d)
+	if len(deliveries) != 1 {
+		t.Fatalf("queued %d, want 1", len(deliveries))
+	}
+	if n := deliveries[0].notification; n.ServerName != "web1" || len(n.ServerTags) != 1 || n.ServerTags[0] != "prod" {
+		t.Errorf("notification = %+v", n)
+	}
+}
+
+func TestDispatchDeduplicates(t *testing.T) {
+	d, channels := newTestDispatcher(t, time.Hour, 0, 1)
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "all", MinSeverity: "low"})
+
+	alert := &models.SecurityAlert{AlertType: "suspicious_command", Severity: "high", UserID: 1, Description: "rm -rf /"}
+	d.Dispatch(alert)
+	d.Dispatch(alert)
+	if n := len(drainQueue(d)); n != 1 {
+		t.Fatalf("duplicate alerts queued %d times, want 1", n)
+	}
+
+	other := *alert
+	other.Description = "shutdown -h now"
+	d.Dispatch(&other)
+	if n := len(drainQueue(d)); n != 1 {
+		t.Fatalf("different alert queued %d times, want 1", n)
+	}
+
+	// 去重窗口过期后再次发送
+	d.stateMutex.Lock()
+	for key := range d.recent {
+		d.recent[key] = time.Now().Add(-2 * time.Hour)
+	}
+	d.stateMutex.Unlock()
+	d.Dispatch(alert)
+	if n := len(drainQueue(d)); n != 1 {
+		t.Fatalf("alert after dedup window queued %d times, want 1", n)
+	}
+
+	// 广播不去重
+	d.Broadcast(alert)
+	d.Broadcast(alert)
+	if n := len(drainQueue(d)); n != 2 {
+		t.Fatalf("broadcast queued %d times, want 2", n)
+	}
+}
+
+func TestDispatchRateLimitsAndReportsSuppressed(t *testing.T) {
+	d, channels := newTestDispatcher(t, 0, 2, 1)
+	createChannel(t, channels, models.NotificationChannelCreate{Name: "all", MinSeverity: "low"})
+
+	for _, description := range []string{"a", "b", "c", "d"} {
+		d.Dispatch(&models.SecurityAlert{AlertType: "x", Severity: "high", Description: description})
+	}
+	deliveries := drainQueue(d)
+	if len(deliveries) != 2 {
+		t.Fatalf("queued %d within rate window, want 2", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.notification.Suppressed != 0 {
+			t.Errorf("suppressed = %d before limit reached", delivery.notification.Suppressed)
+		}
+	}
+
+	// 限流窗口过去后，下一条通知带上被抑制的数量
+	d.stateMutex.Lock()
+	for id, sent := range d.sent {
+		for i := range sent {
+			sent[i] = time.Now().Add(-2 * alertRateWindow)
+		}
+		d.sent[id] = sent
+	}
+	d.stateMutex.Unlock()
+	d.Dispatch(&models.SecurityAlert{AlertType: "x", Severity: "high", Description: "e"})
+	deliveries = drainQueue(d)
+	if len(deliveries) != 1 || deliveries[0].notification.Suppressed != 2 {
+		t.Fatalf("after window: %d deliveries, want 1 reporting 2 suppressed", len(deliveries))
+	}
+}
+
+// flakyEndpoint 前 failures 次请求返回 500，之后返回 200
+func flakyEndpoint(t *testing.T, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func waitFor(t *testing.T, timeout time.Duration, condition func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return condition()
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	server, hits := flakyEndpoint(t, 2)
+	d, channels := newTestDispatcher(t, 0, 0, 3)
+	d.retryBaseDelay = 5 * time.Millisecond
+	channel := createChannel(t, channels, models.NotificationChannelCreate{Name: "hook", MinSeverity: "low", Config: map[string]string{"url": server.URL}})
+
+	d.Start()
+	defer d.Stop()
+	d.Dispatch(&models.SecurityAlert{AlertType: "x", Severity: "high", Description: "retry me"})
+
+	// 投递协程写入发送状态时读取可能遇到 SQLITE_BUSY，读取失败时继续等待
+	var stored *models.NotificationChannel
+	if !waitFor(t, 2*time.Second, func() bool {
+		current, err := channels.GetByID(channel.ID)
+		if err != nil {
+			return false
+		}
+		stored = current
+		return atomic.LoadInt32(hits) == 3 && stored.LastSentAt != nil
+	}) {
+		t.Fatalf("hits = %d, want 3 with successful delivery recorded", atomic.LoadInt32(hits))
+	}
+	if stored.LastError != "" {
+		t.Errorf("last_error = %q after successful retry", stored.LastError)
+	}
+}
+
+func TestDeliverGivesUpAfterMaxAttempts(t *testing.T) {
+	server, hits := flakyEndpoint(t, 100)
+	d, channels := newTestDispatcher(t, 0, 0, 2)
+	d.retryBaseDelay = 5 * time.Millisecond
+	channel := createChannel(t, channels, models.NotificationChannelCreate{Name: "hook", MinSeverity: "low", Config: map[string]string{"url": server.URL}})
+
+	d.Start()
+	defer d.Stop()
+	d.Dispatch(&models.SecurityAlert{AlertType: "x", Severity: "high", Description: "always fails"})
+
+	if !waitFor(t, 2*time.Second, func() bool { return atomic.LoadInt32(hits) == 2 }) {
+		t.Fatalf("hits = %d, want 2", atomic.LoadInt32(hits))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Fatalf("hits = %d after giving up, want 2", n)
+	}
+	stored, err := channels.GetByID(channel.ID)
+	if err != nil {
+		t.Fatalf("get channel: %v", err)
+	}
+	if stored.LastError == "" {
+		t.Error("last_error not recorded for failed delivery")
+	}
+}
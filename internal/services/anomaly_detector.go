@@ -0,0 +1,438 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+const (
+	baselineHistoryDays = 30  // 每日会话数保留天数
+	baselineMaxEntries  = 256 // 来源IP/网段最多保留条数
+)
+
+// AnomalyThresholds 行为异常检测阈值
+type AnomalyThresholds struct {
+	Enabled         bool    `json:"enabled"`
+	MinObservations int     `json:"min_observations"` // 学习期：观测次数达到后才开始告警
+	OffHoursRatio   float64 `json:"off_hours_ratio"`  // 某小时活动占比低于该值视为非常用时段
+	VolumeFactor    float64 `json:"volume_factor"`    // 当日会话数超过日均值的倍数
+	VolumeMinimum   int     `json:"volume_minimum"`   // 当日会话数下限，低于此值不告警
+	DurationSigma   float64 `json:"duration_sigma"`   // 会话时长超过均值的标准差倍数，0 表示不检测
+	Timezone        string  `json:"timezone"`
+}
+
+// anomaly 一次检测发现
+type anomaly struct {
+	alertType   string
+	severity    string
+	description string
+	details     map[string]interface{}
+}
+
+// AnomalyDetector 学习用户的常用时段、来源IP/网段、服务器和会话时长，对偏离基线的登录和会话告警
+type AnomalyDetector struct {
+	auditService    *AuditService
+	baselineService *models.BaselineService
+	thresholds      AnomalyThresholds
+	location        *time.Location
+	mutex           sync.Mutex
+	lastHourAlert   map[int]string // key: 用户ID，避免同一小时内重复的时段告警
+}
+
+// NewAnomalyDetector 创建行为异常检测服务
+func NewAnomalyDetector(auditService *AuditService, baselineService *models.BaselineService, thresholds AnomalyThresholds) *AnomalyDetector {
+	location := time.Local
+	if thresholds.Timezone != "" {
+		if loc, err := time.LoadLocation(thresholds.Timezone); err == nil {
+			location = loc
+		} else {
+			log.Printf("Invalid anomaly detection timezone %q, using local time: %v", thresholds.Timezone, err)
+		}
+	}
+	thresholds.Timezone = location.String()
+
+	return &AnomalyDetector{
+		auditService:    auditService,
+		baselineService: baselineService,
+		thresholds:      thresholds,
+		location:        location,
+		lastHourAlert:   make(map[int]string),
+	}
+}
+
+// Thresholds 当前检测阈值
+func (d *AnomalyDetector) Thresholds() AnomalyThresholds {
+	return d.thresholds
+}
+
+// Reset 清空用户基线，重新进入学习期
+func (d *AnomalyDetector) Reset(userID int) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.lastHourAlert, userID)
+	return d.baselineService.Delete(userID)
+}
+
+// ObserveLogin 登录成功时检测并更新基线
+func (d *AnomalyDetector) ObserveLogin(ctx context.Context, userID int, ipAddress string) {
+	if !d.thresholds.Enabled || userID == 0 {
+		return
+	}
+	now := time.Now().In(d.location)
+
+	d.mutex.Lock()
+	baseline, err := d.baselineService.Get(userID)
+	if err != nil {
+		d.mutex.Unlock()
+		log.Printf("Failed to load baseline for user %d: %v", userID, err)
+		return
+	}
+
+	var findings []anomaly
+	if baseline.Observations >= d.thresholds.MinObservations {
+		findings = append(findings, d.checkHour(baseline, now)...)
+		findings = append(findings, d.checkSource(baseline, ipAddress)...)
+	}
+	findings = append(findings, d.checkConcurrent(ctx, userID, ipAddress, "")...)
+
+	baseline.Observations++
+	baseline.Hours[now.Hour()]++
+	recordSource(baseline, ipAddress, now)
+	d.save(baseline)
+	d.mutex.Unlock()
+
+	d.raise(ctx, userID, 0, "", ipAddress, findings)
+}
+
+// ObserveSessionStart 终端会话建立时检测并更新基线
+func (d *AnomalyDetector) ObserveSessionStart(ctx context.Context, userID, serverID int, sessionID, ipAddress string) {
+	if !d.thresholds.Enabled || userID == 0 {
+		return
+	}
+	now := time.Now().In(d.location)
+	today := now.Format("2006-01-02")
+
+	d.mutex.Lock()
+	baseline, err := d.baselineService.Get(userID)
+	if err != nil {
+		d.mutex.Unlock()
+		log.Printf("Failed to load baseline for user %d: %v", userID, err)
+		return
+	}
+
+	var findings []anomaly
+	if baseline.Observations >= d.thresholds.MinObservations {
+		findings = append(findings, d.checkHour(baseline, now)...)
+		findings = append(findings, d.checkSource(baseline, ipAddress)...)
+	}
+	if sessionsStarted(baseline) >= d.thresholds.MinObservations {
+		if _, ok := baseline.Servers[serverID]; !ok {
+			findings = append(findings, anomaly{
+				alertType:   "new_server",
+				severity:    "low",
+				description: fmt.Sprintf("User connected to server %d for the first time", serverID),
+				details:     map[string]interface{}{"known_servers": len(baseline.Servers)},
+			})
+		}
+		findings = append(findings, d.checkVolume(baseline, today)...)
+	}
+	findings = append(findings, d.checkConcurrent(ctx, userID, ipAddress, sessionID)...)
+
+	baseline.Observations++
+	baseline.Hours[now.Hour()]++
+	recordSource(baseline, ipAddress, now)
+	recordServer(baseline, serverID, now)
+	baseline.DailySessions[today]++
+	pruneDailySessions(baseline, now)
+	d.save(baseline)
+	d.mutex.Unlock()
+
+	d.raise(ctx, userID, serverID, sessionID, ipAddress, findings)
+}
+
+// ObserveSessionEnd 终端会话结束时检测会话时长并累计到基线
+func (d *AnomalyDetector) ObserveSessionEnd(ctx context.Context, session *models.TerminalSession) {
+	if !d.thresholds.Enabled || session.UserID == 0 {
+		return
+	}
+
+	d.mutex.Lock()
+	baseline, err := d.baselineService.Get(session.UserID)
+	if err != nil {
+		d.mutex.Unlock()
+		log.Printf("Failed to load baseline for user %d: %v", session.UserID, err)
+		return
+	}
+
+	var findings []anomaly
+	if baseline.SessionCount >= d.thresholds.MinObservations {
+		findings = append(findings, d.checkDuration(baseline, session.Duration)...)
+	}
+	baseline.AddSessionDuration(float64(session.Duration))
+	d.save(baseline)
+	d.mutex.Unlock()
+
+	d.raise(ctx, session.UserID, session.ServerID, session.SessionID, session.IPAddress, findings)
+}
+
+func (d *AnomalyDetector) save(baseline *models.UserBaseline) {
+	if err := d.baselineService.Save(baseline); err != nil {
+		log.Printf("Failed to save baseline for user %d: %v", baseline.UserID, err)
+	}
+}
+
+// checkHour 非常用时段检测，同一用户同一小时只告警一次
+func (d *AnomalyDetector) checkHour(baseline *models.UserBaseline, now time.Time) []anomaly {
+	total := 0
+	for _, count := range baseline.Hours {
+		total += count
+	}
+	if total == 0 {
+		return nil
+	}
+	ratio := float64(baseline.Hours[now.Hour()]) / float64(total)
+	if ratio >= d.thresholds.OffHoursRatio {
+		return nil
+	}
+
+	slot := now.Format("2006-01-02 15")
+	if d.lastHourAlert[baseline.UserID] == slot {
+		return nil
+	}
+	d.lastHourAlert[baseline.UserID] = slot
+
+	return []anomaly{{
+		alertType:   "unusual_time",
+		severity:    "medium",
+		description: fmt.Sprintf("Activity at unusual hour %02d:00 (%.1f%% of baseline activity)", now.Hour(), ratio*100),
+		details: map[string]interface{}{
+			"hour":      now.Hour(),
+			"ratio":     ratio,
+			"threshold": d.thresholds.OffHoursRatio,
+			"timezone":  d.location.String(),
+		},
+	}}
+}
+
+// checkSource 首次出现的来源IP检测，网段也未出现过时提高级别
+func (d *AnomalyDetector) checkSource(baseline *models.UserBaseline, ipAddress string) []anomaly {
+	if ipAddress == "" {
+		return nil
+	}
+	if _, ok := baseline.SourceIPs[ipAddress]; ok {
+		return nil
+	}
+
+	subnet := subnetOf(ipAddress)
+	_, knownSubnet := baseline.Subnets[subnet]
+	severity := "medium"
+	description := fmt.Sprintf("First access from source IP %s in new network %s", ipAddress, subnet)
+	if knownSubnet {
+		severity = "low"
+		description = fmt.Sprintf("First access from source IP %s in known network %s", ipAddress, subnet)
+	}
+	return []anomaly{{
+		alertType:   "new_source_ip",
+		severity:    severity,
+		description: description,
+		details: map[string]interface{}{
+			"subnet":       subnet,
+			"known_subnet": knownSubnet,
+			"known_ips":    len(baseline.SourceIPs),
+		},
+	}}
+}
+
+// checkConcurrent 同一用户从不同IP同时持有活跃会话
+func (d *AnomalyDetector) checkConcurrent(ctx context.Context, userID int, ipAddress, sessionID string) []anomaly {
+	if ipAddress == "" {
+		return nil
+	}
+	others, err := d.auditService.ActiveSessionIPs(ctx, userID, sessionID, ipAddress)
+	if err != nil {
+		log.Printf("Failed to check concurrent sessions for user %d: %v", userID, err)
+		return nil
+	}
+	if len(others) == 0 {
+		return nil
+	}
+
+	return []anomaly{{
+		alertType:   "multiple_login",
+		severity:    "high",
+		description: fmt.Sprintf("Concurrent activity from %s while sessions are active from %v", ipAddress, others),
+		details:     map[string]interface{}{"other_ips": others},
+	}}
+}
+
+// checkVolume 当日会话数明显高于历史日均值，每天最多告警一次
+func (d *AnomalyDetector) checkVolume(baseline *models.UserBaseline, today string) []anomaly {
+	if baseline.LastAlertDay == today {
+		return nil
+	}
+
+	days, total := 0, 0
+	for day, count := range baseline.DailySessions {
+		if day == today {
+			continue
+		}
+		days++
+		total += count
+	}
+	if days == 0 {
+		return nil
+	}
+
+	average := float64(total) / float64(days)
+	count := baseline.DailySessions[today] + 1
+	limit := average * d.thresholds.VolumeFactor
+	if count < d.thresholds.VolumeMinimum || float64(count) <= limit {
+		return nil
+	}
+
+	baseline.LastAlertDay = today
+	return []anomaly{{
+		alertType:   "abnormal_volume",
+		severity:    "medium",
+		description: fmt.Sprintf("%d sessions today, daily average is %.1f", count, average),
+		details: map[string]interface{}{
+			"today":         count,
+			"daily_average": average,
+			"factor":        d.thresholds.VolumeFactor,
+		},
+	}}
+}
+
+// checkDuration 会话时长超过历史均值加若干倍标准差
+func (d *AnomalyDetector) checkDuration(baseline *models.UserBaseline, duration int) []anomaly {
+	if d.thresholds.DurationSigma <= 0 || baseline.SessionStdDev == 0 {
+		return nil
+	}
+	limit := baseline.SessionMean + d.thresholds.DurationSigma*baseline.SessionStdDev
+	if float64(duration) <= limit {
+		return nil
+	}
+
+	return []anomaly{{
+		alertType:   "long_session",
+		severity:    "low",
+		description: fmt.Sprintf("Session lasted %ds, baseline average is %.0fs", duration, baseline.SessionMean),
+		details: map[string]interface{}{
+			"duration":      duration,
+			"mean_seconds":  baseline.SessionMean,
+			"stddev":        baseline.SessionStdDev,
+			"limit_seconds": limit,
+			"sigma":         d.thresholds.DurationSigma,
+		},
+	}}
+}
+
+// raise 为检测发现创建安全告警
+func (d *AnomalyDetector) raise(ctx context.Context, userID, serverID int, sessionID, ipAddress string, findings []anomaly) {
+	for _, finding := range findings {
+		finding.details["source"] = "anomaly_detector"
+		detailsJSON, _ := json.Marshal(finding.details)
+		alert := &models.SecurityAlert{
+			UserID:      userID,
+			ServerID:    serverID,
+			AlertType:   finding.alertType,
+			Severity:    finding.severity,
+			Description: finding.description,
+			Details:     string(detailsJSON),
+			IPAddress:   ipAddress,
+			SessionID:   sessionID,
+		}
+		if err := d.auditService.CreateSecurityAlert(ctx, alert); err != nil {
+			log.Printf("Failed to create anomaly alert: %v", err)
+		}
+	}
+}
+
+// sessionsStarted 基线中累计建立的会话数
+func sessionsStarted(baseline *models.UserBaseline) int {
+	total := 0
+	for _, entry := range baseline.Servers {
+		total += entry.Count
+	}
+	return total
+}
+
+// recordSource 记录来源IP和所在网段
+func recordSource(baseline *models.UserBaseline, ipAddress string, now time.Time) {
+	if ipAddress == "" {
+		return
+	}
+	recordEntry(baseline.SourceIPs, ipAddress, now)
+	recordEntry(baseline.Subnets, subnetOf(ipAddress), now)
+	trimEntries(baseline.SourceIPs)
+	trimEntries(baseline.Subnets)
+}
+
+// recordEntry 累计一次观测
+func recordEntry(entries map[string]*models.BaselineEntry, key string, now time.Time) {
+	entry, ok := entries[key]
+	if !ok {
+		entry = &models.BaselineEntry{FirstSeen: now}
+		entries[key] = entry
+	}
+	entry.Count++
+	entry.LastSeen = now
+}
+
+// recordServer 累计一次服务器访问
+func recordServer(baseline *models.UserBaseline, serverID int, now time.Time) {
+	entry, ok := baseline.Servers[serverID]
+	if !ok {
+		entry = &models.BaselineEntry{FirstSeen: now}
+		baseline.Servers[serverID] = entry
+	}
+	entry.Count++
+	entry.LastSeen = now
+}
+
+// trimEntries 超过上限时淘汰最久未出现的条目
+func trimEntries(entries map[string]*models.BaselineEntry) {
+	if len(entries) <= baselineMaxEntries {
+		return
+	}
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return entries[keys[i]].LastSeen.Before(entries[keys[j]].LastSeen)
+	})
+	for _, key := range keys[:len(keys)-baselineMaxEntries] {
+		delete(entries, key)
+	}
+}
+
+// pruneDailySessions 只保留最近 baselineHistoryDays 天的每日会话数
+func pruneDailySessions(baseline *models.UserBaseline, now time.Time) {
+	cutoff := now.AddDate(0, 0, -baselineHistoryDays).Format("2006-01-02")
+	for day := range baseline.DailySessions {
+		if day < cutoff {
+			delete(baseline.DailySessions, day)
+		}
+	}
+}
+
+// subnetOf IPv4 取 /24，IPv6 取 /64，无法解析时原样返回
+func subnetOf(ipAddress string) string {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil {
+		return ipAddress
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strconv"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+const (
+	checkpointKindCheckpoint = "checkpoint"
+	checkpointKindAnchor     = "anchor"
+)
+
+// auditChainPayload 参与哈希计算的日志字段，字段顺序即序列化顺序
+type auditChainPayload struct {
+	PrevHash     string `json:"prev_hash"`
+	UserID       int    `json:"user_id"`
+	Action       string `json:"action"`
+	ResourceType string `json:"resource_type"`
+	ResourceID   string `json:"resource_id"`
+	Details      string `json:"details"`
+	IPAddress    string `json:"ip_address"`
+	UserAgent    string `json:"user_agent"`
+	Success      bool   `json:"success"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// hashEntry 计算日志条目的链式哈希
+func (s *AuditService) hashEntry(entry *models.AuditLog) string {
+	payload, _ := json.Marshal(auditChainPayload{
+		PrevHash:     entry.PrevHash,
+		UserID:       entry.UserID,
+		Action:       entry.Action,
+		ResourceType: entry.ResourceType,
+		ResourceID:   entry.ResourceID,
+		Details:      entry.Details,
+		IPAddress:    entry.IPAddress,
+		UserAgent:    entry.UserAgent,
+		Success:      entry.Success,
+		CreatedAt:    entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	var h hash.Hash
+	if len(s.chainKey) > 0 {
+		h = hmac.New(sha256.New, s.chainKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// signCheckpoint 计算检查点签名
+func (s *AuditService) signCheckpoint(cp *models.AuditCheckpoint) string {
+	mac := hmac.New(sha256.New, s.signKey)
+	mac.Write([]byte(cp.Kind + "|" + strconv.Itoa(cp.LastLogID) + "|" + cp.LastHash + "|" +
+		strconv.Itoa(cp.EntryCount) + "|" + cp.Details))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignReport 用检查点签名密钥签名导出的报告内容，返回十六进制 HMAC-SHA256
+func (s *AuditService) SignReport(data []byte) string {
+	mac := hmac.New(sha256.New, s.signKey)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// queryer 同时满足 *sql.DB 和 *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// lastChainHash 获取链尾哈希：最后一条日志，若日志已被全部截断则取最近锚点
+func (s *AuditService) lastChainHash(ctx context.Context, q queryer) (string, error) {
+	var lastHash string
+	err := q.QueryRowContext(ctx, "SELECT COALESCE(hash, '') FROM audit_logs ORDER BY id DESC LIMIT 1").Scan(&lastHash)
+	if err == nil {
+		return lastHash, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get last audit hash: %w", err)
+	}
+
+	anchor, err := s.latestAnchor(ctx, q)
+	if err != nil {
+		return "", err
+	}
+	if anchor == nil {
+		return "", nil
+	}
+	return anchor.LastHash, nil
+}
+
+// latestAnchor 获取最近一次截断留下的锚点
+func (s *AuditService) latestAnchor(ctx context.Context, q queryer) (*models.AuditCheckpoint, error) {
+	query := `
+		SELECT id, kind, last_log_id, last_hash, entry_count, COALESCE(details, ''), signature, created_at
+		FROM audit_checkpoints
+		WHERE kind = ?
+		ORDER BY id DESC LIMIT 1
+	`
+	cp := &models.AuditCheckpoint{}
+	err := q.QueryRowContext(ctx, query, checkpointKindAnchor).Scan(
+		&cp.ID, &cp.Kind, &cp.LastLogID, &cp.LastHash, &cp.EntryCount, &cp.Details, &cp.Signature, &cp.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit anchor: %w", err)
+	}
+	return cp, nil
+}
+
+// SealLegacyLogs 为启用哈希链之前写入的日志补算哈希
+// 仅在链中尚无任何哈希时执行，避免把后续插入的无哈希记录"洗白"
+func (s *AuditService) SealLegacyLogs(ctx context.Context) (int, error) {
+	s.chainMutex.Lock()
+	defer s.chainMutex.Unlock()
+
+	var chained int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_logs WHERE hash IS NOT NULL AND hash != ''").Scan(&chained); err != nil {
+		return 0, fmt.Errorf("failed to count chained audit logs: %w", err)
+	}
+	if chained > 0 {
+		return 0, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin audit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, user_id, action, COALESCE(resource_type, ''), COALESCE(resource_id, ''), COALESCE(details, ''),
+		       COALESCE(ip_address, ''), COALESCE(user_agent, ''), COALESCE(success, TRUE), created_at
+		FROM audit_logs ORDER BY id
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query legacy audit logs: %w", err)
+	}
+
+	var entries []*models.AuditLog
+	for rows.Next() {
+		entry := &models.AuditLog{}
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.ResourceType, &entry.ResourceID,
+			&entry.Details, &entry.IPAddress, &entry.UserAgent, &entry.Success, &entry.CreatedAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan legacy audit log: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+
+	prevHash := ""
+	for _, entry := range entries {
+		entry.PrevHash = prevHash
+		entry.Hash = s.hashEntry(entry)
+		// created_at 按哈希时使用的精度回写，保证后续校验一致
+		if _, err := tx.ExecContext(ctx, "UPDATE audit_logs SET created_at = ?, prev_hash = ?, hash = ? WHERE id = ?",
+			entry.CreatedAt.UTC(), entry.PrevHash, entry.Hash, entry.ID); err != nil {
+			return 0, fmt.Errorf("failed to seal legacy audit log %d: %w", entry.ID, err)
+		}
+		prevHash = entry.Hash
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit legacy audit seal: %w", err)
+	}
+	return len(entries), nil
+}
+
+// CreateCheckpoint 在链尾写入签名检查点，若自上次检查点以来无新日志则跳过
+func (s *AuditService) CreateCheckpoint(ctx context.Context) (*models.AuditCheckpoint, error) {
+	s.chainMutex.Lock()
+	defer s.chainMutex.Unlock()
+
+	var lastID int
+	var lastHash string
+	err := s.db.QueryRowContext(ctx, "SELECT id, COALESCE(hash, '') FROM audit_logs ORDER BY id DESC LIMIT 1").Scan(&lastID, &lastHash)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain tail: %w", err)
+	}
+
+	var checkpointedID int
+	err = s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(last_log_id), 0) FROM audit_checkpoints").Scan(&checkpointedID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last checkpoint: %w", err)
+	}
+	if checkpointedID >= lastID {
+		return nil, nil
+	}
+
+	var count int
+	err = s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_logs WHERE id > ? AND id <= ?", checkpointedID, lastID).Scan(&count)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count audit logs: %w", err)
+	}
+
+	cp := &models.AuditCheckpoint{
+		Kind:       checkpointKindCheckpoint,
+		LastLogID:  lastID,
+		LastHash:   lastHash,
+		EntryCount: count,
+	}
+	if err := s.insertCheckpoint(ctx, s.db, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// execer 同时满足 *sql.DB 和 *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertCheckpoint 签名并写入检查点
+func (s *AuditService) insertCheckpoint(ctx context.Context, e execer, cp *models.AuditCheckpoint) error {
+	cp.Signature = s.signCheckpoint(cp)
+	cp.CreatedAt = time.Now().UTC()
+	result, err := e.ExecContext(ctx, `
+		INSERT INTO audit_checkpoints (kind, last_log_id, last_hash, entry_count, details, signature, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, cp.Kind, cp.LastLogID, cp.LastHash, cp.EntryCount, cp.Details, cp.Signature, cp.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit checkpoint: %w", err)
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		cp.ID = int(id)
+	}
+	return nil
+}
+
+// TruncateWithAnchor 截断早于 before 的审计日志
+// 截断前先校验整条链，并在同一事务中写入签名锚点，使剩余日志仍可从锚点开始校验
+func (s *AuditService) TruncateWithAnchor(ctx context.Context, before time.Time) (int, error) {
+	// 先加锁再校验，校验和删除之间不会有新日志写入
+	s.chainMutex.Lock()
+	defer s.chainMutex.Unlock()
+
+	report, err := s.VerifyChain(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !report.Valid {
+		return 0, fmt.Errorf("refusing to truncate broken audit chain: %s", report.Reason)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin audit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lastID int
+	var lastHash string
+	err = tx.QueryRowContext(ctx, "SELECT id, COALESCE(hash, '') FROM audit_logs WHERE created_at < ? ORDER BY id DESC LIMIT 1",
+		before.UTC()).Scan(&lastID, &lastHash)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find truncation point: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM audit_logs WHERE id <= ?", lastID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to truncate audit logs: %w", err)
+	}
+	deleted, _ := result.RowsAffected()
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"before": before.UTC().Format(time.RFC3339),
+	})
+	anchor := &models.AuditCheckpoint{
+		Kind:       checkpointKindAnchor,
+		LastLogID:  lastID,
+		LastHash:   lastHash,
+		EntryCount: int(deleted),
+		Details:    string(details),
+	}
+	if err := s.insertCheckpoint(ctx, tx, anchor); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit audit truncation: %w", err)
+	}
+	return int(deleted), nil
+}
+
+// VerifyChain 从最近锚点开始遍历哈希链，报告第一个断裂的位置
+func (s *AuditService) VerifyChain(ctx context.Context) (*models.AuditChainReport, error) {
+	report := &models.AuditChainReport{Valid: true, VerifiedAt: time.Now().UTC()}
+	fail := func(reason string) *models.AuditChainReport {
+		report.Valid = false
+		report.Reason = reason
+		return report
+	}
+
+	anchor, err := s.latestAnchor(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedPrev := ""
+	startID := 0
+	if anchor != nil {
+		report.AnchorID = &anchor.ID
+		if !hmac.Equal([]byte(anchor.Signature), []byte(s.signCheckpoint(anchor))) {
+			report.BrokenCheckpointID = &anchor.ID
+			return fail(fmt.Sprintf("anchor %d signature mismatch", anchor.ID)), nil
+		}
+		expectedPrev = anchor.LastHash
+		startID = anchor.LastLogID
+	}
+
+	// 检查点：last_log_id -> 期望哈希
+	checkpoints, err := s.listCheckpointsAfter(ctx, startID)
+	if err != nil {
+		return nil, err
+	}
+	expectedAt := make(map[int]*models.AuditCheckpoint, len(checkpoints))
+	for _, cp := range checkpoints {
+		if !hmac.Equal([]byte(cp.Signature), []byte(s.signCheckpoint(cp))) {
+			report.BrokenCheckpointID = &cp.ID
+			return fail(fmt.Sprintf("checkpoint %d signature mismatch", cp.ID)), nil
+		}
+		expectedAt[cp.LastLogID] = cp
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, user_id, action, COALESCE(resource_type, ''), COALESCE(resource_id, ''), COALESCE(details, ''),
+		       COALESCE(ip_address, ''), COALESCE(user_agent, ''), COALESCE(success, TRUE), created_at,
+		       COALESCE(prev_hash, ''), COALESCE(hash, '')
+		FROM audit_logs WHERE id > ? ORDER BY id
+	`, startID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := &models.AuditLog{}
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.Action, &entry.ResourceType, &entry.ResourceID,
+			&entry.Details, &entry.IPAddress, &entry.UserAgent, &entry.Success, &entry.CreatedAt,
+			&entry.PrevHash, &entry.Hash); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+
+		brokenID := entry.ID
+		switch {
+		case entry.PrevHash != expectedPrev:
+			report.FirstBrokenID = &brokenID
+			return fail(fmt.Sprintf("audit log %d does not link to its predecessor (missing or reordered entry)", entry.ID)), nil
+		case entry.Hash != s.hashEntry(entry):
+			report.FirstBrokenID = &brokenID
+			return fail(fmt.Sprintf("audit log %d content does not match its hash (modified entry)", entry.ID)), nil
+		}
+
+		if cp, ok := expectedAt[entry.ID]; ok {
+			if cp.LastHash != entry.Hash {
+				report.FirstBrokenID = &brokenID
+				report.BrokenCheckpointID = &cp.ID
+				return fail(fmt.Sprintf("audit log %d differs from checkpoint %d", entry.ID, cp.ID)), nil
+			}
+			delete(expectedAt, entry.ID)
+			report.CheckpointsVerified++
+		}
+
+		expectedPrev = entry.Hash
+		report.CheckedEntries++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate audit logs: %w", err)
+	}
+
+	// 检查点引用的日志已不存在，说明链尾被删除
+	for _, cp := range checkpoints {
+		if _, missing := expectedAt[cp.LastLogID]; missing {
+			report.BrokenCheckpointID = &cp.ID
+			return fail(fmt.Sprintf("audit log %d referenced by checkpoint %d is missing", cp.LastLogID, cp.ID)), nil
+		}
+	}
+
+	return report, nil
+}
+
+// listCheckpointsAfter 获取覆盖指定日志ID之后的检查点
+func (s *AuditService) listCheckpointsAfter(ctx context.Context, afterLogID int) ([]*models.AuditCheckpoint, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, kind, last_log_id, last_hash, entry_count, COALESCE(details, ''), signature, created_at
+		FROM audit_checkpoints
+		WHERE kind = ? AND last_log_id > ?
+		ORDER BY id
+	`, checkpointKindCheckpoint, afterLogID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []*models.AuditCheckpoint
+	for rows.Next() {
+		cp := &models.AuditCheckpoint{}
+		if err := rows.Scan(&cp.ID, &cp.Kind, &cp.LastLogID, &cp.LastHash, &cp.EntryCount,
+			&cp.Details, &cp.Signature, &cp.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	return checkpoints, nil
+}
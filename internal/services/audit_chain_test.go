@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+)
+
+// newTestAuditService 创建使用指定哈希链密钥的审计服务，key 为空时哈希链使用 SHA-256
+func newTestAuditService(t *testing.T, db *sql.DB, key string) *AuditService {
+	t.Helper()
+	s := NewAuditService(db, &config.Config{JWTSecret: "test-secret", AuditHMACKey: key})
+	t.Cleanup(s.Close)
+	return s
+}
+
+// appendLogs 写入 n 条审计日志，返回日志ID
+func appendLogs(t *testing.T, s *AuditService, n int, createdAt time.Time) []int {
+	t.Helper()
+	ids := make([]int, 0, n)
+	for i := 0; i < n; i++ {
+		entry := &models.AuditLog{
+			UserID:       1,
+			Action:       fmt.Sprintf("action_%d", i),
+			ResourceType: "server",
+			ResourceID:   fmt.Sprintf("%d", i),
+			Details:      fmt.Sprintf(`{"n":%d}`, i),
+			IPAddress:    "10.0.0.1",
+			Success:      true,
+			CreatedAt:    createdAt,
+		}
+		if err := s.LogAction(context.Background(), entry); err != nil {
+			t.Fatalf("log action: %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func verifyChain(t *testing.T, s *AuditService) *models.AuditChainReport {
+	t.Helper()
+	report, err := s.VerifyChain(context.Background())
+	if err != nil {
+		t.Fatalf("verify chain: %v", err)
+	}
+	return report
+}
+
+func TestVerifyChainIntact(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	appendLogs(t, s, 5, time.Time{})
+
+	report := verifyChain(t, s)
+	if !report.Valid || report.CheckedEntries != 5 {
+		t.Fatalf("report = %+v, want valid with 5 entries", report)
+	}
+}
+
+func TestVerifyChainReportsEditedEntry(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	ids := appendLogs(t, s, 5, time.Time{})
+
+	mustExec(t, db, `UPDATE audit_logs SET details = '{"n":"forged"}' WHERE id = ?`, ids[2])
+	report := verifyChain(t, s)
+	if report.Valid || report.FirstBrokenID == nil || *report.FirstBrokenID != ids[2] || !strings.Contains(report.Reason, "modified") {
+		t.Fatalf("report = %+v, want entry %d reported as modified", report, ids[2])
+	}
+}
+
+func TestVerifyChainDetectsDeletedEntry(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	ids := appendLogs(t, s, 5, time.Time{})
+
+	mustExec(t, db, `DELETE FROM audit_logs WHERE id = ?`, ids[2])
+	report := verifyChain(t, s)
+	if report.Valid || report.FirstBrokenID == nil || *report.FirstBrokenID != ids[3] {
+		t.Fatalf("report = %+v, want the entry after the deleted one (%d) reported", report, ids[3])
+	}
+}
+
+func TestVerifyChainDetectsReorderedEntries(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	ids := appendLogs(t, s, 5, time.Time{})
+
+	// 交换两条日志的全部内容，相当于调换了顺序
+	swap := `UPDATE audit_logs SET
+		action = (SELECT action FROM audit_logs WHERE id = ?), resource_id = (SELECT resource_id FROM audit_logs WHERE id = ?),
+		details = (SELECT details FROM audit_logs WHERE id = ?), created_at = (SELECT created_at FROM audit_logs WHERE id = ?),
+		prev_hash = (SELECT prev_hash FROM audit_logs WHERE id = ?), hash = (SELECT hash FROM audit_logs WHERE id = ?)
+		WHERE id = ?`
+	mustExec(t, db, `CREATE TEMP TABLE saved AS SELECT * FROM audit_logs WHERE id = ?`, ids[1])
+	mustExec(t, db, swap, ids[2], ids[2], ids[2], ids[2], ids[2], ids[2], ids[1])
+	mustExec(t, db, strings.ReplaceAll(swap, "FROM audit_logs WHERE id = ?)", "FROM saved)"), ids[2])
+
+	report := verifyChain(t, s)
+	if report.Valid || report.FirstBrokenID == nil || *report.FirstBrokenID != ids[1] {
+		t.Fatalf("report = %+v, want first swapped entry %d reported", report, ids[1])
+	}
+}
+
+func TestVerifyChainDetectsTruncatedTailAfterCheckpoint(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	ids := appendLogs(t, s, 3, time.Time{})
+	cp, err := s.CreateCheckpoint(context.Background())
+	if err != nil || cp == nil {
+		t.Fatalf("create checkpoint: %v, %v", cp, err)
+	}
+	if report := verifyChain(t, s); !report.Valid || report.CheckpointsVerified != 1 {
+		t.Fatalf("report = %+v, want valid with one checkpoint", report)
+	}
+
+	// 删除链尾后其余日志仍然相连，只有检查点能发现
+	mustExec(t, db, `DELETE FROM audit_logs WHERE id = ?`, ids[2])
+	report := verifyChain(t, s)
+	if report.Valid || report.BrokenCheckpointID == nil || *report.BrokenCheckpointID != cp.ID {
+		t.Fatalf("report = %+v, want checkpoint %d reported", report, cp.ID)
+	}
+}
+
+func TestTruncateWithAnchorThenVerify(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "chain-key")
+	now := time.Now().UTC()
+	appendLogs(t, s, 3, now.Add(-48*time.Hour))
+	appendLogs(t, s, 2, now.Add(-time.Hour))
+
+	deleted, err := s.TruncateWithAnchor(context.Background(), now.Add(-24*time.Hour))
+	if err != nil || deleted != 3 {
+		t.Fatalf("truncate: deleted %d, err %v; want 3", deleted, err)
+	}
+	report := verifyChain(t, s)
+	if !report.Valid || report.AnchorID == nil || report.CheckedEntries != 2 {
+		t.Fatalf("report after truncation = %+v, want valid from the anchor with 2 entries", report)
+	}
+
+	// 全部截断后新日志接在锚点之后
+	if _, err := s.TruncateWithAnchor(context.Background(), now); err != nil {
+		t.Fatalf("truncate all: %v", err)
+	}
+	appendLogs(t, s, 1, time.Time{})
+	if report := verifyChain(t, s); !report.Valid || report.CheckedEntries != 1 {
+		t.Fatalf("report after full truncation = %+v, want valid with 1 entry", report)
+	}
+}
+
+func TestTruncateRefusesBrokenChain(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	now := time.Now().UTC()
+	ids := appendLogs(t, s, 3, now.Add(-48*time.Hour))
+	mustExec(t, db, `UPDATE audit_logs SET action = 'forged' WHERE id = ?`, ids[0])
+
+	if _, err := s.TruncateWithAnchor(context.Background(), now); err == nil {
+		t.Fatal("truncate succeeded on a broken chain, which would hide the tampering")
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM audit_logs`).Scan(&count); err != nil || count != 3 {
+		t.Fatalf("audit logs after refused truncation = %d, %v; want 3", count, err)
+	}
+}
+
+func TestVerifyChainRejectsForgedCheckpointSignatures(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper string
+	}{
+		{"forged signature", `UPDATE audit_checkpoints SET signature = 'deadbeef' WHERE id = ?`},
+		{"removed signature", `UPDATE audit_checkpoints SET signature = '' WHERE id = ?`},
+		{"moved checkpoint", `UPDATE audit_checkpoints SET last_hash = 'ffff' WHERE id = ?`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t)
+			s := newTestAuditService(t, db, "")
+			appendLogs(t, s, 2, time.Time{})
+			cp, err := s.CreateCheckpoint(context.Background())
+			if err != nil || cp == nil {
+				t.Fatalf("create checkpoint: %v, %v", cp, err)
+			}
+
+			mustExec(t, db, tt.tamper, cp.ID)
+			report := verifyChain(t, s)
+			if report.Valid || report.BrokenCheckpointID == nil || *report.BrokenCheckpointID != cp.ID {
+				t.Fatalf("report = %+v, want checkpoint %d rejected", report, cp.ID)
+			}
+		})
+	}
+}
+
+func TestVerifyChainRejectsForgedAnchor(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	now := time.Now().UTC()
+	appendLogs(t, s, 2, now.Add(-48*time.Hour))
+	appendLogs(t, s, 1, time.Time{})
+	if _, err := s.TruncateWithAnchor(context.Background(), now.Add(-24*time.Hour)); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+
+	// 伪造锚点的起点哈希以接上被篡改的日志
+	mustExec(t, db, `UPDATE audit_checkpoints SET last_hash = 'forged' WHERE kind = 'anchor'`)
+	report := verifyChain(t, s)
+	if report.Valid || report.BrokenCheckpointID == nil || report.AnchorID == nil || *report.BrokenCheckpointID != *report.AnchorID {
+		t.Fatalf("report = %+v, want the anchor rejected", report)
+	}
+}
+
+func TestVerifyChainRequiresSameHMACKey(t *testing.T) {
+	db := openTestDB(t)
+	writer := newTestAuditService(t, db, "key-one")
+	appendLogs(t, writer, 3, time.Time{})
+	if _, err := writer.CreateCheckpoint(context.Background()); err != nil {
+		t.Fatalf("create checkpoint: %v", err)
+	}
+
+	if report := verifyChain(t, newTestAuditService(t, db, "key-one")); !report.Valid {
+		t.Fatalf("same key: report = %+v, want valid", report)
+	}
+	if report := verifyChain(t, newTestAuditService(t, db, "key-two")); report.Valid {
+		t.Fatal("chain written with one HMAC key verified with a different key")
+	}
+	// 没有密钥也不能用普通 SHA-256 重算出同样的链
+	if report := verifyChain(t, newTestAuditService(t, db, "")); report.Valid {
+		t.Fatal("keyed chain verified without a key")
+	}
+}
+
+func TestSealLegacyLogs(t *testing.T) {
+	db := openTestDB(t)
+	s := newTestAuditService(t, db, "")
+	mustExec(t, db, `DELETE FROM audit_logs`)
+	for i := 0; i < 3; i++ {
+		mustExec(t, db, `INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address, success, created_at)
+			VALUES (1, 'legacy', 'server', ?, '{}', '10.0.0.1', TRUE, ?)`, fmt.Sprintf("%d", i), time.Now().UTC().Add(time.Duration(i)*time.Second))
+	}
+
+	sealed, err := s.SealLegacyLogs(context.Background())
+	if err != nil || sealed != 3 {
+		t.Fatalf("seal: sealed %d, err %v; want 3", sealed, err)
+	}
+	appendLogs(t, s, 1, time.Time{})
+	if report := verifyChain(t, s); !report.Valid || report.CheckedEntries != 4 {
+		t.Fatalf("report = %+v, want valid with 4 entries", report)
+	}
+
+	// 链中已有哈希时不再补算，之后插入的无哈希记录会被发现
+	mustExec(t, db, `INSERT INTO audit_logs (user_id, action, created_at) VALUES (1, 'injected', ?)`, time.Now().UTC())
+	if sealed, err := s.SealLegacyLogs(context.Background()); err != nil || sealed != 0 {
+		t.Fatalf("second seal: sealed %d, err %v; want 0", sealed, err)
+	}
+	if report := verifyChain(t, s); report.Valid {
+		t.Fatal("injected unhashed entry was not detected")
+	}
+}
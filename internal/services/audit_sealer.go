@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// AuditSealer 审计哈希链维护服务：定期写入签名检查点并按保留期截断
+type AuditSealer struct {
+	auditService *AuditService
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+	isRunning    bool
+	mutex        sync.Mutex
+
+	// 配置参数
+	checkpointInterval time.Duration // 检查点间隔
+	retention          time.Duration // 日志保留期，0 表示不截断
+}
+
+// NewAuditSealer 创建审计哈希链维护服务
+func NewAuditSealer(auditService *AuditService, checkpointInterval, retention time.Duration) *AuditSealer {
+	return &AuditSealer{
+		auditService:       auditService,
+		stopChan:           make(chan struct{}),
+		checkpointInterval: checkpointInterval,
+		retention:          retention,
+	}
+}
+
+// Start 启动哈希链维护
+func (as *AuditSealer) Start() error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if as.isRunning {
+		return nil
+	}
+
+	// 启用哈希链前写入的旧日志需要先补算哈希
+	sealed, err := as.auditService.SealLegacyLogs(context.Background())
+	if err != nil {
+		return err
+	}
+	if sealed > 0 {
+		log.Printf("Sealed %d legacy audit logs into hash chain", sealed)
+	}
+
+	as.isRunning = true
+	as.wg.Add(1)
+
+	go as.sealLoop()
+
+	log.Printf("Audit sealer started - checkpoint interval: %v, retention: %v",
+		as.checkpointInterval, as.retention)
+
+	return nil
+}
+
+// Stop 停止哈希链维护
+func (as *AuditSealer) Stop() {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if !as.isRunning {
+		return
+	}
+
+	as.isRunning = false
+	close(as.stopChan)
+	as.wg.Wait()
+
+	log.Printf("Audit sealer stopped")
+}
+
+// sealLoop 维护循环
+func (as *AuditSealer) sealLoop() {
+	defer as.wg.Done()
+
+	ticker := time.NewTicker(as.checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-as.stopChan:
+			// 退出前补一个检查点，缩小链尾不受保护的窗口
+			as.checkpoint()
+			return
+		case <-ticker.C:
+			as.applyRetention()
+			as.checkpoint()
+		}
+	}
+}
+
+// checkpoint 写入一个检查点
+func (as *AuditSealer) checkpoint() {
+	cp, err := as.auditService.CreateCheckpoint(context.Background())
+	if err != nil {
+		log.Printf("Failed to create audit checkpoint: %v", err)
+		return
+	}
+	if cp != nil {
+		log.Printf("Audit checkpoint %d sealed at log %d (%d entries)", cp.ID, cp.LastLogID, cp.EntryCount)
+	}
+}
+
+// applyRetention 按保留期截断旧日志，并把截断操作本身写入审计日志
+func (as *AuditSealer) applyRetention() {
+	if as.retention <= 0 {
+		return
+	}
+
+	ctx := context.Background()
+	before := time.Now().Add(-as.retention)
+	deleted, err := as.auditService.TruncateWithAnchor(ctx, before)
+	if err != nil {
+		log.Printf("Failed to apply audit log retention: %v", err)
+		return
+	}
+	if deleted == 0 {
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"before":  before.UTC(),
+		"deleted": deleted,
+	})
+	if err := as.auditService.LogAction(ctx, &models.AuditLog{
+		Action:       "audit_truncate",
+		ResourceType: "audit_log",
+		Details:      string(details),
+		Success:      true,
+	}); err != nil {
+		log.Printf("Failed to log audit truncation: %v", err)
+	}
+	log.Printf("Audit retention truncated %d logs older than %v", deleted, before)
+}
@@ -2,54 +2,176 @@ package services
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	"very-jump/internal/config"
 	"very-jump/internal/database/models"
 )
 
 // AuditService 审计服务
 type AuditService struct {
-	db *sql.DB
+	db         *sql.DB
+	chainKey   []byte     // 日志哈希链 HMAC 密钥，为空时使用 SHA-256
+	signKey    []byte     // 检查点签名密钥
+	chainMutex sync.Mutex // 串行化哈希链写入
+	sinks      *auditSinks
+	notifier   AlertNotifier    // 安全告警通知，可为空
+	detector   *AnomalyDetector // 行为异常检测，可为空
 }
 
 // NewAuditService 创建审计服务实例
-func NewAuditService(db *sql.DB) *AuditService {
-	return &AuditService{db: db}
+func NewAuditService(db *sql.DB, cfg *config.Config) *AuditService {
+	signKey := []byte(cfg.AuditHMACKey)
+	if len(signKey) == 0 {
+		log.Printf("AUDIT_HMAC_KEY is not set, deriving audit signing key from JWT_SECRET")
+		signKey = deriveSignKey(cfg.JWTSecret)
+	}
+	s := &AuditService{
+		db:       db,
+		chainKey: []byte(cfg.AuditHMACKey),
+		signKey:  signKey,
+		sinks:    &auditSinks{buffer: cfg.AuditSinkBuffer},
+	}
+
+	// 按配置注册 SIEM 输出端，配置错误只记录日志，不影响审计落库
+	if cfg.AuditSyslogAddr != "" {
+		sink, err := NewSyslogSink(cfg.AuditSyslogNetwork, cfg.AuditSyslogAddr, cfg.AuditSyslogFormat, cfg.AuditSyslogCAFile)
+		if err != nil {
+			log.Printf("Failed to configure syslog audit sink: %v", err)
+		} else {
+			s.AddSink(sink)
+		}
+	}
+	if cfg.AuditFileEnabled {
+		sink, err := NewFileSink(filepath.Join(cfg.DataDir, "logs"), cfg.AuditFileMaxSizeMB, cfg.AuditFileMaxBackups)
+		if err != nil {
+			log.Printf("Failed to configure file audit sink: %v", err)
+		} else {
+			s.AddSink(sink)
+		}
+	}
+
+	return s
+}
+
+// deriveSignKey 未配置 AUDIT_HMAC_KEY 时从 JWT 密钥派生独立的签名密钥，避免检查点和报告签名与 JWT 共用同一个 HMAC 密钥
+func deriveSignKey(secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("very-jump audit signing key"))
+	return mac.Sum(nil)
 }
 
-// LogAction 记录操作审计日志
+// AddSink 注册审计事件输出端
+func (s *AuditService) AddSink(sink AuditSink) {
+	s.sinks.add(sink)
+}
+
+// SetAlertNotifier 设置安全告警通知入口
+func (s *AuditService) SetAlertNotifier(notifier AlertNotifier) {
+	s.notifier = notifier
+}
+
+// SetAnomalyDetector 设置行为异常检测
+func (s *AuditService) SetAnomalyDetector(detector *AnomalyDetector) {
+	s.detector = detector
+}
+
+// ObserveLogin 将成功登录交给行为异常检测
+func (s *AuditService) ObserveLogin(ctx context.Context, userID int, ipAddress string) {
+	if s.detector != nil {
+		s.detector.ObserveLogin(ctx, userID, ipAddress)
+	}
+}
+
+// Publish 将事件镜像到所有输出端，不会阻塞调用方
+func (s *AuditService) Publish(event *AuditEvent) {
+	s.sinks.publish(event)
+}
+
+// Close 关闭所有输出端，尽量投递完缓冲中的事件
+func (s *AuditService) Close() {
+	s.sinks.close()
+}
+
+// LogAction 记录操作审计日志，并将其链接到哈希链末尾
 func (s *AuditService) LogAction(ctx context.Context, log *models.AuditLog) error {
+	s.chainMutex.Lock()
+	defer s.chainMutex.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin audit transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	prevHash, err := s.lastChainHash(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now().UTC()
+	}
+	log.PrevHash = prevHash
+	log.Hash = s.hashEntry(log)
+
 	query := `
-		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address, user_agent, success)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO audit_logs (user_id, action, resource_type, resource_id, details, ip_address, user_agent, success, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := s.db.ExecContext(ctx, query,
+	result, err := tx.ExecContext(ctx, query,
 		log.UserID, log.Action, log.ResourceType, log.ResourceID, log.Details,
-		log.IPAddress, log.UserAgent, log.Success)
-
+		log.IPAddress, log.UserAgent, log.Success, log.CreatedAt, log.PrevHash, log.Hash)
 	if err != nil {
 		return fmt.Errorf("failed to insert audit log: %w", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit audit log: %w", err)
+	}
+
+	if id, err := result.LastInsertId(); err == nil {
+		log.ID = int(id)
+	}
+
+	s.Publish(auditEventFromLog(log))
 	return nil
 }
 
-// LogTerminalStart 记录终端启动
-func (s *AuditService) LogTerminalStart(ctx context.Context, userID, serverID int, sessionID, ipAddress, userAgent string) error {
+// terminalAuditLog 终端启动或复用的审计日志，记录本次连接的原因、工单号、紧急访问和连接策略决定
+func terminalAuditLog(action string, userID, serverID int, sessionID, ipAddress, userAgent string,
+	justification models.SessionJustification) *models.AuditLog {
 	details := map[string]interface{}{
 		"session_id": sessionID,
 		"server_id":  serverID,
 		"timestamp":  time.Now().UTC(),
 	}
+	if justification.Reason != "" {
+		details["reason"] = justification.Reason
+	}
+	if justification.TicketID != "" {
+		details["ticket_id"] = justification.TicketID
+	}
+	if justification.BreakGlassID > 0 {
+		details["break_glass_id"] = justification.BreakGlassID
+	}
+	if justification.Policy != nil {
+		details["policy"] = justification.Policy
+	}
 	detailsJSON, _ := json.Marshal(details)
 
-	auditLog := &models.AuditLog{
+	return &models.AuditLog{
 		UserID:       userID,
-		Action:       "terminal_start",
+		Action:       action,
 		ResourceType: "terminal_session",
 		ResourceID:   sessionID,
 		Details:      string(detailsJSON),
@@ -57,14 +179,31 @@ func (s *AuditService) LogTerminalStart(ctx context.Context, userID, serverID in
 		UserAgent:    userAgent,
 		Success:      true,
 	}
+}
 
+// LogTerminalStart 记录终端启动
+func (s *AuditService) LogTerminalStart(ctx context.Context, userID, serverID int, sessionID, ipAddress, userAgent string,
+	justification models.SessionJustification) error {
 	// 记录审计日志
-	if err := s.LogAction(ctx, auditLog); err != nil {
+	if err := s.LogAction(ctx, terminalAuditLog("terminal_start", userID, serverID, sessionID, ipAddress, userAgent, justification)); err != nil {
 		log.Printf("Failed to log terminal start: %v", err)
 	}
 
 	// 创建会话记录
-	return s.CreateTerminalSession(ctx, sessionID, userID, serverID, ipAddress)
+	if err := s.CreateTerminalSession(ctx, sessionID, userID, serverID, ipAddress, justification); err != nil {
+		return err
+	}
+
+	if s.detector != nil {
+		s.detector.ObserveSessionStart(ctx, userID, serverID, sessionID, ipAddress)
+	}
+	return nil
+}
+
+// LogTerminalReuse 记录复用已有终端会话的连接，本次连接的原因、工单号和连接策略决定记录在审计日志中
+func (s *AuditService) LogTerminalReuse(ctx context.Context, userID, serverID int, sessionID, ipAddress, userAgent string,
+	justification models.SessionJustification) error {
+	return s.LogAction(ctx, terminalAuditLog("terminal_reuse", userID, serverID, sessionID, ipAddress, userAgent, justification))
 }
 
 // LogTerminalEnd 记录终端结束
@@ -81,6 +220,10 @@ func (s *AuditService) LogTerminalEnd(ctx context.Context, sessionID, reason str
 		return nil // 不影响主流程
 	}
 
+	if s.detector != nil && session.Status != "active" {
+		s.detector.ObserveSessionEnd(ctx, session)
+	}
+
 	details := map[string]interface{}{
 		"session_id": sessionID,
 		"reason":     reason,
@@ -104,12 +247,14 @@ func (s *AuditService) LogTerminalEnd(ctx context.Context, sessionID, reason str
 }
 
 // CreateTerminalSession 创建终端会话记录
-func (s *AuditService) CreateTerminalSession(ctx context.Context, sessionID string, userID, serverID int, ipAddress string) error {
+func (s *AuditService) CreateTerminalSession(ctx context.Context, sessionID string, userID, serverID int, ipAddress string,
+	justification models.SessionJustification) error {
 	query := `
-		INSERT INTO terminal_sessions (session_id, user_id, server_id, start_time, ip_address, status)
-		VALUES (?, ?, ?, ?, ?, 'active')
+		INSERT INTO terminal_sessions (session_id, user_id, server_id, start_time, ip_address, status, reason, ticket_id)
+		VALUES (?, ?, ?, ?, ?, 'active', ?, ?)
 	`
-	_, err := s.db.ExecContext(ctx, query, sessionID, userID, serverID, time.Now().UTC(), ipAddress)
+	_, err := s.db.ExecContext(ctx, query, sessionID, userID, serverID, time.Now().UTC(), ipAddress,
+		justification.Reason, justification.TicketID)
 	if err != nil {
 		return fmt.Errorf("failed to create terminal session: %w", err)
 	}
@@ -118,11 +263,21 @@ func (s *AuditService) CreateTerminalSession(ctx context.Context, sessionID stri
 
 // EndTerminalSession 结束终端会话
 func (s *AuditService) EndTerminalSession(ctx context.Context, sessionID, reason string) error {
-	// 计算持续时间
+	// 计算持续时间（start_time 由驱动按 Go 时间格式存储，SQLite 的 julianday 无法解析）
+	var startTime time.Time
+	err := s.db.QueryRowContext(ctx,
+		"SELECT start_time FROM terminal_sessions WHERE session_id = ? AND status = 'active'", sessionID).Scan(&startTime)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to end terminal session: %w", err)
+	}
+
 	query := `
 		UPDATE terminal_sessions 
 		SET end_time = ?, 
-		    duration = CAST((julianday(?) - julianday(start_time)) * 86400 AS INTEGER),
+		    duration = ?,
 		    status = ?,
 		    updated_at = ?
 		WHERE session_id = ? AND status = 'active'
@@ -133,7 +288,7 @@ func (s *AuditService) EndTerminalSession(ctx context.Context, sessionID, reason
 		status = "error"
 	}
 
-	_, err := s.db.ExecContext(ctx, query, now, now, status, now, sessionID)
+	_, err = s.db.ExecContext(ctx, query, now, int(now.Sub(startTime).Seconds()), status, now, sessionID)
 	if err != nil {
 		return fmt.Errorf("failed to end terminal session: %w", err)
 	}
@@ -143,8 +298,8 @@ func (s *AuditService) EndTerminalSession(ctx context.Context, sessionID, reason
 // GetTerminalSession 获取终端会话信息
 func (s *AuditService) GetTerminalSession(ctx context.Context, sessionID string) (*models.TerminalSession, error) {
 	query := `
-		SELECT id, session_id, user_id, server_id, start_time, end_time, duration, 
-		       command_count, ip_address, status, created_at, updated_at
+		SELECT id, session_id, user_id, server_id, start_time, end_time, COALESCE(duration, 0), 
+		       command_count, ip_address, status, COALESCE(reason, ''), COALESCE(ticket_id, ''), created_at, updated_at
 		FROM terminal_sessions 
 		WHERE session_id = ?
 	`
@@ -154,7 +309,7 @@ func (s *AuditService) GetTerminalSession(ctx context.Context, sessionID string)
 	err := row.Scan(
 		&session.ID, &session.SessionID, &session.UserID, &session.ServerID,
 		&session.StartTime, &session.EndTime, &session.Duration, &session.CommandCount,
-		&session.IPAddress, &session.Status, &session.CreatedAt, &session.UpdatedAt,
+		&session.IPAddress, &session.Status, &session.Reason, &session.TicketID, &session.CreatedAt, &session.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get terminal session: %w", err)
@@ -162,25 +317,103 @@ func (s *AuditService) GetTerminalSession(ctx context.Context, sessionID string)
 	return session, nil
 }
 
+// ActiveSessionIPs 用户其他活跃终端会话的来源IP，排除指定会话和IP
+func (s *AuditService) ActiveSessionIPs(ctx context.Context, userID int, excludeSessionID, excludeIP string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ip_address FROM terminal_sessions
+		WHERE user_id = ? AND status = 'active' AND session_id != ?
+		  AND ip_address IS NOT NULL AND ip_address != '' AND ip_address != ?
+	`, userID, excludeSessionID, excludeIP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list active session IPs: %w", err)
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("failed to scan active session IP: %w", err)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, rows.Err()
+}
+
 // CreateSecurityAlert 创建安全告警
 func (s *AuditService) CreateSecurityAlert(ctx context.Context, alert *models.SecurityAlert) error {
 	query := `
 		INSERT INTO security_alerts (user_id, server_id, alert_type, severity, description, details, ip_address, session_id)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := s.db.ExecContext(ctx, query,
+	result, err := s.db.ExecContext(ctx, query,
 		alert.UserID, alert.ServerID, alert.AlertType, alert.Severity,
 		alert.Description, alert.Details, alert.IPAddress, alert.SessionID)
 
 	if err != nil {
 		return fmt.Errorf("failed to create security alert: %w", err)
 	}
+	if id, err := result.LastInsertId(); err == nil {
+		alert.ID = int(id)
+	}
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+
+	s.Publish(auditEventFromAlert(alert))
+	if s.notifier != nil {
+		if alert.Broadcast {
+			s.notifier.Broadcast(alert)
+		} else {
+			s.notifier.Dispatch(alert)
+		}
+	}
 
 	log.Printf("Security Alert [%s]: %s (User: %d, Server: %d)",
 		alert.Severity, alert.Description, alert.UserID, alert.ServerID)
 	return nil
 }
 
+// Notify 只发送通知不保存为安全告警，用于审批流程等非安全事件
+func (s *AuditService) Notify(alert *models.SecurityAlert) {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+	if s.notifier != nil {
+		s.notifier.Dispatch(alert)
+	}
+}
+
+// LogCommand 记录终端中执行的命令：累加会话命令数、镜像到 SIEM 并检查可疑命令
+func (s *AuditService) LogCommand(ctx context.Context, userID, serverID int, sessionID, command, ipAddress string) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		"UPDATE terminal_sessions SET command_count = command_count + 1, updated_at = ? WHERE session_id = ?",
+		time.Now().UTC(), sessionID)
+	if err != nil {
+		log.Printf("Failed to update command count for session %s: %v", sessionID, err)
+	}
+
+	s.Publish(&AuditEvent{
+		Type:      AuditEventCommand,
+		Time:      time.Now().UTC(),
+		Severity:  "info",
+		Action:    "command_execute",
+		Success:   true,
+		UserID:    userID,
+		ServerID:  serverID,
+		SessionID: sessionID,
+		IPAddress: ipAddress,
+		Message:   command,
+	})
+
+	s.CheckSuspiciousCommand(ctx, userID, serverID, sessionID, command, ipAddress)
+}
+
 // CheckSuspiciousCommand 检查可疑命令
 func (s *AuditService) CheckSuspiciousCommand(ctx context.Context, userID, serverID int, sessionID, command, ipAddress string) {
 	suspiciousPatterns := []string{
@@ -241,44 +474,253 @@ func (s *AuditService) getSeverityForCommand(pattern string) string {
 	return "low"
 }
 
+// auditLogSortColumns 审计日志允许排序的字段
+var auditLogSortColumns = map[string]string{
+	"created_at": "created_at",
+	"action":     "action",
+	"user_id":    "user_id",
+	"ip_address": "ip_address",
+	"success":    "success",
+}
+
+// terminalSessionSortColumns 终端会话允许排序的字段
+var terminalSessionSortColumns = map[string]string{
+	"start_time":    "ts.start_time",
+	"duration":      "ts.duration",
+	"command_count": "ts.command_count",
+	"user_id":       "ts.user_id",
+	"server_id":     "ts.server_id",
+}
+
+// orderClause 根据白名单生成排序子句，id 作为第二排序键保证分页稳定
+func orderClause(columns map[string]string, sortBy, sortOrder, defaultColumn, idColumn string) string {
+	column, ok := columns[sortBy]
+	if !ok {
+		column = defaultColumn
+	}
+	direction := "DESC"
+	if strings.EqualFold(sortOrder, "asc") {
+		direction = "ASC"
+	}
+	return fmt.Sprintf(" ORDER BY %s %s, %s %s", column, direction, idColumn, direction)
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// buildAuditLogWhere 根据过滤条件生成 WHERE 子句
+func buildAuditLogWhere(filter *models.AuditLogFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.ResourceType != "" {
+		conditions = append(conditions, "resource_type = ?")
+		args = append(args, filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		conditions = append(conditions, "resource_id = ?")
+		args = append(args, filter.ResourceID)
+	}
+	if filter.Success != nil {
+		conditions = append(conditions, "success = ?")
+		args = append(args, *filter.Success)
+	}
+	if filter.IPAddress != "" {
+		conditions = append(conditions, "ip_address = ?")
+		args = append(args, filter.IPAddress)
+	}
+	if filter.StartTime != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.StartTime.UTC())
+	}
+	if filter.EndTime != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, filter.EndTime.UTC())
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, `details LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(filter.Search)+"%")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+const auditLogColumns = `
+		SELECT id, user_id, action, resource_type, resource_id, details, ip_address, 
+		       user_agent, success, created_at, COALESCE(prev_hash, ''), COALESCE(hash, '')
+		FROM audit_logs`
+
+// scanAuditLog 扫描一行审计日志
+func scanAuditLog(rows *sql.Rows) (*models.AuditLog, error) {
+	log := &models.AuditLog{}
+	err := rows.Scan(
+		&log.ID, &log.UserID, &log.Action, &log.ResourceType, &log.ResourceID,
+		&log.Details, &log.IPAddress, &log.UserAgent, &log.Success,
+		&log.CreatedAt, &log.PrevHash, &log.Hash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit log: %w", err)
+	}
+	return log, nil
+}
+
 // GetAuditLogs 获取审计日志列表
 func (s *AuditService) GetAuditLogs(ctx context.Context, userID *int, limit, offset int) ([]*models.AuditLog, error) {
-	query := `
-		SELECT id, user_id, action, resource_type, resource_id, details, ip_address, 
-		       user_agent, success, created_at
-		FROM audit_logs
-	`
-	args := []interface{}{}
+	logs, _, err := s.SearchAuditLogs(ctx, &models.AuditLogFilter{UserID: userID, Limit: limit, Offset: offset})
+	return logs, err
+}
+
+// SearchAuditLogs 按条件分页查询审计日志，并返回匹配总数
+func (s *AuditService) SearchAuditLogs(ctx context.Context, filter *models.AuditLogFilter) ([]*models.AuditLog, int, error) {
+	where, args := buildAuditLogWhere(filter)
 
-	if userID != nil {
-		query += " WHERE user_id = ?"
-		args = append(args, *userID)
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM audit_logs"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit logs: %w", err)
 	}
 
-	query += " ORDER BY created_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
+	query := auditLogColumns + where +
+		orderClause(auditLogSortColumns, filter.SortBy, filter.SortOrder, "created_at", "id") +
+		" LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
 
 	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+		return nil, 0, fmt.Errorf("failed to query audit logs: %w", err)
 	}
 	defer rows.Close()
 
-	var logs []*models.AuditLog
+	logs := []*models.AuditLog{}
 	for rows.Next() {
-		log := &models.AuditLog{}
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, total, rows.Err()
+}
+
+// StreamAuditLogs 按条件逐行遍历审计日志，不在内存中缓存结果集，忽略分页参数
+func (s *AuditService) StreamAuditLogs(ctx context.Context, filter *models.AuditLogFilter, fn func(*models.AuditLog) error) error {
+	where, args := buildAuditLogWhere(filter)
+	query := auditLogColumns + where +
+		orderClause(auditLogSortColumns, filter.SortBy, filter.SortOrder, "created_at", "id")
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query audit logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		log, err := scanAuditLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(log); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListTerminalSessions 按条件分页查询终端会话，并返回匹配总数
+func (s *AuditService) ListTerminalSessions(ctx context.Context, filter *models.TerminalSessionFilter) ([]*models.TerminalSession, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil {
+		conditions = append(conditions, "ts.user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.ServerID != nil {
+		conditions = append(conditions, "ts.server_id = ?")
+		args = append(args, *filter.ServerID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "ts.status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.IPAddress != "" {
+		conditions = append(conditions, "ts.ip_address = ?")
+		args = append(args, filter.IPAddress)
+	}
+	if filter.TicketID != "" {
+		conditions = append(conditions, "ts.ticket_id = ?")
+		args = append(args, filter.TicketID)
+	}
+	if filter.Search != "" {
+		conditions = append(conditions, `(ts.reason LIKE ? ESCAPE '\' OR ts.ticket_id LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.StartTime != nil {
+		conditions = append(conditions, "ts.start_time >= ?")
+		args = append(args, filter.StartTime.UTC())
+	}
+	if filter.EndTime != nil {
+		conditions = append(conditions, "ts.start_time <= ?")
+		args = append(args, filter.EndTime.UTC())
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM terminal_sessions ts"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count terminal sessions: %w", err)
+	}
+
+	query := `
+		SELECT ts.id, ts.session_id, ts.user_id, ts.server_id, ts.start_time, ts.end_time, COALESCE(ts.duration, 0),
+		       ts.command_count, COALESCE(ts.ip_address, ''), ts.status, COALESCE(ts.reason, ''), COALESCE(ts.ticket_id, ''),
+		       ts.created_at, ts.updated_at, COALESCE(u.username, ''), COALESCE(srv.name, '')
+		FROM terminal_sessions ts
+		LEFT JOIN users u ON ts.user_id = u.id
+		LEFT JOIN servers srv ON ts.server_id = srv.id` + where +
+		orderClause(terminalSessionSortColumns, filter.SortBy, filter.SortOrder, "ts.start_time", "ts.id") +
+		" LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query terminal sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.TerminalSession{}
+	for rows.Next() {
+		session := &models.TerminalSession{}
 		err := rows.Scan(
-			&log.ID, &log.UserID, &log.Action, &log.ResourceType, &log.ResourceID,
-			&log.Details, &log.IPAddress, &log.UserAgent, &log.Success,
-			&log.CreatedAt,
+			&session.ID, &session.SessionID, &session.UserID, &session.ServerID,
+			&session.StartTime, &session.EndTime, &session.Duration, &session.CommandCount,
+			&session.IPAddress, &session.Status, &session.Reason, &session.TicketID, &session.CreatedAt, &session.UpdatedAt,
+			&session.Username, &session.ServerName,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan audit log: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan terminal session: %w", err)
 		}
-		logs = append(logs, log)
+		sessions = append(sessions, session)
 	}
 
-	return logs, nil
+	return sessions, total, rows.Err()
 }
 
 // GetSecurityAlerts 获取安全告警列表
@@ -321,6 +763,37 @@ func (s *AuditService) GetSecurityAlerts(ctx context.Context, resolved *bool, li
 	return alerts, nil
 }
 
+// GetSecurityAlert 获取单条安全告警，不存在时返回 sql.ErrNoRows
+func (s *AuditService) GetSecurityAlert(ctx context.Context, id int) (*models.SecurityAlert, error) {
+	alert := &models.SecurityAlert{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, user_id, server_id, alert_type, severity, description, details,
+		       ip_address, session_id, resolved, resolved_by, resolved_at, created_at
+		FROM security_alerts WHERE id = ?
+	`, id).Scan(
+		&alert.ID, &alert.UserID, &alert.ServerID, &alert.AlertType, &alert.Severity,
+		&alert.Description, &alert.Details, &alert.IPAddress, &alert.SessionID,
+		&alert.Resolved, &alert.ResolvedBy, &alert.ResolvedAt, &alert.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// ResolveSecurityAlert 将告警标记为已解决，记录解决人和时间
+// 告警不存在时返回 sql.ErrNoRows，已解决的告警保持原解决人和时间不变
+func (s *AuditService) ResolveSecurityAlert(ctx context.Context, id, userID int) (*models.SecurityAlert, error) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE security_alerts SET resolved = TRUE, resolved_by = ?, resolved_at = ?
+		WHERE id = ? AND resolved = FALSE
+	`, userID, time.Now().UTC(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve security alert: %w", err)
+	}
+	return s.GetSecurityAlert(ctx, id)
+}
+
 // GetAuditStatistics 获取审计统计信息
 func (s *AuditService) GetAuditStatistics(ctx context.Context) (*models.AuditStatistics, error) {
 	stats := &models.AuditStatistics{}
@@ -365,11 +838,3 @@ func (s *AuditService) GetAuditStatistics(ctx context.Context) (*models.AuditSta
 
 	return stats, nil
 }
-
-
-
-
-
-
-
-
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+)
+
+func TestResolveSecurityAlert(t *testing.T) {
+	db := openTestDB(t)
+	s := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(s.Close)
+	ctx := context.Background()
+
+	alert := &models.SecurityAlert{AlertType: "suspicious_command", Severity: "high", Description: "rm -rf /"}
+	if err := s.CreateSecurityAlert(ctx, alert); err != nil {
+		t.Fatalf("create alert: %v", err)
+	}
+
+	resolved, err := s.ResolveSecurityAlert(ctx, alert.ID, 1)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if !resolved.Resolved || resolved.ResolvedBy == nil || *resolved.ResolvedBy != 1 || resolved.ResolvedAt == nil {
+		t.Fatalf("resolved alert = %+v", resolved)
+	}
+
+	// 再次解决不改变原解决人
+	again, err := s.ResolveSecurityAlert(ctx, alert.ID, 2)
+	if err != nil || *again.ResolvedBy != 1 || !again.ResolvedAt.Equal(*resolved.ResolvedAt) {
+		t.Fatalf("second resolve = %+v, err = %v", again, err)
+	}
+
+	if _, err := s.ResolveSecurityAlert(ctx, alert.ID+100, 1); err != sql.ErrNoRows {
+		t.Fatalf("unknown alert err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestListTerminalSessionsSearchTreatsWildcardsLiterally(t *testing.T) {
+	db := openTestDB(t)
+	s := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(s.Close)
+	ctx := context.Background()
+
+	for id, justification := range map[string]models.SessionJustification{
+		"s1": {Reason: "rollout 100% done"},
+		"s2": {Reason: "rollout 1000 done"},
+		"s3": {Reason: "fix", TicketID: "OPS_1"},
+		"s4": {Reason: "fix", TicketID: "OPSX1"},
+	} {
+		if err := s.CreateTerminalSession(ctx, id, 1, 1, "10.0.0.1", justification); err != nil {
+			t.Fatalf("create session %s: %v", id, err)
+		}
+	}
+
+	tests := []struct {
+		search string
+		want   string
+	}{
+		{"100%", "s1"},
+		{"OPS_", "s3"},
+	}
+	for _, tt := range tests {
+		sessions, total, err := s.ListTerminalSessions(ctx, &models.TerminalSessionFilter{Search: tt.search, Limit: 10})
+		if err != nil {
+			t.Fatalf("search %q: %v", tt.search, err)
+		}
+		if total != 1 || len(sessions) != 1 || sessions[0].SessionID != tt.want {
+			t.Errorf("search %q: total %d, sessions %+v, want only %s", tt.search, total, sessions, tt.want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// 审计事件类型
+const (
+	AuditEventAuditLog      = "audit_log"
+	AuditEventSessionStart  = "session_start"
+	AuditEventSessionEnd    = "session_end"
+	AuditEventCommand       = "command"
+	AuditEventSecurityAlert = "security_alert"
+)
+
+// AuditEvent 镜像到外部 SIEM 的审计事件
+type AuditEvent struct {
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	Severity   string                 `json:"severity"` // info, low, medium, high, critical
+	Action     string                 `json:"action"`
+	Success    bool                   `json:"success"`
+	UserID     int                    `json:"user_id,omitempty"`
+	ServerID   int                    `json:"server_id,omitempty"`
+	SessionID  string                 `json:"session_id,omitempty"`
+	IPAddress  string                 `json:"ip_address,omitempty"`
+	ResourceID string                 `json:"resource_id,omitempty"`
+	Message    string                 `json:"message"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+// AuditSink 审计事件输出端
+type AuditSink interface {
+	Name() string
+	Send(event *AuditEvent) error
+	Close() error
+}
+
+const (
+	sinkMaxAttempts = 5
+	sinkMaxBackoff  = 30 * time.Second
+)
+
+// sinkWorker 单个输出端的缓冲队列和投递协程，输出端故障时只会丢弃新事件，不会阻塞调用方
+type sinkWorker struct {
+	sink    AuditSink
+	queue   chan *AuditEvent
+	dropped int64
+	done    chan struct{}
+}
+
+func newSinkWorker(sink AuditSink, buffer int) *sinkWorker {
+	w := &sinkWorker{
+		sink:  sink,
+		queue: make(chan *AuditEvent, buffer),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// enqueue 非阻塞入队，队列满时丢弃并计数
+func (w *sinkWorker) enqueue(event *AuditEvent) {
+	select {
+	case w.queue <- event:
+	default:
+		if n := atomic.AddInt64(&w.dropped, 1); n == 1 || n%100 == 0 {
+			log.Printf("Audit sink %s queue full, dropped %d events", w.sink.Name(), n)
+		}
+	}
+}
+
+// run 投递循环，失败时指数退避重试
+func (w *sinkWorker) run() {
+	defer close(w.done)
+	for event := range w.queue {
+		backoff := time.Second
+		for attempt := 1; ; attempt++ {
+			err := w.sink.Send(event)
+			if err == nil {
+				break
+			}
+			if attempt >= sinkMaxAttempts {
+				atomic.AddInt64(&w.dropped, 1)
+				log.Printf("Audit sink %s giving up on %s event after %d attempts: %v", w.sink.Name(), event.Type, attempt, err)
+				break
+			}
+			log.Printf("Audit sink %s send failed (attempt %d): %v", w.sink.Name(), attempt, err)
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > sinkMaxBackoff {
+				backoff = sinkMaxBackoff
+			}
+		}
+	}
+}
+
+// close 停止接收事件，等待队列排空（最多 timeout）后关闭输出端
+func (w *sinkWorker) close(timeout time.Duration) {
+	close(w.queue)
+	select {
+	case <-w.done:
+	case <-time.After(timeout):
+		log.Printf("Audit sink %s did not drain within %v", w.sink.Name(), timeout)
+	}
+	if err := w.sink.Close(); err != nil {
+		log.Printf("Failed to close audit sink %s: %v", w.sink.Name(), err)
+	}
+}
+
+// auditSinks 审计事件分发器
+type auditSinks struct {
+	buffer  int
+	mutex   sync.RWMutex
+	workers []*sinkWorker
+	closed  bool
+}
+
+// add 注册输出端
+func (d *auditSinks) add(sink AuditSink) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closed {
+		return
+	}
+	d.workers = append(d.workers, newSinkWorker(sink, d.buffer))
+	log.Printf("Audit sink registered: %s", sink.Name())
+}
+
+// publish 将事件分发给所有输出端
+func (d *auditSinks) publish(event *AuditEvent) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, w := range d.workers {
+		w.enqueue(event)
+	}
+}
+
+// close 关闭所有输出端
+func (d *auditSinks) close() {
+	d.mutex.Lock()
+	d.closed = true
+	workers := d.workers
+	d.workers = nil
+	d.mutex.Unlock()
+
+	for _, w := range workers {
+		w.close(5 * time.Second)
+	}
+}
+
+// auditEventFromLog 由审计日志生成事件，终端启动/结束映射为会话事件
+func auditEventFromLog(entry *models.AuditLog) *AuditEvent {
+	eventType := AuditEventAuditLog
+	switch entry.Action {
+	case "terminal_start":
+		eventType = AuditEventSessionStart
+	case "terminal_end":
+		eventType = AuditEventSessionEnd
+	}
+
+	severity := "info"
+	if !entry.Success {
+		severity = "low"
+	}
+
+	event := &AuditEvent{
+		Type:       eventType,
+		Time:       entry.CreatedAt,
+		Severity:   severity,
+		Action:     entry.Action,
+		Success:    entry.Success,
+		UserID:     entry.UserID,
+		IPAddress:  entry.IPAddress,
+		ResourceID: entry.ResourceID,
+		Message:    fmt.Sprintf("%s %s %s", entry.Action, entry.ResourceType, entry.ResourceID),
+		Data: map[string]interface{}{
+			"audit_id":      entry.ID,
+			"resource_type": entry.ResourceType,
+			"user_agent":    entry.UserAgent,
+			"details":       entry.Details,
+			"hash":          entry.Hash,
+		},
+	}
+	if entry.ResourceType == "terminal_session" {
+		event.SessionID = entry.ResourceID
+	}
+	return event
+}
+
+// auditEventFromAlert 由安全告警生成事件
+func auditEventFromAlert(alert *models.SecurityAlert) *AuditEvent {
+	return &AuditEvent{
+		Type:      AuditEventSecurityAlert,
+		Time:      time.Now().UTC(),
+		Severity:  alert.Severity,
+		Action:    alert.AlertType,
+		Success:   false,
+		UserID:    alert.UserID,
+		ServerID:  alert.ServerID,
+		SessionID: alert.SessionID,
+		IPAddress: alert.IPAddress,
+		Message:   alert.Description,
+		Data: map[string]interface{}{
+			"alert_id": alert.ID,
+			"details":  alert.Details,
+		},
+	}
+}
+
+// syslogSeverity 将事件级别映射为 syslog 严重级别
+func syslogSeverity(severity string) int {
+	switch severity {
+	case "critical":
+		return 2 // crit
+	case "high":
+		return 3 // err
+	case "medium":
+		return 4 // warning
+	case "low":
+		return 5 // notice
+	}
+	return 6 // info
+}
+
+// cefSeverity 将事件级别映射为 CEF 严重级别 (0-10)
+func cefSeverity(severity string) int {
+	switch severity {
+	case "critical":
+		return 10
+	case "high":
+		return 8
+	case "medium":
+		return 5
+	case "low":
+		return 3
+	}
+	return 1
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// FormatCEF 将事件格式化为 ArcSight CEF 消息
+func FormatCEF(event *AuditEvent, hostname string) string {
+	ext := []string{
+		"rt=" + strconv.FormatInt(event.Time.UnixMilli(), 10),
+		"cat=" + cefExtensionEscaper.Replace(event.Type),
+		"act=" + cefExtensionEscaper.Replace(event.Action),
+		"outcome=" + map[bool]string{true: "success", false: "failure"}[event.Success],
+		"dvchost=" + cefExtensionEscaper.Replace(hostname),
+	}
+	if event.UserID != 0 {
+		ext = append(ext, "suid="+strconv.Itoa(event.UserID))
+	}
+	if event.IPAddress != "" {
+		ext = append(ext, "src="+cefExtensionEscaper.Replace(event.IPAddress))
+	}
+	if event.SessionID != "" {
+		ext = append(ext, "cs1Label=sessionId", "cs1="+cefExtensionEscaper.Replace(event.SessionID))
+	}
+	if event.ServerID != 0 {
+		ext = append(ext, "cs2Label=serverId", "cs2="+strconv.Itoa(event.ServerID))
+	}
+	if event.ResourceID != "" {
+		ext = append(ext, "cs3Label=resourceId", "cs3="+cefExtensionEscaper.Replace(event.ResourceID))
+	}
+	ext = append(ext, "msg="+cefExtensionEscaper.Replace(event.Message))
+
+	return fmt.Sprintf("CEF:0|very-jump|very-jump|1.0|%s|%s|%d|%s",
+		cefHeaderEscaper.Replace(event.Type+":"+event.Action),
+		cefHeaderEscaper.Replace(event.Message),
+		cefSeverity(event.Severity),
+		strings.Join(ext, " "))
+}
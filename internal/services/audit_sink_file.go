@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileSink 按大小轮转的 NDJSON 文件输出端
+type FileSink struct {
+	dir        string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	mutex      sync.Mutex
+}
+
+const fileSinkName = "audit.ndjson"
+
+// NewFileSink 创建 NDJSON 文件输出端
+func NewFileSink(dir string, maxSizeMB, maxBackups int) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	if maxSizeMB <= 0 {
+		maxSizeMB = 100
+	}
+	sink := &FileSink{
+		dir:        dir,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+	}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// Name 输出端名称
+func (s *FileSink) Name() string {
+	return "file(" + filepath.Join(s.dir, fileSinkName) + ")"
+}
+
+// Send 追加一行事件，超过大小上限时先轮转
+func (s *FileSink) Send(event *AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size+int64(len(line)) > s.maxSize && s.size > 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// open 以追加方式打开当前文件
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(filepath.Join(s.dir, fileSinkName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log file: %w", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// rotate 将当前文件重命名为带时间戳的备份并清理多余备份
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log file: %w", err)
+	}
+	s.file = nil
+
+	backup := filepath.Join(s.dir, fmt.Sprintf("audit-%s.ndjson", time.Now().Format("20060102-150405.000")))
+	if err := os.Rename(filepath.Join(s.dir, fileSinkName), backup); err != nil {
+		return fmt.Errorf("failed to rotate audit log file: %w", err)
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+	s.pruneBackups()
+	return nil
+}
+
+// pruneBackups 只保留最近的 maxBackups 个备份
+func (s *FileSink) pruneBackups() {
+	if s.maxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(s.dir, "audit-*.ndjson"))
+	if err != nil || len(matches) <= s.maxBackups {
+		return
+	}
+	// 文件名中的时间戳保证字典序即时间序
+	sort.Strings(matches)
+	for _, old := range matches[:len(matches)-s.maxBackups] {
+		if !strings.HasSuffix(old, ".ndjson") {
+			continue
+		}
+		os.Remove(old)
+	}
+}
+
+// Close 关闭文件
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
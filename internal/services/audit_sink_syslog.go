@@ -0,0 +1,191 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	syslogFacility    = 10 // authpriv
+	syslogAppName     = "very-jump"
+	syslogSDID        = "very-jump@32473"
+	syslogDialTimeout = 10 * time.Second
+)
+
+// syslogTimeFormat RFC 5424 时间戳最多 6 位小数
+const syslogTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+var syslogParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "]", `\]`)
+
+// SyslogSink RFC 5424 syslog 输出端，支持 UDP、TCP 和 TLS，消息体可为 JSON 或 CEF
+type SyslogSink struct {
+	network   string // udp, tcp, tls
+	addr      string
+	format    string // rfc5424, cef
+	tlsConfig *tls.Config
+	hostname  string
+	conn      net.Conn
+	mutex     sync.Mutex
+}
+
+// NewSyslogSink 创建 syslog 输出端，连接在首次发送时建立
+func NewSyslogSink(network, addr, format, caFile string) (*SyslogSink, error) {
+	switch network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported syslog network: %s", network)
+	}
+	switch format {
+	case "rfc5424", "cef":
+	default:
+		return nil, fmt.Errorf("unsupported syslog format: %s", format)
+	}
+
+	sink := &SyslogSink{
+		network: network,
+		addr:    addr,
+		format:  format,
+	}
+
+	if network == "tls" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address: %w", err)
+		}
+		sink.tlsConfig = &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+		if caFile != "" {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in syslog CA file %s", caFile)
+			}
+			sink.tlsConfig.RootCAs = pool
+		}
+	}
+
+	sink.hostname, _ = os.Hostname()
+	if sink.hostname == "" {
+		sink.hostname = "-"
+	}
+	return sink, nil
+}
+
+// Name 输出端名称
+func (s *SyslogSink) Name() string {
+	return fmt.Sprintf("syslog(%s://%s,%s)", s.network, s.addr, s.format)
+}
+
+// Send 发送事件，连接失败或写失败时关闭连接，下次发送重新建立
+func (s *SyslogSink) Send(event *AuditEvent) error {
+	msg, err := s.formatMessage(event)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return err
+		}
+	}
+
+	// TCP/TLS 使用 RFC 6587 octet-counting 分帧，UDP 每个数据报一条消息
+	frame := msg
+	if s.network != "udp" {
+		frame = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(syslogDialTimeout))
+	if _, err := s.conn.Write([]byte(frame)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to write syslog message: %w", err)
+	}
+	return nil
+}
+
+// connect 建立到 syslog 服务的连接
+func (s *SyslogSink) connect() error {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	} else {
+		conn, err = dialer.Dial(s.network, s.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog %s: %w", s.addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// formatMessage 生成 RFC 5424 消息
+func (s *SyslogSink) formatMessage(event *AuditEvent) (string, error) {
+	pri := syslogFacility*8 + syslogSeverity(event.Severity)
+
+	var body string
+	if s.format == "cef" {
+		body = FormatCEF(event, s.hostname)
+	} else {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal audit event: %w", err)
+		}
+		body = string(data)
+	}
+
+	params := []string{
+		fmt.Sprintf(`type="%s"`, syslogParamEscaper.Replace(event.Type)),
+		fmt.Sprintf(`action="%s"`, syslogParamEscaper.Replace(event.Action)),
+		fmt.Sprintf(`success="%t"`, event.Success),
+	}
+	if event.UserID != 0 {
+		params = append(params, fmt.Sprintf(`userId="%d"`, event.UserID))
+	}
+	if event.SessionID != "" {
+		params = append(params, fmt.Sprintf(`sessionId="%s"`, syslogParamEscaper.Replace(event.SessionID)))
+	}
+	if event.IPAddress != "" {
+		params = append(params, fmt.Sprintf(`src="%s"`, syslogParamEscaper.Replace(event.IPAddress)))
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s [%s %s] %s",
+		pri,
+		event.Time.UTC().Format(syslogTimeFormat),
+		s.hostname,
+		syslogAppName,
+		os.Getpid(),
+		event.Type,
+		syslogSDID,
+		strings.Join(params, " "),
+		body,
+	), nil
+}
+
+// Close 关闭连接
+func (s *SyslogSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"very-jump/internal/database/models"
+)
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+	// ErrAuthProviderUnavailable 外部身份源无法访问
+	ErrAuthProviderUnavailable = errors.New("身份认证服务暂不可用，请稍后重试")
+	// ErrExternalPassword 外部身份源管理的账号不能在本系统修改密码
+	ErrExternalPassword = errors.New("该账号由外部身份源管理，请在身份源修改密码")
+)
+
+// ExternalIdentity 外部身份源认证通过的用户信息
+type ExternalIdentity struct {
+	Username string   // 本地用户名
+	Role     string   // 由组映射得到的角色
+	Groups   []string // 用户所属组，用于审计和排查
+}
+
+// AuthProvider 用户名密码登录的外部身份源
+// 用户不存在、密码错误或不允许登录时返回 ErrInvalidCredentials，其他错误视为身份源不可用
+type AuthProvider interface {
+	// Name 身份源名称，同时作为本地用户的 auth_source
+	Name() string
+	// Provision 首次登录时是否自动创建本地用户
+	Provision() bool
+	Authenticate(username, password string) (*ExternalIdentity, error)
+}
+
+// RegisterProvider 注册外部身份源，按注册顺序尝试
+func (s *AuthService) RegisterProvider(provider AuthProvider) {
+	s.providers = append(s.providers, provider)
+}
+
+// authenticate 校验用户名密码，返回对应的本地用户
+// 本地账号始终使用本地密码，外部身份源不可用时仍可用于应急登录；
+// 其余用户依次交给外部身份源认证，首次登录时按需创建本地用户
+func (s *AuthService) authenticate(username, password string) (*models.User, error) {
+	user, err := s.userService.GetByUsername(username)
+	if err == nil && user.AuthSource == models.AuthSourceLocal {
+		// 服务账号只能使用 API 令牌
+		if user.AccountType == models.AccountTypeService || !user.ValidatePassword(password) {
+			return nil, ErrInvalidCredentials
+		}
+		return user, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	unavailable := false
+	for _, provider := range s.providers {
+		if user != nil && user.AuthSource != provider.Name() {
+			continue
+		}
+		identity, err := provider.Authenticate(username, password)
+		if err == ErrInvalidCredentials {
+			continue
+		}
+		if err != nil {
+			log.Printf("Auth provider %s failed for %s: %v", provider.Name(), username, err)
+			unavailable = true
+			continue
+		}
+		return s.syncExternalUser(provider.Name(), provider.Provision(), identity)
+	}
+
+	if unavailable {
+		return nil, ErrAuthProviderUnavailable
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// LoginExternal 为已由外部身份源（如 OIDC）认证的身份创建登录会话，签发与密码登录相同的令牌
+func (s *AuthService) LoginExternal(source string, provision bool, identity *ExternalIdentity, ipAddress, userAgent string) (*LoginResponse, error) {
+	user, err := s.syncExternalUser(source, provision, identity)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserActive(user); err != nil {
+		return nil, err
+	}
+	return s.startSession(user, ipAddress, userAgent)
+}
+
+// syncExternalUser 将外部身份映射到本地用户：不存在时创建，角色与组映射不一致时更新
+func (s *AuthService) syncExternalUser(source string, provision bool, identity *ExternalIdentity) (*models.User, error) {
+	user, err := s.userService.GetByUsername(identity.Username)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		}
+		if !provision {
+			return nil, ErrInvalidCredentials
+		}
+		user, err = s.userService.CreateExternalUser(identity.Username, identity.Role, source)
+		if err != nil {
+			return nil, fmt.Errorf("创建用户失败: %v", err)
+		}
+		log.Printf("Provisioned user %s from %s with role %s", user.Username, source, user.Role)
+		return user, nil
+	}
+
+	// 同名的本地账号或其他身份源的账号不能被接管
+	if user.AuthSource != source {
+		log.Printf("Refusing %s login for %s: account uses auth source %s", source, identity.Username, user.AuthSource)
+		return nil, ErrInvalidCredentials
+	}
+	if identity.Role != "" && identity.Role != user.Role {
+		if err := s.userService.SetRole(user.ID, identity.Role); err != nil {
+			return nil, err
+		}
+		log.Printf("Updated role of %s from %s to %s based on %s groups", user.Username, user.Role, identity.Role, source)
+		return s.userService.GetByID(user.ID)
+	}
+	return user, nil
+}
@@ -1,8 +1,13 @@
 package services
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
 	"time"
 
 	"very-jump/internal/config"
@@ -12,17 +17,54 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var (
+	// ErrInvalidRefreshToken 刷新令牌无效或已过期
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期")
+	// ErrRefreshTokenReused 已轮换的刷新令牌被再次使用，所在会话已被撤销
+	ErrRefreshTokenReused = errors.New("刷新令牌已被使用，会话已撤销")
+	// ErrTokenRevoked 访问令牌已被撤销
+	ErrTokenRevoked = errors.New("令牌已被撤销")
+	// ErrUserDisabled 账号已停用
+	ErrUserDisabled = errors.New("账号已停用")
+	// ErrUserLocked 账号已被管理员锁定
+	ErrUserLocked = errors.New("账号已锁定")
+	// ErrUserExpired 账号已过期
+	ErrUserExpired = errors.New("账号已过期")
+	// ErrWrongPassword 当前密码错误
+	ErrWrongPassword = errors.New("当前密码错误")
+	// ErrInvalidAPIToken API 令牌无效、已过期或已撤销
+	ErrInvalidAPIToken = errors.New("API 令牌无效或已过期")
+)
+
+// apiTokenUsageInterval 同一来源IP的令牌使用记录最短更新间隔，避免每个请求都写库
+const apiTokenUsageInterval = time.Minute
+
 // AuthService 认证服务
 type AuthService struct {
-	cfg         *config.Config
-	userService *models.UserService
+	cfg            *config.Config
+	userService    *models.UserService
+	sessionService *models.AuthSessionService
+	tokenService   *models.APITokenService
+	roleService    *models.RoleService
+	totpService    *models.TOTPService
+	passwordPolicy PasswordPolicy
+	providers      []AuthProvider // 外部身份源，按注册顺序尝试
 }
 
 // NewAuthService 创建认证服务
 func NewAuthService(cfg *config.Config, db *sql.DB) *AuthService {
 	return &AuthService{
-		cfg:         cfg,
-		userService: models.NewUserService(db),
+		cfg:            cfg,
+		userService:    models.NewUserService(db),
+		sessionService: models.NewAuthSessionService(db),
+		tokenService:   models.NewAPITokenService(db),
+		roleService:    models.NewRoleService(db),
+		totpService:    models.NewTOTPService(db),
+		passwordPolicy: PasswordPolicy{
+			MinLength:  cfg.PasswordMinLength,
+			MinClasses: cfg.PasswordMinClasses,
+			History:    cfg.PasswordHistory,
+		},
 	}
 }
 
@@ -32,36 +74,291 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 // LoginResponse 登录响应
 type LoginResponse struct {
-	Token     string       `json:"token"`
-	User      *models.User `json:"user"`
-	ExpiresAt time.Time    `json:"expires_at"`
+	Token            string       `json:"token"`
+	RefreshToken     string       `json:"refresh_token"`
+	User             *models.User `json:"user"`
+	ExpiresAt        time.Time    `json:"expires_at"`
+	RefreshExpiresAt time.Time    `json:"refresh_expires_at"`
+	SessionID        string       `json:"session_id"`
 }
 
-// Login 用户登录
-func (s *AuthService) Login(req *LoginRequest) (*LoginResponse, error) {
-	user, err := s.userService.GetByUsername(req.Username)
+// Login 用户登录，创建登录会话并签发访问令牌和刷新令牌
+func (s *AuthService) Login(req *LoginRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	user, err := s.authenticate(req.Username, req.Password)
+	if err != nil {
+		return nil, err
+	}
+	// 密码正确后才提示账号状态，避免泄露账号是否存在
+	if err := checkUserActive(user); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user, ipAddress, userAgent)
+}
+
+// startSession 创建登录会话并签发令牌
+func (s *AuthService) startSession(user *models.User, ipAddress, userAgent string) (*LoginResponse, error) {
+	sessionID, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	session := &models.AuthSession{
+		ID:           sessionID,
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		IPAddress:    ipAddress,
+		UserAgent:    userAgent,
+		ExpiresAt:    time.Now().Add(s.cfg.RefreshTokenExpiry),
+	}
+	if err := s.sessionService.Create(session); err != nil {
+		return nil, err
+	}
+
+	if err := s.sessionService.DeleteExpiredRefreshTokens(); err != nil {
+		log.Printf("Failed to delete expired refresh tokens: %v", err)
+	}
+	if err := s.userService.RecordLogin(user.ID, ipAddress); err != nil {
+		log.Printf("Failed to record last login for user %d: %v", user.ID, err)
+	}
+	now := time.Now().UTC()
+	user.LastLoginAt = &now
+	user.LastLoginIP = ipAddress
+
+	return s.issueTokens(user, session)
+}
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 用户修改自己的密码
+// 校验当前密码和密码策略，修改后撤销该用户全部登录会话，并为当前客户端签发新的令牌
+func (s *AuthService) ChangePassword(userID int, req *ChangePasswordRequest, ipAddress, userAgent string) (*LoginResponse, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.AuthSource != models.AuthSourceLocal {
+		return nil, ErrExternalPassword
+	}
+	if !user.ValidatePassword(req.CurrentPassword) {
+		return nil, ErrWrongPassword
+	}
+	if err := s.passwordPolicy.Validate(req.NewPassword, user.Username); err != nil {
+		return nil, err
+	}
+	if s.passwordPolicy.History > 0 {
+		history, err := s.userService.PasswordHistory(userID, s.passwordPolicy.History-1)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.passwordPolicy.CheckReuse(req.NewPassword, append([]string{user.PasswordHash}, history...)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.userService.ChangePassword(userID, req.NewPassword); err != nil {
+		return nil, err
+	}
+
+	user, err = s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(user, ipAddress, userAgent)
+}
+
+// PasswordPolicy 获取密码策略
+func (s *AuthService) PasswordPolicy() PasswordPolicy {
+	return s.passwordPolicy
+}
+
+// Refresh 轮换刷新令牌并签发新的访问令牌
+// 已使用过的刷新令牌再次出现说明令牌可能被盗用，此时撤销整个会话并返回 ErrRefreshTokenReused
+func (s *AuthService) Refresh(refreshToken, ipAddress, userAgent string) (*LoginResponse, error) {
+	record, err := s.sessionService.GetRefreshToken(hashToken(refreshToken))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("用户名或密码错误")
+			return nil, ErrInvalidRefreshToken
 		}
 		return nil, err
 	}
 
-	if !user.ValidatePassword(req.Password) {
-		return nil, errors.New("用户名或密码错误")
+	if record.UsedAt != nil {
+		s.revokeReusedSession(record.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessionService.GetByID(record.SessionID)
+	if err != nil || !session.Active() {
+		return nil, ErrInvalidRefreshToken
+	}
+	user, err := s.userService.GetByID(session.UserID)
+	if err != nil || user.TokenVersion != session.TokenVersion {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err := checkUserActive(user); err != nil {
+		return nil, err
+	}
+
+	// 并发刷新时只有一个请求能标记成功，另一个按重放处理
+	marked, err := s.sessionService.MarkRefreshTokenUsed(record.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		s.revokeReusedSession(record.SessionID)
+		return nil, ErrRefreshTokenReused
+	}
+
+	session.IPAddress = ipAddress
+	session.UserAgent = userAgent
+	session.ExpiresAt = time.Now().Add(s.cfg.RefreshTokenExpiry)
+	if err := s.sessionService.Touch(session.ID, ipAddress, userAgent, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(user, session)
+}
+
+// revokeReusedSession 刷新令牌重放时撤销会话
+func (s *AuthService) revokeReusedSession(sessionID string) {
+	if err := s.sessionService.Revoke(sessionID, "refresh_token_reuse"); err != nil {
+		log.Printf("Failed to revoke session %s after refresh token reuse: %v", sessionID, err)
 	}
+}
 
-	// 生成 JWT Token
-	expiresAt := time.Now().Add(s.cfg.JWTExpiry)
+// Logout 撤销登录会话，会话下的访问令牌和刷新令牌随之失效
+func (s *AuthService) Logout(sessionID string) error {
+	if sessionID == "" {
+		return nil
+	}
+	return s.sessionService.Revoke(sessionID, "logout")
+}
+
+// SignOutEverywhere 撤销用户的全部令牌和登录会话，返回被撤销的会话数
+func (s *AuthService) SignOutEverywhere(userID int, reason string) (int, error) {
+	return s.userService.BumpTokenVersion(userID, reason)
+}
+
+// ValidateClaims 校验访问令牌对应的用户、令牌版本和登录会话仍然有效
+func (s *AuthService) ValidateClaims(claims *middleware.Claims) error {
+	if claims.SessionID == "" {
+		return ErrTokenRevoked
+	}
+	state, err := s.sessionService.GetTokenState(claims.UserID, claims.SessionID)
+	if err != nil {
+		return ErrTokenRevoked
+	}
+	if state.TokenVersion != claims.TokenVersion || state.Role != claims.Role || !state.SessionValid || !state.UserActive {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// RolePermissions 获取角色的权限，每个请求实时查询，角色权限修改后立即生效
+func (s *AuthService) RolePermissions(role string) ([]string, error) {
+	return s.roleService.Permissions(role)
+}
+
+// SessionActive 登录会话是否仍然有效，供终端票据等派生凭证校验
+func (s *AuthService) SessionActive(userID int, sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	state, err := s.sessionService.GetTokenState(userID, sessionID)
+	return err == nil && state.SessionValid && state.UserActive
+}
+
+// CreateAPIToken 为用户创建 API 令牌，明文令牌只在创建时返回一次
+func (s *AuthService) CreateAPIToken(userID, createdBy int, req *models.APITokenCreate) (string, *models.APIToken, error) {
+	if err := models.ValidateScopes(req.Scopes); err != nil {
+		return "", nil, err
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return "", nil, errors.New("过期时间必须晚于当前时间")
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := middleware.APITokenPrefix + secret
+
+	token := &models.APIToken{
+		UserID:      userID,
+		Name:        req.Name,
+		TokenPrefix: plaintext[:len(middleware.APITokenPrefix)+6],
+		TokenHash:   hashToken(plaintext),
+		Scopes:      req.Scopes,
+		ExpiresAt:   req.ExpiresAt,
+		CreatedBy:   createdBy,
+	}
+	if err := s.tokenService.Create(token); err != nil {
+		return "", nil, err
+	}
+
+	created, err := s.tokenService.GetByID(token.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	return plaintext, created, nil
+}
+
+// AuthenticateAPIToken 校验 API 令牌并记录使用情况，角色取用户当前角色
+func (s *AuthService) AuthenticateAPIToken(plaintext, ipAddress string) (*middleware.APITokenIdentity, error) {
+	token, err := s.tokenService.GetByHash(hashToken(plaintext))
+	if err != nil || !token.Active() || !token.UserActive {
+		return nil, ErrInvalidAPIToken
+	}
+
+	if token.LastUsedAt == nil || token.LastUsedIP != ipAddress || time.Since(*token.LastUsedAt) > apiTokenUsageInterval {
+		if err := s.tokenService.RecordUsage(token.ID, ipAddress); err != nil {
+			log.Printf("Failed to record usage of API token %d: %v", token.ID, err)
+		}
+	}
+
+	return &middleware.APITokenIdentity{
+		TokenID:   token.ID,
+		TokenName: token.Name,
+		UserID:    token.UserID,
+		Username:  token.Username,
+		Role:      token.UserRole,
+		Scopes:    token.Scopes,
+	}, nil
+}
+
+// issueTokens 签发访问令牌和新的刷新令牌
+func (s *AuthService) issueTokens(user *models.User, session *models.AuthSession) (*LoginResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.JWTExpiry)
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
 	claims := &middleware.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Role:     user.Role,
+		UserID:             user.ID,
+		Username:           user.Username,
+		Role:               user.Role,
+		SessionID:          session.ID,
+		TokenVersion:       user.TokenVersion,
+		MustChangePassword: user.MustChangePassword && user.AuthSource == models.AuthSourceLocal,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 			Issuer:    "very-jump",
 		},
 	}
@@ -72,10 +369,25 @@ func (s *AuthService) Login(req *LoginRequest) (*LoginResponse, error) {
 		return nil, err
 	}
 
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessionService.CreateRefreshToken(session.ID, hashToken(refreshToken), session.ExpiresAt); err != nil {
+		return nil, err
+	}
+	// 前端根据权限显示管理功能
+	if user.Permissions, err = s.roleService.Permissions(user.Role); err != nil {
+		return nil, err
+	}
+
 	return &LoginResponse{
-		Token:     tokenString,
-		User:      user,
-		ExpiresAt: expiresAt,
+		Token:            tokenString,
+		RefreshToken:     refreshToken,
+		User:             user,
+		ExpiresAt:        expiresAt,
+		RefreshExpiresAt: session.ExpiresAt,
+		SessionID:        session.ID,
 	}, nil
 }
 
@@ -83,3 +395,48 @@ func (s *AuthService) Login(req *LoginRequest) (*LoginResponse, error) {
 func (s *AuthService) GetUserService() *models.UserService {
 	return s.userService
 }
+
+// GetRoleService 获取角色服务
+func (s *AuthService) GetRoleService() *models.RoleService {
+	return s.roleService
+}
+
+// GetTokenService 获取 API 令牌服务
+func (s *AuthService) GetTokenService() *models.APITokenService {
+	return s.tokenService
+}
+
+// GetSessionService 获取登录会话服务
+func (s *AuthService) GetSessionService() *models.AuthSessionService {
+	return s.sessionService
+}
+
+// checkUserActive 检查账号状态和有效期
+func checkUserActive(user *models.User) error {
+	switch {
+	case user.Status == models.UserStatusDisabled:
+		return ErrUserDisabled
+	case user.Status == models.UserStatusLocked:
+		return ErrUserLocked
+	case user.Status != models.UserStatusActive:
+		return ErrUserDisabled
+	case user.Expired():
+		return ErrUserExpired
+	}
+	return nil
+}
+
+// randomToken 生成 URL 安全的随机令牌
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 令牌只以 SHA-256 哈希形式入库
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+var (
+	// ErrBreakGlassAlreadyActive 用户已有生效中的紧急访问
+	ErrBreakGlassAlreadyActive = errors.New("已有生效中的紧急访问")
+	// ErrBreakGlassNotActive 紧急访问已结束
+	ErrBreakGlassNotActive = errors.New("紧急访问已结束")
+	// ErrBreakGlassStillActive 紧急访问结束后才能复核
+	ErrBreakGlassStillActive = errors.New("紧急访问结束后才能复核")
+	// ErrBreakGlassSelfReview 不能复核自己发起的紧急访问
+	ErrBreakGlassSelfReview = errors.New("不能复核自己发起的紧急访问")
+	// ErrBreakGlassReviewed 紧急访问已复核
+	ErrBreakGlassReviewed = errors.New("紧急访问已复核")
+)
+
+// BreakGlassLimits 紧急访问的全局设置
+type BreakGlassLimits struct {
+	Duration      time.Duration // 每次紧急访问的固定时长
+	CheckInterval time.Duration // 检查紧急访问到期的间隔
+}
+
+// BreakGlassManager 紧急访问流程：发起时向全部通知渠道发送严重告警，到期收回并终止失去权限的终端会话，结束后等待事后复核
+type BreakGlassManager struct {
+	activationService *models.BreakGlassService
+	sessionService    *models.SessionService
+	serverService     *models.ServerService
+	userService       *models.UserService
+	roleService       *models.RoleService
+	ttydService       *TTYDService
+	auditService      *AuditService
+	limits            BreakGlassLimits
+
+	stopChan  chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mutex     sync.Mutex
+}
+
+// NewBreakGlassManager 创建紧急访问流程服务
+func NewBreakGlassManager(activationService *models.BreakGlassService, sessionService *models.SessionService,
+	serverService *models.ServerService, userService *models.UserService, roleService *models.RoleService,
+	ttydService *TTYDService, auditService *AuditService, limits BreakGlassLimits) *BreakGlassManager {
+	return &BreakGlassManager{
+		activationService: activationService,
+		sessionService:    sessionService,
+		serverService:     serverService,
+		userService:       userService,
+		roleService:       roleService,
+		ttydService:       ttydService,
+		auditService:      auditService,
+		limits:            limits,
+		stopChan:          make(chan struct{}),
+	}
+}
+
+// GetActivationService 获取紧急访问数据服务
+func (m *BreakGlassManager) GetActivationService() *models.BreakGlassService {
+	return m.activationService
+}
+
+// Active 获取用户当前生效中的紧急访问，没有时返回 nil
+func (m *BreakGlassManager) Active(userID int) (*models.BreakGlassActivation, error) {
+	activation, err := m.activationService.Active(userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return activation, err
+}
+
+// Get 获取紧急访问及其期间建立的终端会话
+func (m *BreakGlassManager) Get(id int) (*models.BreakGlassActivation, error) {
+	activation, err := m.activationService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if activation.Sessions, err = m.sessionService.ListByBreakGlass(id); err != nil {
+		return nil, err
+	}
+	return activation, nil
+}
+
+// Activate 发起紧急访问，在固定时长内可以连接任意服务器，并立即向全部通知渠道发送严重告警
+func (m *BreakGlassManager) Activate(userID int, justification, ipAddress string) (*models.BreakGlassActivation, error) {
+	active, err := m.Active(userID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, ErrBreakGlassAlreadyActive
+	}
+	// 已到期但尚未被定时任务结束的记录仍占用唯一索引，先结束
+	m.ExpireDue()
+
+	activation, err := m.activationService.Create(userID, justification, ipAddress, m.limits.Duration)
+	if err != nil {
+		// 并发发起时由唯一索引保证只有一方成功
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return nil, ErrBreakGlassAlreadyActive
+		}
+		return nil, err
+	}
+
+	m.logAction(userID, "break-glass_activate", activation, ipAddress, map[string]interface{}{
+		"justification": activation.Justification,
+		"expires_at":    activation.ExpiresAt,
+	})
+	m.alert(activation, "break_glass_activated", "critical", ipAddress, true,
+		fmt.Sprintf("%s 发起紧急访问 #%d，%d 分钟内可以连接任意服务器，所有会话强制录制：%s",
+			activation.Username, activation.ID, int(m.limits.Duration/time.Minute), activation.Justification))
+	return activation, nil
+}
+
+// End 提前结束紧急访问（本人结束或管理员收回），终止失去权限的终端会话
+func (m *BreakGlassManager) End(id, endedBy int, reason, ipAddress string) (*models.BreakGlassActivation, error) {
+	activation, err := m.activationService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	ended, err := m.activationService.End(id, models.BreakGlassEnded, &endedBy, reason)
+	if err != nil {
+		return nil, err
+	}
+	if !ended {
+		return nil, ErrBreakGlassNotActive
+	}
+
+	stopped := terminateUnauthorizedSessions(m.ttydService, m.serverService, m.userService, m.roleService, activation.UserID, "break_glass_ended")
+	if activation, err = m.activationService.GetByID(id); err != nil {
+		return nil, err
+	}
+	// 管理员收回由管理接口的审计中间件记录
+	if endedBy == activation.UserID {
+		m.logAction(endedBy, "break-glass_end", activation, ipAddress, map[string]interface{}{
+			"reason":            reason,
+			"stopped_terminals": stopped,
+		})
+	}
+	m.alert(activation, "break_glass_ended", "high", ipAddress, false,
+		fmt.Sprintf("%s 的紧急访问 #%d 已结束，终止了 %d 个终端会话，等待事后复核", activation.Username, activation.ID, stopped))
+	return activation, nil
+}
+
+// SignOff 事后复核签字，紧急访问结束后由发起人以外的审批人完成
+func (m *BreakGlassManager) SignOff(id, reviewerID int, notes string) (*models.BreakGlassActivation, error) {
+	activation, err := m.activationService.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if activation.Status == models.BreakGlassActive {
+		return nil, ErrBreakGlassStillActive
+	}
+	if activation.UserID == reviewerID {
+		return nil, ErrBreakGlassSelfReview
+	}
+	signed, err := m.activationService.SignOff(id, reviewerID, notes)
+	if err != nil {
+		return nil, err
+	}
+	if !signed {
+		return nil, ErrBreakGlassReviewed
+	}
+
+	return m.Get(id)
+}
+
+// SessionStarted 紧急访问期间建立终端会话时发送通知，附带实时查看地址
+func (m *BreakGlassManager) SessionStarted(activation *models.BreakGlassActivation, process *TTYDProcess, ipAddress string) {
+	if m.auditService == nil {
+		return
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"break_glass_id": activation.ID,
+		"session_id":     process.SessionID,
+		"server_name":    process.ServerName,
+		"live_tail":      fmt.Sprintf("/api/v1/terminal/sessions/%s/live", process.SessionID),
+	})
+	m.auditService.Notify(&models.SecurityAlert{
+		UserID:      activation.UserID,
+		ServerID:    process.ServerID,
+		AlertType:   "break_glass_session",
+		Severity:    "high",
+		Description: fmt.Sprintf("%s 在紧急访问 #%d 期间连接了服务器 %s", activation.Username, activation.ID, process.ServerName),
+		Details:     string(details),
+		IPAddress:   ipAddress,
+		SessionID:   process.SessionID,
+	})
+}
+
+// Start 启动紧急访问到期检查
+func (m *BreakGlassManager) Start() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.isRunning {
+		return nil
+	}
+
+	m.isRunning = true
+	m.wg.Add(1)
+
+	go m.expireLoop()
+
+	log.Printf("Break-glass manager started - duration: %v, check interval: %v", m.limits.Duration, m.limits.CheckInterval)
+
+	return nil
+}
+
+// Stop 停止紧急访问到期检查
+func (m *BreakGlassManager) Stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if !m.isRunning {
+		return
+	}
+
+	m.isRunning = false
+	close(m.stopChan)
+	m.wg.Wait()
+
+	log.Printf("Break-glass manager stopped")
+}
+
+// expireLoop 检查循环
+func (m *BreakGlassManager) expireLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.limits.CheckInterval)
+	defer ticker.Stop()
+
+	// 启动时立即检查一次，收回停机期间到期的紧急访问
+	m.ExpireDue()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.ExpireDue()
+		}
+	}
+}
+
+// ExpireDue 结束到期的紧急访问，返回处理的数量
+func (m *BreakGlassManager) ExpireDue() int {
+	due, err := m.activationService.ListDue(time.Now())
+	if err != nil {
+		log.Printf("Failed to list due break-glass activations: %v", err)
+		return 0
+	}
+
+	expired := 0
+	for _, activation := range due {
+		ended, err := m.activationService.End(activation.ID, models.BreakGlassExpired, nil, "到期")
+		if err != nil {
+			log.Printf("Failed to expire break-glass activation %d: %v", activation.ID, err)
+			continue
+		}
+		if !ended {
+			continue
+		}
+		expired++
+
+		stopped := terminateUnauthorizedSessions(m.ttydService, m.serverService, m.userService, m.roleService, activation.UserID, "break_glass_expired")
+		activation.Status = models.BreakGlassExpired
+		m.logAction(0, "break-glass_expire", activation, "", map[string]interface{}{
+			"stopped_terminals": stopped,
+		})
+		m.alert(activation, "break_glass_expired", "high", "", false,
+			fmt.Sprintf("%s 的紧急访问 #%d 已到期，终止了 %d 个终端会话，等待事后复核", activation.Username, activation.ID, stopped))
+	}
+	return expired
+}
+
+// logAction 记录紧急访问审计日志，userID 为 0 表示系统操作
+func (m *BreakGlassManager) logAction(userID int, action string, activation *models.BreakGlassActivation, ipAddress string, extra map[string]interface{}) {
+	if m.auditService == nil {
+		return
+	}
+
+	details := map[string]interface{}{
+		"requester": activation.Username,
+		"status":    activation.Status,
+	}
+	for key, value := range extra {
+		details[key] = value
+	}
+	detailsJSON, _ := json.Marshal(details)
+
+	entry := &models.AuditLog{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: "break-glass",
+		ResourceID:   fmt.Sprintf("%d", activation.ID),
+		Details:      string(detailsJSON),
+		IPAddress:    ipAddress,
+		Success:      true,
+	}
+	if err := m.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log %s: %v", action, err)
+	}
+}
+
+// alert 保存安全告警，broadcast 为 true 时发送到全部通知渠道
+func (m *BreakGlassManager) alert(activation *models.BreakGlassActivation, alertType, severity, ipAddress string, broadcast bool, description string) {
+	if m.auditService == nil {
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"break_glass_id": activation.ID,
+		"justification":  activation.Justification,
+		"activated_at":   activation.ActivatedAt,
+		"expires_at":     activation.ExpiresAt,
+		"status":         activation.Status,
+	})
+	alert := &models.SecurityAlert{
+		UserID:      activation.UserID,
+		AlertType:   alertType,
+		Severity:    severity,
+		Description: description,
+		Details:     string(details),
+		IPAddress:   ipAddress,
+		Broadcast:   broadcast,
+	}
+	if err := m.auditService.CreateSecurityAlert(context.Background(), alert); err != nil {
+		log.Printf("Failed to create %s alert: %v", alertType, err)
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+func newTestBreakGlassManager(t *testing.T) (*BreakGlassManager, *models.BreakGlassService) {
+	t.Helper()
+	db := openTestDB(t)
+	mustExec(t, db, `INSERT INTO users (username, password_hash, role) VALUES ('oncall', 'x', 'user')`)
+	activations := models.NewBreakGlassService(db)
+	manager := NewBreakGlassManager(activations, models.NewSessionService(db), models.NewServerService(db),
+		models.NewUserService(db), models.NewRoleService(db), nil, nil, BreakGlassLimits{Duration: time.Hour})
+	return manager, activations
+}
+
+func TestBreakGlassActivateConcurrentlyAllowsOne(t *testing.T) {
+	manager, activations := newTestBreakGlassManager(t)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	succeeded, rejected := 0, 0
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// SQLite 写锁冲突时重试，最终每次发起要么成功要么因已有生效中的记录被拒绝
+			var err error
+			for attempt := 0; attempt < 100; attempt++ {
+				if _, err = manager.Activate(2, "database down", "10.0.0.1"); err == nil || !strings.Contains(err.Error(), "SQLITE_BUSY") {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch err {
+			case nil:
+				succeeded++
+			case ErrBreakGlassAlreadyActive:
+				rejected++
+			default:
+				t.Errorf("activate: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 1 || rejected != 7 {
+		t.Fatalf("succeeded = %d, rejected = %d, want exactly one activation", succeeded, rejected)
+	}
+	active, err := activations.List(models.BreakGlassFilter{UserID: 2, Status: models.BreakGlassActive})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(active) != 1 {
+		t.Fatalf("active activations = %d, want 1", len(active))
+	}
+}
+
+func TestBreakGlassActivateReplacesExpiredActiveRecord(t *testing.T) {
+	manager, activations := newTestBreakGlassManager(t)
+
+	// 已到期但尚未被定时任务结束
+	stale, err := activations.Create(2, "earlier incident", "10.0.0.1", -time.Minute)
+	if err != nil {
+		t.Fatalf("create stale activation: %v", err)
+	}
+	if _, err := activations.Create(2, "duplicate", "10.0.0.1", time.Hour); err == nil {
+		t.Fatal("second active activation for one user was inserted")
+	}
+
+	activation, err := manager.Activate(2, "database down", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("activate: %v", err)
+	}
+	if activation.Status != models.BreakGlassActive {
+		t.Errorf("status = %s", activation.Status)
+	}
+	if stale, _ = activations.GetByID(stale.ID); stale.Status != models.BreakGlassExpired {
+		t.Errorf("stale activation status = %s, want expired", stale.Status)
+	}
+}
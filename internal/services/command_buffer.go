@@ -0,0 +1,72 @@
+package services
+
+import "unicode/utf8"
+
+// maxCommandLength 单条命令最大长度，超出部分丢弃
+const maxCommandLength = 4096
+
+// CommandLineBuffer 从终端输入字节流中还原用户输入的命令行
+// 只处理退格、Ctrl-C/Ctrl-U 和 ANSI 转义序列，Tab 补全和历史命令无法还原，结果仅供审计参考
+type CommandLineBuffer struct {
+	line    []rune
+	pending []byte // 跨消息被截断的 UTF-8 字节
+	escape  int    // 0: 普通, 1: 收到 ESC, 2: CSI/SS3 序列中
+}
+
+// Feed 写入一段输入，返回其中已完成（回车结束）的命令
+func (b *CommandLineBuffer) Feed(data []byte) []string {
+	var commands []string
+
+	if len(b.pending) > 0 {
+		data = append(b.pending, data...)
+		b.pending = nil
+	}
+
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			b.pending = append([]byte(nil), data...)
+			break
+		}
+		data = data[size:]
+
+		switch b.escape {
+		case 1:
+			if r == '[' || r == 'O' {
+				b.escape = 2
+			} else {
+				b.escape = 0
+			}
+			continue
+		case 2:
+			if r >= 0x40 && r <= 0x7e {
+				b.escape = 0
+			}
+			continue
+		}
+
+		switch {
+		case r == '\r' || r == '\n':
+			if len(b.line) > 0 {
+				commands = append(commands, string(b.line))
+			}
+			b.line = b.line[:0]
+		case r == 0x7f || r == 0x08:
+			if len(b.line) > 0 {
+				b.line = b.line[:len(b.line)-1]
+			}
+		case r == 0x03 || r == 0x15:
+			b.line = b.line[:0]
+		case r == 0x1b:
+			b.escape = 1
+		case r < 0x20:
+			// 其他控制字符（Tab 等）忽略
+		default:
+			if len(b.line) < maxCommandLength {
+				b.line = append(b.line, r)
+			}
+		}
+	}
+
+	return commands
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// ErrInvalidPolicyExpression 策略表达式无法编译
+var ErrInvalidPolicyExpression = errors.New("策略表达式无效")
+
+// PolicyInput 连接策略的输入
+type PolicyInput struct {
+	User       *models.User
+	Groups     []string // 用户所属用户组名称
+	Server     *models.Server
+	SourceIP   string
+	Time       time.Time
+	Reason     string
+	TicketID   string
+	BreakGlass bool // 是否在紧急访问期间连接
+}
+
+// variables 按 policyVariables 的名称展开输入，时间按 loc 计算
+func (in *PolicyInput) variables(loc *time.Location) map[string]interface{} {
+	groups := make([]interface{}, 0, len(in.Groups))
+	for _, group := range in.Groups {
+		groups = append(groups, group)
+	}
+	tags := make([]interface{}, 0, len(in.Server.Tags))
+	for _, tag := range in.Server.Tags {
+		tags = append(tags, tag)
+	}
+	now := in.Time.In(loc)
+
+	return map[string]interface{}{
+		"user.id":             float64(in.User.ID),
+		"user.name":           in.User.Username,
+		"user.role":           in.User.Role,
+		"user.groups":         groups,
+		"user.account_type":   in.User.AccountType,
+		"user.auth_source":    in.User.AuthSource,
+		"source.ip":           in.SourceIP,
+		"time.hour":           float64(now.Hour()),
+		"time.minute":         float64(now.Minute()),
+		"time.weekday":        float64(now.Weekday()),
+		"server.id":           float64(in.Server.ID),
+		"server.name":         in.Server.Name,
+		"server.host":         in.Server.Host,
+		"server.tags":         tags,
+		"request.reason":      in.Reason,
+		"request.ticket":      in.TicketID,
+		"request.break_glass": in.BreakGlass,
+	}
+}
+
+// PolicyTrace 单条策略的求值结果，用于试运行
+type PolicyTrace struct {
+	PolicyID int    `json:"policy_id"`
+	Name     string `json:"name"`
+	Version  int    `json:"version"`
+	Mode     string `json:"mode"`
+	Effect   string `json:"effect"`
+	Matched  bool   `json:"matched"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ConnectPolicyEngine 连接策略：在角色、授权和连接要求检查通过后按表达式给出允许、拒绝或需要审批的决定。
+// 多条策略命中时 deny 优先，其次 require_approval，没有策略命中时允许；命中策略的附加要求合并后作用于会话。
+// 求值出错的生效策略按拒绝处理
+type ConnectPolicyEngine struct {
+	policyService  *models.ConnectPolicyService
+	userService    *models.UserService
+	groupService   *models.GroupService
+	requestService *models.AccessRequestService
+	auditService   *AuditService
+	location       *time.Location
+}
+
+// NewConnectPolicyEngine 创建连接策略服务，timezone 为空时使用系统时区
+func NewConnectPolicyEngine(policyService *models.ConnectPolicyService, userService *models.UserService, groupService *models.GroupService,
+	requestService *models.AccessRequestService, auditService *AuditService, timezone string) *ConnectPolicyEngine {
+	location := time.Local
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			log.Printf("Invalid POLICY_TIMEZONE %q, using system timezone: %v", timezone, err)
+		} else {
+			location = loc
+		}
+	}
+	return &ConnectPolicyEngine{
+		policyService:  policyService,
+		userService:    userService,
+		groupService:   groupService,
+		requestService: requestService,
+		auditService:   auditService,
+		location:       location,
+	}
+}
+
+// GetPolicyService 获取连接策略数据服务
+func (e *ConnectPolicyEngine) GetPolicyService() *models.ConnectPolicyService {
+	return e.policyService
+}
+
+// Validate 检查策略表达式能否编译
+func (e *ConnectPolicyEngine) Validate(expression string) error {
+	if _, err := CompilePolicyExpr(expression); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPolicyExpression, err)
+	}
+	return nil
+}
+
+// Create 检查表达式后创建连接策略
+func (e *ConnectPolicyEngine) Create(req *models.ConnectPolicyCreate, createdBy int) (*models.ConnectPolicy, error) {
+	if err := e.Validate(req.Expression); err != nil {
+		return nil, err
+	}
+	return e.policyService.Create(req, createdBy)
+}
+
+// Update 检查表达式后更新连接策略
+func (e *ConnectPolicyEngine) Update(id int, req *models.ConnectPolicyUpdate, updatedBy int) (*models.ConnectPolicy, error) {
+	if req.Expression != nil {
+		if err := e.Validate(*req.Expression); err != nil {
+			return nil, err
+		}
+	}
+	return e.policyService.Update(id, req, updatedBy)
+}
+
+// Input 组装连接策略的输入
+func (e *ConnectPolicyEngine) Input(userID int, server *models.Server, sourceIP string, at time.Time,
+	justification models.SessionJustification) (*PolicyInput, error) {
+	user, err := e.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := e.groupService.ListByUserID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Name)
+	}
+	return &PolicyInput{
+		User:       user,
+		Groups:     names,
+		Server:     server,
+		SourceIP:   sourceIP,
+		Time:       at,
+		Reason:     justification.Reason,
+		TicketID:   justification.TicketID,
+		BreakGlass: justification.BreakGlassID > 0,
+	}, nil
+}
+
+// Variables 输入展开后的表达式变量，用于试运行结果
+func (e *ConnectPolicyEngine) Variables(input *PolicyInput) map[string]interface{} {
+	return input.variables(e.location)
+}
+
+// Evaluate 按优先级对策略求值，返回决定和每条策略的结果。停用的策略也会求值，只记录在结果中
+func (e *ConnectPolicyEngine) Evaluate(input *PolicyInput, policies []*models.ConnectPolicy) (*models.PolicyDecision, []PolicyTrace) {
+	vars := input.variables(e.location)
+	decision := &models.PolicyDecision{Decision: models.PolicyEffectAllow, EvaluatedAt: time.Now().UTC()}
+	traces := make([]PolicyTrace, 0, len(policies))
+	denied, approval := false, false
+	obligations := map[string]bool{}
+
+	for _, policy := range policies {
+		trace := PolicyTrace{PolicyID: policy.ID, Name: policy.Name, Version: policy.Version, Mode: policy.Mode, Effect: policy.Effect}
+		expr, err := CompilePolicyExpr(policy.Expression)
+		if err == nil {
+			trace.Matched, err = expr.Eval(vars)
+		}
+		if err != nil {
+			trace.Error = err.Error()
+		}
+		traces = append(traces, trace)
+		if !policy.Enabled || (!trace.Matched && trace.Error == "") {
+			continue
+		}
+
+		match := models.PolicyMatch{
+			PolicyID:    policy.ID,
+			Name:        policy.Name,
+			Version:     policy.Version,
+			Effect:      policy.Effect,
+			Obligations: policy.Obligations,
+			Error:       trace.Error,
+		}
+		if policy.Mode == models.PolicyModeDryRun {
+			decision.DryRun = append(decision.DryRun, match)
+			continue
+		}
+		decision.Matched = append(decision.Matched, match)
+
+		switch {
+		case trace.Error != "", policy.Effect == models.PolicyEffectDeny:
+			denied = true
+		case policy.Effect == models.PolicyEffectRequireApproval:
+			approval = true
+		}
+		for _, obligation := range policy.Obligations {
+			if !obligations[obligation] {
+				obligations[obligation] = true
+				decision.Obligations = append(decision.Obligations, obligation)
+			}
+		}
+	}
+
+	switch {
+	case denied:
+		decision.Decision = models.PolicyEffectDeny
+	case approval:
+		decision.Decision = models.PolicyEffectRequireApproval
+	}
+	return decision, traces
+}
+
+// Decide 连接前求值启用的策略，最终不允许连接时记录审计日志
+func (e *ConnectPolicyEngine) Decide(input *PolicyInput) (*models.PolicyDecision, error) {
+	policies, err := e.policyService.ListEnabled()
+	if err != nil {
+		return nil, err
+	}
+	decision, _, err := e.decide(input, policies)
+	if err != nil {
+		return nil, err
+	}
+	if !Permitted(decision) {
+		e.logDenied(input, decision)
+	}
+	return decision, nil
+}
+
+// DryRun 试运行：对全部策略（包括停用的）和可选的草稿策略求值，不记录审计日志。草稿策略的ID为 0
+func (e *ConnectPolicyEngine) DryRun(input *PolicyInput, draft *models.ConnectPolicy) (*models.PolicyDecision, []PolicyTrace, error) {
+	policies, err := e.policyService.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	if draft != nil {
+		if err := e.Validate(draft.Expression); err != nil {
+			return nil, nil, err
+		}
+		policies = append(policies, draft)
+	}
+	return e.decide(input, policies)
+}
+
+// decide 求值并在 require_approval 时检查已批准的临时访问申请和紧急访问，满足时记录在 Approval 中
+func (e *ConnectPolicyEngine) decide(input *PolicyInput, policies []*models.ConnectPolicy) (*models.PolicyDecision, []PolicyTrace, error) {
+	decision, traces := e.Evaluate(input, policies)
+	if decision.Decision != models.PolicyEffectRequireApproval {
+		return decision, traces, nil
+	}
+
+	if input.BreakGlass {
+		decision.Approval = "break_glass"
+		return decision, traces, nil
+	}
+	requests, err := e.requestService.ListActiveFor(input.User.ID, input.Server.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(requests) > 0 {
+		decision.Approval = "access_request"
+	}
+	return decision, traces, nil
+}
+
+// Permitted 策略的决定是否允许连接
+func Permitted(decision *models.PolicyDecision) bool {
+	switch decision.Decision {
+	case models.PolicyEffectAllow:
+		return true
+	case models.PolicyEffectRequireApproval:
+		return decision.Approval != ""
+	}
+	return false
+}
+
+// logDenied 记录被连接策略拦截的连接
+func (e *ConnectPolicyEngine) logDenied(input *PolicyInput, decision *models.PolicyDecision) {
+	if e.auditService == nil {
+		return
+	}
+
+	details, _ := json.Marshal(map[string]interface{}{
+		"server_id":   input.Server.ID,
+		"server_name": input.Server.Name,
+		"reason":      input.Reason,
+		"ticket_id":   input.TicketID,
+		"policy":      decision,
+	})
+	entry := &models.AuditLog{
+		UserID:       input.User.ID,
+		Action:       "terminal_policy_" + decision.Decision,
+		ResourceType: "server",
+		ResourceID:   fmt.Sprintf("%d", input.Server.ID),
+		Details:      string(details),
+		IPAddress:    input.SourceIP,
+		Success:      false,
+	}
+	if err := e.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log connect policy decision: %v", err)
+	}
+}
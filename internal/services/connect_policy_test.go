@@ -0,0 +1,153 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// testPolicy 创建启用、生效模式的策略
+func testPolicy(id int, effect, expression string, obligations ...string) *models.ConnectPolicy {
+	return &models.ConnectPolicy{
+		ID:          id,
+		Name:        effect,
+		Expression:  expression,
+		Effect:      effect,
+		Obligations: obligations,
+		Enabled:     true,
+		Mode:        models.PolicyModeEnforce,
+		Version:     1,
+	}
+}
+
+func TestConnectPolicyEvaluatePrecedence(t *testing.T) {
+	engine := &ConnectPolicyEngine{location: time.UTC}
+	allow := testPolicy(1, models.PolicyEffectAllow, `true`)
+	approval := testPolicy(2, models.PolicyEffectRequireApproval, `"prod" in server.tags`)
+	deny := testPolicy(3, models.PolicyEffectDeny, `!in_cidr(source.ip, "10.0.0.0/8")`)
+	denyMatched := testPolicy(4, models.PolicyEffectDeny, `in_cidr(source.ip, "10.0.0.0/8")`)
+
+	tests := []struct {
+		name     string
+		policies []*models.ConnectPolicy
+		want     string
+	}{
+		{"no policies", nil, models.PolicyEffectAllow},
+		{"nothing matched", []*models.ConnectPolicy{deny}, models.PolicyEffectAllow},
+		{"allow matched", []*models.ConnectPolicy{allow}, models.PolicyEffectAllow},
+		{"require_approval beats allow", []*models.ConnectPolicy{allow, approval}, models.PolicyEffectRequireApproval},
+		{"deny beats require_approval", []*models.ConnectPolicy{approval, denyMatched}, models.PolicyEffectDeny},
+		{"deny beats all regardless of order", []*models.ConnectPolicy{denyMatched, approval, allow}, models.PolicyEffectDeny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, traces := engine.Evaluate(testPolicyInput(), tt.policies)
+			if decision.Decision != tt.want {
+				t.Errorf("decision = %q, want %q", decision.Decision, tt.want)
+			}
+			if len(traces) != len(tt.policies) {
+				t.Errorf("%d traces for %d policies", len(traces), len(tt.policies))
+			}
+		})
+	}
+}
+
+func TestConnectPolicyEvaluateMergesObligations(t *testing.T) {
+	engine := &ConnectPolicyEngine{location: time.UTC}
+	decision, _ := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{
+		testPolicy(1, models.PolicyEffectAllow, `true`, models.ObligationRecord),
+		testPolicy(2, models.PolicyEffectAllow, `true`, models.ObligationRecord, models.ObligationReadOnly),
+		testPolicy(3, models.PolicyEffectAllow, `false`, "unmatched"),
+	})
+	if len(decision.Obligations) != 2 || !decision.Has(models.ObligationRecord) || !decision.Has(models.ObligationReadOnly) {
+		t.Errorf("obligations = %v, want record and read_only once each", decision.Obligations)
+	}
+}
+
+func TestConnectPolicyDryRunNeverAffectsDecision(t *testing.T) {
+	engine := &ConnectPolicyEngine{location: time.UTC}
+	deny := testPolicy(1, models.PolicyEffectDeny, `true`, models.ObligationReadOnly)
+	deny.Mode = models.PolicyModeDryRun
+	approval := testPolicy(2, models.PolicyEffectRequireApproval, `true`)
+	approval.Mode = models.PolicyModeDryRun
+	broken := testPolicy(3, models.PolicyEffectAllow, `size(user.id) > 0`)
+	broken.Mode = models.PolicyModeDryRun
+
+	decision, _ := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{deny, approval, broken})
+	if decision.Decision != models.PolicyEffectAllow {
+		t.Errorf("decision = %q, want allow", decision.Decision)
+	}
+	if len(decision.Matched) != 0 || len(decision.Obligations) != 0 {
+		t.Errorf("dry-run policies leaked into decision: matched %v, obligations %v", decision.Matched, decision.Obligations)
+	}
+	if len(decision.DryRun) != 3 || decision.DryRun[2].Error == "" {
+		t.Errorf("dry_run = %+v, want all three recorded with the eval error", decision.DryRun)
+	}
+}
+
+func TestConnectPolicyEvalErrorsFailClosed(t *testing.T) {
+	engine := &ConnectPolicyEngine{location: time.UTC}
+	tests := []struct {
+		name   string
+		policy *models.ConnectPolicy
+	}{
+		{"eval error on allow policy", testPolicy(1, models.PolicyEffectAllow, `in_cidr(source.ip, "bad")`)},
+		{"eval error on require_approval policy", testPolicy(2, models.PolicyEffectRequireApproval, `user.name < 1`)},
+		{"stored expression no longer compiles", testPolicy(3, models.PolicyEffectAllow, `user.email == "x"`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, traces := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{tt.policy})
+			if decision.Decision != models.PolicyEffectDeny || Permitted(decision) {
+				t.Errorf("decision = %q, want deny", decision.Decision)
+			}
+			if len(decision.Matched) != 1 || decision.Matched[0].Error == "" || traces[0].Error == "" {
+				t.Errorf("error not recorded: matched %+v, traces %+v", decision.Matched, traces)
+			}
+		})
+	}
+
+	// 停用的策略出错只记录在结果中
+	disabled := testPolicy(4, models.PolicyEffectAllow, `size(true)`)
+	disabled.Enabled = false
+	decision, traces := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{disabled})
+	if decision.Decision != models.PolicyEffectAllow || traces[0].Error == "" {
+		t.Errorf("disabled policy: decision %q, trace %+v", decision.Decision, traces[0])
+	}
+}
+
+func TestConnectPolicyEvaluateUsesLocation(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	// 10:30 UTC 是上海时间 18:30，已过办公时间
+	offHours := testPolicy(1, models.PolicyEffectDeny, `time.hour < 9 || time.hour >= 18`)
+	engine := &ConnectPolicyEngine{location: shanghai}
+	if decision, _ := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{offHours}); decision.Decision != models.PolicyEffectDeny {
+		t.Errorf("decision in Asia/Shanghai = %q, want deny", decision.Decision)
+	}
+	engine = &ConnectPolicyEngine{location: time.UTC}
+	if decision, _ := engine.Evaluate(testPolicyInput(), []*models.ConnectPolicy{offHours}); decision.Decision != models.PolicyEffectAllow {
+		t.Errorf("decision in UTC = %q, want allow", decision.Decision)
+	}
+}
+
+func TestPermitted(t *testing.T) {
+	tests := []struct {
+		decision models.PolicyDecision
+		want     bool
+	}{
+		{models.PolicyDecision{Decision: models.PolicyEffectAllow}, true},
+		{models.PolicyDecision{Decision: models.PolicyEffectDeny}, false},
+		{models.PolicyDecision{Decision: models.PolicyEffectRequireApproval}, false},
+		{models.PolicyDecision{Decision: models.PolicyEffectRequireApproval, Approval: "access_request"}, true},
+		{models.PolicyDecision{Decision: "unknown"}, false},
+	}
+	for _, tt := range tests {
+		if got := Permitted(&tt.decision); got != tt.want {
+			t.Errorf("Permitted(%+v) = %v, want %v", tt.decision, got, tt.want)
+		}
+	}
+}
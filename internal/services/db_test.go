@@ -0,0 +1,30 @@
+package services
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"very-jump/internal/database"
+)
+
+// openTestDB 在临时目录创建已完成迁移的数据库
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.Init(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// mustExec 执行测试数据准备语句
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) sql.Result {
+	t.Helper()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("exec %q: %v", query, err)
+	}
+	return result
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig LDAP / Active Directory 连接和映射配置
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	CACertFile         string
+	BindDN             string
+	BindPassword       string
+	BaseDN             string
+	UserFilter         string // %s 替换为转义后的用户名
+	UsernameAttribute  string
+	GroupAttribute     string
+	AdminGroups        []string
+	UserGroups         []string
+	Provision          bool
+	Timeout            time.Duration
+}
+
+// LDAPConfigFromConfig 从应用配置读取 LDAP 配置
+func LDAPConfigFromConfig(cfg *config.Config) LDAPConfig {
+	return LDAPConfig{
+		URL:                cfg.LDAPURL,
+		StartTLS:           cfg.LDAPStartTLS,
+		InsecureSkipVerify: cfg.LDAPInsecureSkipVerify,
+		CACertFile:         cfg.LDAPCACertFile,
+		BindDN:             cfg.LDAPBindDN,
+		BindPassword:       cfg.LDAPBindPassword,
+		BaseDN:             cfg.LDAPBaseDN,
+		UserFilter:         cfg.LDAPUserFilter,
+		UsernameAttribute:  cfg.LDAPUsernameAttribute,
+		GroupAttribute:     cfg.LDAPGroupAttribute,
+		AdminGroups:        cfg.LDAPAdminGroups,
+		UserGroups:         cfg.LDAPUserGroups,
+		Provision:          cfg.LDAPProvision,
+		Timeout:            cfg.LDAPTimeout,
+	}
+}
+
+// LDAPProvider 使用 LDAP 先查询后绑定的方式认证用户
+// 先用服务账号（或匿名）按 UserFilter 查出用户 DN 和所属组，再用用户 DN 和密码绑定校验密码
+type LDAPProvider struct {
+	cfg       LDAPConfig
+	tlsConfig *tls.Config
+}
+
+// NewLDAPProvider 创建 LDAP 身份源
+func NewLDAPProvider(cfg LDAPConfig) (*LDAPProvider, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("LDAP_URL 和 LDAP_BASE_DN 不能为空")
+	}
+	if !strings.Contains(cfg.UserFilter, "%s") {
+		return nil, errors.New("LDAP_USER_FILTER 必须包含 %s")
+	}
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 LDAP_URL: %v", err)
+	}
+	if parsed.Scheme == "ldaps" && cfg.StartTLS {
+		return nil, errors.New("ldaps:// 连接不能同时启用 StartTLS")
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         parsed.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 LDAP CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("LDAP CA 证书格式无效")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &LDAPProvider{cfg: cfg, tlsConfig: tlsConfig}, nil
+}
+
+// Name 身份源名称
+func (p *LDAPProvider) Name() string {
+	return models.AuthSourceLDAP
+}
+
+// Provision 首次登录时是否自动创建本地用户
+func (p *LDAPProvider) Provision() bool {
+	return p.cfg.Provision
+}
+
+// Encrypted 连接是否加密
+func (p *LDAPProvider) Encrypted() bool {
+	return strings.HasPrefix(p.cfg.URL, "ldaps://") || p.cfg.StartTLS
+}
+
+// Authenticate 查询用户并用其 DN 和密码绑定
+func (p *LDAPProvider) Authenticate(username, password string) (*ExternalIdentity, error) {
+	// 空密码绑定在多数目录上是匿名绑定，会被当作认证成功
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("服务账号绑定失败: %v", err)
+		}
+	}
+
+	attributes := []string{p.cfg.UsernameAttribute, p.cfg.GroupAttribute}
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		// 超出 sizeLimit 说明查询条件匹配到多个用户，与多条结果一样拒绝登录
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) || ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+	// 查询条件不唯一时拒绝登录，避免绑定到错误的用户
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("用户绑定失败: %v", err)
+	}
+
+	groups := entry.GetAttributeValues(p.cfg.GroupAttribute)
+	role := mapGroupsToRole(groups, p.cfg.AdminGroups, p.cfg.UserGroups)
+	if role == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	localName := entry.GetAttributeValue(p.cfg.UsernameAttribute)
+	if localName == "" {
+		localName = username
+	}
+
+	return &ExternalIdentity{
+		Username: strings.ToLower(localName),
+		Role:     role,
+		Groups:   groups,
+	}, nil
+}
+
+// dial 建立连接，按配置使用 LDAPS 或 StartTLS
+func (p *LDAPProvider) dial() (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithDialer(dialer), ldap.DialWithTLSConfig(p.tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("连接 LDAP 失败: %v", err)
+	}
+	conn.SetTimeout(p.cfg.Timeout)
+
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS 失败: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// mapGroupsToRole 按组映射角色：命中 adminGroups 为 admin，命中 userGroups 或 userGroups 为空时为 user，否则为空
+func mapGroupsToRole(groups, adminGroups, userGroups []string) string {
+	if matchGroups(groups, adminGroups) {
+		return models.RoleAdmin
+	}
+	if len(userGroups) == 0 || matchGroups(groups, userGroups) {
+		return models.RoleUser
+	}
+	return ""
+}
+
+// matchGroups 判断用户组是否命中配置的组，配置值可以是完整 DN 或组的 CN，不区分大小写
+func matchGroups(groups, configured []string) bool {
+	for _, group := range groups {
+		cn := groupCN(group)
+		for _, want := range configured {
+			if strings.EqualFold(group, want) || (cn != "" && strings.EqualFold(cn, want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// groupCN 取组 DN 的第一个 CN
+func groupCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 {
+		return ""
+	}
+	for _, attr := range parsed.RDNs[0].Attributes {
+		if strings.EqualFold(attr.Type, "cn") {
+			return attr.Value
+		}
+	}
+	return ""
+}
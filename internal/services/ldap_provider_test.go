@@ -0,0 +1,363 @@
+package services
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeLDAPEntry 目录条目
+type fakeLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// fakeLDAPServer 进程内的最小 LDAP 服务，支持简单绑定和查询
+// 查询按过滤条件中的 uid 匹配条目，超过客户端的 sizeLimit 时返回 sizeLimitExceeded
+type fakeLDAPServer struct {
+	t        *testing.T
+	listener net.Listener
+	entries  []fakeLDAPEntry
+
+	mutex    sync.Mutex
+	binds    []string // 绑定成功和失败的 DN
+	filters  []string
+	bindDN   string
+	bindPass string
+}
+
+func newFakeLDAPServer(t *testing.T, entries ...fakeLDAPEntry) *fakeLDAPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeLDAPServer{
+		t:        t,
+		listener: listener,
+		entries:  entries,
+		bindDN:   "cn=svc,dc=example,dc=com",
+		bindPass: "svc-secret",
+	}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeLDAPServer) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *fakeLDAPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeLDAPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if err != io.EOF {
+				s.t.Logf("fake ldap read: %v", err)
+			}
+			return
+		}
+		messageID := packet.Children[0].Value
+		request := packet.Children[1]
+		switch request.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := request.Children[1].Value.(string)
+			password := request.Children[2].Data.String()
+			s.mutex.Lock()
+			s.binds = append(s.binds, dn)
+			s.mutex.Unlock()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if s.checkPassword(dn, password) {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResponse(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			sizeLimit := int(request.Children[3].Value.(int64))
+			filter, err := ldap.DecompileFilter(request.Children[6])
+			if err != nil {
+				s.t.Errorf("decompile filter: %v", err)
+				return
+			}
+			s.mutex.Lock()
+			s.filters = append(s.filters, filter)
+			s.mutex.Unlock()
+
+			matched := s.search(filter)
+			code := uint16(ldap.LDAPResultSuccess)
+			if sizeLimit > 0 && len(matched) > sizeLimit {
+				matched = matched[:sizeLimit]
+				code = ldap.LDAPResultSizeLimitExceeded
+			}
+			for _, entry := range matched {
+				conn.Write(ldapSearchEntry(messageID, entry).Bytes())
+			}
+			conn.Write(ldapResponse(messageID, ldap.ApplicationSearchResultDone, code).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			s.t.Errorf("unexpected LDAP operation %d", request.Tag)
+			return
+		}
+	}
+}
+
+func (s *fakeLDAPServer) checkPassword(dn, password string) bool {
+	if dn == s.bindDN {
+		return password == s.bindPass
+	}
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return password != "" && password == entry.password
+		}
+	}
+	return false
+}
+
+// search 取过滤条件中的 uid 值，返回 uid 属性相同的条目
+func (s *fakeLDAPServer) search(filter string) []fakeLDAPEntry {
+	start := strings.Index(filter, "(uid=")
+	if start < 0 {
+		return nil
+	}
+	value := filter[start+len("(uid="):]
+	value = value[:strings.Index(value, ")")]
+
+	var matched []fakeLDAPEntry
+	for _, entry := range s.entries {
+		for _, uid := range entry.attributes["uid"] {
+			if strings.EqualFold(uid, value) {
+				matched = append(matched, entry)
+			}
+		}
+	}
+	return matched
+}
+
+func ldapResponse(messageID interface{}, tag ber.Tag, code uint16) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	response := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Response")
+	response.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	response.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	packet.AppendChild(response)
+	return packet
+}
+
+func ldapSearchEntry(messageID interface{}, entry fakeLDAPEntry) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+	packet.AppendChild(result)
+	return packet
+}
+
+func newTestLDAPProvider(t *testing.T, server *fakeLDAPServer, provision bool) *LDAPProvider {
+	t.Helper()
+	provider, err := NewLDAPProvider(LDAPConfig{
+		URL:               server.URL(),
+		BindDN:            server.bindDN,
+		BindPassword:      server.bindPass,
+		BaseDN:            "dc=example,dc=com",
+		UserFilter:        "(&(objectClass=person)(uid=%s))",
+		UsernameAttribute: "uid",
+		GroupAttribute:    "memberOf",
+		AdminGroups:       []string{"ops-admins"},
+		UserGroups:        []string{"developers"},
+		Provision:         provision,
+		Timeout:           2 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new ldap provider: %v", err)
+	}
+	return provider
+}
+
+func ldapUser(uid, password string, groups ...string) fakeLDAPEntry {
+	return fakeLDAPEntry{
+		dn:       "uid=" + uid + ",ou=people,dc=example,dc=com",
+		password: password,
+		attributes: map[string][]string{
+			"uid":      {uid},
+			"memberOf": groups,
+		},
+	}
+}
+
+func TestLDAPAuthenticateMapsGroupsToRole(t *testing.T) {
+	server := newFakeLDAPServer(t,
+		ldapUser("alice", "alice-pw", "cn=ops-admins,ou=groups,dc=example,dc=com"),
+		ldapUser("bob", "bob-pw", "cn=developers,ou=groups,dc=example,dc=com"),
+		ldapUser("carol", "carol-pw", "cn=finance,ou=groups,dc=example,dc=com"),
+	)
+	provider := newTestLDAPProvider(t, server, true)
+
+	identity, err := provider.Authenticate("Alice", "alice-pw")
+	if err != nil {
+		t.Fatalf("authenticate alice: %v", err)
+	}
+	if identity.Username != "alice" || identity.Role != models.RoleAdmin {
+		t.Errorf("alice identity = %+v, want admin", identity)
+	}
+
+	identity, err = provider.Authenticate("bob", "bob-pw")
+	if err != nil || identity.Role != models.RoleUser {
+		t.Errorf("bob identity = %+v, err = %v, want user", identity, err)
+	}
+
+	// 不在任何映射组中
+	if _, err := provider.Authenticate("carol", "carol-pw"); err != ErrInvalidCredentials {
+		t.Errorf("carol err = %v, want ErrInvalidCredentials", err)
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.binds[0] != server.bindDN {
+		t.Errorf("first bind = %q, want service account", server.binds[0])
+	}
+	if server.filters[0] != "(&(objectClass=person)(uid=Alice))" {
+		t.Errorf("filter = %q", server.filters[0])
+	}
+}
+
+func TestLDAPAuthenticateBindFailures(t *testing.T) {
+	server := newFakeLDAPServer(t, ldapUser("alice", "alice-pw", "cn=developers,dc=example,dc=com"))
+
+	// 用户密码错误
+	provider := newTestLDAPProvider(t, server, true)
+	if _, err := provider.Authenticate("alice", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("wrong password err = %v, want ErrInvalidCredentials", err)
+	}
+	// 空密码不发起绑定
+	if _, err := provider.Authenticate("alice", ""); err != ErrInvalidCredentials {
+		t.Errorf("empty password err = %v, want ErrInvalidCredentials", err)
+	}
+
+	// 服务账号绑定失败属于身份源不可用，而不是密码错误
+	provider.cfg.BindPassword = "rotated"
+	_, err := provider.Authenticate("alice", "alice-pw")
+	if err == nil || err == ErrInvalidCredentials {
+		t.Errorf("service bind failure err = %v, want provider error", err)
+	}
+
+	// 身份源无法连接
+	provider = newTestLDAPProvider(t, server, true)
+	provider.cfg.URL = "ldap://127.0.0.1:1"
+	if _, err := provider.Authenticate("alice", "alice-pw"); err == nil || err == ErrInvalidCredentials {
+		t.Errorf("dial failure err = %v, want provider error", err)
+	}
+}
+
+func TestLDAPAuthenticateRequiresExactlyOneEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []fakeLDAPEntry
+	}{
+		{"no entry", nil},
+		{"two entries", []fakeLDAPEntry{
+			ldapUser("alice", "alice-pw", "cn=developers"),
+			{dn: "uid=alice,ou=contractors,dc=example,dc=com", password: "alice-pw", attributes: map[string][]string{"uid": {"alice"}}},
+		}},
+		{"size limit exceeded", []fakeLDAPEntry{
+			ldapUser("alice", "alice-pw", "cn=developers"),
+			{dn: "uid=alice,ou=contractors,dc=example,dc=com", password: "alice-pw", attributes: map[string][]string{"uid": {"alice"}}},
+			{dn: "uid=alice,ou=partners,dc=example,dc=com", password: "alice-pw", attributes: map[string][]string{"uid": {"alice"}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeLDAPServer(t, tt.entries...)
+			provider := newTestLDAPProvider(t, server, true)
+			if _, err := provider.Authenticate("alice", "alice-pw"); err != ErrInvalidCredentials {
+				t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+			}
+			// 不能绑定到任何一个候选用户
+			server.mutex.Lock()
+			defer server.mutex.Unlock()
+			for _, dn := range server.binds {
+				if dn != server.bindDN {
+					t.Errorf("bound as %q despite ambiguous search", dn)
+				}
+			}
+		})
+	}
+}
+
+func newTestAuthService(t *testing.T) *AuthService {
+	t.Helper()
+	return NewAuthService(&config.Config{
+		JWTSecret:          "test-secret",
+		JWTExpiry:          time.Hour,
+		RefreshTokenExpiry: time.Hour,
+	}, openTestDB(t))
+}
+
+func TestLDAPLoginProvisionsAndRefusesTakeover(t *testing.T) {
+	server := newFakeLDAPServer(t,
+		ldapUser("alice", "alice-pw", "cn=developers,dc=example,dc=com"),
+		ldapUser("admin", "directory-pw", "cn=ops-admins,dc=example,dc=com"),
+		ldapUser("samluser", "saml-pw", "cn=developers,dc=example,dc=com"),
+	)
+	auth := newTestAuthService(t)
+	auth.RegisterProvider(newTestLDAPProvider(t, server, true))
+
+	resp, err := auth.Login(&LoginRequest{Username: "alice", Password: "alice-pw"}, "10.0.0.1", "test")
+	if err != nil {
+		t.Fatalf("ldap login: %v", err)
+	}
+	if resp.User.AuthSource != models.AuthSourceLDAP || resp.User.Role != models.RoleUser {
+		t.Errorf("provisioned user = %+v", resp.User)
+	}
+
+	// 本地管理员账号不能通过同名目录账号登录
+	if _, err := auth.Login(&LoginRequest{Username: "admin", Password: "directory-pw"}, "10.0.0.1", "test"); err != ErrInvalidCredentials {
+		t.Errorf("local account via ldap err = %v, want ErrInvalidCredentials", err)
+	}
+
+	// 其他外部身份源的账号不能被 LDAP 接管
+	if _, err := auth.userService.CreateExternalUser("samluser", models.RoleUser, models.AuthSourceSAML); err != nil {
+		t.Fatalf("create saml user: %v", err)
+	}
+	identity := &ExternalIdentity{Username: "samluser", Role: models.RoleAdmin}
+	if _, err := auth.syncExternalUser(models.AuthSourceLDAP, true, identity); err != ErrInvalidCredentials {
+		t.Errorf("sync over saml account err = %v, want ErrInvalidCredentials", err)
+	}
+	user, _ := auth.userService.GetByUsername("samluser")
+	if user.AuthSource != models.AuthSourceSAML || user.Role != models.RoleUser {
+		t.Errorf("saml account changed by refused sync: %+v", user)
+	}
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidLoginCode 一次性登录码无效或已过期
+var ErrInvalidLoginCode = errors.New("登录码无效或已过期")
+
+// loginCodeTTL 前端用登录码换取令牌的最长时间
+const loginCodeTTL = time.Minute
+
+// pendingLogin 等待前端换取的登录结果
+type pendingLogin struct {
+	response  *LoginResponse
+	expiresAt time.Time
+}
+
+// LoginCodeStore 单点登录完成后的一次性登录码
+// 身份源回调以浏览器跳转完成，令牌不能出现在 URL 中，因此只把登录码通过 URL 片段交给前端，由前端通过 POST 换取
+type LoginCodeStore struct {
+	mutex sync.Mutex
+	codes map[string]*pendingLogin
+}
+
+// NewLoginCodeStore 创建一次性登录码存储
+func NewLoginCodeStore() *LoginCodeStore {
+	return &LoginCodeStore{codes: make(map[string]*pendingLogin)}
+}
+
+// Issue 保存登录结果并返回一次性登录码
+func (s *LoginCodeStore) Issue(response *LoginResponse) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, pending := range s.codes {
+		if now.After(pending.expiresAt) {
+			delete(s.codes, key)
+		}
+	}
+	s.codes[code] = &pendingLogin{response: response, expiresAt: now.Add(loginCodeTTL)}
+	return code, nil
+}
+
+// Redeem 用一次性登录码换取登录结果，登录码只能使用一次
+func (s *LoginCodeStore) Redeem(code string) (*LoginResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	pending, ok := s.codes[code]
+	delete(s.codes, code)
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, ErrInvalidLoginCode
+	}
+	return pending.response, nil
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录限制原因
+const (
+	LoginBlockLocked  = "locked"       // 失败次数过多，已锁定
+	LoginBlockDelayed = "rate_limited" // 距上次失败未满等待时间，或已有尝试正在验证
+)
+
+// loginPendingRetryAfter 同一用户名已有尝试正在验证时建议的重试等待时间
+const loginPendingRetryAfter = time.Second
+
+// LoginLimits 登录防暴力破解参数
+type LoginLimits struct {
+	MaxFailures     int           // 同一用户名窗口内失败上限
+	IPMaxFailures   int           // 同一IP窗口内失败上限
+	Window          time.Duration // 滑动窗口
+	LockoutDuration time.Duration // 锁定时长
+	DelayBase       time.Duration // 首次失败后的等待时间
+	DelayMax        time.Duration // 等待时间上限
+}
+
+// LoginBlock 登录被限制的原因和剩余等待时间
+type LoginBlock struct {
+	Reason     string
+	Key        string // 触发限制的用户名或IP
+	KeyType    string // username 或 ip
+	RetryAfter time.Duration
+}
+
+// LoginFailureResult 记录一次失败后的状态
+type LoginFailureResult struct {
+	UserFailures int
+	IPFailures   int
+	UserLocked   bool // 本次失败导致用户名被锁定
+	IPLocked     bool // 本次失败导致IP被锁定
+}
+
+// LoginLockout 锁定记录
+type LoginLockout struct {
+	Key         string    `json:"key"`
+	Type        string    `json:"type"` // username 或 ip
+	Failures    int       `json:"failures"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// LoginAttempt 已预占的一次登录尝试，验证结束后必须调用 RecordFailure、RecordSuccess 或 Release 之一
+type LoginAttempt struct {
+	username  string
+	ipAddress string
+}
+
+// loginAttempts 单个用户名或IP的失败记录
+type loginAttempts struct {
+	failures    []time.Time
+	lockedUntil time.Time
+	pending     int // 已预占、尚未得出结果的尝试数
+}
+
+// LoginLimiter 登录失败限制
+// 按用户名和来源IP分别统计滑动窗口内的失败次数：每次失败后需等待逐次翻倍的时间才能再次尝试，
+// 达到上限后锁定一段时间，管理员可以提前解锁
+type LoginLimiter struct {
+	limits LoginLimits
+	mutex  sync.Mutex
+	users  map[string]*loginAttempts
+	ips    map[string]*loginAttempts
+}
+
+// NewLoginLimiter 创建登录失败限制
+func NewLoginLimiter(limits LoginLimits) *LoginLimiter {
+	return &LoginLimiter{
+		limits: limits,
+		users:  make(map[string]*loginAttempts),
+		ips:    make(map[string]*loginAttempts),
+	}
+}
+
+// Reserve 检查是否允许本次登录尝试，允许时在同一临界区内预占一次尝试，被限制时返回原因
+// 同一用户名同时只允许一次尝试在验证中，同一IP在验证中的尝试计入失败上限，
+// 避免并发请求在得出失败结果前绕过等待时间和锁定
+func (l *LoginLimiter) Reserve(username, ipAddress string) (*LoginAttempt, *LoginBlock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	username = loginKey(username)
+	if block := l.checkLocked(l.users[username], l.limits.MaxFailures, now); block != nil {
+		block.Key, block.KeyType = username, "username"
+		return nil, block
+	}
+	if attempts := l.users[username]; attempts != nil && attempts.pending > 0 {
+		return nil, &LoginBlock{Reason: LoginBlockDelayed, Key: username, KeyType: "username", RetryAfter: loginPendingRetryAfter}
+	}
+	if block := l.checkLocked(l.ips[ipAddress], l.limits.IPMaxFailures, now); block != nil {
+		block.Key, block.KeyType = ipAddress, "ip"
+		return nil, block
+	}
+
+	l.reserve(l.users, username)
+	l.reserve(l.ips, ipAddress)
+	return &LoginAttempt{username: username, ipAddress: ipAddress}, nil
+}
+
+// RecordFailure 预占的尝试验证失败，计入失败次数
+func (l *LoginLimiter) RecordFailure(attempt *LoginAttempt) *LoginFailureResult {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	l.release(l.users, attempt.username)
+	l.release(l.ips, attempt.ipAddress)
+	l.pruneLocked(now)
+
+	result := &LoginFailureResult{}
+	result.UserFailures, result.UserLocked = l.addFailure(l.users, attempt.username, l.limits.MaxFailures, now)
+	result.IPFailures, result.IPLocked = l.addFailure(l.ips, attempt.ipAddress, l.limits.IPMaxFailures, now)
+	return result
+}
+
+// RecordSuccess 预占的尝试验证成功，清除该用户名的失败记录，IP 的失败记录保留
+func (l *LoginLimiter) RecordSuccess(attempt *LoginAttempt) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.users, attempt.username)
+	l.release(l.ips, attempt.ipAddress)
+}
+
+// Release 预占的尝试未验证凭据（如参数错误、认证源不可用），不计入失败次数
+func (l *LoginLimiter) Release(attempt *LoginAttempt) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.release(l.users, attempt.username)
+	l.release(l.ips, attempt.ipAddress)
+}
+
+// Unlock 解除用户名或IP的锁定并清除失败记录，返回是否存在记录
+func (l *LoginLimiter) Unlock(username, ipAddress string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	found := false
+	username = loginKey(username)
+	if _, ok := l.users[username]; ok && username != "" {
+		delete(l.users, username)
+		found = true
+	}
+	if _, ok := l.ips[ipAddress]; ok && ipAddress != "" {
+		delete(l.ips, ipAddress)
+		found = true
+	}
+	return found
+}
+
+// Lockouts 获取当前处于锁定状态的用户名和IP
+func (l *LoginLimiter) Lockouts() []*LoginLockout {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	lockouts := []*LoginLockout{}
+	collect := func(entries map[string]*loginAttempts, keyType string) {
+		for key, attempts := range entries {
+			if now.Before(attempts.lockedUntil) {
+				lockouts = append(lockouts, &LoginLockout{
+					Key:         key,
+					Type:        keyType,
+					Failures:    len(attempts.failures),
+					LockedUntil: attempts.lockedUntil,
+				})
+			}
+		}
+	}
+	collect(l.users, "username")
+	collect(l.ips, "ip")
+
+	sort.Slice(lockouts, func(i, j int) bool {
+		return lockouts[i].LockedUntil.After(lockouts[j].LockedUntil)
+	})
+	return lockouts
+}
+
+// checkLocked 检查锁定、逐次等待时间，以及失败次数加验证中的尝试是否已达上限
+func (l *LoginLimiter) checkLocked(attempts *loginAttempts, limit int, now time.Time) *LoginBlock {
+	if attempts == nil {
+		return nil
+	}
+	if now.Before(attempts.lockedUntil) {
+		return &LoginBlock{Reason: LoginBlockLocked, RetryAfter: attempts.lockedUntil.Sub(now)}
+	}
+
+	failures := l.recentFailures(attempts, now)
+	if limit > 0 && attempts.pending > 0 && failures+attempts.pending >= limit {
+		return &LoginBlock{Reason: LoginBlockDelayed, RetryAfter: loginPendingRetryAfter}
+	}
+	if failures == 0 {
+		return nil
+	}
+	next := attempts.failures[len(attempts.failures)-1].Add(l.delay(failures))
+	if now.Before(next) {
+		return &LoginBlock{Reason: LoginBlockDelayed, RetryAfter: next.Sub(now)}
+	}
+	return nil
+}
+
+// reserve 预占一次尝试
+func (l *LoginLimiter) reserve(entries map[string]*loginAttempts, key string) {
+	if key == "" {
+		return
+	}
+	attempts, ok := entries[key]
+	if !ok {
+		attempts = &loginAttempts{}
+		entries[key] = attempts
+	}
+	attempts.pending++
+}
+
+// release 释放一次预占，记录已不存在（如被管理员解锁）时忽略
+func (l *LoginLimiter) release(entries map[string]*loginAttempts, key string) {
+	if attempts, ok := entries[key]; ok && attempts.pending > 0 {
+		attempts.pending--
+	}
+}
+
+// addFailure 追加一次失败，达到上限时锁定，返回窗口内失败次数和是否本次被锁定
+func (l *LoginLimiter) addFailure(entries map[string]*loginAttempts, key string, limit int, now time.Time) (int, bool) {
+	if key == "" {
+		return 0, false
+	}
+	attempts, ok := entries[key]
+	if !ok {
+		attempts = &loginAttempts{}
+		entries[key] = attempts
+	}
+	l.recentFailures(attempts, now)
+	attempts.failures = append(attempts.failures, now)
+
+	failures := len(attempts.failures)
+	if limit > 0 && failures >= limit && !now.Before(attempts.lockedUntil) {
+		attempts.lockedUntil = now.Add(l.limits.LockoutDuration)
+		return failures, true
+	}
+	return failures, false
+}
+
+// recentFailures 丢弃窗口外的失败记录，返回窗口内失败次数
+func (l *LoginLimiter) recentFailures(attempts *loginAttempts, now time.Time) int {
+	cutoff := now.Add(-l.limits.Window)
+	i := 0
+	for i < len(attempts.failures) && attempts.failures[i].Before(cutoff) {
+		i++
+	}
+	attempts.failures = attempts.failures[i:]
+	return len(attempts.failures)
+}
+
+// delay 第 n 次失败后的等待时间
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	if l.limits.DelayBase <= 0 {
+		return 0
+	}
+	delay := l.limits.DelayBase
+	for i := 1; i < failures && delay < l.limits.DelayMax; i++ {
+		delay *= 2
+	}
+	if l.limits.DelayMax > 0 && delay > l.limits.DelayMax {
+		delay = l.limits.DelayMax
+	}
+	return delay
+}
+
+// pruneLocked 清理已过期且窗口内无失败的记录，调用方需持有锁
+func (l *LoginLimiter) pruneLocked(now time.Time) {
+	for _, entries := range []map[string]*loginAttempts{l.users, l.ips} {
+		for key, attempts := range entries {
+			if l.recentFailures(attempts, now) == 0 && attempts.pending == 0 && !now.Before(attempts.lockedUntil) {
+				delete(entries, key)
+			}
+		}
+	}
+}
+
+// loginKey 用户名计数键，忽略大小写和首尾空白
+func loginKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginLimiterReserveIsExclusivePerUsername(t *testing.T) {
+	l := NewLoginLimiter(LoginLimits{MaxFailures: 5, IPMaxFailures: 20, Window: time.Minute, LockoutDuration: time.Minute})
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	granted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if attempt, block := l.Reserve("alice", "10.0.0.1"); block == nil && attempt != nil {
+				mutex.Lock()
+				granted++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 1 {
+		t.Fatalf("granted %d concurrent attempts for one username, want 1", granted)
+	}
+}
+
+func TestLoginLimiterPendingAttemptsCountTowardsIPLimit(t *testing.T) {
+	l := NewLoginLimiter(LoginLimits{MaxFailures: 5, IPMaxFailures: 3, Window: time.Minute, LockoutDuration: time.Minute})
+
+	for _, username := range []string{"a", "b", "c"} {
+		if _, block := l.Reserve(username, "10.0.0.1"); block != nil {
+			t.Fatalf("reserve %s: blocked %+v", username, block)
+		}
+	}
+	if _, block := l.Reserve("d", "10.0.0.1"); block == nil || block.KeyType != "ip" {
+		t.Fatalf("fourth pending attempt from one IP: block = %+v, want ip block", block)
+	}
+}
+
+func TestLoginLimiterNormalizesUsername(t *testing.T) {
+	l := NewLoginLimiter(LoginLimits{MaxFailures: 2, Window: time.Minute, LockoutDuration: time.Minute})
+
+	for _, username := range []string{"Alice", " alice "} {
+		attempt, block := l.Reserve(username, "")
+		if block != nil {
+			t.Fatalf("reserve %q: blocked %+v", username, block)
+		}
+		l.RecordFailure(attempt)
+	}
+	if _, block := l.Reserve("ALICE", ""); block == nil || block.Reason != LoginBlockLocked || block.Key != "alice" {
+		t.Fatalf("block = %+v, want alice locked", block)
+	}
+	if !l.Unlock(" Alice", "") {
+		t.Fatal("unlock by differently cased username found no record")
+	}
+	if _, block := l.Reserve("alice", ""); block != nil {
+		t.Fatalf("blocked after unlock: %+v", block)
+	}
+}
+
+func TestLoginLimiterReleaseAndSuccessFreeReservation(t *testing.T) {
+	l := NewLoginLimiter(LoginLimits{MaxFailures: 1, IPMaxFailures: 1, Window: time.Minute, LockoutDuration: time.Minute})
+
+	attempt, _ := l.Reserve("alice", "10.0.0.1")
+	l.Release(attempt)
+	attempt, block := l.Reserve("alice", "10.0.0.1")
+	if block != nil {
+		t.Fatalf("blocked after release: %+v", block)
+	}
+	l.RecordSuccess(attempt)
+	if _, block := l.Reserve("bob", "10.0.0.1"); block != nil {
+		t.Fatalf("blocked after success: %+v", block)
+	}
+}
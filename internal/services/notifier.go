@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// Notification 一次告警通知的内容
+type Notification struct {
+	Alert      *models.SecurityAlert `json:"alert"`
+	Username   string                `json:"username,omitempty"`
+	ServerName string                `json:"server_name,omitempty"`
+	ServerTags []string              `json:"server_tags,omitempty"`
+	Suppressed int                   `json:"suppressed,omitempty"` // 上次发送后因限流被抑制的告警数
+	Test       bool                  `json:"test,omitempty"`
+}
+
+// Notifier 告警通知渠道
+type Notifier interface {
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// NewNotifier 根据渠道配置创建通知器，同时校验必填配置
+func NewNotifier(channel *models.NotificationChannel) (Notifier, error) {
+	config := channel.Config
+	switch channel.Type {
+	case "webhook":
+		if config["url"] == "" {
+			return nil, fmt.Errorf("webhook channel requires url")
+		}
+		return &WebhookNotifier{URL: config["url"], Secret: config["secret"]}, nil
+	case "dingtalk":
+		if config["url"] == "" {
+			return nil, fmt.Errorf("dingtalk channel requires url")
+		}
+		return &DingTalkNotifier{URL: config["url"], Secret: config["secret"]}, nil
+	case "feishu":
+		if config["url"] == "" {
+			return nil, fmt.Errorf("feishu channel requires url")
+		}
+		return &FeishuNotifier{URL: config["url"], Secret: config["secret"]}, nil
+	case "wecom":
+		if config["url"] == "" {
+			return nil, fmt.Errorf("wecom channel requires url")
+		}
+		return &WeComNotifier{URL: config["url"]}, nil
+	case "email":
+		return newEmailNotifier(config)
+	}
+	return nil, fmt.Errorf("unsupported notification channel type: %s", channel.Type)
+}
+
+// severityRank 告警级别排序，未知级别视为最低
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 4
+	case "high":
+		return 3
+	case "medium":
+		return 2
+	}
+	return 1
+}
+
+// channelMatches 判断告警是否符合渠道的路由条件
+func channelMatches(channel *models.NotificationChannel, alert *models.SecurityAlert, serverTags []string) bool {
+	if severityRank(alert.Severity) < severityRank(channel.MinSeverity) {
+		return false
+	}
+	if len(channel.AlertTypes) > 0 && !containsString(channel.AlertTypes, alert.AlertType) {
+		return false
+	}
+	if len(channel.ServerTags) > 0 {
+		for _, tag := range serverTags {
+			if containsString(channel.ServerTags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// notificationTitle 通知标题
+func notificationTitle(n *Notification) string {
+	title := fmt.Sprintf("[%s] 安全告警: %s", strings.ToUpper(n.Alert.Severity), n.Alert.AlertType)
+	if n.Test {
+		title = "[测试] " + title
+	}
+	return title
+}
+
+// notificationLines 通知正文，每行一项
+func notificationLines(n *Notification) []string {
+	alert := n.Alert
+	lines := []string{alert.Description}
+
+	user := n.Username
+	if user == "" && alert.UserID != 0 {
+		user = fmt.Sprintf("#%d", alert.UserID)
+	}
+	if user != "" {
+		lines = append(lines, "用户: "+user)
+	}
+	if n.ServerName != "" || alert.ServerID != 0 {
+		server := n.ServerName
+		if server == "" {
+			server = fmt.Sprintf("#%d", alert.ServerID)
+		}
+		if len(n.ServerTags) > 0 {
+			server += " (" + strings.Join(n.ServerTags, ", ") + ")"
+		}
+		lines = append(lines, "服务器: "+server)
+	}
+	if alert.IPAddress != "" {
+		lines = append(lines, "来源IP: "+alert.IPAddress)
+	}
+	if alert.SessionID != "" {
+		lines = append(lines, "会话: "+alert.SessionID)
+	}
+	created := alert.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	lines = append(lines, "时间: "+created.Format("2006-01-02 15:04:05 MST"))
+	if alert.ID != 0 {
+		lines = append(lines, fmt.Sprintf("告警ID: %d", alert.ID))
+	}
+	if n.Suppressed > 0 {
+		lines = append(lines, fmt.Sprintf("另有 %d 条告警因限流未单独发送", n.Suppressed))
+	}
+	return lines
+}
+
+// notificationText 纯文本通知内容
+func notificationText(n *Notification) string {
+	return notificationTitle(n) + "\n" + strings.Join(notificationLines(n), "\n")
+}
+
+// notificationMarkdown Markdown 通知内容
+func notificationMarkdown(n *Notification) string {
+	lines := notificationLines(n)
+	var b strings.Builder
+	b.WriteString("### " + notificationTitle(n) + "\n")
+	b.WriteString(lines[0] + "\n")
+	for _, line := range lines[1:] {
+		b.WriteString("\n- " + line)
+	}
+	return b.String()
+}
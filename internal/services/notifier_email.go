@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// EmailNotifier SMTP 邮件通知
+type EmailNotifier struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Security string // starttls, tls, none
+}
+
+// newEmailNotifier 由渠道配置创建邮件通知器
+// 配置项: host, port, username, password, from, to(逗号分隔), security(starttls|tls|none)
+func newEmailNotifier(config map[string]string) (*EmailNotifier, error) {
+	n := &EmailNotifier{
+		Host:     config["host"],
+		Port:     config["port"],
+		Username: config["username"],
+		Password: config["password"],
+		From:     config["from"],
+		Security: config["security"],
+	}
+	for _, to := range strings.Split(config["to"], ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			n.To = append(n.To, to)
+		}
+	}
+	if n.Host == "" || n.From == "" || len(n.To) == 0 {
+		return nil, fmt.Errorf("email channel requires host, from and to")
+	}
+
+	if n.Security == "" {
+		n.Security = "starttls"
+	}
+	switch n.Security {
+	case "starttls", "none":
+		if n.Port == "" {
+			n.Port = "587"
+		}
+	case "tls":
+		if n.Port == "" {
+			n.Port = "465"
+		}
+	default:
+		return nil, fmt.Errorf("unsupported email security mode: %s", n.Security)
+	}
+	return n, nil
+}
+
+// Send 发送通知
+func (n *EmailNotifier) Send(ctx context.Context, notification *Notification) error {
+	addr := net.JoinHostPort(n.Host, n.Port)
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if n.Security == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: n.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server %s: %w", addr, err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, n.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if n.Security == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: n.Host}); err != nil {
+			return fmt.Errorf("smtp STARTTLS failed: %w", err)
+		}
+	}
+
+	if n.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", n.Username, n.Password, n.Host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(n.From); err != nil {
+		return fmt.Errorf("smtp MAIL FROM failed: %w", err)
+	}
+	for _, to := range n.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp RCPT TO %s failed: %w", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA failed: %w", err)
+	}
+	if _, err := writer.Write(n.buildMessage(notification)); err != nil {
+		writer.Close()
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("smtp server rejected email: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildMessage 生成 UTF-8 纯文本邮件
+func (n *EmailNotifier) buildMessage(notification *Notification) []byte {
+	var msg bytes.Buffer
+	msg.WriteString("From: " + n.From + "\r\n")
+	msg.WriteString("To: " + strings.Join(n.To, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", notificationTitle(notification)) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	body := quotedprintable.NewWriter(&msg)
+	body.Write([]byte(strings.ReplaceAll(notificationText(notification), "\n", "\r\n")))
+	body.Close()
+	return msg.Bytes()
+}
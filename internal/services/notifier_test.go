@@ -0,0 +1,417 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+func testNotification() *Notification {
+	return &Notification{
+		Alert: &models.SecurityAlert{
+			ID:          7,
+			UserID:      3,
+			ServerID:    5,
+			AlertType:   "suspicious_command",
+			Severity:    "high",
+			Description: "执行了 rm -rf /",
+			IPAddress:   "10.0.0.8",
+			CreatedAt:   time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		},
+		Username:   "alice",
+		ServerName: "web1",
+		ServerTags: []string{"prod"},
+	}
+}
+
+// capturedRequest httptest 服务收到的请求
+type capturedRequest struct {
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// newCaptureServer 记录请求并按 respond 返回响应
+func newCaptureServer(t *testing.T, status int, respond string) (*httptest.Server, func() []capturedRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, capturedRequest{URL: r.URL.String(), Header: r.Header.Clone(), Body: body})
+		mu.Unlock()
+		w.WriteHeader(status)
+		io.WriteString(w, respond)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []capturedRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]capturedRequest(nil), requests...)
+	}
+}
+
+func TestNewNotifierValidatesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		channel models.NotificationChannel
+		wantErr bool
+	}{
+		{"webhook", models.NotificationChannel{Type: "webhook", Config: map[string]string{"url": "http://x"}}, false},
+		{"webhook without url", models.NotificationChannel{Type: "webhook", Config: map[string]string{}}, true},
+		{"dingtalk without url", models.NotificationChannel{Type: "dingtalk", Config: map[string]string{}}, true},
+		{"feishu without url", models.NotificationChannel{Type: "feishu", Config: map[string]string{}}, true},
+		{"wecom without url", models.NotificationChannel{Type: "wecom", Config: map[string]string{}}, true},
+		{"email", models.NotificationChannel{Type: "email", Config: map[string]string{"host": "smtp", "from": "a@x", "to": "b@x"}}, false},
+		{"email without to", models.NotificationChannel{Type: "email", Config: map[string]string{"host": "smtp", "from": "a@x"}}, true},
+		{"email bad security", models.NotificationChannel{Type: "email", Config: map[string]string{"host": "smtp", "from": "a@x", "to": "b@x", "security": "ssl"}}, true},
+		{"unknown type", models.NotificationChannel{Type: "pager", Config: map[string]string{}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewNotifier(&tt.channel)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewNotifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmailNotifierDefaultPorts(t *testing.T) {
+	tests := []struct {
+		security string
+		want     string
+	}{
+		{"", "587"},
+		{"starttls", "587"},
+		{"none", "587"},
+		{"tls", "465"},
+	}
+	for _, tt := range tests {
+		n, err := newEmailNotifier(map[string]string{"host": "smtp", "from": "a@x", "to": "b@x, c@x", "security": tt.security})
+		if err != nil {
+			t.Fatalf("security %q: %v", tt.security, err)
+		}
+		if n.Port != tt.want {
+			t.Errorf("security %q: port = %s, want %s", tt.security, n.Port, tt.want)
+		}
+		if len(n.To) != 2 || n.To[1] != "c@x" {
+			t.Errorf("recipients = %v", n.To)
+		}
+	}
+}
+
+func TestWebhookNotifierSignsBody(t *testing.T) {
+	server, requests := newCaptureServer(t, http.StatusOK, "ok")
+	n := &WebhookNotifier{URL: server.URL, Secret: "s3cret"}
+	if err := n.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	got := requests()
+	if len(got) != 1 {
+		t.Fatalf("requests = %d, want 1", len(got))
+	}
+	req := got[0]
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(req.Header.Get("X-VeryJump-Timestamp") + "."))
+	mac.Write(req.Body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); req.Header.Get("X-VeryJump-Signature") != want {
+		t.Errorf("signature = %s, want %s", req.Header.Get("X-VeryJump-Signature"), want)
+	}
+
+	var payload struct {
+		Event string                `json:"event"`
+		Alert *models.SecurityAlert `json:"alert"`
+		User  string                `json:"username"`
+	}
+	if err := json.Unmarshal(req.Body, &payload); err != nil {
+		t.Fatalf("payload: %v", err)
+	}
+	if payload.Event != "security_alert" || payload.Alert.ID != 7 || payload.User != "alice" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookNotifierWithoutSecret(t *testing.T) {
+	server, requests := newCaptureServer(t, http.StatusOK, "ok")
+	if err := (&WebhookNotifier{URL: server.URL}).Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if h := requests()[0].Header.Get("X-VeryJump-Signature"); h != "" {
+		t.Errorf("unexpected signature header %q", h)
+	}
+}
+
+func TestWebhookNotifierHTTPError(t *testing.T) {
+	server, _ := newCaptureServer(t, http.StatusBadGateway, "upstream down")
+	err := (&WebhookNotifier{URL: server.URL}).Send(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "upstream down") {
+		t.Fatalf("err = %v, want endpoint error", err)
+	}
+}
+
+func TestDingTalkNotifier(t *testing.T) {
+	server, requests := newCaptureServer(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+	n := &DingTalkNotifier{URL: server.URL + "/robot/send?access_token=abc", Secret: "SEC"}
+	if err := n.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	req := requests()[0]
+	parsed, err := url.Parse(req.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := parsed.Query()
+	if values.Get("access_token") != "abc" {
+		t.Errorf("access_token lost: %s", req.URL)
+	}
+	mac := hmac.New(sha256.New, []byte("SEC"))
+	mac.Write([]byte(values.Get("timestamp") + "\nSEC"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); values.Get("sign") != want {
+		t.Errorf("sign = %s, want %s", values.Get("sign"), want)
+	}
+
+	var payload struct {
+		MsgType  string            `json:"msgtype"`
+		Markdown map[string]string `json:"markdown"`
+	}
+	json.Unmarshal(req.Body, &payload)
+	if payload.MsgType != "markdown" || !strings.Contains(payload.Markdown["text"], "服务器: web1 (prod)") {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestDingTalkNotifierRobotError(t *testing.T) {
+	server, _ := newCaptureServer(t, http.StatusOK, `{"errcode":310000,"errmsg":"sign not match"}`)
+	err := (&DingTalkNotifier{URL: server.URL}).Send(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "310000") {
+		t.Fatalf("err = %v, want robot errcode", err)
+	}
+}
+
+func TestFeishuNotifier(t *testing.T) {
+	server, requests := newCaptureServer(t, http.StatusOK, `{"code":0,"msg":"success"}`)
+	if err := (&FeishuNotifier{URL: server.URL, Secret: "SEC"}).Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var payload struct {
+		MsgType   string            `json:"msg_type"`
+		Content   map[string]string `json:"content"`
+		Timestamp string            `json:"timestamp"`
+		Sign      string            `json:"sign"`
+	}
+	json.Unmarshal(requests()[0].Body, &payload)
+	mac := hmac.New(sha256.New, []byte(payload.Timestamp+"\nSEC"))
+	if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); payload.Sign != want {
+		t.Errorf("sign = %s, want %s", payload.Sign, want)
+	}
+	if payload.MsgType != "text" || !strings.Contains(payload.Content["text"], "用户: alice") {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestFeishuNotifierRobotError(t *testing.T) {
+	server, _ := newCaptureServer(t, http.StatusOK, `{"code":19021,"msg":"sign match fail"}`)
+	err := (&FeishuNotifier{URL: server.URL}).Send(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "19021") {
+		t.Fatalf("err = %v, want robot code", err)
+	}
+}
+
+func TestWeComNotifier(t *testing.T) {
+	server, requests := newCaptureServer(t, http.StatusOK, `{"errcode":0,"errmsg":"ok"}`)
+	if err := (&WeComNotifier{URL: server.URL}).Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	var payload struct {
+		MsgType  string            `json:"msgtype"`
+		Markdown map[string]string `json:"markdown"`
+	}
+	json.Unmarshal(requests()[0].Body, &payload)
+	if payload.MsgType != "markdown" || !strings.Contains(payload.Markdown["content"], "[HIGH] 安全告警: suspicious_command") {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWeComNotifierUnexpectedResponse(t *testing.T) {
+	server, _ := newCaptureServer(t, http.StatusOK, "not json")
+	if err := (&WeComNotifier{URL: server.URL}).Send(context.Background(), testNotification()); err == nil {
+		t.Fatal("expected error for non-JSON robot response")
+	}
+}
+
+// fakeSMTPServer 最小的 SMTP 服务，记录收到的命令和邮件内容
+type fakeSMTPServer struct {
+	listener   net.Listener
+	extensions []string
+	rejectRcpt string
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func newFakeSMTPServer(t *testing.T, extensions ...string) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, extensions: extensions}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *fakeSMTPServer) port() string {
+	_, port, _ := net.SplitHostPort(s.listener.Addr().String())
+	return port
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 fake.smtp ESMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO", "HELO":
+			lines := append([]string{"fake.smtp"}, s.extensions...)
+			for i, ext := range lines {
+				if i == len(lines)-1 {
+					reply("250 " + ext)
+				} else {
+					reply("250-" + ext)
+				}
+			}
+		case "AUTH":
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			reply("250 OK")
+		case "RCPT":
+			if s.rejectRcpt != "" && strings.Contains(line, s.rejectRcpt) {
+				reply("550 no such user")
+			} else {
+				reply("250 OK")
+			}
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) snapshot() ([]string, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), s.data
+}
+
+func TestEmailNotifierSendsMail(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t, "AUTH PLAIN")
+	n, err := newEmailNotifier(map[string]string{
+		"host": "127.0.0.1", "port": smtpServer.port(), "security": "none",
+		"username": "bot", "password": "pw", "from": "alerts@example.com", "to": "sec@example.com,ops@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Send(context.Background(), testNotification()); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	commands, data := smtpServer.snapshot()
+	joined := strings.Join(commands, "\n")
+	for _, want := range []string{"AUTH PLAIN", "MAIL FROM:<alerts@example.com>", "RCPT TO:<sec@example.com>", "RCPT TO:<ops@example.com>", "QUIT"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing command %q in %v", want, commands)
+		}
+	}
+	if !strings.Contains(data, "Subject: =?utf-8?q?") || !strings.Contains(data, "Content-Type: text/plain; charset=UTF-8") {
+		t.Errorf("unexpected headers:\n%s", data)
+	}
+	if !strings.Contains(data, "10.0.0.8") {
+		t.Errorf("body missing alert details:\n%s", data)
+	}
+}
+
+func TestEmailNotifierRequiresSTARTTLS(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t)
+	n, _ := newEmailNotifier(map[string]string{"host": "127.0.0.1", "port": smtpServer.port(), "from": "a@x", "to": "b@x"})
+	err := n.Send(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("err = %v, want STARTTLS error", err)
+	}
+	if commands, _ := smtpServer.snapshot(); strings.Contains(strings.Join(commands, "\n"), "MAIL FROM") {
+		t.Error("mail sent in plaintext without STARTTLS")
+	}
+}
+
+func TestEmailNotifierRejectedRecipient(t *testing.T) {
+	smtpServer := newFakeSMTPServer(t)
+	smtpServer.rejectRcpt = "nobody@"
+	n, _ := newEmailNotifier(map[string]string{"host": "127.0.0.1", "port": smtpServer.port(), "security": "none", "from": "a@x", "to": "nobody@x"})
+	err := n.Send(context.Background(), testNotification())
+	if err == nil || !strings.Contains(err.Error(), "RCPT TO nobody@x") {
+		t.Fatalf("err = %v, want RCPT error", err)
+	}
+}
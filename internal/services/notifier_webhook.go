@@ -0,0 +1,204 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// notifierHTTPClient 通知请求使用的 HTTP 客户端
+var notifierHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+// postJSON 发送 JSON 请求，返回响应体；非 2xx 状态视为失败
+func postJSON(ctx context.Context, target string, payload interface{}, headers map[string]string) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return postBody(ctx, target, body, headers)
+}
+
+func postBody(ctx context.Context, target string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification url: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "very-jump-notifier/1.0")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := notifierHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("notification request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return respBody, fmt.Errorf("notification endpoint returned %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return respBody, nil
+}
+
+// robotResult 机器人接口的通用返回结构
+type robotResult struct {
+	ErrCode    *int   `json:"errcode"`    // 钉钉、企业微信
+	ErrMsg     string `json:"errmsg"`     // 钉钉、企业微信
+	Code       *int   `json:"code"`       // 飞书
+	Msg        string `json:"msg"`        // 飞书
+	StatusCode *int   `json:"StatusCode"` // 飞书旧版接口
+}
+
+// checkRobotResult 机器人接口在 HTTP 200 时也可能返回业务错误
+func checkRobotResult(body []byte) error {
+	var result robotResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("unexpected robot response: %s", strings.TrimSpace(string(body)))
+	}
+	switch {
+	case result.ErrCode != nil && *result.ErrCode != 0:
+		return fmt.Errorf("robot returned errcode %d: %s", *result.ErrCode, result.ErrMsg)
+	case result.Code != nil && *result.Code != 0:
+		return fmt.Errorf("robot returned code %d: %s", *result.Code, result.Msg)
+	case result.StatusCode != nil && *result.StatusCode != 0:
+		return fmt.Errorf("robot returned status %d: %s", *result.StatusCode, result.Msg)
+	}
+	return nil
+}
+
+// WebhookNotifier 通用 Webhook，配置 secret 时对请求体签名
+// 签名头 X-VeryJump-Signature: sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+}
+
+// webhookPayload 通用 Webhook 请求体
+type webhookPayload struct {
+	Event  string `json:"event"`
+	SentAt string `json:"sent_at"`
+	*Notification
+}
+
+// Send 发送通知
+func (n *WebhookNotifier) Send(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(webhookPayload{
+		Event:        "security_alert",
+		SentAt:       time.Now().UTC().Format(time.RFC3339),
+		Notification: notification,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	headers := map[string]string{}
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		headers["X-VeryJump-Timestamp"] = timestamp
+		headers["X-VeryJump-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	_, err = postBody(ctx, n.URL, body, headers)
+	return err
+}
+
+// DingTalkNotifier 钉钉群机器人，配置 secret 时使用加签模式
+type DingTalkNotifier struct {
+	URL    string
+	Secret string
+}
+
+// Send 发送通知
+func (n *DingTalkNotifier) Send(ctx context.Context, notification *Notification) error {
+	target := n.URL
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(n.Secret))
+		mac.Write([]byte(timestamp + "\n" + n.Secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+
+	payload := map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"title": notificationTitle(notification),
+			"text":  notificationMarkdown(notification),
+		},
+	}
+	body, err := postJSON(ctx, target, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkRobotResult(body)
+}
+
+// FeishuNotifier 飞书群机器人，配置 secret 时使用签名校验
+type FeishuNotifier struct {
+	URL    string
+	Secret string
+}
+
+// Send 发送通知
+func (n *FeishuNotifier) Send(ctx context.Context, notification *Notification) error {
+	payload := map[string]interface{}{
+		"msg_type": "text",
+		"content": map[string]string{
+			"text": notificationText(notification),
+		},
+	}
+	if n.Secret != "" {
+		// 飞书以 timestamp + "\n" + secret 作为 HMAC 密钥，对空串签名
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(timestamp+"\n"+n.Secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	body, err := postJSON(ctx, n.URL, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkRobotResult(body)
+}
+
+// WeComNotifier 企业微信群机器人
+type WeComNotifier struct {
+	URL string
+}
+
+// Send 发送通知
+func (n *WeComNotifier) Send(ctx context.Context, notification *Notification) error {
+	payload := map[string]interface{}{
+		"msgtype": "markdown",
+		"markdown": map[string]string{
+			"content": notificationMarkdown(notification),
+		},
+	}
+	body, err := postJSON(ctx, n.URL, payload, nil)
+	if err != nil {
+		return err
+	}
+	return checkRobotResult(body)
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"very-jump/internal/database/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	// ErrOIDCProviderNotFound 身份源不存在或未启用
+	ErrOIDCProviderNotFound = errors.New("身份源不存在或未启用")
+	// ErrInvalidOIDCState 登录请求已过期或不是由本系统发起
+	ErrInvalidOIDCState = errors.New("登录请求无效或已过期，请重新登录")
+	// ErrOIDCAccessDenied 身份源账号不属于允许登录的组，或未开通本系统账号
+	ErrOIDCAccessDenied = errors.New("该账号未开通或不允许通过此身份源登录")
+)
+
+const (
+	oidcStateTTL    = 10 * time.Minute // 跳转到身份源后完成登录的最长时间
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+// oidcClient 已完成发现的身份源客户端，身份源配置更新后重建
+type oidcClient struct {
+	updatedAt time.Time
+	provider  *oidc.Provider
+	verifier  *oidc.IDTokenVerifier
+}
+
+// oidcState 发起登录时保存的状态，回调时校验并一次性消费
+type oidcState struct {
+	provider     string
+	nonce        string
+	codeVerifier string
+	redirectURL  string
+	expiresAt    time.Time
+}
+
+// OIDCLoginResult 回调完成后的登录结果
+type OIDCLoginResult struct {
+	Response       *LoginResponse
+	Identity       *ExternalIdentity
+	Source         string
+	GrantedServers int // 按组映射同步的服务器授权数
+}
+
+// OIDCService OpenID Connect 单点登录
+// 使用授权码 + PKCE 流程：发起登录时生成 state、nonce 和 code_verifier，回调时换取并校验 ID 令牌，
+// 按声明映射本地用户、角色和服务器授权，最后签发与密码登录相同的令牌。
+type OIDCService struct {
+	providerService *models.OIDCProviderService
+	serverService   *models.ServerService
+	authService     *AuthService
+	httpClient      *http.Client
+
+	mutex   sync.Mutex
+	clients map[string]*oidcClient
+	states  map[string]*oidcState
+}
+
+// NewOIDCService 创建 OIDC 单点登录服务
+func NewOIDCService(db *sql.DB, authService *AuthService) *OIDCService {
+	return &OIDCService{
+		providerService: models.NewOIDCProviderService(db),
+		serverService:   models.NewServerService(db),
+		authService:     authService,
+		httpClient:      &http.Client{Timeout: oidcHTTPTimeout},
+		clients:         make(map[string]*oidcClient),
+		states:          make(map[string]*oidcState),
+	}
+}
+
+// GetProviderService 获取身份源配置服务
+func (s *OIDCService) GetProviderService() *models.OIDCProviderService {
+	return s.providerService
+}
+
+// Forget 丢弃身份源的缓存客户端，配置变更或删除后调用
+func (s *OIDCService) Forget(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.clients, name)
+}
+
+// Begin 发起登录，返回跳转到身份源的授权地址和 state
+func (s *OIDCService) Begin(name, redirectURL string) (string, string, error) {
+	provider, err := s.enabledProvider(name)
+	if err != nil {
+		return "", "", err
+	}
+	client, err := s.client(provider)
+	if err != nil {
+		return "", "", err
+	}
+	if provider.RedirectURL != "" {
+		redirectURL = provider.RedirectURL
+	}
+
+	state, err := randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	s.mutex.Lock()
+	s.pruneLocked(time.Now())
+	s.states[state] = &oidcState{
+		provider:     name,
+		nonce:        nonce,
+		codeVerifier: verifier,
+		redirectURL:  redirectURL,
+		expiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	s.mutex.Unlock()
+
+	authURL := s.oauth2Config(provider, client, redirectURL).AuthCodeURL(state,
+		oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+// Complete 处理身份源回调：消费 state，用授权码和 code_verifier 换取令牌并校验 ID 令牌，登录对应的本地用户
+func (s *OIDCService) Complete(ctx context.Context, name, state, code, ipAddress, userAgent string) (*OIDCLoginResult, error) {
+	s.mutex.Lock()
+	pending, ok := s.states[state]
+	delete(s.states, state)
+	s.mutex.Unlock()
+	if !ok || pending.provider != name || time.Now().After(pending.expiresAt) {
+		return nil, ErrInvalidOIDCState
+	}
+
+	provider, err := s.enabledProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.client(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, s.httpClient)
+	token, err := s.oauth2Config(provider, client, pending.redirectURL).Exchange(ctx, code, oauth2.VerifierOption(pending.codeVerifier))
+	if err != nil {
+		return nil, fmt.Errorf("换取令牌失败: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("身份源未返回 ID 令牌")
+	}
+	idToken, err := client.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("ID 令牌校验失败: %v", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, errors.New("ID 令牌 nonce 不匹配")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("解析 ID 令牌声明失败: %v", err)
+	}
+	identity, err := identityFromClaims(provider, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	source := provider.AuthSource()
+	response, err := s.authService.LoginExternal(source, provider.Provision, identity, ipAddress, userAgent)
+	if err == ErrInvalidCredentials {
+		return nil, ErrOIDCAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &OIDCLoginResult{Response: response, Identity: identity, Source: source}
+	granted, err := s.serverService.SyncSourceGrants(response.User.ID, source, grantedTags(provider, identity.Groups))
+	if err != nil {
+		log.Printf("Failed to sync server grants of %s from %s: %v", identity.Username, source, err)
+	} else {
+		result.GrantedServers = granted
+	}
+	return result, nil
+}
+
+// enabledProvider 获取已启用的身份源
+func (s *OIDCService) enabledProvider(name string) (*models.OIDCProvider, error) {
+	provider, err := s.providerService.GetByName(name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrOIDCProviderNotFound
+		}
+		return nil, err
+	}
+	if !provider.Enabled {
+		return nil, ErrOIDCProviderNotFound
+	}
+	return provider, nil
+}
+
+// client 获取身份源客户端，首次使用或配置变更后重新执行发现
+func (s *OIDCService) client(provider *models.OIDCProvider) (*oidcClient, error) {
+	s.mutex.Lock()
+	cached, ok := s.clients[provider.Name]
+	s.mutex.Unlock()
+	if ok && cached.updatedAt.Equal(provider.UpdatedAt) {
+		return cached, nil
+	}
+
+	// 发现结果和 JWKS 在后续请求中复用，不能绑定到单个请求的 context
+	ctx := oidc.ClientContext(context.Background(), s.httpClient)
+	discovered, err := oidc.NewProvider(ctx, provider.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("身份源发现失败: %v", err)
+	}
+	client := &oidcClient{
+		updatedAt: provider.UpdatedAt,
+		provider:  discovered,
+		verifier:  discovered.Verifier(&oidc.Config{ClientID: provider.ClientID}),
+	}
+
+	s.mutex.Lock()
+	s.clients[provider.Name] = client
+	s.mutex.Unlock()
+	return client, nil
+}
+
+// oauth2Config 构造授权码流程配置
+func (s *OIDCService) oauth2Config(provider *models.OIDCProvider, client *oidcClient, redirectURL string) *oauth2.Config {
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range provider.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return &oauth2.Config{
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		Endpoint:     client.provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// pruneLocked 清理过期的 state，调用方需持有锁
+func (s *OIDCService) pruneLocked(now time.Time) {
+	for key, state := range s.states {
+		if now.After(state.expiresAt) {
+			delete(s.states, key)
+		}
+	}
+}
+
+// identityFromClaims 从 ID 令牌声明中读取用户名和组，并映射角色
+func identityFromClaims(provider *models.OIDCProvider, claims map[string]interface{}) (*ExternalIdentity, error) {
+	username, _ := claims[provider.UsernameClaim].(string)
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" {
+		return nil, fmt.Errorf("ID 令牌缺少 %s 声明", provider.UsernameClaim)
+	}
+
+	groups := claimStrings(claims[provider.GroupsClaim])
+	role := mapGroupsToRole(groups, provider.AdminGroups, provider.UserGroups)
+	if role == "" {
+		return nil, ErrOIDCAccessDenied
+	}
+
+	return &ExternalIdentity{Username: username, Role: role, Groups: groups}, nil
+}
+
+// claimStrings 将字符串或字符串数组声明转换为切片
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
+
+// grantedTags 按用户所属组汇总身份源配置的服务器标签授权
+func grantedTags(provider *models.OIDCProvider, groups []string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for group, groupTags := range provider.ServerGrants {
+		if !matchGroups(groups, []string{group}) {
+			continue
+		}
+		for _, tag := range groupTags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordReused 新密码与最近使用过的密码相同
+var ErrPasswordReused = errors.New("不能使用最近使用过的密码")
+
+// PasswordPolicy 密码策略
+type PasswordPolicy struct {
+	MinLength  int `json:"min_length"`  // 最短长度
+	MinClasses int `json:"min_classes"` // 至少包含的字符类别数：小写字母、大写字母、数字、符号
+	History    int `json:"history"`     // 不能与当前及最近几次使用过的密码相同
+}
+
+// Validate 校验密码长度和字符类别，密码不能包含用户名
+func (p PasswordPolicy) Validate(password, username string) error {
+	if len([]rune(password)) < p.MinLength {
+		return fmt.Errorf("密码长度不能少于 %d 个字符", p.MinLength)
+	}
+	if classes := passwordClasses(password); classes < p.MinClasses {
+		return fmt.Errorf("密码至少需要包含小写字母、大写字母、数字、符号中的 %d 类", p.MinClasses)
+	}
+	if username != "" && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return errors.New("密码不能包含用户名")
+	}
+	return nil
+}
+
+// CheckReuse 检查新密码是否与给定的历史密码哈希之一相同，hashes 应按时间倒序
+func (p PasswordPolicy) CheckReuse(password string, hashes []string) error {
+	for i, hash := range hashes {
+		if i >= p.History {
+			break
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// passwordClasses 统计密码包含的字符类别数
+func passwordClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,676 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 连接策略表达式是 CEL 的一个子集：
+//   字面量：字符串（"..." 或 '...'）、数字、true/false、列表 [a, b]
+//   运算符：|| && ! == != < <= > >= in，括号分组
+//   变量：见 policyVariables，例如 user.role、server.tags、source.ip、time.hour
+//   函数：见 policyFunctions，例如 in_cidr(source.ip, "10.0.0.0/8")
+// 表达式在保存策略时编译，引用未知变量、函数或语法错误时拒绝保存
+
+// policyVariables 表达式可以引用的变量及说明
+var policyVariables = map[string]string{
+	"user.id":             "用户ID",
+	"user.name":           "用户名",
+	"user.role":           "角色",
+	"user.groups":         "所属用户组名称列表",
+	"user.account_type":   "账号类型：human 或 service",
+	"user.auth_source":    "身份源：local 或外部身份源名称",
+	"source.ip":           "发起连接的客户端IP",
+	"time.hour":           "当前小时（0-23，按 POLICY_TIMEZONE）",
+	"time.minute":         "当前分钟（0-59）",
+	"time.weekday":        "星期几（0 为星期日）",
+	"server.id":           "服务器ID",
+	"server.name":         "服务器名称",
+	"server.host":         "服务器地址",
+	"server.tags":         "服务器标签列表",
+	"request.reason":      "连接原因",
+	"request.ticket":      "工单号",
+	"request.break_glass": "是否在紧急访问期间连接",
+}
+
+// policyFunction 表达式内置函数，args 为已求值的参数
+type policyFunction struct {
+	minArgs int
+	maxArgs int // -1 表示不限
+	call    func(args []interface{}) (interface{}, error)
+}
+
+// policyFunctions 表达式可以调用的函数
+var policyFunctions = map[string]policyFunction{
+	"in_cidr": {minArgs: 2, maxArgs: -1, call: func(args []interface{}) (interface{}, error) {
+		ip, err := exprString(args[0], "in_cidr")
+		if err != nil {
+			return nil, err
+		}
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return false, nil
+		}
+		for _, arg := range args[1:] {
+			cidrs := []interface{}{arg}
+			if list, ok := arg.([]interface{}); ok {
+				cidrs = list
+			}
+			for _, item := range cidrs {
+				cidr, err := exprString(item, "in_cidr")
+				if err != nil {
+					return nil, err
+				}
+				_, network, err := net.ParseCIDR(cidr)
+				if err != nil {
+					return nil, fmt.Errorf("in_cidr: 无效的网段 %q", cidr)
+				}
+				if network.Contains(parsed) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}},
+	"starts_with": {minArgs: 2, maxArgs: 2, call: stringPredicate("starts_with", strings.HasPrefix)},
+	"ends_with":   {minArgs: 2, maxArgs: 2, call: stringPredicate("ends_with", strings.HasSuffix)},
+	"contains":    {minArgs: 2, maxArgs: 2, call: stringPredicate("contains", strings.Contains)},
+	"matches": {minArgs: 2, maxArgs: 2, call: func(args []interface{}) (interface{}, error) {
+		s, err := exprString(args[0], "matches")
+		if err != nil {
+			return nil, err
+		}
+		pattern, err := exprString(args[1], "matches")
+		if err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("matches: 无效的正则表达式 %q", pattern)
+		}
+		return re.MatchString(s), nil
+	}},
+	"lower": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		s, err := exprString(args[0], "lower")
+		if err != nil {
+			return nil, err
+		}
+		return strings.ToLower(s), nil
+	}},
+	"size": {minArgs: 1, maxArgs: 1, call: func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("size: 参数必须是字符串或列表")
+	}},
+}
+
+func stringPredicate(name string, fn func(s, sub string) bool) func(args []interface{}) (interface{}, error) {
+	return func(args []interface{}) (interface{}, error) {
+		s, err := exprString(args[0], name)
+		if err != nil {
+			return nil, err
+		}
+		sub, err := exprString(args[1], name)
+		if err != nil {
+			return nil, err
+		}
+		return fn(s, sub), nil
+	}
+}
+
+func exprString(v interface{}, name string) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: 参数必须是字符串", name)
+	}
+	return s, nil
+}
+
+// PolicyVariables 表达式可以引用的变量，按名称排序
+func PolicyVariables() []map[string]string {
+	names := make([]string, 0, len(policyVariables))
+	for name := range policyVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := make([]map[string]string, 0, len(names))
+	for _, name := range names {
+		variables = append(variables, map[string]string{"name": name, "description": policyVariables[name]})
+	}
+	return variables
+}
+
+// PolicyExpr 编译后的策略表达式
+type PolicyExpr struct {
+	source string
+	root   exprNode
+}
+
+// CompilePolicyExpr 编译策略表达式，检查语法、变量和函数
+func CompilePolicyExpr(source string) (*PolicyExpr, error) {
+	tokens, err := lexPolicyExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("位置 %d: 多余的内容 %q", tok.pos, tok.text)
+	}
+	return &PolicyExpr{source: source, root: root}, nil
+}
+
+// Eval 按变量求值，结果必须是布尔值
+func (e *PolicyExpr) Eval(vars map[string]interface{}) (bool, error) {
+	value, err := e.root.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("表达式的结果必须是布尔值")
+	}
+	return result, nil
+}
+
+// String 表达式原文
+func (e *PolicyExpr) String() string {
+	return e.source
+}
+
+// ---- 词法分析 ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexPolicyExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("位置 %d: 字符串没有结束", start)
+				}
+				if runes[i] == r {
+					i++
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					default:
+						sb.WriteRune(runes[i])
+					}
+					i++
+					continue
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokString, text: sb.String(), pos: start})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		default:
+			start := i
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch two {
+			case "&&", "||", "==", "!=", "<=", ">=":
+				tokens = append(tokens, exprToken{kind: tokOp, text: two, pos: start})
+				i += 2
+				continue
+			}
+			switch r {
+			case '!', '<', '>', '(', ')', '[', ']', ',', '-':
+				tokens = append(tokens, exprToken{kind: tokOp, text: string(r), pos: start})
+				i++
+			default:
+				return nil, fmt.Errorf("位置 %d: 无法识别的字符 %q", start, string(r))
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// ---- 语法分析 ----
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) accept(op string) bool {
+	if tok := p.peek(); tok.kind == tokOp && tok.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		tok := p.peek()
+		return fmt.Errorf("位置 %d: 需要 %q", tok.pos, op)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	op := ""
+	switch {
+	case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" || tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+		op = tok.text
+	case tok.kind == tokIdent && tok.text == "in":
+		op = "in"
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	if p.accept("-") {
+		tok := p.next()
+		if tok.kind != tokNumber {
+			return nil, fmt.Errorf("位置 %d: 负号后需要数字", tok.pos)
+		}
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("位置 %d: 无效的数字 %q", tok.pos, tok.text)
+		}
+		return &literalNode{value: -n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("位置 %d: 无效的数字 %q", tok.pos, tok.text)
+		}
+		return &literalNode{value: n}, nil
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		}
+		if p.accept("(") {
+			return p.parseCall(tok)
+		}
+		if _, ok := policyVariables[tok.text]; !ok {
+			return nil, fmt.Errorf("位置 %d: 未知的变量 %q", tok.pos, tok.text)
+		}
+		return &variableNode{name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		case "[":
+			items, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{items: items}, nil
+		}
+	case tokEOF:
+		return nil, fmt.Errorf("位置 %d: 表达式不完整", tok.pos)
+	}
+	return nil, fmt.Errorf("位置 %d: 意外的 %q", tok.pos, tok.text)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := policyFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("位置 %d: 未知的函数 %q", name.pos, name.text)
+	}
+	args, err := p.parseArgs(")")
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < fn.minArgs || (fn.maxArgs >= 0 && len(args) > fn.maxArgs) {
+		return nil, fmt.Errorf("位置 %d: 函数 %s 的参数个数不正确", name.pos, name.text)
+	}
+	// 字面量正则在编译时检查，避免保存后每次求值都失败
+	if name.text == "matches" {
+		if lit, ok := args[1].(*literalNode); ok {
+			if pattern, ok := lit.value.(string); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					return nil, fmt.Errorf("位置 %d: 无效的正则表达式 %q", name.pos, pattern)
+				}
+			}
+		}
+	}
+	return &callNode{name: name.text, fn: fn, args: args}, nil
+}
+
+// parseArgs 解析逗号分隔的表达式直到 closing，允许空列表
+func (p *exprParser) parseArgs(closing string) ([]exprNode, error) {
+	var items []exprNode
+	if p.accept(closing) {
+		return items, nil
+	}
+	for {
+		item, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		if p.accept(closing) {
+			return items, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ---- 求值 ----
+
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) {
+	return n.value, nil
+}
+
+type variableNode struct {
+	name string
+}
+
+func (n *variableNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, ok := vars[n.name]
+	if !ok {
+		return nil, fmt.Errorf("变量 %s 没有值", n.name)
+	}
+	return value, nil
+}
+
+type listNode struct {
+	items []exprNode
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	values := make([]interface{}, 0, len(n.items))
+	for _, item := range n.items {
+		value, err := item.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+type callNode struct {
+	name string
+	fn   policyFunction
+	args []exprNode
+}
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	args := make([]interface{}, 0, len(n.args))
+	for _, arg := range n.args {
+		value, err := arg.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+	return n.fn.call(args)
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+func (n *notNode) eval(vars map[string]interface{}) (interface{}, error) {
+	value, err := evalBool(n.operand, vars, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+type logicalNode struct {
+	op          string
+	left, right exprNode
+}
+
+// eval 短路求值：&& 左侧为 false、|| 左侧为 true 时不再计算右侧
+func (n *logicalNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := evalBool(n.left, vars, n.op)
+	if err != nil {
+		return nil, err
+	}
+	if (n.op == "&&" && !left) || (n.op == "||" && left) {
+		return left, nil
+	}
+	return evalBool(n.right, vars, n.op)
+}
+
+func evalBool(node exprNode, vars map[string]interface{}, op string) (bool, error) {
+	value, err := node.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%s 的操作数必须是布尔值", op)
+	}
+	return b, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(vars map[string]interface{}) (interface{}, error) {
+	left, err := n.left.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return exprEqual(left, right), nil
+	case "!=":
+		return !exprEqual(left, right), nil
+	case "in":
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("in 的右侧必须是列表")
+		}
+		for _, item := range list {
+			if exprEqual(left, item) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s 两侧的类型不一致", n.op)
+		}
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s 两侧的类型不一致", n.op)
+		}
+		cmp = strings.Compare(l, r)
+	default:
+		return nil, fmt.Errorf("%s 只能比较数字或字符串", n.op)
+	}
+
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+// exprEqual 类型不同时视为不相等
+func exprEqual(left, right interface{}) bool {
+	switch l := left.(type) {
+	case []interface{}:
+		r, ok := right.([]interface{})
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !exprEqual(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case string, float64, bool:
+		return left == right
+	}
+	return false
+}
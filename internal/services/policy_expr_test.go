@@ -0,0 +1,156 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/database/models"
+)
+
+// testPolicyInput 表达式测试使用的输入：周三 10:30（UTC），来自 10.20.30.40 连接带 prod、db 标签的服务器
+func testPolicyInput() *PolicyInput {
+	return &PolicyInput{
+		User:     &models.User{ID: 2, Username: "Alice", Role: models.RoleUser, AccountType: "human", AuthSource: models.AuthSourceLocal},
+		Groups:   []string{"ops"},
+		Server:   &models.Server{ID: 7, Name: "db1", Host: "10.1.2.3", Tags: []string{"prod", "db"}},
+		SourceIP: "10.20.30.40",
+		Time:     time.Date(2024, 1, 3, 10, 30, 0, 0, time.UTC),
+		Reason:   "deploy",
+	}
+}
+
+func TestPolicyExprEval(t *testing.T) {
+	vars := testPolicyInput().variables(time.UTC)
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		// 运算符优先级：! 高于比较，比较高于 &&，&& 高于 ||
+		{"and binds tighter than or", `true || false && false`, true},
+		{"parentheses override precedence", `(true || false) && false`, false},
+		{"not binds tighter than and", `!false && false`, false},
+		{"not of group", `!(false && false)`, true},
+		{"comparison binds tighter than and", `user.role == "user" && server.name == "db1"`, true},
+		{"or of comparisons", `user.role == "admin" || user.id == 2`, true},
+		{"short circuit and skips type error", `false && size(1) > 0`, false},
+		{"short circuit or skips type error", `true || size(1) > 0`, true},
+		{"negative number", `-1 < 0`, true},
+		{"string ordering", `"a" < "b"`, true},
+		{"different types not equal", `user.id == "2"`, false},
+		{"list equality", `server.tags == ["prod", "db"]`, true},
+		{"bool variable", `!request.break_glass`, true},
+
+		// CIDR
+		{"in_cidr match", `in_cidr(source.ip, "10.0.0.0/8")`, true},
+		{"in_cidr no match", `in_cidr(source.ip, "192.168.0.0/16")`, false},
+		{"in_cidr any argument", `in_cidr(source.ip, "192.168.0.0/16", "10.20.0.0/16")`, true},
+		{"in_cidr list argument", `in_cidr(source.ip, ["192.168.0.0/16", "10.20.30.0/24"])`, true},
+		{"in_cidr invalid ip", `in_cidr("not-an-ip", "10.0.0.0/8")`, false},
+		{"in_cidr ipv6", `in_cidr("fd00::1", "fd00::/8")`, true},
+
+		// 时间
+		{"office hours", `time.hour >= 9 && time.hour < 18`, true},
+		{"outside office hours", `time.hour < 9 || time.hour >= 18`, false},
+		{"minute", `time.minute == 30`, true},
+		{"weekday in workdays", `time.weekday in [1, 2, 3, 4, 5]`, true},
+		{"weekday weekend", `time.weekday in [0, 6]`, false},
+
+		// 标签、用户组和字符串函数
+		{"tag in server tags", `"prod" in server.tags`, true},
+		{"tag not in server tags", `"dev" in server.tags`, false},
+		{"tag count", `size(server.tags) == 2`, true},
+		{"group membership", `"ops" in user.groups`, true},
+		{"starts_with", `starts_with(server.name, "db")`, true},
+		{"ends_with", `ends_with(server.host, ".4")`, false},
+		{"contains", `contains(request.reason, "ploy")`, true},
+		{"matches", `matches(server.host, "^10\\.1\\.")`, true},
+		{"lower", `lower(user.name) == "alice"`, true},
+		{"string size", `size(request.reason) > 0`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := CompilePolicyExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("compile %q: %v", tt.expr, err)
+			}
+			got, err := expr.Eval(vars)
+			if err != nil {
+				t.Fatalf("eval %q: %v", tt.expr, err)
+			}
+			if got != tt.want {
+				t.Errorf("eval %q = %v, want %v", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyExprEvalTypeErrors(t *testing.T) {
+	vars := testPolicyInput().variables(time.UTC)
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"mismatched comparison", `user.role < 1`, "类型不一致"},
+		{"compare bools", `true < false`, "只能比较数字或字符串"},
+		{"and with string", `user.name && true`, "必须是布尔值"},
+		{"not of string", `!user.name`, "必须是布尔值"},
+		{"in without list", `"x" in user.name`, "右侧必须是列表"},
+		{"non-bool result", `user.name`, "结果必须是布尔值"},
+		{"string function on list", `starts_with(server.tags, "p")`, "参数必须是字符串"},
+		{"size of bool", `size(true)`, "参数必须是字符串或列表"},
+		{"in_cidr non-string ip", `in_cidr(user.id, "10.0.0.0/8")`, "参数必须是字符串"},
+		{"in_cidr invalid network", `in_cidr(source.ip, "10.0.0.0/33")`, "无效的网段"},
+		{"matches non-literal invalid pattern", `matches(server.name, lower("["))`, "无效的正则表达式"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := CompilePolicyExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("compile %q: %v", tt.expr, err)
+			}
+			got, err := expr.Eval(vars)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("eval %q = %v, %v; want error containing %q", tt.expr, got, err, tt.wantErr)
+			}
+			if got {
+				t.Errorf("eval %q returned true with error", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCompilePolicyExprErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"empty", ``, "表达式不完整"},
+		{"missing operand", `user.role ==`, "表达式不完整"},
+		{"unclosed group", `(true || false`, `需要 ")"`},
+		{"unclosed list", `time.hour in [1, 2`, `需要 ","`},
+		{"unterminated string", `user.name == "alice`, "字符串没有结束"},
+		{"single equals", `user.role = "admin"`, "无法识别的字符"},
+		{"trailing tokens", `true false`, "多余的内容"},
+		{"chained comparison", `1 < 2 < 3`, "多余的内容"},
+		{"unknown variable", `user.email == "a@b"`, "未知的变量"},
+		{"unknown function", `now() > 0`, "未知的函数"},
+		{"too few arguments", `in_cidr(source.ip)`, "参数个数不正确"},
+		{"too many arguments", `lower(user.name, "x")`, "参数个数不正确"},
+		{"invalid literal regex", `matches(user.name, "[")`, "无效的正则表达式"},
+		{"minus without number", `-user.id < 0`, "负号后需要数字"},
+		{"invalid number", `time.hour == 1.2.3`, "无效的数字"},
+		{"dangling operator", `&& true`, "意外的"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompilePolicyExpr(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("compile %q: err = %v, want error containing %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
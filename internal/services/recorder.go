@@ -19,8 +19,13 @@ type SessionRecorder struct {
 	isRecording bool
 	width       int
 	height      int
+	header      []byte                   // asciinema 头部，实时查看时先发送
+	subscribers map[chan []byte]struct{} // 实时查看的订阅者，每条事件是一行 asciinema 记录
 }
 
+// liveTailBuffer 每个实时查看订阅者缓冲的事件数，订阅者跟不上时丢弃事件而不阻塞录制
+const liveTailBuffer = 256
+
 // AsciinemaHeader asciinema文件头
 type AsciinemaHeader struct {
 	Version   int    `json:"version"`
@@ -85,6 +90,7 @@ func (r *SessionRecorder) Start() error {
 	if _, err := r.file.Write(append(headerBytes, '\n')); err != nil {
 		return fmt.Errorf("failed to write header: %v", err)
 	}
+	r.header = headerBytes
 
 	log.Printf("Started recording for session %s to file %s", r.sessionID, r.filePath)
 	return nil
@@ -139,11 +145,7 @@ func (r *SessionRecorder) WriteOutput(data []byte) error {
 		return fmt.Errorf("failed to marshal event: %v", err)
 	}
 
-	if _, err := r.file.Write(append(eventBytes, '\n')); err != nil {
-		return fmt.Errorf("failed to write event: %v", err)
-	}
-
-	return nil
+	return r.writeEvent(eventBytes)
 }
 
 // WriteInput 录制输入数据
@@ -193,11 +195,7 @@ func (r *SessionRecorder) WriteInput(data []byte) error {
 		return fmt.Errorf("failed to marshal event: %v", err)
 	}
 
-	if _, err := r.file.Write(append(eventBytes, '\n')); err != nil {
-		return fmt.Errorf("failed to write event: %v", err)
-	}
-
-	return nil
+	return r.writeEvent(eventBytes)
 }
 
 // Stop 停止录制
@@ -210,6 +208,10 @@ func (r *SessionRecorder) Stop() error {
 	}
 
 	r.isRecording = false
+	for ch := range r.subscribers {
+		close(ch)
+	}
+	r.subscribers = nil
 
 	if err := r.file.Close(); err != nil {
 		log.Printf("Failed to close recording file: %v", err)
@@ -231,3 +233,45 @@ func (r *SessionRecorder) IsRecording() bool {
 func (r *SessionRecorder) GetFilePath() string {
 	return r.filePath
 }
+
+// writeEvent 写入一条事件并转发给实时查看的订阅者，调用方需持有锁
+func (r *SessionRecorder) writeEvent(event []byte) error {
+	line := append(event, '\n')
+	if _, err := r.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write event: %v", err)
+	}
+	for ch := range r.subscribers {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+	return nil
+}
+
+// Subscribe 订阅会话的实时输出，返回 asciinema 头部、事件通道和取消订阅函数
+// 录制结束时通道被关闭；没有在录制时返回 false
+func (r *SessionRecorder) Subscribe() ([]byte, <-chan []byte, func(), bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.isRecording {
+		return nil, nil, nil, false
+	}
+	if r.subscribers == nil {
+		r.subscribers = make(map[chan []byte]struct{})
+	}
+	ch := make(chan []byte, liveTailBuffer)
+	r.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if _, ok := r.subscribers[ch]; ok {
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+	header := append(append(make([]byte, 0, len(r.header)+1), r.header...), '\n')
+	return header, ch, unsubscribe, true
+}
@@ -0,0 +1,446 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+var (
+	// ErrInvalidSAMLState 登录请求已过期或不是由本系统发起
+	ErrInvalidSAMLState = errors.New("登录请求无效或已过期，请重新登录")
+	// ErrInvalidSAMLResponse SAML 响应签名、有效期或接收方校验未通过
+	ErrInvalidSAMLResponse = errors.New("SAML 响应无效或签名校验失败")
+	// ErrSAMLAccessDenied 账号不属于允许登录的组，或未开通本系统账号
+	ErrSAMLAccessDenied = errors.New("该账号未开通或不允许通过 SAML 登录")
+)
+
+const (
+	samlRequestTTL       = 10 * time.Minute // 跳转到 IdP 后完成登录的最长时间
+	samlMetadataRefresh  = 24 * time.Hour   // 从地址获取的 IdP 元数据刷新间隔
+	samlHTTPTimeout      = 10 * time.Second
+	samlMetadataPath     = "/api/v1/auth/saml/metadata"
+	samlACSPath          = "/api/v1/auth/saml/acs"
+	samlCertificateValid = 10 * 365 * 24 * time.Hour
+)
+
+// SAMLConfig SAML 2.0 服务提供方（SP）配置
+type SAMLConfig struct {
+	DisplayName       string
+	RootURL           string
+	EntityID          string
+	IDPMetadataURL    string
+	IDPMetadataFile   string
+	CertFile          string
+	KeyFile           string
+	SignRequests      bool
+	UsernameAttribute string // 为空时使用 NameID
+	GroupsAttribute   string
+	AdminGroups       []string
+	UserGroups        []string
+	Provision         bool
+}
+
+// SAMLConfigFromConfig 从应用配置读取 SAML 配置
+func SAMLConfigFromConfig(cfg *config.Config) SAMLConfig {
+	return SAMLConfig{
+		DisplayName:       cfg.SAMLDisplayName,
+		RootURL:           cfg.SAMLRootURL,
+		EntityID:          cfg.SAMLEntityID,
+		IDPMetadataURL:    cfg.SAMLIDPMetadataURL,
+		IDPMetadataFile:   cfg.SAMLIDPMetadataFile,
+		CertFile:          cfg.SAMLSPCertFile,
+		KeyFile:           cfg.SAMLSPKeyFile,
+		SignRequests:      cfg.SAMLSignRequests,
+		UsernameAttribute: cfg.SAMLUsernameAttribute,
+		GroupsAttribute:   cfg.SAMLGroupsAttribute,
+		AdminGroups:       cfg.SAMLAdminGroups,
+		UserGroups:        cfg.SAMLUserGroups,
+		Provision:         cfg.SAMLProvision,
+	}
+}
+
+// samlRequest 发起登录时保存的认证请求，断言的 InResponseTo 必须与之匹配
+type samlRequest struct {
+	requestID string
+	expiresAt time.Time
+}
+
+// SAMLLoginResult 断言校验通过后的登录结果
+type SAMLLoginResult struct {
+	Response *LoginResponse
+	Identity *ExternalIdentity
+}
+
+// SAMLService SAML 2.0 单点登录
+// 本系统作为 SP：以 HTTP-Redirect 绑定发送签名的认证请求，在断言消费地址以 HTTP-POST 绑定接收响应，
+// 要求响应或断言带有 IdP 签名，支持用 SP 私钥解密的加密断言；只接受本系统发起的请求对应的响应。
+// 断言属性按组映射角色后登录对应的本地用户（auth_source=saml），签发与密码登录相同的令牌
+type SAMLService struct {
+	cfg         SAMLConfig
+	sp          saml.ServiceProvider // 不含 IdP 元数据的模板，使用时复制
+	authService *AuthService
+	httpClient  *http.Client
+
+	mutex       sync.Mutex
+	idpMetadata *saml.EntityDescriptor
+	loadedAt    time.Time
+	requests    map[string]*samlRequest
+}
+
+// NewSAMLService 创建 SAML 单点登录服务，SP 证书未配置时在数据目录生成自签名证书
+func NewSAMLService(cfg SAMLConfig, dataDir string, authService *AuthService) (*SAMLService, error) {
+	rootURL, err := url.Parse(strings.TrimSuffix(cfg.RootURL, "/"))
+	if err != nil || rootURL.Scheme == "" || rootURL.Host == "" {
+		return nil, errors.New("SAML_ROOT_URL 必须是完整的访问地址，如 https://jump.example.com")
+	}
+	if cfg.IDPMetadataURL == "" && cfg.IDPMetadataFile == "" {
+		return nil, errors.New("SAML_IDP_METADATA_URL 和 SAML_IDP_METADATA_FILE 不能同时为空")
+	}
+	if cfg.GroupsAttribute == "" {
+		cfg.GroupsAttribute = "groups"
+	}
+
+	key, cert, err := loadSAMLKeyPair(cfg, dataDir, rootURL.Hostname())
+	if err != nil {
+		return nil, err
+	}
+
+	metadataURL := *rootURL
+	metadataURL.Path += samlMetadataPath
+	acsURL := *rootURL
+	acsURL.Path += samlACSPath
+
+	s := &SAMLService{
+		cfg:         cfg,
+		authService: authService,
+		httpClient:  &http.Client{Timeout: samlHTTPTimeout},
+		requests:    make(map[string]*samlRequest),
+	}
+	s.sp = saml.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       metadataURL,
+		AcsURL:            acsURL,
+		HTTPClient:        s.httpClient,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if cfg.SignRequests {
+		s.sp.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+
+	// 元数据文件配置错误时直接报错；元数据地址暂时无法访问时登录时再重试
+	if _, err := s.provider(); err != nil {
+		if cfg.IDPMetadataFile != "" {
+			return nil, err
+		}
+		log.Printf("Failed to load SAML IdP metadata, will retry on login: %v", err)
+	}
+	return s, nil
+}
+
+// DisplayName 登录页按钮名称
+func (s *SAMLService) DisplayName() string {
+	return s.cfg.DisplayName
+}
+
+// Metadata 生成 SP 元数据，供 IdP 导入
+func (s *SAMLService) Metadata() ([]byte, error) {
+	descriptor := s.sp.Metadata()
+	// 只支持 HTTP-POST 绑定，不在元数据中声明 Artifact 绑定，避免 IdP 选择本系统不处理的方式
+	for i := range descriptor.SPSSODescriptors {
+		services := []saml.IndexedEndpoint{}
+		for _, endpoint := range descriptor.SPSSODescriptors[i].AssertionConsumerServices {
+			if endpoint.Binding == saml.HTTPPostBinding {
+				services = append(services, endpoint)
+			}
+		}
+		descriptor.SPSSODescriptors[i].AssertionConsumerServices = services
+	}
+
+	data, err := xml.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// Begin 发起登录，返回跳转到 IdP 的地址和 RelayState
+func (s *SAMLService) Begin() (string, string, error) {
+	sp, err := s.provider()
+	if err != nil {
+		return "", "", err
+	}
+	location := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if location == "" {
+		return "", "", errors.New("IdP 元数据缺少 HTTP-Redirect 绑定的单点登录地址")
+	}
+
+	req, err := sp.MakeAuthenticationRequest(location, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return "", "", fmt.Errorf("生成认证请求失败: %v", err)
+	}
+	relayState, err := randomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	redirectURL, err := req.Redirect(relayState, sp)
+	if err != nil {
+		return "", "", fmt.Errorf("签名认证请求失败: %v", err)
+	}
+
+	now := time.Now()
+	s.mutex.Lock()
+	for key, pending := range s.requests {
+		if now.After(pending.expiresAt) {
+			delete(s.requests, key)
+		}
+	}
+	s.requests[relayState] = &samlRequest{requestID: req.ID, expiresAt: now.Add(samlRequestTTL)}
+	s.mutex.Unlock()
+
+	return redirectURL.String(), relayState, nil
+}
+
+// Complete 处理断言消费地址收到的响应：消费 RelayState，校验签名、接收方、有效期和 InResponseTo，登录对应的本地用户
+func (s *SAMLService) Complete(relayState, samlResponse, ipAddress, userAgent string) (*SAMLLoginResult, error) {
+	s.mutex.Lock()
+	pending, ok := s.requests[relayState]
+	delete(s.requests, relayState)
+	s.mutex.Unlock()
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, ErrInvalidSAMLState
+	}
+
+	sp, err := s.provider()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(samlResponse)
+	if err != nil {
+		return nil, ErrInvalidSAMLResponse
+	}
+	assertion, err := sp.ParseXMLResponse(raw, []string{pending.requestID})
+	if err != nil {
+		// 详细原因只写日志，不返回给浏览器
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		log.Printf("Rejected SAML response: %v", err)
+		return nil, ErrInvalidSAMLResponse
+	}
+
+	identity, err := s.identityFromAssertion(assertion)
+	if err != nil {
+		return nil, err
+	}
+	response, err := s.authService.LoginExternal(models.AuthSourceSAML, s.cfg.Provision, identity, ipAddress, userAgent)
+	if err == ErrInvalidCredentials {
+		return nil, ErrSAMLAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SAMLLoginResult{Response: response, Identity: identity}, nil
+}
+
+// provider 返回带有 IdP 元数据的 SP 副本，元数据来自地址时定期刷新，刷新失败时继续使用旧的元数据
+func (s *SAMLService) provider() (*saml.ServiceProvider, error) {
+	s.mutex.Lock()
+	metadata, loadedAt := s.idpMetadata, s.loadedAt
+	s.mutex.Unlock()
+
+	if metadata == nil || (s.cfg.IDPMetadataFile == "" && time.Since(loadedAt) > samlMetadataRefresh) {
+		loaded, err := s.loadIDPMetadata()
+		if err != nil {
+			if metadata == nil {
+				return nil, err
+			}
+			log.Printf("Failed to refresh SAML IdP metadata, using cached copy: %v", err)
+		} else {
+			metadata = loaded
+			s.mutex.Lock()
+			s.idpMetadata, s.loadedAt = loaded, time.Now()
+			s.mutex.Unlock()
+		}
+	}
+
+	sp := s.sp
+	sp.IDPMetadata = metadata
+	return &sp, nil
+}
+
+// loadIDPMetadata 读取 IdP 元数据，支持单个 EntityDescriptor 或包含 IdP 的 EntitiesDescriptor
+func (s *SAMLService) loadIDPMetadata() (*saml.EntityDescriptor, error) {
+	var data []byte
+	if s.cfg.IDPMetadataFile != "" {
+		content, err := os.ReadFile(s.cfg.IDPMetadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 IdP 元数据失败: %v", err)
+		}
+		data = content
+	} else {
+		resp, err := s.httpClient.Get(s.cfg.IDPMetadataURL)
+		if err != nil {
+			return nil, fmt.Errorf("获取 IdP 元数据失败: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("获取 IdP 元数据失败: HTTP %d", resp.StatusCode)
+		}
+		content, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		if err != nil {
+			return nil, fmt.Errorf("获取 IdP 元数据失败: %v", err)
+		}
+		data = content
+	}
+
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil && len(entity.IDPSSODescriptors) > 0 {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err == nil {
+		for i := range entities.EntityDescriptors {
+			if len(entities.EntityDescriptors[i].IDPSSODescriptors) > 0 {
+				return &entities.EntityDescriptors[i], nil
+			}
+		}
+	}
+	return nil, errors.New("IdP 元数据格式无效或不包含 IDPSSODescriptor")
+}
+
+// identityFromAssertion 从断言中读取用户名和组，并映射角色
+func (s *SAMLService) identityFromAssertion(assertion *saml.Assertion) (*ExternalIdentity, error) {
+	username := ""
+	if s.cfg.UsernameAttribute != "" {
+		if values := assertionAttribute(assertion, s.cfg.UsernameAttribute); len(values) > 0 {
+			username = values[0]
+		}
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		username = assertion.Subject.NameID.Value
+	}
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" {
+		if s.cfg.UsernameAttribute != "" {
+			return nil, fmt.Errorf("断言缺少 %s 属性", s.cfg.UsernameAttribute)
+		}
+		return nil, errors.New("断言缺少 NameID")
+	}
+
+	groups := assertionAttribute(assertion, s.cfg.GroupsAttribute)
+	role := mapGroupsToRole(groups, s.cfg.AdminGroups, s.cfg.UserGroups)
+	if role == "" {
+		return nil, ErrSAMLAccessDenied
+	}
+	return &ExternalIdentity{Username: username, Role: role, Groups: groups}, nil
+}
+
+// assertionAttribute 按 Name 或 FriendlyName 读取断言属性的全部取值
+func assertionAttribute(assertion *saml.Assertion, name string) []string {
+	values := []string{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				if value.Value != "" {
+					values = append(values, value.Value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// loadSAMLKeyPair 读取 SP 证书和私钥；均未配置时使用数据目录中的密钥对，不存在则生成自签名证书
+func loadSAMLKeyPair(cfg SAMLConfig, dataDir, hostname string) (*rsa.PrivateKey, *x509.Certificate, error) {
+	certFile, keyFile := cfg.CertFile, cfg.KeyFile
+	if certFile == "" && keyFile == "" {
+		certFile = filepath.Join(dataDir, "saml", "sp.crt")
+		keyFile = filepath.Join(dataDir, "saml", "sp.key")
+		if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+			if err := generateSAMLKeyPair(certFile, keyFile, hostname); err != nil {
+				return nil, nil, fmt.Errorf("生成 SAML SP 证书失败: %v", err)
+			}
+			log.Printf("Generated SAML service provider certificate at %s", certFile)
+		}
+	} else if certFile == "" || keyFile == "" {
+		return nil, nil, errors.New("SAML_SP_CERT_FILE 和 SAML_SP_KEY_FILE 必须同时配置")
+	}
+
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取 SAML SP 证书失败: %v", err)
+	}
+	key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, errors.New("SAML SP 私钥必须是 RSA 密钥")
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析 SAML SP 证书失败: %v", err)
+	}
+	return key, cert, nil
+}
+
+// generateSAMLKeyPair 生成 RSA 2048 密钥和自签名证书，SAML 只使用证书中的公钥，不校验证书链
+func generateSAMLKeyPair(certFile, keyFile, hostname string) error {
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"Very Jump"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(samlCertificateValid),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
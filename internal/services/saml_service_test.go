@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"very-jump/internal/database/models"
+
+	"github.com/crewjam/saml"
+)
+
+// testAssertion 构造带 NameID 和属性的断言，nameID 为空时不含 Subject
+func testAssertion(nameID string, attributes ...saml.Attribute) *saml.Assertion {
+	assertion := &saml.Assertion{AttributeStatements: []saml.AttributeStatement{{Attributes: attributes}}}
+	if nameID != "" {
+		assertion.Subject = &saml.Subject{NameID: &saml.NameID{Value: nameID}}
+	}
+	return assertion
+}
+
+func testAttribute(name, friendlyName string, values ...string) saml.Attribute {
+	attribute := saml.Attribute{Name: name, FriendlyName: friendlyName}
+	for _, value := range values {
+		attribute.Values = append(attribute.Values, saml.AttributeValue{Type: "xs:string", Value: value})
+	}
+	return attribute
+}
+
+func TestSAMLIdentityFromAssertion(t *testing.T) {
+	tests := []struct {
+		name              string
+		usernameAttribute string
+		assertion         *saml.Assertion
+		wantUsername      string
+		wantRole          string
+		wantErr           string
+	}{
+		{"NameID is normalized", "", testAssertion(" Alice ", testAttribute("groups", "", "developers")), "alice", models.RoleUser, ""},
+		{"admin group", "", testAssertion("alice", testAttribute("groups", "", "admins")), "alice", models.RoleAdmin, ""},
+		{"admin wins over user group", "", testAssertion("alice", testAttribute("groups", "", "developers", "admins")), "alice", models.RoleAdmin, ""},
+		{"group DN matches by CN", "", testAssertion("alice", testAttribute("groups", "", "cn=admins,ou=groups,dc=example,dc=com")), "alice", models.RoleAdmin, ""},
+		{"groups by friendly name", "", testAssertion("alice", testAttribute("urn:oid:1.3.6.1.4.1.5923.1.1.1.1", "groups", "developers")), "alice", models.RoleUser, ""},
+		{"no allowed group", "", testAssertion("alice", testAttribute("groups", "", "contractors")), "", "", ErrSAMLAccessDenied.Error()},
+		{"no groups attribute", "", testAssertion("alice"), "", "", ErrSAMLAccessDenied.Error()},
+		{"missing NameID", "", testAssertion("", testAttribute("groups", "", "admins")), "", "", "NameID"},
+		{"blank NameID", "", testAssertion("  ", testAttribute("groups", "", "admins")), "", "", "NameID"},
+		{"username attribute overrides NameID", "uid", testAssertion("transient-id", testAttribute("uid", "", "Bob"), testAttribute("groups", "", "developers")), "bob", models.RoleUser, ""},
+		{"missing username attribute", "uid", testAssertion("transient-id", testAttribute("groups", "", "developers")), "", "", "uid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &SAMLService{cfg: SAMLConfig{
+				UsernameAttribute: tt.usernameAttribute,
+				GroupsAttribute:   "groups",
+				AdminGroups:       []string{"admins"},
+				UserGroups:        []string{"developers"},
+			}}
+			identity, err := s.identityFromAssertion(tt.assertion)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("identity = %+v, err = %v; want error containing %q", identity, err, tt.wantErr)
+				}
+				if tt.wantErr == ErrSAMLAccessDenied.Error() && !errors.Is(err, ErrSAMLAccessDenied) {
+					t.Errorf("err = %v, want ErrSAMLAccessDenied", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("identity from assertion: %v", err)
+			}
+			if identity.Username != tt.wantUsername || identity.Role != tt.wantRole {
+				t.Errorf("identity = %s/%s, want %s/%s", identity.Username, identity.Role, tt.wantUsername, tt.wantRole)
+			}
+		})
+	}
+}
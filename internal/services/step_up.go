@@ -0,0 +1,187 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"very-jump/internal/database/models"
+	"very-jump/internal/middleware"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrStepUpFailed 重新验证身份时密码或验证码错误
+	ErrStepUpFailed = errors.New("密码或验证码错误")
+	// ErrStepUpMethodRequired 没有提供密码或验证码
+	ErrStepUpMethodRequired = errors.New("请提供密码或动态验证码")
+	// ErrTOTPNotEnabled 用户没有启用动态验证码
+	ErrTOTPNotEnabled = errors.New("未启用动态验证码")
+	// ErrTOTPAlreadyEnabled 用户已启用动态验证码，需要先停用才能重新设置
+	ErrTOTPAlreadyEnabled = errors.New("已启用动态验证码，请先停用")
+	// ErrTOTPNotSetup 启用前没有生成密钥
+	ErrTOTPNotSetup = errors.New("请先生成动态验证码密钥")
+	// ErrInvalidTOTPCode 动态验证码错误或已被使用
+	ErrInvalidTOTPCode = errors.New("动态验证码错误或已被使用")
+)
+
+// 重新验证身份的方式
+const (
+	StepUpMethodPassword = "password"
+	StepUpMethodTOTP     = "totp"
+)
+
+// StepUpRequest 重新验证身份请求，密码和动态验证码二选一
+type StepUpRequest struct {
+	Password string `json:"password"`
+	TOTPCode string `json:"totp_code"`
+}
+
+// StepUpResponse 重新验证身份响应，二次认证令牌通过 X-Step-Up-Token 请求头发送
+type StepUpResponse struct {
+	StepUpToken string    `json:"step_up_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Method      string    `json:"method"`
+}
+
+// TOTPSetupResponse 生成动态验证码密钥的响应，确认验证码后才启用
+type TOTPSetupResponse struct {
+	Secret string `json:"secret"`
+	URL    string `json:"otpauth_url"`
+}
+
+// StepUp 重新验证当前登录用户的身份，签发绑定登录会话的短期二次认证令牌
+// 外部身份源（如 LDAP）的账号通过身份源校验密码；单点登录账号只能使用动态验证码
+func (s *AuthService) StepUp(userID int, sessionID string, req *StepUpRequest) (*StepUpResponse, error) {
+	user, err := s.userService.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUserActive(user); err != nil {
+		return nil, err
+	}
+
+	var method string
+	switch {
+	case req.TOTPCode != "":
+		if err := s.checkTOTP(userID, req.TOTPCode); err != nil {
+			return nil, err
+		}
+		method = StepUpMethodTOTP
+	case req.Password != "":
+		authenticated, err := s.authenticate(user.Username, req.Password)
+		if err == ErrInvalidCredentials || (err == nil && authenticated.ID != user.ID) {
+			return nil, ErrStepUpFailed
+		}
+		if err != nil {
+			return nil, err
+		}
+		method = StepUpMethodPassword
+	default:
+		return nil, ErrStepUpMethodRequired
+	}
+
+	return s.issueStepUpToken(user.ID, sessionID, method)
+}
+
+// checkTOTP 校验已启用的动态验证码，同一时间步的验证码只能使用一次
+func (s *AuthService) checkTOTP(userID int, code string) error {
+	totp, err := s.totpService.Get(userID)
+	if err == sql.ErrNoRows || (err == nil && !totp.Enabled) {
+		return ErrTOTPNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	step, ok := verifyTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return ErrStepUpFailed
+	}
+	used, err := s.totpService.UseStep(userID, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// issueStepUpToken 签发二次认证令牌，有效期为 STEP_UP_MAX_AGE
+func (s *AuthService) issueStepUpToken(userID int, sessionID, method string) (*StepUpResponse, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.StepUpMaxAge)
+	jti, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	claims := &middleware.StepUpClaims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Method:    method,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			Audience:  jwt.ClaimStrings{middleware.StepUpAudience},
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    "very-jump",
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString([]byte(s.cfg.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+	return &StepUpResponse{StepUpToken: tokenString, ExpiresAt: expiresAt, Method: method}, nil
+}
+
+// TOTPStatus 获取用户的动态验证码状态，未设置时返回 nil
+func (s *AuthService) TOTPStatus(userID int) (*models.UserTOTP, error) {
+	totp, err := s.totpService.Get(userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return totp, err
+}
+
+// SetupTOTP 为用户生成待确认的动态验证码密钥，覆盖之前未确认的密钥
+func (s *AuthService) SetupTOTP(userID int, username string) (*TOTPSetupResponse, error) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	saved, err := s.totpService.SetPending(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	return &TOTPSetupResponse{Secret: secret, URL: totpURL(username, secret)}, nil
+}
+
+// EnableTOTP 用身份验证器生成的验证码确认并启用密钥
+func (s *AuthService) EnableTOTP(userID int, code string) error {
+	totp, err := s.totpService.Get(userID)
+	if err == sql.ErrNoRows {
+		return ErrTOTPNotSetup
+	}
+	if err != nil {
+		return err
+	}
+	if totp.Enabled {
+		return ErrTOTPAlreadyEnabled
+	}
+	step, ok := verifyTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTOTPCode
+	}
+	return s.totpService.Enable(userID, step)
+}
+
+// DisableTOTP 停用并删除用户的动态验证码密钥
+func (s *AuthService) DisableTOTP(userID int) error {
+	return s.totpService.Delete(userID)
+}
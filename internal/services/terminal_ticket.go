@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// TerminalTicketTTL 终端票据有效期
+	TerminalTicketTTL = 30 * time.Second
+	// terminalGrantTTL 票据兑换后的访问凭证最长有效期
+	terminalGrantTTL = 12 * time.Hour
+)
+
+var (
+	// ErrInvalidTerminalTicket 票据不存在、已使用、已过期或与会话/IP 不匹配
+	ErrInvalidTerminalTicket = errors.New("invalid or expired terminal ticket")
+)
+
+// LoginSessionChecker 检查登录会话是否仍然有效
+type LoginSessionChecker interface {
+	SessionActive(userID int, sessionID string) bool
+}
+
+// TerminalAccess 票据或访问凭证绑定的身份
+type TerminalAccess struct {
+	UserID            int
+	Username          string
+	LoginSessionID    string // 签发时的登录会话，登出后随之失效
+	TerminalSessionID string
+	IPAddress         string
+	ExpiresAt         time.Time
+}
+
+// TerminalTicketService 终端一次性票据
+// 票据绑定终端会话、登录会话和客户端IP，30 秒内只能兑换一次；
+// 兑换后得到仅用于 /proxy-terminal 的访问凭证（以 Cookie 下发），供 ttyd 页面后续的 HTTP 和 WebSocket 请求使用
+type TerminalTicketService struct {
+	sessionChecker LoginSessionChecker
+	mutex          sync.Mutex
+	tickets        map[string]*TerminalAccess // key: 票据哈希
+	grants         map[string]*TerminalAccess // key: 凭证哈希
+}
+
+// NewTerminalTicketService 创建终端票据服务
+func NewTerminalTicketService(sessionChecker LoginSessionChecker) *TerminalTicketService {
+	return &TerminalTicketService{
+		sessionChecker: sessionChecker,
+		tickets:        make(map[string]*TerminalAccess),
+		grants:         make(map[string]*TerminalAccess),
+	}
+}
+
+// Issue 签发票据
+func (s *TerminalTicketService) Issue(userID int, username, loginSessionID, terminalSessionID, ipAddress string) (string, time.Time, error) {
+	ticket, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(TerminalTicketTTL)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pruneLocked()
+	s.tickets[hashToken(ticket)] = &TerminalAccess{
+		UserID:            userID,
+		Username:          username,
+		LoginSessionID:    loginSessionID,
+		TerminalSessionID: terminalSessionID,
+		IPAddress:         ipAddress,
+		ExpiresAt:         expiresAt,
+	}
+	return ticket, expiresAt, nil
+}
+
+// Redeem 兑换票据，无论成功与否票据都会被销毁；成功时返回访问凭证
+func (s *TerminalTicketService) Redeem(ticket, terminalSessionID, ipAddress string) (string, *TerminalAccess, error) {
+	s.mutex.Lock()
+	key := hashToken(ticket)
+	access, ok := s.tickets[key]
+	delete(s.tickets, key)
+	s.mutex.Unlock()
+
+	if !ok || !s.matches(access, terminalSessionID, ipAddress) {
+		return "", nil, ErrInvalidTerminalTicket
+	}
+
+	grant, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	granted := *access
+	granted.ExpiresAt = time.Now().Add(terminalGrantTTL)
+
+	s.mutex.Lock()
+	s.grants[hashToken(grant)] = &granted
+	s.mutex.Unlock()
+	return grant, &granted, nil
+}
+
+// Check 校验访问凭证
+func (s *TerminalTicketService) Check(grant, terminalSessionID, ipAddress string) (*TerminalAccess, error) {
+	s.mutex.Lock()
+	access, ok := s.grants[hashToken(grant)]
+	s.mutex.Unlock()
+
+	if !ok || !s.matches(access, terminalSessionID, ipAddress) {
+		return nil, ErrInvalidTerminalTicket
+	}
+	return access, nil
+}
+
+// RevokeTerminal 终端会话结束时清理相关票据和凭证
+func (s *TerminalTicketService) RevokeTerminal(terminalSessionID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, access := range s.tickets {
+		if access.TerminalSessionID == terminalSessionID {
+			delete(s.tickets, key)
+		}
+	}
+	for key, access := range s.grants {
+		if access.TerminalSessionID == terminalSessionID {
+			delete(s.grants, key)
+		}
+	}
+}
+
+// matches 校验终端会话、IP、有效期和登录会话
+func (s *TerminalTicketService) matches(access *TerminalAccess, terminalSessionID, ipAddress string) bool {
+	if access.TerminalSessionID != terminalSessionID || access.IPAddress != ipAddress {
+		return false
+	}
+	if time.Now().After(access.ExpiresAt) {
+		return false
+	}
+	return s.sessionChecker == nil || s.sessionChecker.SessionActive(access.UserID, access.LoginSessionID)
+}
+
+// pruneLocked 清理过期的票据和凭证，调用方需持有锁
+func (s *TerminalTicketService) pruneLocked() {
+	now := time.Now()
+	for key, access := range s.tickets {
+		if now.After(access.ExpiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	for key, access := range s.grants {
+		if now.After(access.ExpiresAt) {
+			delete(s.grants, key)
+		}
+	}
+}
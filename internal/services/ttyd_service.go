@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -90,9 +92,57 @@ type TTYDProcess struct {
 	Process       *os.Process
 	Cancel        context.CancelFunc
 	CreatedAt     time.Time
-	RecordingFile string           // 录制文件路径
-	DBSessionID   string           // 数据库中的会话ID
-	Recorder      *SessionRecorder // 录制器
+	RecordingFile string                      // 录制文件路径
+	DBSessionID   string                      // 数据库中的会话ID
+	Recorder      *SessionRecorder            // 录制器
+	ClientIP      string                      // 发起会话的客户端IP
+	Justification models.SessionJustification // 连接原因和工单号
+
+	WindowOverride atomic.Bool // 在访问时间窗口外强制连接，窗口检查不终止该会话
+
+	noticeMutex sync.Mutex
+	noticeSubs  map[chan string]struct{} // 已连接的终端页面，用于推送系统提示
+
+	commandMutex   sync.Mutex
+	commands       chan string   // 待审计的命令，由每个会话唯一的写入协程按输入顺序写入
+	commandsDone   chan struct{} // 写入协程写完全部命令后关闭
+	commandsClosed bool
+}
+
+// commandQueueSize 每个会话待审计命令的缓冲数，写入跟不上时丢弃新命令而不阻塞终端输入
+const commandQueueSize = 256
+
+// SubscribeNotices 订阅推送到终端的系统提示，返回的函数用于取消订阅
+func (p *TTYDProcess) SubscribeNotices() (<-chan string, func()) {
+	ch := make(chan string, 4)
+	p.noticeMutex.Lock()
+	if p.noticeSubs == nil {
+		p.noticeSubs = make(map[chan string]struct{})
+	}
+	p.noticeSubs[ch] = struct{}{}
+	p.noticeMutex.Unlock()
+
+	return ch, func() {
+		p.noticeMutex.Lock()
+		delete(p.noticeSubs, ch)
+		p.noticeMutex.Unlock()
+	}
+}
+
+// notify 向所有已连接的终端页面推送提示，页面处理不过来时丢弃
+func (p *TTYDProcess) notify(message string) int {
+	p.noticeMutex.Lock()
+	defer p.noticeMutex.Unlock()
+
+	delivered := 0
+	for ch := range p.noticeSubs {
+		select {
+		case ch <- message:
+			delivered++
+		default:
+		}
+	}
+	return delivered
 }
 
 // NewTTYDService 创建ttyd服务
@@ -114,7 +164,7 @@ func NewTTYDService(dataDir string, auditService *AuditService, sessionService *
 
 // StartTTYDSession 启动ttyd会话
 func (ts *TTYDService) StartTTYDSession(server *models.Server, userID int, username string) (*TTYDProcess, error) {
-	return ts.StartTTYDSessionWithAudit(server, userID, username, "", "")
+	return ts.StartTTYDSessionWithAudit(server, userID, username, "", "", models.SessionJustification{})
 }
 
 // FindActiveSession 查找用户在指定服务器上的活跃会话
@@ -130,11 +180,20 @@ func (ts *TTYDService) FindActiveSession(userID, serverID int) (*TTYDProcess, bo
 	return nil, false
 }
 
-// StartTTYDSessionWithAudit 启动ttyd会话并记录审计信息
-func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID int, username, ipAddress, userAgent string) (*TTYDProcess, error) {
+// StartTTYDSessionWithAudit 启动ttyd会话并记录审计信息。已有会话的连接原因、工单号和紧急访问与本次相同，
+// 且只读和录制要求兼容时复用该会话，并记录本次连接的审计日志；否则启动新会话
+func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID int, username, ipAddress, userAgent string,
+	justification models.SessionJustification) (*TTYDProcess, error) {
 	// 首先检查是否有活跃会话可以复用
-	if existingProcess, exists := ts.FindActiveSession(userID, server.ID); exists {
+	if existingProcess, exists := ts.FindActiveSession(userID, server.ID); exists && reusable(existingProcess.Justification, justification) {
 		log.Printf("复用现有ttyd会话: sessionID=%s, userID=%d, serverID=%d", existingProcess.SessionID, userID, server.ID)
+		if ts.auditService != nil {
+			go func() {
+				if err := ts.auditService.LogTerminalReuse(context.Background(), userID, server.ID, existingProcess.SessionID, ipAddress, userAgent, justification); err != nil {
+					log.Printf("Failed to log terminal reuse: %v", err)
+				}
+			}()
+		}
 		return existingProcess, nil
 	}
 
@@ -158,9 +217,12 @@ func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID i
 		"-T", "xterm-256color",
 		"-t", "enableZmodem=true",
 		"-t", "enableTrzsz=true",
-		"-W",
 		"-b", "/proxy-terminal", // 设置基础路径以匹配代理
 	}
+	// 连接策略要求只读时不开启写入
+	if !justification.ReadOnly() {
+		args = append(args, "-W")
+	}
 
 	if server.AuthType == "password" {
 		// 动态创建expect脚本文件
@@ -297,11 +359,18 @@ func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID i
 		CreatedAt:     time.Now(),
 		RecordingFile: recordingFilePath,
 		Recorder:      recorder,
+		ClientIP:      ipAddress,
+		Justification: justification,
 	}
 
-	// 启动录制
+	// 启动录制，紧急访问期间或连接策略要求录制的会话录制失败时不允许连接
 	if err := recorder.Start(); err != nil {
 		log.Printf("Failed to start recording: %v", err)
+		if justification.MustRecord() {
+			cancel()
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+			return nil, fmt.Errorf("该会话必须录制，启动录制失败: %v", err)
+		}
 	}
 
 	// 保存进程信息
@@ -313,7 +382,7 @@ func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID i
 	// 记录审计日志
 	if ts.auditService != nil {
 		go func() {
-			if err := ts.auditService.LogTerminalStart(context.Background(), userID, server.ID, sessionID, ipAddress, userAgent); err != nil {
+			if err := ts.auditService.LogTerminalStart(context.Background(), userID, server.ID, sessionID, ipAddress, userAgent, justification); err != nil {
 				log.Printf("Failed to log terminal start: %v", err)
 			}
 		}()
@@ -323,7 +392,7 @@ func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID i
 	if ts.sessionService != nil {
 		// 稍后延迟创建，让主进程先完成启动
 		time.Sleep(100 * time.Millisecond)
-		if session, err := ts.sessionService.Create(userID, server.ID, ipAddress, recordingFileName); err != nil {
+		if session, err := ts.sessionService.Create(userID, server.ID, ipAddress, recordingFileName, justification); err != nil {
 			log.Printf("Failed to create session record: %v", err)
 		} else {
 			// 保存数据库会话ID到进程信息中
@@ -336,11 +405,52 @@ func (ts *TTYDService) StartTTYDSessionWithAudit(server *models.Server, userID i
 	return process, nil
 }
 
+// reusable 已有会话能否用于本次连接：连接原因、工单号和紧急访问相同，只读要求一致，本次要求录制时已有会话也在录制
+func reusable(existing, requested models.SessionJustification) bool {
+	return existing.Reason == requested.Reason &&
+		existing.TicketID == requested.TicketID &&
+		existing.BreakGlassID == requested.BreakGlassID &&
+		existing.ReadOnly() == requested.ReadOnly() &&
+		(existing.MustRecord() || !requested.MustRecord())
+}
+
 // StopTTYDSession 停止ttyd会话
 func (ts *TTYDService) StopTTYDSession(sessionID string) error {
 	ts.mutex.Lock()
 	defer ts.mutex.Unlock()
 
+	return ts.stopSessionLocked(sessionID, "manual_stop")
+}
+
+// StopSessionWithReason 停止ttyd会话并记录指定的结束原因
+func (ts *TTYDService) StopSessionWithReason(sessionID, reason string) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	return ts.stopSessionLocked(sessionID, reason)
+}
+
+// StopUserSessions 停止用户的全部ttyd会话，返回停止的会话数
+func (ts *TTYDService) StopUserSessions(userID int, reason string) int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	stopped := 0
+	for sessionID, process := range ts.processes {
+		if process.UserID != userID {
+			continue
+		}
+		if err := ts.stopSessionLocked(sessionID, reason); err != nil {
+			log.Printf("Failed to stop session %s of user %d: %v", sessionID, userID, err)
+			continue
+		}
+		stopped++
+	}
+	return stopped
+}
+
+// stopSessionLocked 停止ttyd会话并记录结束原因，调用方需持有锁
+func (ts *TTYDService) stopSessionLocked(sessionID, reason string) error {
 	process, exists := ts.processes[sessionID]
 	if !exists {
 		return fmt.Errorf("会话不存在: %s", sessionID)
@@ -375,7 +485,7 @@ func (ts *TTYDService) StopTTYDSession(sessionID string) error {
 	// 记录审计日志
 	if ts.auditService != nil {
 		go func() {
-			if err := ts.auditService.LogTerminalEnd(context.Background(), sessionID, "manual_stop"); err != nil {
+			if err := ts.auditService.LogTerminalEnd(context.Background(), sessionID, reason); err != nil {
 				log.Printf("Failed to log terminal end audit: %v", err)
 			}
 		}()
@@ -404,6 +514,99 @@ func (ts *TTYDService) StopTTYDSession(sessionID string) error {
 	return nil
 }
 
+// NotifySession 在终端中显示一条系统提示并写入录像，返回收到提示的终端页面数
+func (ts *TTYDService) NotifySession(sessionID, message string) int {
+	process, exists := ts.GetTTYDProcess(sessionID)
+	if !exists {
+		return 0
+	}
+
+	// ttyd 输出消息以 '0' 开头，换行并用黄色显示，避免与命令输出混在一起
+	output := "0\r\n\x1b[1;33m[very-jump] " + message + "\x1b[0m\r\n"
+	if process.Recorder != nil && process.Recorder.IsRecording() {
+		if err := process.Recorder.WriteOutput([]byte(output)); err != nil {
+			log.Printf("Failed to record notice: %v", err)
+		}
+	}
+	return process.notify(output)
+}
+
+// RecordCommand 将会话中执行的命令加入审计队列，不等待写入；
+// 首次调用时启动该会话的写入协程，命令按加入顺序写入，队列已满时丢弃并记录日志
+func (ts *TTYDService) RecordCommand(process *TTYDProcess, command string) {
+	if ts.auditService == nil {
+		return
+	}
+
+	process.commandMutex.Lock()
+	defer process.commandMutex.Unlock()
+
+	if process.commandsClosed {
+		return
+	}
+	if process.commands == nil {
+		process.commands = make(chan string, commandQueueSize)
+		process.commandsDone = make(chan struct{})
+		go ts.commandWriter(process, process.commands, process.commandsDone)
+	}
+	select {
+	case process.commands <- command:
+	default:
+		log.Printf("Command audit queue full, dropping command of session %s", process.SessionID)
+	}
+}
+
+// commandWriter 按顺序写入会话的命令审计，队列关闭后写完剩余命令再退出
+func (ts *TTYDService) commandWriter(process *TTYDProcess, commands <-chan string, done chan<- struct{}) {
+	defer close(done)
+	for command := range commands {
+		ts.auditService.LogCommand(context.Background(), process.UserID, process.ServerID, process.SessionID, command, process.ClientIP)
+	}
+}
+
+// closeCommands 关闭会话的命令审计队列，之后加入的命令被忽略
+func (p *TTYDProcess) closeCommands() {
+	p.commandMutex.Lock()
+	defer p.commandMutex.Unlock()
+
+	if p.commandsClosed {
+		return
+	}
+	p.commandsClosed = true
+	if p.commands != nil {
+		close(p.commands)
+	}
+}
+
+// RecordShadowAttach 记录他人接入会话，审计日志记在接入者名下并注明会话所有者
+func (ts *TTYDService) RecordShadowAttach(process *TTYDProcess, viewerID int, viewerName, ipAddress string) {
+	if ts.auditService == nil {
+		return
+	}
+	details, _ := json.Marshal(map[string]interface{}{
+		"session_id":  process.SessionID,
+		"server_id":   process.ServerID,
+		"server_name": process.ServerName,
+		"owner_id":    process.UserID,
+		"owner_name":  process.Username,
+		"viewer_id":   viewerID,
+		"viewer_name": viewerName,
+		"read_only":   true,
+	})
+	entry := &models.AuditLog{
+		UserID:       viewerID,
+		Action:       "terminal_shadow",
+		ResourceType: "terminal_session",
+		ResourceID:   process.SessionID,
+		Details:      string(details),
+		IPAddress:    ipAddress,
+		Success:      true,
+	}
+	if err := ts.auditService.LogAction(context.Background(), entry); err != nil {
+		log.Printf("Failed to log shadow attach to session %s: %v", process.SessionID, err)
+	}
+}
+
 // GetTTYDProcess 获取ttyd进程信息
 func (ts *TTYDService) GetTTYDProcess(sessionID string) (*TTYDProcess, bool) {
 	ts.mutex.RLock()
@@ -519,6 +722,7 @@ func (ts *TTYDService) monitorProcess(process *TTYDProcess, cmd *exec.Cmd) {
 
 	// 等待进程结束
 	err := cmd.Wait()
+	process.closeCommands()
 
 	ts.mutex.Lock()
 	defer ts.mutex.Unlock()
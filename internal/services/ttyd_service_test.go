@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"very-jump/internal/config"
+	"very-jump/internal/database/models"
+)
+
+func TestRecordShadowAttachNamesBothUsers(t *testing.T) {
+	db := openTestDB(t)
+	audit := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(audit.Close)
+	ts := NewTTYDService(t.TempDir(), audit, nil, nil)
+
+	process := &TTYDProcess{SessionID: "alice_web1_2_1", UserID: 2, Username: "alice", ServerID: 1, ServerName: "web1"}
+	ts.RecordShadowAttach(process, 3, "bob", "10.0.0.9")
+
+	var userID int
+	var action, resourceID, details, ip string
+	err := db.QueryRow(`SELECT user_id, action, resource_id, details, ip_address FROM audit_logs WHERE action = 'terminal_shadow'`).
+		Scan(&userID, &action, &resourceID, &details, &ip)
+	if err != nil {
+		t.Fatalf("query shadow audit log: %v", err)
+	}
+	if userID != 3 || resourceID != process.SessionID || ip != "10.0.0.9" {
+		t.Errorf("audit log user %d, resource %q, ip %q", userID, resourceID, ip)
+	}
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(details), &parsed); err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	if parsed["owner_name"] != "alice" || parsed["viewer_name"] != "bob" || parsed["owner_id"] != float64(2) || parsed["viewer_id"] != float64(3) {
+		t.Errorf("details = %v, want owner alice and viewer bob", parsed)
+	}
+}
+
+func TestReusableRequiresSameJustification(t *testing.T) {
+	readOnly := &models.PolicyDecision{Obligations: []string{models.ObligationReadOnly}}
+	record := &models.PolicyDecision{Obligations: []string{models.ObligationRecord}}
+	base := models.SessionJustification{Reason: "deploy", TicketID: "OPS-1"}
+	tests := []struct {
+		name      string
+		existing  models.SessionJustification
+		requested models.SessionJustification
+		want      bool
+	}{
+		{"same justification", base, base, true},
+		{"policy decision may differ", base, models.SessionJustification{Reason: "deploy", TicketID: "OPS-1", Policy: &models.PolicyDecision{}}, true},
+		{"different ticket", base, models.SessionJustification{Reason: "deploy", TicketID: "OPS-2"}, false},
+		{"different reason", base, models.SessionJustification{Reason: "debug", TicketID: "OPS-1"}, false},
+		{"break-glass connect", base, models.SessionJustification{Reason: "deploy", TicketID: "OPS-1", BreakGlassID: 3}, false},
+		{"read-only mismatch", base, models.SessionJustification{Reason: "deploy", TicketID: "OPS-1", Policy: readOnly}, false},
+		{"recording required but not recorded", base, models.SessionJustification{Reason: "deploy", TicketID: "OPS-1", Policy: record}, false},
+		{"recorded session serves unrecorded connect", models.SessionJustification{Reason: "deploy", TicketID: "OPS-1", Policy: record}, base, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reusable(tt.existing, tt.requested); got != tt.want {
+				t.Errorf("reusable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogTerminalReuseRecordsNewJustification(t *testing.T) {
+	db := openTestDB(t)
+	audit := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(audit.Close)
+
+	justification := models.SessionJustification{
+		Reason:   "second login",
+		TicketID: "OPS-42",
+		Policy:   &models.PolicyDecision{Decision: models.PolicyEffectAllow, Obligations: []string{models.ObligationRecord}},
+	}
+	if err := audit.LogTerminalReuse(context.Background(), 2, 1, "alice_web1_2_1", "10.0.0.9", "curl", justification); err != nil {
+		t.Fatalf("log reuse: %v", err)
+	}
+
+	var details string
+	if err := db.QueryRow(`SELECT details FROM audit_logs WHERE action = 'terminal_reuse' AND resource_id = 'alice_web1_2_1'`).Scan(&details); err != nil {
+		t.Fatalf("query reuse audit log: %v", err)
+	}
+	var parsed struct {
+		Reason   string                 `json:"reason"`
+		TicketID string                 `json:"ticket_id"`
+		Policy   *models.PolicyDecision `json:"policy"`
+	}
+	if err := json.Unmarshal([]byte(details), &parsed); err != nil {
+		t.Fatalf("details: %v", err)
+	}
+	if parsed.Reason != "second login" || parsed.TicketID != "OPS-42" || parsed.Policy == nil || !parsed.Policy.Has(models.ObligationRecord) {
+		t.Errorf("details = %s", details)
+	}
+}
+
+func TestRecordCommandWritesInInputOrder(t *testing.T) {
+	db := openTestDB(t)
+	audit := NewAuditService(db, &config.Config{JWTSecret: "test-secret"})
+	t.Cleanup(audit.Close)
+	ts := NewTTYDService(t.TempDir(), audit, nil, nil)
+
+	process := &TTYDProcess{SessionID: "alice_web1_2_1", UserID: 2, Username: "alice", ServerID: 1, ServerName: "web1"}
+	const n = 20
+	for i := 0; i < n; i++ {
+		ts.RecordCommand(process, fmt.Sprintf("rm -rf /tmp/%02d", i))
+	}
+	process.closeCommands()
+	// 关闭后加入的命令被忽略
+	ts.RecordCommand(process, "rm -rf /late")
+
+	select {
+	case <-process.commandsDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command writer did not finish")
+	}
+
+	rows, err := db.Query(`SELECT description FROM security_alerts WHERE session_id = ? ORDER BY id`, process.SessionID)
+	if err != nil {
+		t.Fatalf("query alerts: %v", err)
+	}
+	defer rows.Close()
+	var descriptions []string
+	for rows.Next() {
+		var description string
+		if err := rows.Scan(&description); err != nil {
+			t.Fatalf("scan alert: %v", err)
+		}
+		descriptions = append(descriptions, description)
+	}
+	if len(descriptions) != n {
+		t.Fatalf("%d commands audited, want %d", len(descriptions), n)
+	}
+	for i, description := range descriptions {
+		if want := fmt.Sprintf("/tmp/%02d", i); !strings.HasSuffix(description, want) {
+			t.Errorf("alert %d = %q, want command %s", i, description, want)
+		}
+	}
+}
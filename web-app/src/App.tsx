@@ -2,7 +2,7 @@ import React, { useEffect } from 'react';
 import { BrowserRouter as Router, Routes, Route, Navigate } from 'react-router-dom';
 import { ConfigProvider, theme } from 'antd';
 import zhCN from 'antd/locale/zh_CN';
-import { useAuthStore } from './stores/authStore';
+import { useAuthStore, hasPermission } from './stores/authStore';
 import AppLayout from './components/Layout/AppLayout';
 import LoginForm from './components/Auth/LoginForm';
 import Dashboard from './pages/Dashboard';
@@ -27,12 +27,12 @@ const ProtectedRoute: React.FC<{ children: React.ReactNode }> = ({ children }) =
   return <>{children}</>;
 };
 
-// 管理员路由组件
-const AdminRoute: React.FC<{ children: React.ReactNode }> = ({ children }) => {
+// 管理路由组件，需要角色拥有 permission 权限
+const AdminRoute: React.FC<{ permission: string; children: React.ReactNode }> = ({ permission, children }) => {
   const { user } = useAuthStore();
   const tokenInStorage = typeof window !== 'undefined' ? localStorage.getItem('token') : null;
 
-  if (!tokenInStorage || user?.role !== 'admin') {
+  if (!tokenInStorage || !hasPermission(user, permission)) {
     return <Navigate to="/dashboard" replace />;
   }
 
@@ -100,7 +100,7 @@ const App: React.FC = () => {
             <Route
               path="users"
               element={
-                <AdminRoute>
+                <AdminRoute permission="users.read">
                   <Users />
                 </AdminRoute>
               }
@@ -108,7 +108,7 @@ const App: React.FC = () => {
             <Route
               path="credentials"
               element={
-                <AdminRoute>
+                <AdminRoute permission="credentials.read">
                   <Credentials />
                 </AdminRoute>
               }
@@ -1,17 +1,42 @@
-import React, { useState } from 'react';
-import { Form, Input, Button, Card, Typography, Alert, Space } from 'antd';
-import { UserOutlined, LockOutlined, RocketOutlined } from '@ant-design/icons';
+import React, { useEffect, useState } from 'react';
+import { Form, Input, Button, Card, Typography, Alert, Space, Divider } from 'antd';
+import { UserOutlined, LockOutlined, RocketOutlined, LoginOutlined } from '@ant-design/icons';
 import { useNavigate } from 'react-router-dom';
 import { useAuthStore } from '../../stores/authStore';
+import { authAPI } from '../../services/api';
+import type { SSOProviderOption } from '../../types';
 
 const { Title, Text } = Typography;
 
 const LoginForm: React.FC = () => {
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
-  const { login } = useAuthStore();
+  const [providers, setProviders] = useState<SSOProviderOption[]>([]);
+  const { login, loginWithSSOCode } = useAuthStore();
   const navigate = useNavigate();
 
+  // 单点登录回调通过 URL 片段传回一次性登录码或错误信息
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    const code = params.get('sso_code');
+    const ssoError = params.get('sso_error');
+    if (code || ssoError) {
+      window.history.replaceState(null, '', window.location.pathname);
+    }
+    if (ssoError) {
+      setError(ssoError);
+    }
+    if (code) {
+      setLoading(true);
+      loginWithSSOCode(code)
+        .then(() => navigate('/dashboard'))
+        .catch((err: any) => setError(err.message || '单点登录失败'))
+        .finally(() => setLoading(false));
+    }
+
+    authAPI.getSSOProviders().then(setProviders).catch(() => setProviders([]));
+  }, []);
+
   const handleSubmit = async (values: { username: string; password: string }) => {
     setLoading(true);
     setError(null);
@@ -117,6 +142,26 @@ const LoginForm: React.FC = () => {
           </Form.Item>
         </Form>
 
+        {providers.length > 0 && (
+          <>
+            <Divider plain>
+              <Text type="secondary" style={{ fontSize: '12px' }}>单点登录</Text>
+            </Divider>
+            <Space direction="vertical" style={{ width: '100%' }}>
+              {providers.map((provider) => (
+                <Button
+                  key={provider.name}
+                  icon={<LoginOutlined />}
+                  block
+                  onClick={() => { window.location.href = provider.login_url; }}
+                >
+                  {provider.display_name}
+                </Button>
+              ))}
+            </Space>
+          </>
+        )}
+
         <div style={{ textAlign: 'center', marginTop: 20 }}>
           <Text type="secondary" style={{ fontSize: '12px' }}>
             默认账号：admin / admin
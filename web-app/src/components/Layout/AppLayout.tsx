@@ -11,7 +11,7 @@ import {
   DashboardOutlined,
 } from '@ant-design/icons';
 import { useNavigate, useLocation, Outlet } from 'react-router-dom';
-import { useAuthStore } from '../../stores/authStore';
+import { useAuthStore, hasPermission } from '../../stores/authStore';
 import { useAppStore } from '../../stores/appStore';
 import { sessionAPI } from '../../services/api';
 
@@ -70,12 +70,14 @@ const AppLayout: React.FC = () => {
       icon: <SafetyOutlined />,
       label: '安全审计',
     },
-    ...(user?.role === 'admin' ? [
+    ...(hasPermission(user, 'users.read') ? [
       {
         key: '/users',
         icon: <UserOutlined />,
         label: '用户管理',
       },
+    ] : []),
+    ...(hasPermission(user, 'credentials.read') ? [
       {
         key: '/credentials',
         icon: <KeyOutlined />,
@@ -145,7 +147,7 @@ const AppLayout: React.FC = () => {
               <Avatar size="small" icon={<UserOutlined />} />
               <span>{user?.username}</span>
               <span style={{ fontSize: '12px', color: '#999' }}>
-                ({user?.role === 'admin' ? '管理员' : '用户'})
+                ({user?.role === 'admin' ? '管理员' : user?.role === 'user' ? '用户' : user?.role})
               </span>
             </Space>
           </Dropdown>
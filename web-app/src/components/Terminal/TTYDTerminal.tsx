@@ -1,8 +1,8 @@
 import React, { useEffect, useState, useRef } from 'react';
-import { Card, Button, Space, Typography, message, Spin } from 'antd';
+import { Card, Button, Space, Typography, message, Spin, Form, Input } from 'antd';
 import { CloseOutlined, ReloadOutlined } from '@ant-design/icons';
 import type { TerminalProps } from '../../types';
-import api from '../../services/api';
+import api, { authAPI } from '../../services/api';
 import { useAuthStore } from '../../stores/authStore';
 import { heartbeatManager } from '../../services/heartbeat';
 
@@ -14,14 +14,34 @@ interface TTYDSession {
   url: string;
 }
 
+// 服务器要求填写的连接原因和工单号
+interface Justification {
+  reason?: string;
+  ticket_id?: string;
+}
+
+interface JustificationRequirement {
+  reason: boolean;
+  ticket: boolean;
+}
+
+// 敏感服务器连接前重新验证身份，密码和动态验证码二选一
+interface StepUpForm {
+  password?: string;
+  totp_code?: string;
+}
+
 const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }) => {
   const [session, setSession] = useState<TTYDSession | null>(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const { isAuthenticated, token, checkAuth } = useAuthStore();
+  const [requirement, setRequirement] = useState<JustificationRequirement | null>(null);
+  const [stepUpRequired, setStepUpRequired] = useState(false);
+  const justificationRef = useRef<Justification>({});
   const iframeRef = useRef<HTMLIFrameElement>(null);
 
-  const startTerminalSession = async () => {
+  const startTerminalSession = async (justification?: Justification) => {
     try {
       setLoading(true);
       setError(null);
@@ -30,17 +50,19 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
         throw new Error('用户未认证，请重新登录');
       }
 
-      const response = await api.post(`/terminal/start/${serverId}`);
+      // 重新连接时沿用上一次填写的原因和工单号
+      if (justification) {
+        justificationRef.current = justification;
+      }
+      const response = await api.post(`/terminal/start/${serverId}`, justificationRef.current);
       const sessionData: TTYDSession = response.data;
 
       if (!sessionData.url) {
         throw new Error('服务器返回的URL为空');
       }
 
+      // url 中已包含一次性终端票据，不再附带登录令牌
       const absoluteUrl = new URL(sessionData.url, window.location.origin);
-      absoluteUrl.searchParams.append('token', token!);
-
-      console.log('Final URL with token:', absoluteUrl.href);
 
       setSession({
         ...sessionData,
@@ -50,9 +72,19 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
       // 启动心跳
       heartbeatManager.startHeartbeat(sessionData.session_id);
 
+      setRequirement(null);
+      setStepUpRequired(false);
       message.success('终端会话已启动');
     } catch (err: any) {
-      const errorMsg = err.response?.data?.error || err.message || '启动终端失败';
+      const data = err.response?.data;
+      if (data?.require_reason !== undefined || data?.ticket_pattern !== undefined) {
+        setRequirement((prev) => ({
+          reason: data.require_reason ?? prev?.reason ?? false,
+          ticket: data.require_ticket ?? prev?.ticket ?? false,
+        }));
+      }
+      setStepUpRequired(data?.code === 'step_up_required');
+      const errorMsg = data?.error || err.message || '启动终端失败';
       setError(errorMsg);
       message.error(errorMsg);
 
@@ -64,6 +96,18 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
     }
   };
 
+  const submitStepUp = async (values: StepUpForm) => {
+    try {
+      await authAPI.stepUp(values.totp_code ? { totp_code: values.totp_code } : { password: values.password });
+    } catch (err: any) {
+      const errorMsg = err.response?.data?.error || '验证失败';
+      setError(errorMsg);
+      message.error(errorMsg);
+      return;
+    }
+    await startTerminalSession();
+  };
+
   const stopTerminalSession = async (sessionId: string) => {
     try {
       // 停止心跳
@@ -147,7 +191,7 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
             <Button
               type="primary"
               icon={<ReloadOutlined />}
-              onClick={startTerminalSession}
+              onClick={() => startTerminalSession()}
             >
               重试
             </Button>
@@ -167,13 +211,55 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
           height: 'calc(100vh - 80px)',
         }}
       >
-        <div style={{ textAlign: 'center' }}>
-          <Text type="danger">{error}</Text>
-          <br />
-          <Button type="primary" onClick={startTerminalSession} style={{ marginTop: 16 }}>
-            重新启动
-          </Button>
-        </div>
+        {stepUpRequired ? (
+          <Form layout="vertical" style={{ width: 400 }} onFinish={submitStepUp}>
+            <Text type="danger">{error}</Text>
+            <Form.Item name="password" label="登录密码" style={{ marginTop: 16 }}>
+              <Input.Password autoComplete="current-password" />
+            </Form.Item>
+            <Form.Item name="totp_code" label="或动态验证码">
+              <Input placeholder="6 位验证码" maxLength={6} autoComplete="one-time-code" />
+            </Form.Item>
+            <Button type="primary" htmlType="submit">
+              验证并连接
+            </Button>
+          </Form>
+        ) : requirement ? (
+          <Form
+            layout="vertical"
+            style={{ width: 400 }}
+            initialValues={justificationRef.current}
+            onFinish={(values: Justification) => startTerminalSession(values)}
+          >
+            <Text type="danger">{error}</Text>
+            <Form.Item
+              name="reason"
+              label="连接原因"
+              style={{ marginTop: 16 }}
+              rules={[{ required: requirement.reason, message: '请填写连接原因' }]}
+            >
+              <Input.TextArea rows={3} maxLength={500} />
+            </Form.Item>
+            <Form.Item
+              name="ticket_id"
+              label="工单号"
+              rules={[{ required: requirement.ticket, message: '请填写工单号' }]}
+            >
+              <Input placeholder="CHG-1024" maxLength={100} />
+            </Form.Item>
+            <Button type="primary" htmlType="submit">
+              连接
+            </Button>
+          </Form>
+        ) : (
+          <div style={{ textAlign: 'center' }}>
+            <Text type="danger">{error}</Text>
+            <br />
+            <Button type="primary" onClick={() => startTerminalSession()} style={{ marginTop: 16 }}>
+              重新启动
+            </Button>
+          </div>
+        )}
       </Card>
     );
   }
@@ -197,7 +283,7 @@ const TTYDTerminal: React.FC<TerminalProps> = ({ serverId, serverName, onClose }
           <Button
             type="text"
             icon={<ReloadOutlined />}
-            onClick={startTerminalSession}
+            onClick={() => startTerminalSession()}
             title="重新连接"
           />
           <Button
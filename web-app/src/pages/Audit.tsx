@@ -7,7 +7,7 @@ import {
   DesktopOutlined,
   ReloadOutlined
 } from '@ant-design/icons';
-import { useAuthStore } from '../stores/authStore';
+import { useAuthStore, hasPermission } from '../stores/authStore';
 import api from '../services/api';
 import type { ColumnsType } from 'antd/es/table';
 
@@ -81,8 +81,8 @@ const Audit: React.FC = () => {
     resolved: undefined as boolean | undefined,
   });
 
-  // 检查管理员权限
-  const isAdmin = user?.role === 'admin';
+  // 检查审计权限
+  const isAdmin = hasPermission(user, 'audit.read');
 
   useEffect(() => {
     if (activeTab === 'statistics') {
@@ -291,7 +291,7 @@ const Audit: React.FC = () => {
           <Tag color={resolved ? 'green' : 'red'}>
             {resolved ? '已解决' : '待处理'}
           </Tag>
-          {!resolved && isAdmin && (
+          {!resolved && hasPermission(user, 'alerts.resolve') && (
             <Button
               size="small"
               type="link"
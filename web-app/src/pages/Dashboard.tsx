@@ -15,7 +15,7 @@ import {
   LinkOutlined,
 } from '@ant-design/icons';
 import { systemAPI, serverAPI } from '../services/api';
-import { useAuthStore } from '../stores/authStore';
+import { useAuthStore, hasPermission } from '../stores/authStore';
 import ServerCard from '../components/ServerCard';
 import type { Server } from '../types';
 
@@ -184,15 +184,15 @@ const Dashboard: React.FC = () => {
               <Typography.Link href="/sessions">
                 📊 查看会话历史
               </Typography.Link>
-              {user?.role === 'admin' && (
-                <>
-                  <Typography.Link href="/users">
-                    👥 用户管理
-                  </Typography.Link>
-                  <Typography.Link href="/audit">
-                    🔍 审计日志
-                  </Typography.Link>
-                </>
+              {hasPermission(user, 'users.read') && (
+                <Typography.Link href="/users">
+                  👥 用户管理
+                </Typography.Link>
+              )}
+              {hasPermission(user, 'audit.read') && (
+                <Typography.Link href="/audit">
+                  🔍 审计日志
+                </Typography.Link>
               )}
             </Space>
           </Card>
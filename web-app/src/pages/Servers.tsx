@@ -24,7 +24,7 @@ import {
   ReloadOutlined,
 } from '@ant-design/icons';
 import { serverAPI, credentialAPI } from '../services/api';
-import { useAuthStore } from '../stores/authStore';
+import { useAuthStore, hasPermission } from '../stores/authStore';
 import { useAppStore } from '../stores/appStore';
 
 import type { Server, ServerCreateRequest, Credential } from '../types';
@@ -268,7 +268,7 @@ const Servers: React.FC = () => {
           <Button type="primary" onClick={() => handleConnectServer(record)} icon={<LinkOutlined />}>
             连接
           </Button>
-          {user?.role === 'admin' && (
+          {hasPermission(user, 'servers.write') && (
             <>
               <Tooltip title="编辑">
                 <Button icon={<EditOutlined />} onClick={() => handleEditServer(record)} />
@@ -303,7 +303,7 @@ const Servers: React.FC = () => {
           >
             刷新状态
           </Button>
-          {user?.role === 'admin' && (
+          {hasPermission(user, 'servers.write') && (
             <Button
               type="primary"
               icon={<PlusOutlined />}
@@ -99,6 +99,18 @@ const Sessions: React.FC = () => {
         return <Tag color={config.color}>{config.text}</Tag>;
       },
     },
+    {
+      title: '连接原因',
+      key: 'reason',
+      render: (_, session: Session) => (
+        <Space>
+          {session.ticket_id && <Tag color="blue">{session.ticket_id}</Tag>}
+          <Typography.Text ellipsis style={{ maxWidth: 240 }} title={session.reason}>
+            {session.reason || '-'}
+          </Typography.Text>
+        </Space>
+      ),
+    },
     {
       title: '客户端IP',
       dataIndex: 'client_ip',
@@ -20,8 +20,8 @@ import {
   UserOutlined,
 } from '@ant-design/icons';
 import type { ColumnsType } from 'antd/es/table';
-import { userAPI } from '../services/api';
-import type { User, UserCreateRequest } from '../types';
+import { userAPI, roleAPI } from '../services/api';
+import type { User, UserCreateRequest, Role } from '../types';
 
 const { Title } = Typography;
 const { Option } = Select;
@@ -29,6 +29,7 @@ const { Option } = Select;
 const Users: React.FC = () => {
   const [loading, setLoading] = useState(false);
   const [users, setUsers] = useState<User[]>([]);
+  const [roles, setRoles] = useState<Role[]>([]);
   const [modalVisible, setModalVisible] = useState(false);
   const [editingUser, setEditingUser] = useState<User | null>(null);
   const [form] = Form.useForm();
@@ -45,8 +46,19 @@ const Users: React.FC = () => {
     }
   };
 
+  const fetchRoles = async () => {
+    try {
+      const data = await roleAPI.getRoles();
+      setRoles(data.roles);
+    } catch (error: any) {
+      // 没有 roles.read 权限时只能选择内置角色
+      setRoles([]);
+    }
+  };
+
   useEffect(() => {
     fetchUsers();
+    fetchRoles();
   }, []);
 
   const handleAddUser = () => {
@@ -122,7 +134,7 @@ const Users: React.FC = () => {
       key: 'role',
       render: (role: string) => (
         <Tag color={role === 'admin' ? 'red' : 'blue'}>
-          {role === 'admin' ? '管理员' : '用户'}
+          {role === 'admin' ? '管理员' : role === 'user' ? '用户' : role}
         </Tag>
       ),
     },
@@ -263,6 +275,9 @@ const Users: React.FC = () => {
             <Select placeholder="请选择角色">
               <Option value="user">用户</Option>
               <Option value="admin">管理员</Option>
+              {roles.filter((role) => !role.builtin).map((role) => (
+                <Option key={role.name} value={role.name}>{role.name}</Option>
+              ))}
             </Select>
           </Form.Item>
         </Form>
@@ -2,6 +2,7 @@ import axios, { type AxiosResponse } from 'axios';
 import type {
   LoginRequest,
   LoginResponse,
+  SSOProviderOption,
   User,
   ServerListResponse,
   SessionListResponse,
@@ -11,7 +12,8 @@ import type {
   Session,
   AuditLog,
   Credential,
-  CredentialCreateRequest
+  CredentialCreateRequest,
+  Role
 } from '../types';
 
 // 创建 axios 实例
@@ -26,6 +28,12 @@ api.interceptors.request.use((config) => {
   if (token) {
     config.headers.Authorization = `Bearer ${token}`;
   }
+  // 近期重新验证过身份时附带二次认证令牌，过期后由后端返回 step_up_required
+  const stepUpToken = sessionStorage.getItem('step_up_token');
+  const stepUpExpiresAt = sessionStorage.getItem('step_up_expires_at');
+  if (stepUpToken && stepUpExpiresAt && new Date(stepUpExpiresAt).getTime() > Date.now()) {
+    config.headers['X-Step-Up-Token'] = stepUpToken;
+  }
   return config;
 });
 
@@ -60,6 +68,23 @@ export const authAPI = {
     const response: AxiosResponse<User> = await api.get('/auth/profile');
     return response.data;
   },
+
+  getSSOProviders: async (): Promise<SSOProviderOption[]> => {
+    const response: AxiosResponse<{ providers: SSOProviderOption[] }> = await api.get('/auth/sso/providers');
+    return response.data.providers;
+  },
+
+  exchangeSSOCode: async (code: string): Promise<LoginResponse> => {
+    const response: AxiosResponse<LoginResponse> = await api.post('/auth/sso/exchange', { code });
+    return response.data;
+  },
+
+  // 重新验证身份（密码或动态验证码），二次认证令牌保存在 sessionStorage 中
+  stepUp: async (data: { password?: string; totp_code?: string }): Promise<void> => {
+    const response = await api.post('/me/step-up', data);
+    sessionStorage.setItem('step_up_token', response.data.step_up_token);
+    sessionStorage.setItem('step_up_expires_at', response.data.expires_at);
+  },
 };
 
 // 服务器管理 API
@@ -195,6 +220,14 @@ export const userAPI = {
   },
 };
 
+// 角色 API (管理员)
+export const roleAPI = {
+  getRoles: async (): Promise<{ roles: Role[]; total: number }> => {
+    const response = await api.get('/admin/roles');
+    return response.data;
+  },
+};
+
 // 审计日志 API
 export const auditAPI = {
   getLogs: async (params?: {
@@ -28,6 +28,23 @@ export const useAuthStore = create<AuthState>()(
         }
       },
 
+      loginWithSSOCode: async (code: string) => {
+        try {
+          const response = await authAPI.exchangeSSOCode(code);
+
+          localStorage.setItem('token', response.token);
+          localStorage.setItem('user', JSON.stringify(response.user));
+
+          set({
+            isAuthenticated: true,
+            user: response.user,
+            token: response.token,
+          });
+        } catch (error: any) {
+          throw new Error(error.response?.data?.error || '单点登录失败');
+        }
+      },
+
       logout: () => {
         // 清除 localStorage
         localStorage.removeItem('token');
@@ -75,3 +92,10 @@ export const useAuthStore = create<AuthState>()(
     }
   )
 );
+
+// hasPermission 当前用户的角色是否拥有权限，* 表示全部权限，资源.write 同时包含资源.read
+export const hasPermission = (user: User | null, permission: string): boolean => {
+  const permissions = user?.permissions || (user?.role === 'admin' ? ['*'] : []);
+  const write = permission.replace(/\.read$/, '.write');
+  return permissions.some((p) => p === '*' || p === permission || (permission.endsWith('.read') && p === write));
+};
@@ -3,11 +3,21 @@
 export interface User {
   id: number;
   username: string;
-  role: 'admin' | 'user';
+  role: string;
+  permissions?: string[];
   created_at: string;
   updated_at: string;
 }
 
+export interface Role {
+  id: number;
+  name: string;
+  description: string;
+  permissions: string[];
+  builtin: boolean;
+  user_count: number;
+}
+
 export interface Server {
   id: number;
   name: string;
@@ -34,6 +44,8 @@ export interface Session {
   status: 'active' | 'closed' | 'error';
   client_ip: string;
   recording_file: string;
+  reason?: string;
+  ticket_id?: string;
   username?: string;
   server_name?: string;
 }
@@ -64,6 +76,13 @@ export interface LoginResponse {
   expires_at: string;
 }
 
+export interface SSOProviderOption {
+  name: string;
+  type: 'oidc' | 'saml';
+  display_name: string;
+  login_url: string;
+}
+
 export interface ApiResponse<T> {
   data?: T;
   error?: string;
@@ -114,7 +133,7 @@ export interface ServerCreateRequest {
 export interface UserCreateRequest {
   username: string;
   password: string;
-  role: 'admin' | 'user';
+  role: string;
 }
 
 // 应用状态类型
@@ -124,6 +143,7 @@ export interface AuthState {
   user: User | null;
   token: string | null;
   login: (username: string, password: string) => Promise<void>;
+  loginWithSSOCode: (code: string) => Promise<void>;
   logout: () => void;
   checkAuth: () => void;
 }